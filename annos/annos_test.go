@@ -173,7 +173,36 @@ func (a *AnnosTestSuite) TestToMapMaps() {
 		"canary.kage.cloud/map_string_float_32":          "str=1.1",
 		"canary.kage.cloud/map_string_float_64":          "str=1.1",
 		"canary.kage.cloud/map_string_bool":              "str=true",
-		"canary.kage.cloud/map_string_map_string_string": "str=str=str",
+		"canary.kage.cloud/map_string_map_string_string": `{"str":{"str":"str"}}`,
+	}
+
+	// -- When
+	//
+	actual := ToMap("canary.kage.cloud", given)
+
+	// -- Then
+	//
+	a.Equal(expected, actual)
+}
+
+func (a *AnnosTestSuite) TestToMapMultipleEntries() {
+	// -- Given
+	//
+	given := Maps{
+		MapStringString: map[string]string{
+			"b": "2",
+			"a": "1",
+			"c": "3",
+		},
+	}
+
+	expected := map[string]string{
+		"canary.kage.cloud/map_string_string":            "a=1,b=2,c=3",
+		"canary.kage.cloud/map_string_int":               "",
+		"canary.kage.cloud/map_string_float_32":          "",
+		"canary.kage.cloud/map_string_float_64":          "",
+		"canary.kage.cloud/map_string_bool":              "",
+		"canary.kage.cloud/map_string_map_string_string": "",
 	}
 
 	// -- When
@@ -185,6 +214,49 @@ func (a *AnnosTestSuite) TestToMapMaps() {
 	a.Equal(expected, actual)
 }
 
+func (a *AnnosTestSuite) TestMapOfMapsRoundTrip() {
+	// -- Given
+	//
+	given := &Maps{
+		MapStringMapStringString: map[string]map[string]string{
+			"nginx":   {"app": "nginx", "tier": "web"},
+			"nginx-2": {"app": "nginx"},
+		},
+	}
+
+	// -- When
+	//
+	actual := new(Maps)
+	err := FromMap("canary.kage.cloud", ToMap("canary.kage.cloud", given), actual)
+
+	// -- Then
+	//
+	if a.NoError(err) {
+		a.Equal(given.MapStringMapStringString, actual.MapStringMapStringString)
+	}
+}
+
+func (a *AnnosTestSuite) TestFromMapLegacyMapOfMaps() {
+	// -- Given
+	//
+	given := map[string]string{
+		"canary.kage.cloud/map_string_string":            "a=1,b=2",
+		"canary.kage.cloud/map_string_map_string_string": "nginx=app=nginx",
+	}
+
+	// -- When
+	//
+	actual := new(Maps)
+	err := FromMap("canary.kage.cloud", given, actual)
+
+	// -- Then
+	//
+	if a.NoError(err) {
+		a.Equal(map[string]string{"a": "1", "b": "2"}, actual.MapStringString)
+		a.Equal(map[string]map[string]string{"nginx": {"app": "nginx"}}, actual.MapStringMapStringString)
+	}
+}
+
 func (a *AnnosTestSuite) TestToMapSlices() {
 	// -- Given
 	//
@@ -6,6 +6,7 @@ import (
 	"github.com/fatih/structtag"
 	"path"
 	"reflect"
+	"sort"
 	"strconv"
 	"strings"
 	"unicode"
@@ -97,6 +98,14 @@ func setValFromString(s string, val reflect.Value) error {
 		}
 		val.Set(valSlice)
 	case reflect.Map:
+		if strings.HasPrefix(strings.TrimSpace(s), "{") {
+			n := reflect.New(val.Type())
+			if err := json.Unmarshal([]byte(s), n.Interface()); err != nil {
+				return err
+			}
+			val.Set(n.Elem())
+			return nil
+		}
 		spli := strings.Split(s, ",")
 		refMap := reflect.MakeMap(val.Type())
 		for _, ele := range spli {
@@ -258,17 +267,34 @@ func valAsString(val reflect.Value) string {
 		}
 		return strings.Join(s, ",")
 	case reflect.Map:
+		// Values which are themselves lists would be ambiguous when joined with commas.
+		if val.Len() > 0 && isComposite(val.Type().Elem()) {
+			s, _ := json.Marshal(val.Interface())
+			return string(s)
+		}
 		iter := val.MapRange()
 		s := make([]string, 0, val.Len())
 		for iter.Next() {
 			k := iter.Key()
 			v := iter.Value()
 			s = append(s, fmt.Sprintf("%s=%s", valAsString(k), valAsString(v)))
-			return strings.Join(s, ",")
 		}
+		sort.Strings(s)
+		return strings.Join(s, ",")
 	case reflect.Struct:
 		s, _ := json.Marshal(val.Interface())
 		return string(s)
 	}
 	return fmt.Sprintf("%v", val.Interface())
 }
+
+func isComposite(t reflect.Type) bool {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Map, reflect.Slice, reflect.Array, reflect.Struct:
+		return true
+	}
+	return false
+}
@@ -4,7 +4,9 @@ go 1.14
 
 require (
 	github.com/davecgh/go-spew v1.1.1
+	github.com/stretchr/testify v1.6.1
 	k8s.io/api v0.15.10
 	k8s.io/apimachinery v0.15.10
 	k8s.io/client-go v0.15.10
+	k8s.io/utils v0.0.0-20190221042446-c2654d5206da
 )
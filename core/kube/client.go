@@ -12,6 +12,7 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/clientcmd/api"
 	"time"
@@ -20,6 +21,9 @@ import (
 type Client interface {
 	WatchDeploy(lo metav1.ListOptions, opt kconfig.Opt) (watch.Interface, error)
 	WaitTillDeployReady(name string, timeout time.Duration, opt kconfig.Opt) error
+
+	// Blocks until all of the pods managed by the object are up to date and ready or the timeout is reached.
+	WaitTillReady(name string, kind ktypes.Kind, timeout time.Duration, opt kconfig.Opt) error
 	DeleteConfigMap(name string, opt kconfig.Opt) error
 	UpsertConfigMap(cm *corev1.ConfigMap, opt kconfig.Opt) (*corev1.ConfigMap, error)
 	UpsertDeploy(dep *appsv1.Deployment, opt kconfig.Opt) (*appsv1.Deployment, error)
@@ -36,8 +40,10 @@ type Client interface {
 	Create(obj runtime.Object, opt kconfig.Opt) (runtime.Object, error)
 	Delete(name string, kind ktypes.Kind, opt kconfig.Opt) error
 	Update(obj runtime.Object, opt kconfig.Opt) (runtime.Object, error)
+	Watch(kind ktypes.Kind, lo metav1.ListOptions, opt kconfig.Opt) (watch.Interface, error)
 
 	Api() kubernetes.Interface
+	Dynamic() dynamic.Interface
 	ApiConfig() kconfig.Config
 }
 
@@ -52,9 +58,15 @@ func FromApiConfig(conf *api.Config) (Client, error) {
 		return nil, err
 	}
 
+	dynamicInter, err := configClient.Dynamic("")
+	if err != nil {
+		return nil, err
+	}
+
 	return &client{
-		Interface: inter,
-		Config:    configClient,
+		Interface:        inter,
+		DynamicInterface: dynamicInter,
+		Config:           configClient,
 	}, nil
 }
 
@@ -69,9 +81,15 @@ func NewClient(spec ClientSpec) (Client, error) {
 		return nil, err
 	}
 
+	dynamicClient, err := conf.Dynamic(spec.Context)
+	if err != nil {
+		return nil, err
+	}
+
 	return &client{
-		Interface: apiClient,
-		Config:    conf,
+		Interface:        apiClient,
+		DynamicInterface: dynamicClient,
+		Config:           conf,
 	}, nil
 }
 
@@ -81,28 +99,29 @@ type ClientSpec struct {
 }
 
 type client struct {
-	Interface kubernetes.Interface
-	Config    kconfig.Config
+	Interface        kubernetes.Interface
+	DynamicInterface dynamic.Interface
+	Config           kconfig.Config
 }
 
 func (c *client) Create(obj runtime.Object, opt kconfig.Opt) (runtime.Object, error) {
 	switch typ := obj.(type) {
 	case *corev1.Pod:
-		return c.Api().CoreV1().Pods(opt.Namespace).Update(typ)
+		return c.Api().CoreV1().Pods(opt.Namespace).Create(typ)
 	case *appsv1.Deployment:
-		return c.Api().AppsV1().Deployments(opt.Namespace).Update(typ)
+		return c.Api().AppsV1().Deployments(opt.Namespace).Create(typ)
 	case *corev1.Service:
-		return c.Api().CoreV1().Services(opt.Namespace).Update(typ)
+		return c.Api().CoreV1().Services(opt.Namespace).Create(typ)
 	case *appsv1.ReplicaSet:
-		return c.Api().AppsV1().ReplicaSets(opt.Namespace).Update(typ)
+		return c.Api().AppsV1().ReplicaSets(opt.Namespace).Create(typ)
 	case *corev1.ConfigMap:
-		return c.Api().CoreV1().ConfigMaps(opt.Namespace).Update(typ)
+		return c.Api().CoreV1().ConfigMaps(opt.Namespace).Create(typ)
 	case *corev1.Endpoints:
-		return c.Api().CoreV1().Endpoints(opt.Namespace).Update(typ)
+		return c.Api().CoreV1().Endpoints(opt.Namespace).Create(typ)
 	case *appsv1.DaemonSet:
-		return c.Api().AppsV1().DaemonSets(opt.Namespace).Update(typ)
+		return c.Api().AppsV1().DaemonSets(opt.Namespace).Create(typ)
 	case *appsv1.StatefulSet:
-		return c.Api().AppsV1().StatefulSets(opt.Namespace).Update(typ)
+		return c.Api().AppsV1().StatefulSets(opt.Namespace).Create(typ)
 	}
 
 	return nil, except.NewError("%T is not a supported Kubernetes kind", except.ErrUnsupported, obj)
@@ -134,21 +153,21 @@ func (c *client) Delete(name string, kind ktypes.Kind, opt kconfig.Opt) error {
 func (c *client) Update(obj runtime.Object, opt kconfig.Opt) (runtime.Object, error) {
 	switch typ := obj.(type) {
 	case *corev1.Pod:
-		return c.Api().CoreV1().Pods(opt.Namespace).Create(typ)
+		return c.Api().CoreV1().Pods(opt.Namespace).Update(typ)
 	case *appsv1.Deployment:
-		return c.Api().AppsV1().Deployments(opt.Namespace).Create(typ)
+		return c.Api().AppsV1().Deployments(opt.Namespace).Update(typ)
 	case *corev1.Service:
-		return c.Api().CoreV1().Services(opt.Namespace).Create(typ)
+		return c.Api().CoreV1().Services(opt.Namespace).Update(typ)
 	case *appsv1.ReplicaSet:
-		return c.Api().AppsV1().ReplicaSets(opt.Namespace).Create(typ)
+		return c.Api().AppsV1().ReplicaSets(opt.Namespace).Update(typ)
 	case *corev1.ConfigMap:
-		return c.Api().CoreV1().ConfigMaps(opt.Namespace).Create(typ)
+		return c.Api().CoreV1().ConfigMaps(opt.Namespace).Update(typ)
 	case *corev1.Endpoints:
-		return c.Api().CoreV1().Endpoints(opt.Namespace).Create(typ)
+		return c.Api().CoreV1().Endpoints(opt.Namespace).Update(typ)
 	case *appsv1.DaemonSet:
-		return c.Api().AppsV1().DaemonSets(opt.Namespace).Create(typ)
+		return c.Api().AppsV1().DaemonSets(opt.Namespace).Update(typ)
 	case *appsv1.StatefulSet:
-		return c.Api().AppsV1().StatefulSets(opt.Namespace).Create(typ)
+		return c.Api().AppsV1().StatefulSets(opt.Namespace).Update(typ)
 	}
 
 	return nil, except.NewError("%T is not a supported Kubernetes kind", except.ErrUnsupported, obj)
@@ -221,6 +240,10 @@ func (c *client) Api() kubernetes.Interface {
 	return c.Interface
 }
 
+func (c *client) Dynamic() dynamic.Interface {
+	return c.DynamicInterface
+}
+
 func (c *client) UpdateEndpoints(ep *corev1.Endpoints, opt kconfig.Opt) (*corev1.Endpoints, error) {
 	return c.Api().CoreV1().Endpoints(opt.Namespace).Update(ep)
 }
@@ -247,26 +270,35 @@ func (c *client) WatchDeploy(lo metav1.ListOptions, opt kconfig.Opt) (watch.Inte
 }
 
 func (c *client) WaitTillDeployReady(name string, timeout time.Duration, opt kconfig.Opt) error {
-	dep, err := c.Api().AppsV1().Deployments(opt.Namespace).Get(name, metav1.GetOptions{})
+	return c.WaitTillReady(name, ktypes.KindDeployment, timeout, opt)
+}
+
+func (c *client) WaitTillReady(name string, kind ktypes.Kind, timeout time.Duration, opt kconfig.Opt) error {
+	obj, err := c.Get(name, kind, opt)
 	if err != nil {
 		return err
 	}
 
-	if kubeutil.DeploymentIsReady(dep) {
+	if kubeutil.IsReady(obj) {
 		return nil
 	}
 
-	wi, err := c.WatchDeploy(metav1.ListOptions{FieldSelector: fmt.Sprintf("metadata.name=%s", name)}, opt)
+	wi, err := c.Watch(kind, metav1.ListOptions{FieldSelector: fmt.Sprintf("metadata.name=%s", name)}, opt)
 	if err != nil {
 		return err
 	}
+	defer wi.Stop()
 
 	timer := time.NewTimer(timeout)
+	defer timer.Stop()
 	for {
 		select {
 		case <-timer.C:
-			return except.NewError("Deploy failed to be ready after %s", except.ErrTimeout, timeout)
-		case r := <-wi.ResultChan():
+			return except.NewError("%s %s failed to be ready after %s", except.ErrTimeout, kind, name, timeout)
+		case r, ok := <-wi.ResultChan():
+			if !ok {
+				return except.NewError("Watch on %s %s closed before it was ready", except.ErrInternalError, kind, name)
+			}
 			switch r.Type {
 			case watch.Error:
 				reason := "unknown"
@@ -277,20 +309,41 @@ func (c *client) WaitTillDeployReady(name string, timeout time.Duration, opt kco
 						}
 					}
 				}
-				return except.NewError("Deploy %s failed: %s", except.ErrInternalError, reason)
+				return except.NewError("%s %s failed: %s", except.ErrInternalError, kind, name, reason)
+			case watch.Deleted:
+				return except.NewError("%s %s was deleted before it was ready", except.ErrNotFound, kind, name)
 			case watch.Modified:
-				if r.Object != nil {
-					if dep, ok := r.Object.(*appsv1.Deployment); ok {
-						if kubeutil.DeploymentIsReady(dep) {
-							return nil
-						}
-					}
+				if r.Object != nil && kubeutil.IsReady(r.Object) {
+					return nil
 				}
 			}
 		}
 	}
 }
 
+func (c *client) Watch(kind ktypes.Kind, lo metav1.ListOptions, opt kconfig.Opt) (watch.Interface, error) {
+	switch kind {
+	case ktypes.KindPod:
+		return c.Api().CoreV1().Pods(opt.Namespace).Watch(lo)
+	case ktypes.KindDeployment:
+		return c.Api().AppsV1().Deployments(opt.Namespace).Watch(lo)
+	case ktypes.KindService:
+		return c.Api().CoreV1().Services(opt.Namespace).Watch(lo)
+	case ktypes.KindReplicaSet:
+		return c.Api().AppsV1().ReplicaSets(opt.Namespace).Watch(lo)
+	case ktypes.KindConfigMap:
+		return c.Api().CoreV1().ConfigMaps(opt.Namespace).Watch(lo)
+	case ktypes.KindEndpoints:
+		return c.Api().CoreV1().Endpoints(opt.Namespace).Watch(lo)
+	case ktypes.KindDaemonSet:
+		return c.Api().AppsV1().DaemonSets(opt.Namespace).Watch(lo)
+	case ktypes.KindStatefulSet:
+		return c.Api().AppsV1().StatefulSets(opt.Namespace).Watch(lo)
+	}
+
+	return nil, except.NewError("%s is not a supported Kubernetes kind", except.ErrUnsupported, kind)
+}
+
 func (c *client) DeleteDeploy(name string, opt kconfig.Opt) error {
 	return c.Api().AppsV1().Deployments(opt.Namespace).Delete(name, &metav1.DeleteOptions{})
 }
@@ -10,9 +10,11 @@ import (
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/dynamic/dynamicinformer"
 	"k8s.io/client-go/informers"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/util/workqueue"
@@ -28,6 +30,10 @@ type InformerClient interface {
 	List(nsKind ktypes.NamespaceKind, selector labels.Selector) (metav1.ListInterface, error)
 
 	Get(nsKind ktypes.NamespaceKind, name string) (runtime.Object, error)
+
+	// Informs on a resource without a typed client such as a custom resource. The handlers receive
+	// *unstructured.Unstructured objects and an *unstructured.UnstructuredList.
+	InformResource(ctx context.Context, spec kinformer.ResourceInformerSpec) error
 }
 
 func NewInformerClient(apiClient Client) InformerClient {
@@ -35,6 +41,7 @@ func NewInformerClient(apiClient Client) InformerClient {
 		Client:                   apiClient,
 		factoriesLock:            sync.RWMutex{},
 		factoriesByNamespaceKind: map[ktypes.NamespaceKind]informers.SharedInformerFactory{},
+		dynamicFactories:         map[string]dynamicinformer.DynamicSharedInformerFactory{},
 	}
 }
 
@@ -43,6 +50,9 @@ type informerClient struct {
 	factoriesLock sync.RWMutex
 
 	factoriesByNamespaceKind map[ktypes.NamespaceKind]informers.SharedInformerFactory
+
+	// The factories for resources without a typed client indexed by the namespace.
+	dynamicFactories map[string]dynamicinformer.DynamicSharedInformerFactory
 }
 
 func (i *informerClient) Get(nsKind ktypes.NamespaceKind, name string) (runtime.Object, error) {
@@ -217,6 +227,7 @@ func (i *informerClient) Inform(ctx context.Context, spec kinformer.InformerSpec
 
 	obj, err := i.List(spec.NamespaceKind, labels.Everything())
 	if err != nil {
+		cancel()
 		return err
 	}
 	if spec.Filter != nil {
@@ -237,9 +248,72 @@ func (i *informerClient) Inform(ctx context.Context, spec kinformer.InformerSpec
 		}
 	}
 
+	releaseOnDone(ctx, cancel)
 	return nil
 }
 
+func (i *informerClient) InformResource(ctx context.Context, spec kinformer.ResourceInformerSpec) error {
+	if spec.Filter == nil {
+		spec.Filter = func(object metav1.Object) bool {
+			return true
+		}
+	}
+
+	informer := i.lazyGetDynamicFactory(spec.Namespace).ForResource(spec.Resource).Informer()
+
+	kindSpec := kinformer.InformerSpec{
+		BatchDuration: spec.BatchDuration,
+		Filter:        spec.Filter,
+		Handlers:      spec.Handlers,
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+
+	queue := i.createHandlerQueue(ctx, kindSpec)
+
+	informer.AddEventHandler(i.handlerFactory(queue, kindSpec))
+
+	i.runInformer(informer)
+
+	i.waitForSync(informer)
+
+	list := &unstructured.UnstructuredList{}
+	for _, v := range informer.GetStore().List() {
+		if u, ok := v.(*unstructured.Unstructured); ok && spec.Filter(u) {
+			list.Items = append(list.Items, *u)
+		}
+	}
+
+	for _, h := range spec.Handlers {
+		if err := h.OnListEvent(list); err != nil {
+			cancel()
+			return err
+		}
+	}
+
+	releaseOnDone(ctx, cancel)
+	return nil
+}
+
+// The handler queue runs until the parent context is done so the cancel func is only released then.
+func releaseOnDone(ctx context.Context, cancel context.CancelFunc) {
+	go func() {
+		<-ctx.Done()
+		cancel()
+	}()
+}
+
+func (i *informerClient) lazyGetDynamicFactory(namespace string) dynamicinformer.DynamicSharedInformerFactory {
+	i.factoriesLock.Lock()
+	defer i.factoriesLock.Unlock()
+	fact, ok := i.dynamicFactories[namespace]
+	if !ok {
+		fact = dynamicinformer.NewFilteredDynamicSharedInformerFactory(i.Client.Dynamic(), 0, namespace, nil)
+		i.dynamicFactories[namespace] = fact
+	}
+	return fact
+}
+
 func (i *informerClient) lazyGetFactory(nsKind ktypes.NamespaceKind) informers.SharedInformerFactory {
 	i.factoriesLock.Lock()
 	defer i.factoriesLock.Unlock()
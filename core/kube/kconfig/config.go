@@ -2,6 +2,7 @@ package kconfig
 
 import (
 	"io/ioutil"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	_ "k8s.io/client-go/plugin/pkg/client/auth/gcp"
 	"k8s.io/client-go/rest"
@@ -19,6 +20,10 @@ type Opt struct {
 type Config interface {
 	// If the context is a blank string, the current config is returned.
 	Api(context string) (kubernetes.Interface, error)
+
+	// A client for arbitrary resources such as custom resources. If the context is a blank string, the current config is
+	// used.
+	Dynamic(context string) (dynamic.Interface, error)
 	RestConfig() *rest.Config
 	InCluster() bool
 	GetNamespace() string
@@ -63,15 +68,7 @@ func (c *config) InCluster() bool {
 
 func (c *config) Api(context string) (kubernetes.Interface, error) {
 	if c.Interface == nil {
-		override := &clientcmd.ConfigOverrides{}
-		if context != "" {
-			override.CurrentContext = context
-		}
-
-		conf, err := clientcmd.NewDefaultClientConfig(
-			*c.Config,
-			override,
-		).ClientConfig()
+		conf, err := c.contextRestConfig(context)
 		if err != nil {
 			return nil, err
 		}
@@ -82,6 +79,31 @@ func (c *config) Api(context string) (kubernetes.Interface, error) {
 	return c.Interface, nil
 }
 
+func (c *config) Dynamic(context string) (dynamic.Interface, error) {
+	conf := c.Rest
+	if c.Config != nil {
+		var err error
+		conf, err = c.contextRestConfig(context)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return dynamic.NewForConfig(conf)
+}
+
+func (c *config) contextRestConfig(context string) (*rest.Config, error) {
+	override := &clientcmd.ConfigOverrides{}
+	if context != "" {
+		override.CurrentContext = context
+	}
+
+	return clientcmd.NewDefaultClientConfig(
+		*c.Config,
+		override,
+	).ClientConfig()
+}
+
 func FromApiConfig(apiConf *api.Config) (Config, error) {
 	conf, err := clientcmd.NewDefaultClientConfig(
 		*apiConf,
@@ -131,6 +153,7 @@ func NewConfigClient(spec ConfigSpec) (Config, error) {
 		}
 	} else {
 		confClient.Interface, err = kubernetes.NewForConfig(conf)
+		confClient.Rest = conf
 		confClient.IsInCluster = true
 		if err != nil {
 			return nil, err
@@ -5,6 +5,7 @@ import (
 	"github.com/kage-cloud/kage/core/kube/kfilter"
 	"github.com/kage-cloud/kage/core/kube/ktypes"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/watch"
 	"time"
 )
@@ -28,6 +29,20 @@ type InformerSpec struct {
 	Handlers []InformEventHandler
 }
 
+// Informs on a resource which has no typed client e.g. a custom resource.
+type ResourceInformerSpec struct {
+	Resource schema.GroupVersionResource
+
+	// If blank, the resource is watched in all namespaces.
+	Namespace string
+
+	BatchDuration time.Duration
+
+	Filter kfilter.Filter
+
+	Handlers []InformEventHandler
+}
+
 type InformEventHandlerFuncs struct {
 	OnWatch OnWatchEventFunc
 	OnList  OnListEventFunc
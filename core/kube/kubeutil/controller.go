@@ -0,0 +1,84 @@
+package kubeutil
+
+import (
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// Returns the pod template of the controller. Returns nil if the object does not have a pod template e.g. a Pod.
+func PodTemplate(obj runtime.Object) *corev1.PodTemplateSpec {
+	switch typ := obj.(type) {
+	case *appsv1.Deployment:
+		return &typ.Spec.Template
+	case *appsv1.StatefulSet:
+		return &typ.Spec.Template
+	case *appsv1.DaemonSet:
+		return &typ.Spec.Template
+	case *appsv1.ReplicaSet:
+		return &typ.Spec.Template
+	}
+	return nil
+}
+
+// Whether the controller replaces its pods when its pod template changes. Bare ReplicaSets, paused Deployments, and
+// StatefulSets or DaemonSets using the OnDelete strategy or a partition leave some or all of their old pods running.
+func RollsOutTemplate(obj runtime.Object) bool {
+	switch typ := obj.(type) {
+	case *appsv1.Deployment:
+		return !typ.Spec.Paused
+	case *appsv1.StatefulSet:
+		strategy := typ.Spec.UpdateStrategy
+		if strategy.Type == appsv1.OnDeleteStatefulSetStrategyType {
+			return false
+		}
+		return strategy.RollingUpdate == nil || strategy.RollingUpdate.Partition == nil || *strategy.RollingUpdate.Partition == 0
+	case *appsv1.DaemonSet:
+		return typ.Spec.UpdateStrategy.Type != appsv1.OnDeleteDaemonSetStrategyType
+	}
+	return false
+}
+
+// Whether all of the pods managed by the object are up to date and ready. For controllers, the status must reflect the
+// latest generation of the spec, every desired replica must run the latest pod template and be ready, and no old
+// replicas may be left. ReplicaSets do not track which template their pods run so only their readiness is checked.
+func IsReady(obj runtime.Object) bool {
+	switch typ := obj.(type) {
+	case *appsv1.Deployment:
+		desired := desiredReplicas(typ.Spec.Replicas)
+		return typ.Status.ObservedGeneration >= typ.Generation &&
+			typ.Status.UpdatedReplicas == desired &&
+			typ.Status.Replicas == desired &&
+			typ.Status.ReadyReplicas == desired
+	case *appsv1.StatefulSet:
+		desired := desiredReplicas(typ.Spec.Replicas)
+		return typ.Status.ObservedGeneration >= typ.Generation &&
+			typ.Status.CurrentRevision == typ.Status.UpdateRevision &&
+			typ.Status.UpdatedReplicas == desired &&
+			typ.Status.ReadyReplicas == desired
+	case *appsv1.DaemonSet:
+		return typ.Status.ObservedGeneration >= typ.Generation &&
+			typ.Status.NumberReady == typ.Status.DesiredNumberScheduled &&
+			typ.Status.UpdatedNumberScheduled == typ.Status.DesiredNumberScheduled
+	case *appsv1.ReplicaSet:
+		desired := desiredReplicas(typ.Spec.Replicas)
+		return typ.Status.ObservedGeneration >= typ.Generation &&
+			typ.Status.Replicas == desired &&
+			typ.Status.ReadyReplicas == desired
+	case *corev1.Pod:
+		for _, cond := range typ.Status.Conditions {
+			if cond.Type == corev1.PodReady {
+				return cond.Status == corev1.ConditionTrue
+			}
+		}
+	}
+	return false
+}
+
+// The replicas of a controller's spec which default to 1.
+func desiredReplicas(replicas *int32) int32 {
+	if replicas == nil {
+		return 1
+	}
+	return *replicas
+}
@@ -0,0 +1,313 @@
+package kubeutil
+
+import (
+	"github.com/stretchr/testify/suite"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/utils/pointer"
+	"testing"
+)
+
+type ControllerTestSuite struct {
+	suite.Suite
+}
+
+func (c *ControllerTestSuite) TestIsReady() {
+	// -- Given
+	//
+	type test struct {
+		Name     string
+		Given    runtime.Object
+		Expected bool
+	}
+
+	given := []test{
+		{
+			Name: "deployment ready",
+			Given: &appsv1.Deployment{
+				ObjectMeta: metav1.ObjectMeta{Generation: 2},
+				Spec:       appsv1.DeploymentSpec{Replicas: pointer.Int32Ptr(3)},
+				Status:     appsv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 3, UpdatedReplicas: 3, ReadyReplicas: 3},
+			},
+			Expected: true,
+		},
+		{
+			Name: "deployment defaults to 1 replica",
+			Given: &appsv1.Deployment{
+				Status: appsv1.DeploymentStatus{Replicas: 1, UpdatedReplicas: 1, ReadyReplicas: 1},
+			},
+			Expected: true,
+		},
+		{
+			Name: "deployment generation not observed",
+			Given: &appsv1.Deployment{
+				ObjectMeta: metav1.ObjectMeta{Generation: 3},
+				Spec:       appsv1.DeploymentSpec{Replicas: pointer.Int32Ptr(3)},
+				Status:     appsv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 3, UpdatedReplicas: 3, ReadyReplicas: 3},
+			},
+		},
+		{
+			Name: "deployment partially updated",
+			Given: &appsv1.Deployment{
+				ObjectMeta: metav1.ObjectMeta{Generation: 2},
+				Spec:       appsv1.DeploymentSpec{Replicas: pointer.Int32Ptr(3)},
+				Status:     appsv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 4, UpdatedReplicas: 2, ReadyReplicas: 4},
+			},
+		},
+		{
+			Name: "deployment old replicas left",
+			Given: &appsv1.Deployment{
+				ObjectMeta: metav1.ObjectMeta{Generation: 2},
+				Spec:       appsv1.DeploymentSpec{Replicas: pointer.Int32Ptr(3)},
+				Status:     appsv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 4, UpdatedReplicas: 3, ReadyReplicas: 3},
+			},
+		},
+		{
+			Name: "deployment scaling up",
+			Given: &appsv1.Deployment{
+				ObjectMeta: metav1.ObjectMeta{Generation: 2},
+				Spec:       appsv1.DeploymentSpec{Replicas: pointer.Int32Ptr(3)},
+				Status:     appsv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 1, UpdatedReplicas: 1, ReadyReplicas: 1},
+			},
+		},
+		{
+			Name: "statefulset ready",
+			Given: &appsv1.StatefulSet{
+				ObjectMeta: metav1.ObjectMeta{Generation: 1},
+				Spec:       appsv1.StatefulSetSpec{Replicas: pointer.Int32Ptr(2)},
+				Status:     appsv1.StatefulSetStatus{ObservedGeneration: 1, Replicas: 2, UpdatedReplicas: 2, ReadyReplicas: 2},
+			},
+			Expected: true,
+		},
+		{
+			Name: "statefulset generation not observed",
+			Given: &appsv1.StatefulSet{
+				ObjectMeta: metav1.ObjectMeta{Generation: 2},
+				Spec:       appsv1.StatefulSetSpec{Replicas: pointer.Int32Ptr(2)},
+				Status:     appsv1.StatefulSetStatus{ObservedGeneration: 1, Replicas: 2, UpdatedReplicas: 2, ReadyReplicas: 2},
+			},
+		},
+		{
+			Name: "statefulset partially updated",
+			Given: &appsv1.StatefulSet{
+				ObjectMeta: metav1.ObjectMeta{Generation: 2},
+				Spec:       appsv1.StatefulSetSpec{Replicas: pointer.Int32Ptr(2)},
+				Status:     appsv1.StatefulSetStatus{ObservedGeneration: 2, Replicas: 2, UpdatedReplicas: 1, ReadyReplicas: 2},
+			},
+		},
+		{
+			Name: "statefulset revision not current",
+			Given: &appsv1.StatefulSet{
+				ObjectMeta: metav1.ObjectMeta{Generation: 2},
+				Spec:       appsv1.StatefulSetSpec{Replicas: pointer.Int32Ptr(2)},
+				Status: appsv1.StatefulSetStatus{
+					ObservedGeneration: 2,
+					Replicas:           2,
+					UpdatedReplicas:    2,
+					ReadyReplicas:      2,
+					CurrentRevision:    "a",
+					UpdateRevision:     "b",
+				},
+			},
+		},
+		{
+			Name: "daemonset ready",
+			Given: &appsv1.DaemonSet{
+				ObjectMeta: metav1.ObjectMeta{Generation: 1},
+				Status:     appsv1.DaemonSetStatus{ObservedGeneration: 1, DesiredNumberScheduled: 3, NumberReady: 3, UpdatedNumberScheduled: 3},
+			},
+			Expected: true,
+		},
+		{
+			Name: "daemonset generation not observed",
+			Given: &appsv1.DaemonSet{
+				ObjectMeta: metav1.ObjectMeta{Generation: 2},
+				Status:     appsv1.DaemonSetStatus{ObservedGeneration: 1, DesiredNumberScheduled: 3, NumberReady: 3, UpdatedNumberScheduled: 3},
+			},
+		},
+		{
+			Name: "daemonset partially updated",
+			Given: &appsv1.DaemonSet{
+				ObjectMeta: metav1.ObjectMeta{Generation: 2},
+				Status:     appsv1.DaemonSetStatus{ObservedGeneration: 2, DesiredNumberScheduled: 3, NumberReady: 3, UpdatedNumberScheduled: 1},
+			},
+		},
+		{
+			Name: "replicaset ready",
+			Given: &appsv1.ReplicaSet{
+				ObjectMeta: metav1.ObjectMeta{Generation: 1},
+				Spec:       appsv1.ReplicaSetSpec{Replicas: pointer.Int32Ptr(2)},
+				Status:     appsv1.ReplicaSetStatus{ObservedGeneration: 1, Replicas: 2, ReadyReplicas: 2},
+			},
+			Expected: true,
+		},
+		{
+			Name: "replicaset generation not observed",
+			Given: &appsv1.ReplicaSet{
+				ObjectMeta: metav1.ObjectMeta{Generation: 2},
+				Spec:       appsv1.ReplicaSetSpec{Replicas: pointer.Int32Ptr(2)},
+				Status:     appsv1.ReplicaSetStatus{ObservedGeneration: 1, Replicas: 2, ReadyReplicas: 2},
+			},
+		},
+		{
+			Name: "replicaset partially ready",
+			Given: &appsv1.ReplicaSet{
+				ObjectMeta: metav1.ObjectMeta{Generation: 1},
+				Spec:       appsv1.ReplicaSetSpec{Replicas: pointer.Int32Ptr(2)},
+				Status:     appsv1.ReplicaSetStatus{ObservedGeneration: 1, Replicas: 2, ReadyReplicas: 1},
+			},
+		},
+		{
+			Name: "pod ready",
+			Given: &corev1.Pod{
+				Status: corev1.PodStatus{Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}}},
+			},
+			Expected: true,
+		},
+		{
+			Name: "pod not ready",
+			Given: &corev1.Pod{
+				Status: corev1.PodStatus{Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionFalse}}},
+			},
+		},
+		{
+			Name:  "pod without conditions",
+			Given: &corev1.Pod{},
+		},
+		{
+			Name:  "not a controller",
+			Given: &corev1.Service{},
+		},
+	}
+
+	for _, v := range given {
+		// -- When
+		//
+		actual := IsReady(v.Given)
+
+		// -- Then
+		//
+		c.Equal(v.Expected, actual, v.Name)
+	}
+}
+
+func (c *ControllerTestSuite) TestRollsOutTemplate() {
+	// -- Given
+	//
+	type test struct {
+		Name     string
+		Given    runtime.Object
+		Expected bool
+	}
+
+	given := []test{
+		{
+			Name:     "deployment",
+			Given:    &appsv1.Deployment{},
+			Expected: true,
+		},
+		{
+			Name:  "paused deployment",
+			Given: &appsv1.Deployment{Spec: appsv1.DeploymentSpec{Paused: true}},
+		},
+		{
+			Name: "statefulset rolling update",
+			Given: &appsv1.StatefulSet{Spec: appsv1.StatefulSetSpec{
+				UpdateStrategy: appsv1.StatefulSetUpdateStrategy{Type: appsv1.RollingUpdateStatefulSetStrategyType},
+			}},
+			Expected: true,
+		},
+		{
+			Name: "statefulset on delete",
+			Given: &appsv1.StatefulSet{Spec: appsv1.StatefulSetSpec{
+				UpdateStrategy: appsv1.StatefulSetUpdateStrategy{Type: appsv1.OnDeleteStatefulSetStrategyType},
+			}},
+		},
+		{
+			Name: "statefulset partitioned",
+			Given: &appsv1.StatefulSet{Spec: appsv1.StatefulSetSpec{
+				UpdateStrategy: appsv1.StatefulSetUpdateStrategy{
+					Type:          appsv1.RollingUpdateStatefulSetStrategyType,
+					RollingUpdate: &appsv1.RollingUpdateStatefulSetStrategy{Partition: pointer.Int32Ptr(1)},
+				},
+			}},
+		},
+		{
+			Name: "daemonset rolling update",
+			Given: &appsv1.DaemonSet{Spec: appsv1.DaemonSetSpec{
+				UpdateStrategy: appsv1.DaemonSetUpdateStrategy{Type: appsv1.RollingUpdateDaemonSetStrategyType},
+			}},
+			Expected: true,
+		},
+		{
+			Name: "daemonset on delete",
+			Given: &appsv1.DaemonSet{Spec: appsv1.DaemonSetSpec{
+				UpdateStrategy: appsv1.DaemonSetUpdateStrategy{Type: appsv1.OnDeleteDaemonSetStrategyType},
+			}},
+		},
+		{
+			Name:  "replicaset",
+			Given: &appsv1.ReplicaSet{},
+		},
+		{
+			Name:  "pod",
+			Given: &corev1.Pod{},
+		},
+	}
+
+	for _, v := range given {
+		// -- When
+		//
+		actual := RollsOutTemplate(v.Given)
+
+		// -- Then
+		//
+		c.Equal(v.Expected, actual, v.Name)
+	}
+}
+
+func (c *ControllerTestSuite) TestPodTemplate() {
+	// -- Given
+	//
+	template := corev1.PodTemplateSpec{ObjectMeta: metav1.ObjectMeta{Name: "template"}}
+
+	type test struct {
+		Name     string
+		Given    runtime.Object
+		Expected bool
+	}
+
+	given := []test{
+		{Name: "deployment", Given: &appsv1.Deployment{Spec: appsv1.DeploymentSpec{Template: template}}, Expected: true},
+		{Name: "statefulset", Given: &appsv1.StatefulSet{Spec: appsv1.StatefulSetSpec{Template: template}}, Expected: true},
+		{Name: "daemonset", Given: &appsv1.DaemonSet{Spec: appsv1.DaemonSetSpec{Template: template}}, Expected: true},
+		{Name: "replicaset", Given: &appsv1.ReplicaSet{Spec: appsv1.ReplicaSetSpec{Template: template}}, Expected: true},
+		{Name: "pod", Given: &corev1.Pod{}},
+	}
+
+	for _, v := range given {
+		// -- When
+		//
+		actual := PodTemplate(v.Given)
+
+		// -- Then
+		//
+		if v.Expected {
+			if c.NotNil(actual, v.Name) {
+				c.Equal("template", actual.Name, v.Name)
+
+				// The template is the controller's so changes to it are made to the controller.
+				actual.Labels = map[string]string{"changed": "true"}
+				c.Equal(actual, PodTemplate(v.Given), v.Name)
+			}
+		} else {
+			c.Nil(actual, v.Name)
+		}
+	}
+}
+
+func TestControllerTestSuite(t *testing.T) {
+	suite.Run(t, new(ControllerTestSuite))
+}
@@ -0,0 +1,89 @@
+package kube
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/flowcontrol"
+)
+
+const (
+	defaultEventQps   = 10
+	defaultEventBurst = 50
+
+	// The rate at which events for a single object are allowed once the object's burst is used up.
+	defaultObjectEventQps   = 1. / 30.
+	defaultObjectEventBurst = 10
+)
+
+// Records Kubernetes Events on the objects affected by an action so they show up in kubectl describe. Events are
+// dropped rather than blocking the caller once the rate limits are exceeded.
+type EventRecorder interface {
+	Normal(obj runtime.Object, reason EventReason, messageFmt string, args ...interface{})
+	Warning(obj runtime.Object, reason EventReason, messageFmt string, args ...interface{})
+}
+
+// A short, CamelCase reason for the event e.g. ServiceProxied.
+type EventReason string
+
+type EventRecorderSpec struct {
+	// The name of the component recording the events.
+	Component string
+
+	// The rate and burst of events sent to the API server across all objects. Defaults to 10 and 50.
+	Qps   float32
+	Burst int
+
+	// The rate and burst of events for a single object. Defaults to one every 30 seconds and 10.
+	ObjectQps   float32
+	ObjectBurst int
+}
+
+func NewEventRecorder(client Client, spec EventRecorderSpec) EventRecorder {
+	if spec.Qps == 0 {
+		spec.Qps = defaultEventQps
+	}
+	if spec.Burst == 0 {
+		spec.Burst = defaultEventBurst
+	}
+	if spec.ObjectQps == 0 {
+		spec.ObjectQps = defaultObjectEventQps
+	}
+	if spec.ObjectBurst == 0 {
+		spec.ObjectBurst = defaultObjectEventBurst
+	}
+
+	broadcaster := record.NewBroadcasterWithCorrelatorOptions(record.CorrelatorOptions{
+		QPS:       spec.ObjectQps,
+		BurstSize: spec.ObjectBurst,
+	})
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: client.Api().CoreV1().Events("")})
+
+	return &eventRecorder{
+		Recorder: broadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: spec.Component}),
+		Limiter:  flowcontrol.NewTokenBucketRateLimiter(spec.Qps, spec.Burst),
+	}
+}
+
+type eventRecorder struct {
+	Recorder record.EventRecorder
+	Limiter  flowcontrol.RateLimiter
+}
+
+func (e *eventRecorder) Normal(obj runtime.Object, reason EventReason, messageFmt string, args ...interface{}) {
+	e.record(obj, corev1.EventTypeNormal, reason, messageFmt, args...)
+}
+
+func (e *eventRecorder) Warning(obj runtime.Object, reason EventReason, messageFmt string, args ...interface{}) {
+	e.record(obj, corev1.EventTypeWarning, reason, messageFmt, args...)
+}
+
+func (e *eventRecorder) record(obj runtime.Object, eventType string, reason EventReason, messageFmt string, args ...interface{}) {
+	if obj == nil || !e.Limiter.TryAccept() {
+		return
+	}
+
+	e.Recorder.Eventf(obj, eventType, string(reason), messageFmt, args...)
+}
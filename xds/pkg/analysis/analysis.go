@@ -0,0 +1,71 @@
+package analysis
+
+import (
+	"fmt"
+)
+
+type Verdict string
+
+const (
+	// The canary is healthy and can be advanced.
+	VerdictPass Verdict = "Pass"
+
+	// The canary is unhealthy and should be rolled back.
+	VerdictFail Verdict = "Fail"
+
+	// Not enough traffic has gone through the canary to make a decision.
+	VerdictInconclusive Verdict = "Inconclusive"
+)
+
+type Thresholds struct {
+	// The minimum number of requests the canary must receive before a decision is made.
+	MinRequests uint64
+
+	// The max amount the canary's success rate can be below the source's success rate e.g. 0.01 allows the canary to
+	// have a success rate one percent lower than the source.
+	MaxSuccessRateDrop float64
+
+	// The latency percentile which is compared e.g. 99 for the P99.
+	LatencyPercentile float64
+
+	// The max amount of milliseconds the canary's latency can be above the source's latency.
+	MaxLatencyIncreaseMs float64
+}
+
+type Result struct {
+	Verdict Verdict
+
+	// Why the verdict was reached.
+	Reasons []string
+}
+
+// Compares the canary's stats against the source's stats.
+func Compare(source, canary *ClusterStats, thresholds *Thresholds) *Result {
+	if canary.Requests < thresholds.MinRequests {
+		return &Result{
+			Verdict: VerdictInconclusive,
+			Reasons: []string{fmt.Sprintf("canary has received %d of the required %d requests", canary.Requests, thresholds.MinRequests)},
+		}
+	}
+
+	reasons := make([]string, 0)
+
+	sourceRate, canaryRate := source.SuccessRate(), canary.SuccessRate()
+	if sourceRate-canaryRate > thresholds.MaxSuccessRateDrop {
+		reasons = append(reasons, fmt.Sprintf("canary success rate %.4f is more than %.4f below the source success rate %.4f", canaryRate, thresholds.MaxSuccessRateDrop, sourceRate))
+	}
+
+	if thresholds.LatencyPercentile > 0 {
+		sourceLatency, sourceOk := source.Latency.Percentile(thresholds.LatencyPercentile)
+		canaryLatency, canaryOk := canary.Latency.Percentile(thresholds.LatencyPercentile)
+		if sourceOk && canaryOk && canaryLatency-sourceLatency > thresholds.MaxLatencyIncreaseMs {
+			reasons = append(reasons, fmt.Sprintf("canary P%g latency %gms is more than %gms above the source latency %gms", thresholds.LatencyPercentile, canaryLatency, thresholds.MaxLatencyIncreaseMs, sourceLatency))
+		}
+	}
+
+	if len(reasons) > 0 {
+		return &Result{Verdict: VerdictFail, Reasons: reasons}
+	}
+
+	return &Result{Verdict: VerdictPass, Reasons: reasons}
+}
@@ -0,0 +1,393 @@
+package analysis
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/suite"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const adminStats = `# TYPE envoy_cluster_upstream_rq_completed counter
+envoy_cluster_upstream_rq_completed{envoy_cluster_name="xds"} 500
+envoy_cluster_upstream_rq_completed{envoy_cluster_name="canary"} 100
+envoy_cluster_upstream_rq_completed{envoy_cluster_name="source"} 1000
+# TYPE envoy_cluster_upstream_rq_xx counter
+envoy_cluster_upstream_rq_xx{envoy_response_code_class="2",envoy_cluster_name="canary"} 90
+envoy_cluster_upstream_rq_xx{envoy_response_code_class="5",envoy_cluster_name="canary"} 10
+envoy_cluster_upstream_rq_xx{envoy_response_code_class="2",envoy_cluster_name="source"} 999
+envoy_cluster_upstream_rq_xx{envoy_response_code_class="5",envoy_cluster_name="source"} 1
+# TYPE envoy_cluster_upstream_rq_time histogram
+envoy_cluster_upstream_rq_time_bucket{envoy_cluster_name="canary",le="1"} 50
+envoy_cluster_upstream_rq_time_bucket{envoy_cluster_name="canary",le="5"} 80
+envoy_cluster_upstream_rq_time_bucket{envoy_cluster_name="canary",le="10"} 90
+envoy_cluster_upstream_rq_time_bucket{envoy_cluster_name="canary",le="250"} 90
+envoy_cluster_upstream_rq_time_bucket{envoy_cluster_name="canary",le="500"} 100
+envoy_cluster_upstream_rq_time_bucket{envoy_cluster_name="canary",le="+Inf"} 100
+envoy_cluster_upstream_rq_time_sum{envoy_cluster_name="canary"} 3500
+envoy_cluster_upstream_rq_time_count{envoy_cluster_name="canary"} 100
+envoy_cluster_upstream_rq_time_bucket{envoy_cluster_name="source",le="1"} 500
+envoy_cluster_upstream_rq_time_bucket{envoy_cluster_name="source",le="5"} 990
+envoy_cluster_upstream_rq_time_bucket{envoy_cluster_name="source",le="10"} 1000
+envoy_cluster_upstream_rq_time_bucket{envoy_cluster_name="source",le="250"} 1000
+envoy_cluster_upstream_rq_time_bucket{envoy_cluster_name="source",le="500"} 1000
+envoy_cluster_upstream_rq_time_bucket{envoy_cluster_name="source",le="+Inf"} 1000
+envoy_cluster_upstream_rq_time_sum{envoy_cluster_name="source"} 2000
+envoy_cluster_upstream_rq_time_count{envoy_cluster_name="source"} 1000
+# TYPE envoy_server_live gauge
+envoy_server_live{} 1
+`
+
+type AnalysisTestSuite struct {
+	suite.Suite
+}
+
+func (a *AnalysisTestSuite) TestParseStats() {
+	// -- Given
+	//
+	given := strings.NewReader(adminStats)
+
+	expected := MeshStats{
+		"canary": {
+			Name:     "canary",
+			Requests: 100,
+			Errors:   10,
+			Latency: Histogram{
+				Buckets: []Bucket{{1, 50}, {5, 80}, {10, 90}, {250, 90}, {500, 100}},
+				Count:   100,
+			},
+		},
+		"source": {
+			Name:     "source",
+			Requests: 1000,
+			Errors:   1,
+			Latency: Histogram{
+				Buckets: []Bucket{{1, 500}, {5, 990}, {10, 1000}, {250, 1000}, {500, 1000}},
+				Count:   1000,
+			},
+		},
+	}
+
+	// -- When
+	//
+	actual, err := ParseStats(given, "canary", "source")
+
+	// -- Then
+	//
+	if a.NoError(err) {
+		a.Equal(expected, actual)
+	}
+}
+
+func (a *AnalysisTestSuite) TestParseStatsNoRecordedValues() {
+	// -- Given
+	//
+	given := strings.NewReader(`envoy_cluster_upstream_rq_completed{envoy_cluster_name="canary"} 0
+envoy_cluster_upstream_rq_time_bucket{envoy_cluster_name="canary",le="+Inf"} 0
+envoy_cluster_upstream_rq_time_count{envoy_cluster_name="canary"} 0
+`)
+
+	// -- When
+	//
+	actual, err := ParseStats(given, "canary")
+
+	// -- Then
+	//
+	if a.NoError(err) {
+		_, ok := actual["canary"].Latency.Percentile(99)
+		a.False(ok)
+		a.Equal(float64(1), actual["canary"].SuccessRate())
+	}
+}
+
+func (a *AnalysisTestSuite) TestParseStatsPortClusters() {
+	// -- Given
+	//
+	given := strings.NewReader(`envoy_cluster_upstream_rq_completed{envoy_cluster_name="canary|8080"} 60
+envoy_cluster_upstream_rq_completed{envoy_cluster_name="canary|8081"} 40
+envoy_cluster_upstream_rq_xx{envoy_response_code_class="5",envoy_cluster_name="canary|8080"} 3
+envoy_cluster_upstream_rq_xx{envoy_response_code_class="5",envoy_cluster_name="canary|8081"} 2
+envoy_cluster_upstream_rq_time_bucket{envoy_cluster_name="canary|8080",le="10"} 60
+envoy_cluster_upstream_rq_time_bucket{envoy_cluster_name="canary|8081",le="10"} 40
+envoy_cluster_upstream_rq_time_count{envoy_cluster_name="canary|8080"} 60
+envoy_cluster_upstream_rq_time_count{envoy_cluster_name="canary|8081"} 40
+`)
+
+	// -- When
+	//
+	actual, err := ParseStats(given, "canary")
+
+	// -- Then
+	//
+	if a.NoError(err) {
+		canary := actual["canary"]
+		a.Equal(uint64(100), canary.Requests)
+		a.Equal(uint64(5), canary.Errors)
+		a.Equal(uint64(100), canary.Latency.Count)
+		a.Equal([]Bucket{{UpperBound: 10, Count: 100}}, canary.Latency.Buckets)
+	}
+}
+
+func (a *AnalysisTestSuite) TestParseStatsGrpc() {
+	// -- Given
+	//
+	given := strings.NewReader(`envoy_cluster_grpc_0{envoy_grpc_bridge_method="SayHello",envoy_grpc_bridge_service="helloworld.Greeter",envoy_cluster_name="canary"} 80
+envoy_cluster_grpc_5{envoy_grpc_bridge_method="SayHello",envoy_grpc_bridge_service="helloworld.Greeter",envoy_cluster_name="canary"} 10
+envoy_cluster_grpc_14{envoy_grpc_bridge_method="SayHello",envoy_grpc_bridge_service="helloworld.Greeter",envoy_cluster_name="canary"} 6
+envoy_cluster_grpc_failure{envoy_grpc_bridge_method="SayHello",envoy_grpc_bridge_service="helloworld.Greeter",envoy_cluster_name="canary"} 16
+envoy_cluster_grpc_total{envoy_grpc_bridge_method="SayHello",envoy_grpc_bridge_service="helloworld.Greeter",envoy_cluster_name="canary"} 96
+envoy_cluster_grpc_SayBye_13{envoy_grpc_bridge_service="Greeter",envoy_cluster_name="canary"} 4
+envoy_cluster_grpc_SayBye_total{envoy_grpc_bridge_service="Greeter",envoy_cluster_name="canary"} 4
+envoy_cluster_upstream_rq_completed{envoy_cluster_name="canary"} 100
+`)
+
+	// -- When
+	//
+	actual, err := ParseStats(given, "canary")
+
+	// -- Then
+	//
+	if a.NoError(err) {
+		canary := actual["canary"]
+		a.Equal(uint64(100), canary.GrpcRequests)
+		a.Equal(uint64(10), canary.GrpcErrors)
+		a.Equal(0.9, canary.SuccessRate())
+	}
+}
+
+func (a *AnalysisTestSuite) TestPercentile() {
+	// -- Given
+	//
+	stats, _ := ParseStats(strings.NewReader(adminStats), "canary", "source")
+
+	type test struct {
+		Given      *Histogram
+		Percentile float64
+		Expected   float64
+	}
+
+	given := []test{
+		{Given: &stats["source"].Latency, Percentile: 50, Expected: 1},
+		{Given: &stats["source"].Latency, Percentile: 99, Expected: 5},
+		{Given: &stats["canary"].Latency, Percentile: 99, Expected: 475},
+		{Given: &stats["canary"].Latency, Percentile: 100, Expected: 500},
+		{Given: &Histogram{Buckets: []Bucket{{10, 2}}, Count: 4}, Percentile: 99, Expected: 10},
+	}
+
+	for _, v := range given {
+		// -- When
+		//
+		actual, ok := v.Given.Percentile(v.Percentile)
+
+		// -- Then
+		//
+		if a.True(ok) {
+			a.InDelta(v.Expected, actual, 0.001, "P%g", v.Percentile)
+		}
+	}
+}
+
+func (a *AnalysisTestSuite) TestMerge() {
+	// -- Given
+	//
+	given := MeshStats{"canary": {Name: "canary", Requests: 10, Latency: Histogram{Buckets: []Bucket{{1, 5}, {10, 10}}, Count: 10}}}
+	other := MeshStats{"canary": {Name: "canary", Requests: 20, Latency: Histogram{Buckets: []Bucket{{1, 2}, {5, 15}, {10, 20}}, Count: 20}}}
+
+	// -- When
+	//
+	given.Merge(other)
+
+	// -- Then
+	//
+	a.Equal(uint64(30), given["canary"].Requests)
+	a.Equal(Histogram{Buckets: []Bucket{{1, 7}, {5, 15}, {10, 30}}, Count: 30}, given["canary"].Latency)
+}
+
+func (a *AnalysisTestSuite) TestFetch() {
+	// -- Given
+	//
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/stats/prometheus" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = fmt.Fprint(w, adminStats)
+	}))
+	defer server.Close()
+
+	client := NewStatsClient(&StatsClientSpec{Timeout: time.Second})
+
+	// -- When
+	//
+	actual, err := client.Fetch(strings.TrimPrefix(server.URL, "http://"), "canary", "source")
+
+	// -- Then
+	//
+	if a.NoError(err) {
+		a.Equal(uint64(100), actual["canary"].Requests)
+		a.Equal(uint64(1000), actual["source"].Requests)
+	}
+}
+
+func (a *AnalysisTestSuite) TestFetchBadStatus() {
+	// -- Given
+	//
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	client := NewStatsClient(&StatsClientSpec{Timeout: time.Second})
+
+	// -- When
+	//
+	_, err := client.Fetch(strings.TrimPrefix(server.URL, "http://"), "canary")
+
+	// -- Then
+	//
+	a.Error(err)
+}
+
+func (a *AnalysisTestSuite) TestCompareFailsOnSuccessRate() {
+	// -- Given
+	//
+	stats, _ := ParseStats(strings.NewReader(adminStats), "canary", "source")
+	thresholds := &Thresholds{MinRequests: 50, MaxSuccessRateDrop: 0.05}
+
+	// -- When
+	//
+	actual := Compare(stats["source"], stats["canary"], thresholds)
+
+	// -- Then
+	//
+	a.Equal(VerdictFail, actual.Verdict)
+	a.Len(actual.Reasons, 1)
+}
+
+func (a *AnalysisTestSuite) TestCompareFailsOnLatency() {
+	// -- Given
+	//
+	stats, _ := ParseStats(strings.NewReader(adminStats), "canary", "source")
+	thresholds := &Thresholds{MinRequests: 50, MaxSuccessRateDrop: 0.5, LatencyPercentile: 99, MaxLatencyIncreaseMs: 100}
+
+	// -- When
+	//
+	actual := Compare(stats["source"], stats["canary"], thresholds)
+
+	// -- Then
+	//
+	a.Equal(VerdictFail, actual.Verdict)
+	a.Len(actual.Reasons, 1)
+}
+
+func (a *AnalysisTestSuite) TestComparePasses() {
+	// -- Given
+	//
+	stats, _ := ParseStats(strings.NewReader(adminStats), "canary", "source")
+	thresholds := &Thresholds{MinRequests: 50, MaxSuccessRateDrop: 0.5, LatencyPercentile: 99, MaxLatencyIncreaseMs: 500}
+
+	// -- When
+	//
+	actual := Compare(stats["source"], stats["canary"], thresholds)
+
+	// -- Then
+	//
+	a.Equal(VerdictPass, actual.Verdict)
+	a.Empty(actual.Reasons)
+}
+
+func (a *AnalysisTestSuite) TestCompareInconclusive() {
+	// -- Given
+	//
+	stats, _ := ParseStats(strings.NewReader(adminStats), "canary", "source")
+	thresholds := &Thresholds{MinRequests: 200}
+
+	// -- When
+	//
+	actual := Compare(stats["source"], stats["canary"], thresholds)
+
+	// -- Then
+	//
+	a.Equal(VerdictInconclusive, actual.Verdict)
+}
+
+func (a *AnalysisTestSuite) TestSince() {
+	// -- Given
+	//
+	prev := &ClusterStats{Name: "canary", Requests: 40, Errors: 4}
+	curr := &ClusterStats{Name: "canary", Requests: 100, Errors: 10}
+
+	// -- When
+	//
+	actual := curr.Since(prev)
+
+	// -- Then
+	//
+	a.Equal(uint64(60), actual.Requests)
+	a.Equal(uint64(6), actual.Errors)
+}
+
+func (a *AnalysisTestSuite) TestSinceLatency() {
+	// -- Given
+	//
+	// The first 100 requests were slow but the 100 since were all fast.
+	prev := &ClusterStats{Name: "canary", Requests: 100, Latency: Histogram{Buckets: []Bucket{{10, 10}, {500, 100}}, Count: 100}}
+	curr := &ClusterStats{Name: "canary", Requests: 200, Latency: Histogram{Buckets: []Bucket{{10, 110}, {500, 200}}, Count: 200}}
+
+	// -- When
+	//
+	actual := curr.Since(prev)
+
+	// -- Then
+	//
+	a.Equal(Histogram{Buckets: []Bucket{{10, 100}, {500, 100}}, Count: 100}, actual.Latency)
+	p99, ok := actual.Latency.Percentile(99)
+	if a.True(ok) {
+		a.InDelta(9.9, p99, 0.001)
+	}
+	a.Equal(Histogram{Buckets: []Bucket{{10, 110}, {500, 200}}, Count: 200}, curr.Latency)
+}
+
+func (a *AnalysisTestSuite) TestSinceCounterReset() {
+	// -- Given
+	//
+	prev := &ClusterStats{Name: "canary", Requests: 400, Errors: 4, Latency: Histogram{Buckets: []Bucket{{10, 400}}, Count: 400}}
+	curr := &ClusterStats{Name: "canary", Requests: 100, Errors: 10, Latency: Histogram{Buckets: []Bucket{{10, 100}}, Count: 100}}
+
+	// -- When
+	//
+	actual := curr.Since(prev)
+
+	// -- Then
+	//
+	a.Equal(uint64(100), actual.Requests)
+	a.Equal(uint64(10), actual.Errors)
+	a.Equal(uint64(100), actual.Latency.Count)
+}
+
+func (a *AnalysisTestSuite) TestCheckpointRoundTrip() {
+	// -- Given
+	//
+	given, err := ParseStats(strings.NewReader(adminStats), "canary", "source")
+	a.Require().NoError(err)
+
+	// -- When
+	//
+	b, err := json.Marshal(given)
+	a.Require().NoError(err)
+	actual := MeshStats{}
+	err = json.Unmarshal(b, &actual)
+
+	// -- Then
+	//
+	if a.NoError(err) {
+		a.Equal(given, actual)
+	}
+}
+
+func TestAnalysisTestSuite(t *testing.T) {
+	suite.Run(t, new(AnalysisTestSuite))
+}
@@ -0,0 +1,43 @@
+package analysis
+
+import (
+	"fmt"
+	"github.com/kage-cloud/kage/core/except"
+	"github.com/kage-cloud/kage/xds/pkg/model/consts"
+	"net/http"
+	"time"
+)
+
+// Scrapes the Prometheus stats of an Envoy admin server exposed through the kage-mesh stats listener.
+type StatsClient interface {
+	// Fetches the stats of the specified clusters from the stats listener at the address e.g. 10.0.0.1:15090.
+	Fetch(addr string, clusters ...string) (MeshStats, error)
+}
+
+type StatsClientSpec struct {
+	Timeout time.Duration
+}
+
+func NewStatsClient(spec *StatsClientSpec) StatsClient {
+	return &statsClient{
+		Client: &http.Client{Timeout: spec.Timeout},
+	}
+}
+
+type statsClient struct {
+	Client *http.Client
+}
+
+func (s *statsClient) Fetch(addr string, clusters ...string) (MeshStats, error) {
+	resp, err := s.Client.Get(fmt.Sprintf("http://%s%s", addr, consts.StatsPath))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, except.NewError("kage-mesh stats listener %s responded with %d", except.ErrInternalError, addr, resp.StatusCode)
+	}
+
+	return ParseStats(resp.Body, clusters...)
+}
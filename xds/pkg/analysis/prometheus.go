@@ -0,0 +1,202 @@
+package analysis
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/kage-cloud/kage/core/except"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"text/template"
+	"time"
+)
+
+const PrometheusProviderName = "prometheus"
+
+// A PromQL query which is evaluated against pass/fail thresholds. The query is a Go template which has access to the
+// Target e.g. sum(rate(http_requests_total{namespace="{{.Canary.Namespace}}",pod=~"{{.Canary.Name}}-.*"}[1m])).
+type PrometheusQuery struct {
+	Name  string
+	Query string
+
+	// The value returned by the query must be at least Min. Ignored if nil.
+	Min *float64
+
+	// The value returned by the query must be at most Max. Ignored if nil.
+	Max *float64
+}
+
+type PrometheusProviderSpec struct {
+	// The address of the Prometheus server e.g. http://prometheus:9090.
+	Address string
+	Timeout time.Duration
+	Queries []PrometheusQuery
+}
+
+func NewPrometheusProvider(spec *PrometheusProviderSpec) (Provider, error) {
+	queries := make([]prometheusQuery, 0, len(spec.Queries))
+	for _, v := range spec.Queries {
+		tmpl, err := template.New(v.Name).Parse(v.Query)
+		if err != nil {
+			return nil, except.NewError("invalid Prometheus query %s: %s", except.ErrInvalid, v.Name, err.Error())
+		}
+		queries = append(queries, prometheusQuery{PrometheusQuery: v, Template: tmpl})
+	}
+
+	return &prometheusProvider{
+		Address: spec.Address,
+		Client:  &http.Client{Timeout: spec.Timeout},
+		Queries: queries,
+	}, nil
+}
+
+type prometheusQuery struct {
+	PrometheusQuery
+	Template *template.Template
+}
+
+type prometheusProvider struct {
+	Address string
+	Client  *http.Client
+	Queries []prometheusQuery
+}
+
+type prometheusResponse struct {
+	Status    string         `json:"status"`
+	Error     string         `json:"error"`
+	ErrorType string         `json:"errorType"`
+	Data      prometheusData `json:"data"`
+}
+
+type prometheusData struct {
+	ResultType string          `json:"resultType"`
+	Result     json.RawMessage `json:"result"`
+}
+
+type prometheusSample struct {
+	Value []interface{} `json:"value"`
+}
+
+func (p *prometheusProvider) Name() string {
+	return PrometheusProviderName
+}
+
+func (p *prometheusProvider) Evaluate(target *Target) (*Result, error) {
+	results := make([]*Result, 0, len(p.Queries))
+	for _, q := range p.Queries {
+		if !selected(q.Name, target.Metrics) {
+			continue
+		}
+
+		res, err := p.evaluate(&q, target)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, res)
+	}
+
+	return Combine(results...), nil
+}
+
+func (p *prometheusProvider) evaluate(q *prometheusQuery, target *Target) (*Result, error) {
+	buf := bytes.NewBuffer([]byte{})
+	if err := q.Template.Execute(buf, target); err != nil {
+		return nil, except.NewError("failed to render Prometheus query %s: %s", except.ErrInvalid, q.Name, err.Error())
+	}
+
+	val, ok, err := p.query(buf.String())
+	if err != nil {
+		return nil, err
+	}
+
+	if !ok {
+		return &Result{
+			Verdict: VerdictInconclusive,
+			Reasons: []string{fmt.Sprintf("Prometheus query %s returned no data", q.Name)},
+		}, nil
+	}
+
+	if q.Min != nil && val < *q.Min {
+		return &Result{
+			Verdict: VerdictFail,
+			Reasons: []string{fmt.Sprintf("Prometheus query %s returned %g which is below the min of %g", q.Name, val, *q.Min)},
+		}, nil
+	}
+
+	if q.Max != nil && val > *q.Max {
+		return &Result{
+			Verdict: VerdictFail,
+			Reasons: []string{fmt.Sprintf("Prometheus query %s returned %g which is above the max of %g", q.Name, val, *q.Max)},
+		}, nil
+	}
+
+	return &Result{Verdict: VerdictPass, Reasons: []string{}}, nil
+}
+
+// Runs an instant query and returns the first value. If the query returned nothing, false is returned.
+func (p *prometheusProvider) query(query string) (float64, bool, error) {
+	u := fmt.Sprintf("%s/api/v1/query?%s", p.Address, url.Values{"query": []string{query}}.Encode())
+	resp, err := p.Client.Get(u)
+	if err != nil {
+		return 0, false, err
+	}
+	defer resp.Body.Close()
+
+	promResp := new(prometheusResponse)
+	if err := json.NewDecoder(resp.Body).Decode(promResp); err != nil {
+		return 0, false, except.NewError("unexpected response from Prometheus: %s", except.ErrInternalError, err.Error())
+	}
+
+	if promResp.Status != "success" {
+		return 0, false, except.NewError("Prometheus query failed with %s: %s", except.ErrInternalError, promResp.ErrorType, promResp.Error)
+	}
+
+	var sample []interface{}
+	switch promResp.Data.ResultType {
+	case "vector":
+		samples := make([]prometheusSample, 0)
+		if err := json.Unmarshal(promResp.Data.Result, &samples); err != nil {
+			return 0, false, err
+		}
+		if len(samples) == 0 {
+			return 0, false, nil
+		}
+		sample = samples[0].Value
+	case "scalar":
+		if err := json.Unmarshal(promResp.Data.Result, &sample); err != nil {
+			return 0, false, err
+		}
+	default:
+		return 0, false, except.NewError("unsupported Prometheus result type %s", except.ErrUnsupported, promResp.Data.ResultType)
+	}
+
+	if len(sample) != 2 {
+		return 0, false, nil
+	}
+
+	str, ok := sample[1].(string)
+	if !ok {
+		return 0, false, nil
+	}
+
+	val, err := strconv.ParseFloat(str, 64)
+	if err != nil {
+		return 0, false, except.NewError("Prometheus returned a non-numeric value %s", except.ErrInternalError, str)
+	}
+
+	return val, !math.IsNaN(val), nil
+}
+
+func selected(name string, metrics []string) bool {
+	if len(metrics) == 0 {
+		return true
+	}
+	for _, v := range metrics {
+		if v == name {
+			return true
+		}
+	}
+	return false
+}
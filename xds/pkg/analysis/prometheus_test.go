@@ -0,0 +1,234 @@
+package analysis
+
+import (
+	"fmt"
+	"github.com/kage-cloud/kage/xds/pkg/meta"
+	"github.com/stretchr/testify/suite"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type PrometheusTestSuite struct {
+	suite.Suite
+	Server  *httptest.Server
+	Queries map[string]string
+	Results map[string]string
+}
+
+func (p *PrometheusTestSuite) SetupTest() {
+	p.Queries = map[string]string{}
+	p.Results = map[string]string{}
+	p.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/query" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		query := r.URL.Query().Get("query")
+		p.Queries[query] = query
+		res, ok := p.Results[query]
+		if !ok {
+			res = `{"status":"success","data":{"resultType":"vector","result":[]}}`
+		}
+		_, _ = fmt.Fprint(w, res)
+	}))
+}
+
+func (p *PrometheusTestSuite) TearDownTest() {
+	p.Server.Close()
+}
+
+func (p *PrometheusTestSuite) TestEvaluatePass() {
+	// -- Given
+	//
+	max := 0.05
+	given := &PrometheusProviderSpec{
+		Address: p.Server.URL,
+		Timeout: time.Second,
+		Queries: []PrometheusQuery{
+			{Name: "error-rate", Query: `errors{namespace="{{.Canary.Namespace}}",name="{{.Canary.Name}}"}`, Max: &max},
+		},
+	}
+	p.Results[`errors{namespace="default",name="nginx-canary"}`] = vector("0.01")
+
+	provider, err := NewPrometheusProvider(given)
+	if !p.NoError(err) {
+		return
+	}
+
+	// -- When
+	//
+	actual, err := provider.Evaluate(target())
+
+	// -- Then
+	//
+	if p.NoError(err) {
+		p.Equal(VerdictPass, actual.Verdict)
+		p.Contains(p.Queries, `errors{namespace="default",name="nginx-canary"}`)
+	}
+}
+
+func (p *PrometheusTestSuite) TestEvaluateFailMax() {
+	// -- Given
+	//
+	max := 0.05
+	given := &PrometheusProviderSpec{
+		Address: p.Server.URL,
+		Timeout: time.Second,
+		Queries: []PrometheusQuery{
+			{Name: "error-rate", Query: `errors{name="{{.Canary.Name}}"}`, Max: &max},
+		},
+	}
+	p.Results[`errors{name="nginx-canary"}`] = vector("0.5")
+
+	provider, _ := NewPrometheusProvider(given)
+
+	// -- When
+	//
+	actual, err := provider.Evaluate(target())
+
+	// -- Then
+	//
+	if p.NoError(err) {
+		p.Equal(VerdictFail, actual.Verdict)
+		p.Len(actual.Reasons, 1)
+	}
+}
+
+func (p *PrometheusTestSuite) TestEvaluateFailMin() {
+	// -- Given
+	//
+	min := 0.99
+	given := &PrometheusProviderSpec{
+		Address: p.Server.URL,
+		Timeout: time.Second,
+		Queries: []PrometheusQuery{
+			{Name: "success-rate", Query: `success{name="{{.Source.Name}}"}`, Min: &min},
+		},
+	}
+	p.Results[`success{name="nginx"}`] = `{"status":"success","data":{"resultType":"scalar","result":[1435781451.781,"0.9"]}}`
+
+	provider, _ := NewPrometheusProvider(given)
+
+	// -- When
+	//
+	actual, err := provider.Evaluate(target())
+
+	// -- Then
+	//
+	if p.NoError(err) {
+		p.Equal(VerdictFail, actual.Verdict)
+	}
+}
+
+func (p *PrometheusTestSuite) TestEvaluateNoData() {
+	// -- Given
+	//
+	given := &PrometheusProviderSpec{
+		Address: p.Server.URL,
+		Timeout: time.Second,
+		Queries: []PrometheusQuery{
+			{Name: "latency", Query: `latency`},
+		},
+	}
+
+	provider, _ := NewPrometheusProvider(given)
+
+	// -- When
+	//
+	actual, err := provider.Evaluate(target())
+
+	// -- Then
+	//
+	if p.NoError(err) {
+		p.Equal(VerdictInconclusive, actual.Verdict)
+	}
+}
+
+func (p *PrometheusTestSuite) TestEvaluateSelectedMetrics() {
+	// -- Given
+	//
+	max := 0.05
+	given := &PrometheusProviderSpec{
+		Address: p.Server.URL,
+		Timeout: time.Second,
+		Queries: []PrometheusQuery{
+			{Name: "error-rate", Query: `errors`, Max: &max},
+			{Name: "latency", Query: `latency`, Max: &max},
+		},
+	}
+	p.Results[`errors`] = vector("0.01")
+	p.Results[`latency`] = vector("100")
+
+	provider, _ := NewPrometheusProvider(given)
+	t := target()
+	t.Metrics = []string{"error-rate"}
+
+	// -- When
+	//
+	actual, err := provider.Evaluate(t)
+
+	// -- Then
+	//
+	if p.NoError(err) {
+		p.Equal(VerdictPass, actual.Verdict)
+		p.NotContains(p.Queries, `latency`)
+	}
+}
+
+func (p *PrometheusTestSuite) TestEvaluateQueryError() {
+	// -- Given
+	//
+	given := &PrometheusProviderSpec{
+		Address: p.Server.URL,
+		Timeout: time.Second,
+		Queries: []PrometheusQuery{
+			{Name: "bad", Query: `sum(`},
+		},
+	}
+	p.Results[`sum(`] = `{"status":"error","errorType":"bad_data","error":"parse error"}`
+
+	provider, _ := NewPrometheusProvider(given)
+
+	// -- When
+	//
+	_, err := provider.Evaluate(target())
+
+	// -- Then
+	//
+	p.Error(err)
+}
+
+func (p *PrometheusTestSuite) TestNewPrometheusProviderBadTemplate() {
+	// -- Given
+	//
+	given := &PrometheusProviderSpec{
+		Queries: []PrometheusQuery{
+			{Name: "bad", Query: `{{.Canary.Name`},
+		},
+	}
+
+	// -- When
+	//
+	_, err := NewPrometheusProvider(given)
+
+	// -- Then
+	//
+	p.Error(err)
+}
+
+func target() *Target {
+	return TargetFromCanary(&meta.Canary{
+		SourceObj: meta.ObjRef{Name: "nginx", Kind: "Deployment", Namespace: "default"},
+		CanaryObj: meta.ObjRef{Name: "nginx-canary", Kind: "Deployment", Namespace: "default"},
+	})
+}
+
+func vector(val string) string {
+	return fmt.Sprintf(`{"status":"success","data":{"resultType":"vector","result":[{"metric":{},"value":[1435781451.781,"%s"]}]}}`, val)
+}
+
+func TestPrometheusTestSuite(t *testing.T) {
+	suite.Run(t, new(PrometheusTestSuite))
+}
@@ -0,0 +1,52 @@
+package analysis
+
+import (
+	"github.com/kage-cloud/kage/xds/pkg/meta"
+)
+
+// Evaluates a canary against an external source of metrics e.g. Prometheus.
+type Provider interface {
+	Name() string
+
+	// Evaluates the canary. An error is only returned if the provider could not be reached or the metrics could not be
+	// read. A canary with missing metrics is inconclusive.
+	Evaluate(target *Target) (*Result, error)
+}
+
+// The variables available to a provider's queries.
+type Target struct {
+	Source meta.ObjRef
+	Canary meta.ObjRef
+
+	// The names of the metrics to evaluate. If empty, all of the provider's metrics are evaluated.
+	Metrics []string
+}
+
+func TargetFromCanary(canary *meta.Canary) *Target {
+	return &Target{
+		Source:  canary.SourceObj,
+		Canary:  canary.CanaryObj,
+		Metrics: canary.Analysis.Metrics,
+	}
+}
+
+// Combines the results into a single result. A failure takes precedence over an inconclusive result which takes
+// precedence over a pass.
+func Combine(results ...*Result) *Result {
+	out := &Result{Verdict: VerdictPass, Reasons: []string{}}
+	for _, r := range results {
+		if r == nil {
+			continue
+		}
+		out.Reasons = append(out.Reasons, r.Reasons...)
+		switch r.Verdict {
+		case VerdictFail:
+			out.Verdict = VerdictFail
+		case VerdictInconclusive:
+			if out.Verdict != VerdictFail {
+				out.Verdict = VerdictInconclusive
+			}
+		}
+	}
+	return out
+}
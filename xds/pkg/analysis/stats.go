@@ -0,0 +1,335 @@
+package analysis
+
+import (
+	"bufio"
+	"github.com/kage-cloud/kage/xds/pkg/model"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The Prometheus names of the stats of the Envoy clusters. The cluster's name is the envoy_cluster_name label.
+const (
+	statRequestsCompleted = "envoy_cluster_upstream_rq_completed"
+	statRequestsByClass   = "envoy_cluster_upstream_rq_xx"
+	statRequestTimeBucket = "envoy_cluster_upstream_rq_time_bucket"
+	statRequestTimeCount  = "envoy_cluster_upstream_rq_time_count"
+
+	// The prefix of the stats recorded for each gRPC method. The service and method are either labels or part of the
+	// name depending on how Envoy could split them up e.g. envoy_cluster_grpc_total or envoy_cluster_grpc_SayHello_14.
+	statGrpcPrefix = "envoy_cluster_grpc_"
+	statGrpcTotal  = "total"
+
+	labelCluster           = "envoy_cluster_name"
+	labelResponseCodeClass = "envoy_response_code_class"
+	labelBucketUpperBound  = "le"
+)
+
+// The gRPC status codes which are the fault of the server, the same as a 5xx for HTTP. These are Unknown,
+// DeadlineExceeded, Unimplemented, Internal, Unavailable, and DataLoss.
+var grpcServerErrorCodes = map[string]bool{
+	"2":  true,
+	"4":  true,
+	"12": true,
+	"13": true,
+	"14": true,
+	"15": true,
+}
+
+// The stats for a single Envoy cluster scraped from the Envoy admin /stats/prometheus endpoint.
+type ClusterStats struct {
+	Name string `json:"name"`
+
+	// The number of requests which completed.
+	Requests uint64 `json:"requests"`
+
+	// The number of requests which failed.
+	Errors uint64 `json:"errors"`
+
+	// The request latencies in milliseconds.
+	Latency Histogram `json:"latency"`
+
+	// The number of gRPC requests which completed. gRPC failures are sent as a status in a successful HTTP response so
+	// they are counted separately.
+	GrpcRequests uint64 `json:"grpc_requests"`
+
+	// The number of gRPC requests which failed with a status that was the fault of the server.
+	GrpcErrors uint64 `json:"grpc_errors"`
+}
+
+// The percentage of requests which succeeded between 0 and 1. If the cluster served any gRPC requests, the gRPC status
+// codes are used rather than the HTTP status codes. If no requests were made, 1 is returned.
+func (c *ClusterStats) SuccessRate() float64 {
+	if c.GrpcRequests > 0 {
+		return 1 - float64(c.GrpcErrors)/float64(c.GrpcRequests)
+	}
+	if c.Requests == 0 {
+		return 1
+	}
+	return 1 - float64(c.Errors)/float64(c.Requests)
+}
+
+// Adds the other cluster's stats to this one.
+func (c *ClusterStats) Merge(other *ClusterStats) {
+	c.Requests += other.Requests
+	c.Errors += other.Errors
+	c.GrpcRequests += other.GrpcRequests
+	c.GrpcErrors += other.GrpcErrors
+	c.Latency.Merge(&other.Latency)
+}
+
+// Returns the stats accumulated since the previous stats were taken, including the latencies. Counters that have gone
+// backwards e.g. because Envoy restarted are treated as having started from zero.
+func (c *ClusterStats) Since(prev *ClusterStats) *ClusterStats {
+	out := &ClusterStats{
+		Name:         c.Name,
+		Requests:     c.Requests,
+		Errors:       c.Errors,
+		Latency:      c.Latency.copy(),
+		GrpcRequests: c.GrpcRequests,
+		GrpcErrors:   c.GrpcErrors,
+	}
+
+	if prev == nil || prev.Requests > c.Requests || prev.Errors > c.Errors ||
+		prev.GrpcRequests > c.GrpcRequests || prev.GrpcErrors > c.GrpcErrors {
+		return out
+	}
+
+	out.Requests -= prev.Requests
+	out.Errors -= prev.Errors
+	out.GrpcRequests -= prev.GrpcRequests
+	out.GrpcErrors -= prev.GrpcErrors
+	if latency, ok := c.Latency.since(&prev.Latency); ok {
+		out.Latency = latency
+	}
+	return out
+}
+
+// A cumulative histogram of values.
+type Histogram struct {
+	// Sorted by the upper bound. Does not include the +Inf bucket.
+	Buckets []Bucket `json:"buckets,omitempty"`
+
+	// The number of values recorded, the same as the count of the +Inf bucket.
+	Count uint64 `json:"count"`
+}
+
+type Bucket struct {
+	UpperBound float64 `json:"le"`
+
+	// The number of values at most the upper bound.
+	Count uint64 `json:"count"`
+}
+
+// Estimates the value at the percentile e.g. 99 for the P99 by interpolating within the bucket the percentile falls
+// into. Values above the highest bucket are estimated as its upper bound. Returns false if no values were recorded.
+func (h *Histogram) Percentile(percentile float64) (float64, bool) {
+	if h.Count == 0 || len(h.Buckets) == 0 {
+		return 0, false
+	}
+
+	rank := percentile / 100 * float64(h.Count)
+	lowerBound, lowerCount := float64(0), uint64(0)
+	for _, v := range h.Buckets {
+		if float64(v.Count) >= rank {
+			if v.Count == lowerCount {
+				return v.UpperBound, true
+			}
+			return lowerBound + (v.UpperBound-lowerBound)*(rank-float64(lowerCount))/float64(v.Count-lowerCount), true
+		}
+		lowerBound, lowerCount = v.UpperBound, v.Count
+	}
+
+	return h.Buckets[len(h.Buckets)-1].UpperBound, true
+}
+
+// Adds the counts of the other histogram's buckets to this one's.
+func (h *Histogram) Merge(other *Histogram) {
+	h.Count += other.Count
+	for _, v := range other.Buckets {
+		h.add(v.UpperBound, v.Count)
+	}
+}
+
+func (h *Histogram) add(upperBound float64, count uint64) {
+	idx := sort.Search(len(h.Buckets), func(i int) bool {
+		return h.Buckets[i].UpperBound >= upperBound
+	})
+	if idx < len(h.Buckets) && h.Buckets[idx].UpperBound == upperBound {
+		h.Buckets[idx].Count += count
+		return
+	}
+
+	h.Buckets = append(h.Buckets, Bucket{})
+	copy(h.Buckets[idx+1:], h.Buckets[idx:])
+	h.Buckets[idx] = Bucket{UpperBound: upperBound, Count: count}
+}
+
+// The values recorded since the previous histogram. Returns false if any of the counts went backwards.
+func (h *Histogram) since(prev *Histogram) (Histogram, bool) {
+	if prev.Count > h.Count {
+		return Histogram{}, false
+	}
+
+	prevCounts := make(map[float64]uint64, len(prev.Buckets))
+	for _, v := range prev.Buckets {
+		prevCounts[v.UpperBound] = v.Count
+	}
+
+	out := Histogram{Count: h.Count - prev.Count, Buckets: make([]Bucket, 0, len(h.Buckets))}
+	for _, v := range h.Buckets {
+		if prevCounts[v.UpperBound] > v.Count {
+			return Histogram{}, false
+		}
+		out.Buckets = append(out.Buckets, Bucket{UpperBound: v.UpperBound, Count: v.Count - prevCounts[v.UpperBound]})
+	}
+	return out, true
+}
+
+func (h *Histogram) copy() Histogram {
+	out := Histogram{Count: h.Count}
+	if h.Buckets != nil {
+		out.Buckets = append([]Bucket{}, h.Buckets...)
+	}
+	return out
+}
+
+// ClusterStats indexed by the cluster name.
+type MeshStats map[string]*ClusterStats
+
+func (m MeshStats) Merge(other MeshStats) {
+	for k, v := range other {
+		if cur, ok := m[k]; ok {
+			cur.Merge(v)
+		} else {
+			m[k] = &ClusterStats{Name: v.Name}
+			m[k].Merge(v)
+		}
+	}
+}
+
+func (m MeshStats) Since(prev MeshStats) MeshStats {
+	out := MeshStats{}
+	for k, v := range m {
+		out[k] = v.Since(prev[k])
+	}
+	return out
+}
+
+// Parses the Prometheus text output of the Envoy admin /stats/prometheus endpoint. Only the stats for the specified
+// clusters are returned. The stats of every gRPC method of a cluster, and of the clusters serving each of its ports, are
+// summed.
+func ParseStats(r io.Reader, clusters ...string) (MeshStats, error) {
+	stats := MeshStats{}
+	for _, v := range clusters {
+		stats[v] = &ClusterStats{Name: v}
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		name, labels, val, ok := parseSample(scanner.Text())
+		if !ok {
+			continue
+		}
+
+		cluster := labels[labelCluster]
+		if v, _, ok := model.SplitPortName(cluster); ok {
+			cluster = v
+		}
+
+		cs, ok := stats[cluster]
+		if !ok {
+			continue
+		}
+
+		switch name {
+		case statRequestsCompleted:
+			cs.Requests += parseCount(val)
+		case statRequestsByClass:
+			if labels[labelResponseCodeClass] == "5" {
+				cs.Errors += parseCount(val)
+			}
+		case statRequestTimeBucket:
+			upperBound, err := strconv.ParseFloat(labels[labelBucketUpperBound], 64)
+			if err == nil && !math.IsInf(upperBound, 1) {
+				cs.Latency.add(upperBound, parseCount(val))
+			}
+		case statRequestTimeCount:
+			cs.Latency.Count += parseCount(val)
+		default:
+			if strings.HasPrefix(name, statGrpcPrefix) {
+				parseGrpcStat(cs, name, val)
+			}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
+
+// Splits a sample such as envoy_cluster_upstream_rq_completed{envoy_cluster_name="source"} 10 into its name, labels,
+// and value. Returns false for comments and blank lines.
+func parseSample(line string) (string, map[string]string, string, bool) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return "", nil, "", false
+	}
+
+	labels := map[string]string{}
+	nameEnd := strings.IndexAny(line, "{ ")
+	if nameEnd < 0 {
+		return "", nil, "", false
+	}
+	name, rest := line[:nameEnd], line[nameEnd:]
+
+	if strings.HasPrefix(rest, "{") {
+		labelsEnd := strings.LastIndex(rest, "}")
+		if labelsEnd < 0 {
+			return "", nil, "", false
+		}
+		for _, pair := range strings.Split(rest[1:labelsEnd], ",") {
+			eq := strings.Index(pair, "=")
+			if eq < 0 {
+				continue
+			}
+			labels[strings.TrimSpace(pair[:eq])] = strings.Trim(strings.TrimSpace(pair[eq+1:]), `"`)
+		}
+		rest = rest[labelsEnd+1:]
+	}
+
+	fields := strings.Fields(rest)
+	if len(fields) == 0 {
+		return "", nil, "", false
+	}
+
+	return name, labels, fields[0], true
+}
+
+func parseCount(val string) uint64 {
+	f, err := strconv.ParseFloat(val, 64)
+	if err != nil || f < 0 || math.IsNaN(f) {
+		return 0
+	}
+	return uint64(f)
+}
+
+// Adds the gRPC method's stat to the cluster's gRPC requests if it is the total or to its errors if it is the count of
+// a server error status code.
+func parseGrpcStat(cs *ClusterStats, name, val string) {
+	stat := name[strings.LastIndex(name, "_")+1:]
+	if stat != statGrpcTotal && !grpcServerErrorCodes[stat] {
+		return
+	}
+
+	if stat == statGrpcTotal {
+		cs.GrpcRequests += parseCount(val)
+	} else {
+		cs.GrpcErrors += parseCount(val)
+	}
+}
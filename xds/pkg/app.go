@@ -1,13 +1,16 @@
 package pkg
 
 import (
+	"context"
 	"fmt"
 	"github.com/eddieowens/axon"
 	"github.com/kage-cloud/kage/core/except"
 	"github.com/kage-cloud/kage/xds/pkg/config"
 	"github.com/kage-cloud/kage/xds/pkg/controller"
 	"github.com/kage-cloud/kage/xds/pkg/controlplane"
+	"github.com/kage-cloud/kage/xds/pkg/kubeinformer"
 	"github.com/kage-cloud/kage/xds/pkg/service"
+	"github.com/kage-cloud/kage/xds/pkg/webhook"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 	log "github.com/sirupsen/logrus"
@@ -22,10 +25,12 @@ type App interface {
 }
 
 type app struct {
-	Controllers       []axon.Instance          `inject:"Controllers"`
-	Config            *config.Config           `inject:"Config"`
-	EnvoyControlPlane controlplane.Envoy       `inject:"EnvoyControlPlane"`
-	StateSyncService  service.StateSyncService `inject:"StateSyncService"`
+	Controllers       []axon.Instance        `inject:"Controllers"`
+	Config            *config.Config         `inject:"Config"`
+	EnvoyControlPlane controlplane.Envoy     `inject:"EnvoyControlPlane"`
+	KubeControllers   []axon.Instance        `inject:"KubeControllers"`
+	RolloutService    service.RolloutService `inject:"RolloutService"`
+	WebhookServer     webhook.Server         `inject:"WebhookServer"`
 }
 
 func (a *app) Start() error {
@@ -33,7 +38,17 @@ func (a *app) Start() error {
 		return err
 	}
 
-	if err := a.StateSyncService.Start(); err != nil {
+	for _, v := range a.KubeControllers {
+		if err := v.GetStructPtr().(kubeinformer.Interface).Inform(context.Background()); err != nil {
+			return err
+		}
+	}
+
+	if err := a.RolloutService.Start(); err != nil {
+		return err
+	}
+
+	if err := a.WebhookServer.StartAsync(); err != nil {
 		return err
 	}
 
@@ -3,21 +3,28 @@ package config
 import (
 	"bytes"
 	"github.com/eddieowens/axon"
+	"github.com/kage-cloud/kage/core/except"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
 	"gopkg.in/yaml.v2"
 	"k8s.io/client-go/tools/clientcmd"
 	"os"
 	"strings"
+	"text/template"
+	"time"
 )
 
 const ConfigKey = "Config"
 
 type Config struct {
-	Server Server `mapstructure:"server"`
-	Kube   Kube   `mapstructure:"kube"`
-	Xds    Xds    `mapstructure:"xds"`
-	Log    Log    `mapstructure:"log"`
+	Server   Server   `mapstructure:"server"`
+	Kube     Kube     `mapstructure:"kube"`
+	Xds      Xds      `mapstructure:"xds"`
+	Log      Log      `mapstructure:"log"`
+	Analysis Analysis `mapstructure:"analysis"`
+	Webhook  Webhook  `mapstructure:"webhook"`
+
+	Resiliency Resiliency `mapstructure:"resiliency"`
 }
 
 type Log struct {
@@ -33,12 +40,115 @@ type Kube struct {
 	Config    string `mapstructure:"config"`
 	Context   string `mapstructure:"context"`
 	Namespace string `mapstructure:"namespace"`
+
+	// The rate and burst of Kubernetes Events recorded across all objects.
+	EventQps   float32 `mapstructure:"eventqps"`
+	EventBurst int     `mapstructure:"eventburst"`
 }
 
 type Xds struct {
 	Port      uint16 `mapstructure:"port"`
 	Address   string `mapstructure:"address"`
 	AdminPort uint16 `mapstructure:"adminport"`
+
+	// The port of the kage-mesh listener which only serves the Prometheus stats of the Envoy admin server. The admin
+	// server itself only listens on localhost.
+	StatsPort uint16 `mapstructure:"statsport"`
+
+	// How long to wait for an Envoy to ACK a snapshot before giving up.
+	AckTimeout time.Duration `mapstructure:"acktimeout"`
+
+	// Serves every resource over a single ADS stream so Envoy applies the updates in order. Only kage-meshes created
+	// or restarted after switching modes pick up the change.
+	Ads bool `mapstructure:"ads"`
+
+	// Has the kage-meshes request only the resources which changed instead of every resource on each update. The
+	// control plane always serves both protocols so kage-meshes created before switching keep using the
+	// state-of-the-world protocol until they are restarted.
+	Delta bool `mapstructure:"delta"`
+
+	// Serves xDS over mutual TLS. Every kage-mesh is issued a client certificate for its node ID and streams for any
+	// other node ID are rejected. Kage-meshes created before enabling TLS are issued a certificate the next time one of
+	// their variants is added or removed.
+	Tls XdsTls `mapstructure:"tls"`
+}
+
+// The certificates of the xDS server. If any of the files are empty, a CA and server certificate are generated and
+// stored in the Secret in the control plane's namespace.
+type XdsTls struct {
+	Enabled bool `mapstructure:"enabled"`
+
+	CertFile string `mapstructure:"certfile"`
+	KeyFile  string `mapstructure:"keyfile"`
+
+	// The CA which signs the kage-meshes' client certificates. The server's certificate must be signed by it too as
+	// the kage-meshes only trust the CA.
+	CaFile    string `mapstructure:"cafile"`
+	CaKeyFile string `mapstructure:"cakeyfile"`
+
+	SecretName string `mapstructure:"secretname"`
+}
+
+// The HTTPS server for the validating admission webhook. Disabled if either the cert or key file is empty.
+type Webhook struct {
+	Port     uint16 `mapstructure:"port"`
+	CertFile string `mapstructure:"certfile"`
+	KeyFile  string `mapstructure:"keyfile"`
+}
+
+// The default timeouts, retries, and circuit breakers of the source and canary clusters. Each can be overridden by the
+// canary's annotations.
+type Resiliency struct {
+	Timeout            time.Duration `mapstructure:"timeout"`
+	RetryOn            []string      `mapstructure:"retryon"`
+	NumRetries         uint32        `mapstructure:"numretries"`
+	MaxConnections     uint32        `mapstructure:"maxconnections"`
+	MaxPendingRequests uint32        `mapstructure:"maxpendingrequests"`
+	MaxRequests        uint32        `mapstructure:"maxrequests"`
+}
+
+// The default thresholds used when analysing a canary. Each can be overridden by the canary's annotations.
+type Analysis struct {
+	MinRequests          uint64        `mapstructure:"minrequests"`
+	MaxSuccessRateDrop   float64       `mapstructure:"maxsuccessratedrop"`
+	LatencyPercentile    float64       `mapstructure:"latencypercentile"`
+	MaxLatencyIncreaseMs float64       `mapstructure:"maxlatencyincreasems"`
+	ScrapeTimeout        time.Duration `mapstructure:"scrapetimeout"`
+	Prometheus           Prometheus    `mapstructure:"prometheus"`
+}
+
+// Analyses canaries using PromQL queries. Disabled if the address is empty.
+type Prometheus struct {
+	Address string            `mapstructure:"address"`
+	Timeout time.Duration     `mapstructure:"timeout"`
+	Queries []PrometheusQuery `mapstructure:"queries"`
+}
+
+type PrometheusQuery struct {
+	Name  string   `mapstructure:"name"`
+	Query string   `mapstructure:"query"`
+	Min   *float64 `mapstructure:"min"`
+	Max   *float64 `mapstructure:"max"`
+}
+
+// Checks the parts of the config which would otherwise only fail once they are used. Every Prometheus query must have
+// a unique name and be a valid Go template.
+func (c *Config) Validate() error {
+	names := map[string]bool{}
+	for i, v := range c.Analysis.Prometheus.Queries {
+		if v.Name == "" {
+			return except.NewError("Prometheus query %d has no name", except.ErrInvalid, i)
+		}
+		if names[v.Name] {
+			return except.NewError("Prometheus query %s is defined more than once", except.ErrInvalid, v.Name)
+		}
+		names[v.Name] = true
+
+		if _, err := template.New(v.Name).Parse(v.Query); err != nil {
+			return except.NewError("invalid Prometheus query %s: %s", except.ErrInvalid, v.Name, err.Error())
+		}
+	}
+	return nil
 }
 
 func defaultConfig() *Config {
@@ -47,12 +157,40 @@ func defaultConfig() *Config {
 			Port: 8080,
 		},
 		Xds: Xds{
-			Port:      8081,
-			Address:   "0.0.0.0",
-			AdminPort: 8082,
+			Port:       8081,
+			Address:    "0.0.0.0",
+			AdminPort:  8082,
+			StatsPort:  15090,
+			AckTimeout: 30 * time.Second,
+			Tls: XdsTls{
+				SecretName: "kage-xds-tls",
+			},
 		},
 		Kube: Kube{
-			Config: clientcmd.RecommendedHomeFile,
+			Config:     clientcmd.RecommendedHomeFile,
+			EventQps:   10,
+			EventBurst: 50,
+		},
+		Webhook: Webhook{
+			Port: 8443,
+		},
+		Resiliency: Resiliency{
+			Timeout:            15 * time.Second,
+			RetryOn:            []string{"connect-failure", "refused-stream", "unavailable"},
+			NumRetries:         1,
+			MaxConnections:     1024,
+			MaxPendingRequests: 1024,
+			MaxRequests:        1024,
+		},
+		Analysis: Analysis{
+			MinRequests:          20,
+			MaxSuccessRateDrop:   0.01,
+			LatencyPercentile:    99,
+			MaxLatencyIncreaseMs: 100,
+			ScrapeTimeout:        5 * time.Second,
+			Prometheus: Prometheus{
+				Timeout: 10 * time.Second,
+			},
 		},
 	}
 }
@@ -87,5 +225,9 @@ func configFactory(_ axon.Injector, _ axon.Args) axon.Instance {
 		log.Fatal(err)
 	}
 
+	if err := config.Validate(); err != nil {
+		log.Fatal(err)
+	}
+
 	return axon.Any(config)
 }
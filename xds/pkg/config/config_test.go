@@ -0,0 +1,70 @@
+package config
+
+import (
+	"github.com/kage-cloud/kage/core/except"
+	"github.com/stretchr/testify/suite"
+	"testing"
+)
+
+type ConfigTestSuite struct {
+	suite.Suite
+}
+
+func (c *ConfigTestSuite) TestValidate() {
+	// -- Given
+	//
+	given := defaultConfig()
+	given.Analysis.Prometheus.Queries = []PrometheusQuery{
+		{Name: "error-rate", Query: `sum(rate(requests_total{pod=~"{{.Canary.Name}}-.*"}[1m]))`},
+	}
+
+	// -- When
+	//
+	err := given.Validate()
+
+	// -- Then
+	//
+	c.NoError(err)
+}
+
+func (c *ConfigTestSuite) TestValidateInvalidQuery() {
+	// -- Given
+	//
+	given := defaultConfig()
+	given.Analysis.Prometheus.Queries = []PrometheusQuery{
+		{Name: "error-rate", Query: `sum(rate(requests_total{pod=~"{{.Canary.Name"}[1m]))`},
+	}
+
+	// -- When
+	//
+	err := given.Validate()
+
+	// -- Then
+	//
+	if c.Error(err) {
+		c.Equal(except.ErrInvalid, except.Reason(err))
+		c.Contains(err.Error(), "invalid Prometheus query error-rate")
+	}
+}
+
+func (c *ConfigTestSuite) TestValidateDuplicateQuery() {
+	// -- Given
+	//
+	given := defaultConfig()
+	given.Analysis.Prometheus.Queries = []PrometheusQuery{
+		{Name: "error-rate", Query: "1"},
+		{Name: "error-rate", Query: "2"},
+	}
+
+	// -- When
+	//
+	err := given.Validate()
+
+	// -- Then
+	//
+	c.Equal(except.ErrInvalid, except.Reason(err))
+}
+
+func TestConfigTestSuite(t *testing.T) {
+	suite.Run(t, new(ConfigTestSuite))
+}
@@ -3,11 +3,13 @@ package controller
 import (
 	"github.com/gogo/protobuf/jsonpb"
 	"github.com/kage-cloud/kage/core/kube/kconfig"
+	"github.com/kage-cloud/kage/xds/pkg/controlplane"
 	"github.com/kage-cloud/kage/xds/pkg/exchange"
 	"github.com/kage-cloud/kage/xds/pkg/service"
 	"github.com/kage-cloud/kage/xds/pkg/snap"
 	"github.com/labstack/echo/v4"
 	"net/http"
+	"sort"
 )
 
 const AdminControllerKey = "AdminController"
@@ -15,11 +17,15 @@ const AdminControllerKey = "AdminController"
 type AdminController interface {
 	Controller
 	Get(ctx echo.Context) error
+	ListVersions(ctx echo.Context) error
+	ListNodes(ctx echo.Context) error
 }
 
 type adminController struct {
+	CanaryService   service.CanaryService   `inject:"CanaryService"`
 	KageMeshService service.KageMeshService `inject:"KageMeshService"`
 	StoreClient     snap.StoreClient        `inject:"StoreClient"`
+	AckTracker      controlplane.AckTracker `inject:"AckTracker"`
 }
 
 func (a *adminController) Routes() []Route {
@@ -29,6 +35,16 @@ func (a *adminController) Routes() []Route {
 			Method:  http.MethodGet,
 			Path:    "/:namespace/:canary_name",
 		},
+		{
+			Handler: a.ListVersions,
+			Method:  http.MethodGet,
+			Path:    "/versions",
+		},
+		{
+			Handler: a.ListNodes,
+			Method:  http.MethodGet,
+			Path:    "/nodes",
+		},
 	}
 }
 
@@ -42,12 +58,17 @@ func (a *adminController) Get(ctx echo.Context) error {
 		return err
 	}
 
-	v, err := a.KageMeshService.Fetch(req.CanaryName, kconfig.Opt{Namespace: req.Namespace})
+	canary, err := a.CanaryService.Get(req.CanaryName, kconfig.Opt{Namespace: req.Namespace})
 	if err != nil {
 		return err
 	}
 
-	state, err := a.StoreClient.Get(v.MeshConfig.NodeId)
+	xdsAnno, err := a.KageMeshService.FetchForCanary(canary)
+	if err != nil {
+		return err
+	}
+
+	state, err := a.StoreClient.Get(xdsAnno.Config.NodeId)
 	if err != nil {
 		return err
 	}
@@ -59,3 +80,58 @@ func (a *adminController) Get(ctx echo.Context) error {
 
 	return ctx.JSONBlob(http.StatusOK, []byte(str))
 }
+
+func (a *adminController) ListVersions(ctx echo.Context) error {
+	states := a.StoreClient.List()
+
+	resp := &exchange.ListNodeVersionsResponse{Data: make([]exchange.NodeVersions, 0, len(states))}
+	for nodeId, state := range states {
+		versions := exchange.NodeVersions{
+			NodeId:    nodeId,
+			Versions:  state.Versions,
+			UpdatedAt: state.CreationTimestampUtc,
+		}
+
+		snapshot, err := a.StoreClient.SnapshotCache().GetSnapshot(nodeId)
+		if err == nil {
+			err = snap.Consistent(&snapshot)
+		}
+		if err != nil {
+			versions.ConsistencyError = err.Error()
+		}
+
+		resp.Data = append(resp.Data, versions)
+	}
+
+	sort.Slice(resp.Data, func(i, j int) bool {
+		return resp.Data[i].NodeId < resp.Data[j].NodeId
+	})
+
+	return ctx.JSON(http.StatusOK, resp)
+}
+
+func (a *adminController) ListNodes(ctx echo.Context) error {
+	nodes := a.AckTracker.Nodes()
+
+	resp := &exchange.ListNodesResponse{Data: make([]exchange.NodeDetails, len(nodes))}
+	for i, node := range nodes {
+		details := exchange.NodeDetails{
+			NodeId:       node.Id,
+			EnvoyVersion: node.EnvoyVersion,
+			ConnectedAt:  node.ConnectedAt,
+			Acks:         make(map[string]exchange.AckDetails, len(node.Acks)),
+		}
+		for typeUrl, ack := range node.Acks {
+			details.Acks[typeUrl] = exchange.AckDetails{
+				Version:  ack.Version,
+				Rejected: ack.Rejected,
+				Nacked:   ack.Nacked,
+				Error:    ack.Detail,
+				At:       ack.At,
+			}
+		}
+		resp.Data[i] = details
+	}
+
+	return ctx.JSON(http.StatusOK, resp)
+}
@@ -1,9 +1,15 @@
 package controller
 
 import (
+	"github.com/kage-cloud/kage/core/except"
+	"github.com/kage-cloud/kage/core/kube/kconfig"
+	"github.com/kage-cloud/kage/core/kube/ktypes"
 	"github.com/kage-cloud/kage/xds/pkg/exchange"
+	"github.com/kage-cloud/kage/xds/pkg/meta"
 	"github.com/kage-cloud/kage/xds/pkg/service"
+	"github.com/kage-cloud/kage/xds/pkg/snap"
 	"github.com/labstack/echo/v4"
+	"k8s.io/apimachinery/pkg/api/errors"
 	"net/http"
 )
 
@@ -11,16 +17,71 @@ const CanaryControllerKey = "CanaryController"
 
 type CanaryController interface {
 	Controller
-	Create(ctx echo.Context) error
-	Delete(ctx echo.Context) error
+	Promote(ctx echo.Context) error
+	Abort(ctx echo.Context) error
+	List(ctx echo.Context) error
+	Get(ctx echo.Context) error
+	DirectTraffic(ctx echo.Context) error
+	ToggleFaults(ctx echo.Context) error
 }
 
 type canaryController struct {
-	CanaryControllerService service.CanaryControllerService `inject:"CanaryControllerService"`
+	CanaryService       service.CanaryService       `inject:"CanaryService"`
+	CanaryStatusService service.CanaryStatusService `inject:"CanaryStatusService"`
+	KageMeshService     service.KageMeshService     `inject:"KageMeshService"`
+	KubeReaderService   service.KubeReaderService   `inject:"KubeReaderService"`
+	EnvoyStateService   service.EnvoyStateService   `inject:"EnvoyStateService"`
+	StoreClient         snap.StoreClient            `inject:"StoreClient"`
 }
 
-func (c *canaryController) Create(ctx echo.Context) error {
-	req := new(exchange.CreateCanaryRequest)
+func (c *canaryController) List(ctx echo.Context) error {
+	req := new(exchange.ListCanariesRequest)
+	if err := ctx.Bind(req); err != nil {
+		return err
+	}
+
+	canaries, err := c.CanaryService.List(kconfig.Opt{Namespace: req.Namespace})
+	if err != nil {
+		return err
+	}
+
+	res := &exchange.ListCanariesResponse{Data: make([]exchange.CanaryDetails, 0, len(canaries))}
+	for i := range canaries {
+		details, err := c.details(&canaries[i])
+		if err != nil {
+			return err
+		}
+		res.Data = append(res.Data, *details)
+	}
+
+	return ctx.JSON(http.StatusOK, res)
+}
+
+func (c *canaryController) Get(ctx echo.Context) error {
+	req := new(exchange.GetCanaryRequest)
+	if err := ctx.Bind(req); err != nil {
+		return err
+	}
+
+	if err := req.Validate(); err != nil {
+		return err
+	}
+
+	canary, err := c.CanaryService.Get(req.Name, kconfig.Opt{Namespace: req.Namespace})
+	if err != nil {
+		return err
+	}
+
+	details, err := c.details(canary)
+	if err != nil {
+		return err
+	}
+
+	return ctx.JSON(http.StatusOK, &exchange.GetCanaryResponse{Data: details})
+}
+
+func (c *canaryController) DirectTraffic(ctx echo.Context) error {
+	req := new(exchange.DirectTrafficRequest)
 	if err := ctx.Bind(req); err != nil {
 		return err
 	}
@@ -29,39 +90,182 @@ func (c *canaryController) Create(ctx echo.Context) error {
 		return err
 	}
 
-	res, err := c.CanaryControllerService.Create(req)
+	canary, err := c.CanaryService.Get(req.Name, kconfig.Opt{Namespace: req.Namespace})
+	if err != nil {
+		return err
+	}
+
+	if err := c.CanaryService.SetRoutingPercentage(canary, *req.Percentage); err != nil {
+		return err
+	}
+
+	details, err := c.details(canary)
 	if err != nil {
 		return err
 	}
 
-	return ctx.JSON(http.StatusCreated, res)
+	return ctx.JSON(http.StatusOK, &exchange.DirectTrafficResponse{Data: details})
 }
 
-func (c *canaryController) Delete(ctx echo.Context) error {
-	req := new(exchange.DeleteCanaryRequest)
+func (c *canaryController) ToggleFaults(ctx echo.Context) error {
+	req := new(exchange.ToggleFaultsRequest)
 	if err := ctx.Bind(req); err != nil {
 		return err
 	}
 
-	err := c.CanaryControllerService.Delete(req)
+	if err := req.Validate(); err != nil {
+		return err
+	}
+
+	canary, err := c.CanaryService.Get(req.Name, kconfig.Opt{Namespace: req.Namespace})
 	if err != nil {
 		return err
 	}
 
+	if err := c.CanaryService.SetFaultsEnabled(canary, *req.Enabled); err != nil {
+		return err
+	}
+
+	details, err := c.details(canary)
+	if err != nil {
+		return err
+	}
+
+	return ctx.JSON(http.StatusOK, &exchange.ToggleFaultsResponse{Data: details})
+}
+
+// The weight is read from the kage-mesh's routes, falling back on the recorded status if the kage-mesh has not been
+// created yet.
+func (c *canaryController) details(canary *meta.Canary) (*exchange.CanaryDetails, error) {
+	opt := kconfig.Opt{Namespace: canary.CanaryObj.Namespace}
+	obj, err := c.KubeReaderService.Get(canary.CanaryObj.Name, ktypes.Kind(canary.CanaryObj.Kind), opt)
+	if err != nil {
+		return nil, err
+	}
+
+	status, err := c.CanaryStatusService.Fetch(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	details := &exchange.CanaryDetails{
+		Source:        exchange.ObjRef(canary.SourceObj),
+		Canary:        exchange.ObjRef(canary.CanaryObj),
+		NodeId:        status.NodeId,
+		Weight:        status.Weight,
+		Phase:         string(status.Phase),
+		FaultsEnabled: canary.Faults.Enabled,
+	}
+
+	xdsAnno, err := c.KageMeshService.FetchForCanary(canary)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return details, nil
+		}
+		return nil, err
+	}
+	details.NodeId = xdsAnno.Config.NodeId
+
+	state, err := c.StoreClient.Get(xdsAnno.Config.NodeId)
+	if err != nil {
+		if except.Reason(err) == except.ErrNotFound {
+			return details, nil
+		}
+		return nil, err
+	}
+
+	cluster, ok := xdsAnno.Config.VariantCluster(canary.CanaryObj.Name)
+	if !ok {
+		return details, nil
+	}
+
+	weight, err := c.EnvoyStateService.FetchClusterWeight(state, &xdsAnno.Config, cluster)
+	if err != nil {
+		if except.Reason(err) == except.ErrNotFound {
+			return details, nil
+		}
+		return nil, err
+	}
+	details.Weight = weight
+
+	return details, nil
+}
+
+func (c *canaryController) Promote(ctx echo.Context) error {
+	req := new(exchange.PromoteCanaryRequest)
+	if err := ctx.Bind(req); err != nil {
+		return err
+	}
+
+	if err := req.Validate(); err != nil {
+		return err
+	}
+
+	canary, err := c.CanaryService.Get(req.Name, kconfig.Opt{Namespace: req.Namespace})
+	if err != nil {
+		return err
+	}
+
+	if err := c.CanaryService.Promote(canary); err != nil {
+		return err
+	}
+
+	return ctx.NoContent(http.StatusOK)
+}
+
+func (c *canaryController) Abort(ctx echo.Context) error {
+	req := new(exchange.AbortCanaryRequest)
+	if err := ctx.Bind(req); err != nil {
+		return err
+	}
+
+	if err := req.Validate(); err != nil {
+		return err
+	}
+
+	canary, err := c.CanaryService.Get(req.Name, kconfig.Opt{Namespace: req.Namespace})
+	if err != nil {
+		return err
+	}
+
+	if err := c.CanaryService.Abort(canary, req.Reason); err != nil {
+		return err
+	}
+
 	return ctx.NoContent(http.StatusOK)
 }
 
 func (c *canaryController) Routes() []Route {
 	return []Route{
+		{
+			Path:    "",
+			Method:  http.MethodGet,
+			Handler: c.List,
+		},
 		{
 			Path:    "/:namespace/:name",
-			Method:  http.MethodPost,
-			Handler: c.Create,
+			Method:  http.MethodGet,
+			Handler: c.Get,
 		},
 		{
 			Path:    "/:namespace/:name",
-			Method:  http.MethodDelete,
-			Handler: c.Delete,
+			Method:  http.MethodPatch,
+			Handler: c.DirectTraffic,
+		},
+		{
+			Path:    "/:namespace/:name/promote",
+			Method:  http.MethodPost,
+			Handler: c.Promote,
+		},
+		{
+			Path:    "/:namespace/:name/abort",
+			Method:  http.MethodPost,
+			Handler: c.Abort,
+		},
+		{
+			Path:    "/:namespace/:name/faults",
+			Method:  http.MethodPut,
+			Handler: c.ToggleFaults,
 		},
 	}
 }
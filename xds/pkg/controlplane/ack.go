@@ -0,0 +1,276 @@
+package controlplane
+
+import (
+	"fmt"
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	discovery "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
+	"github.com/kage-cloud/kage/core/except"
+	"sort"
+	"sync"
+	"time"
+)
+
+const AckTrackerKey = "AckTracker"
+
+// Tracks every Envoy connected to the control plane and the snapshot versions each has ACKed or NACKed.
+type AckTracker interface {
+	// Blocks until the Envoy with the node ID ACKs the version of the resource type. Returns an error if the version is
+	// NACKed, the timeout is reached, or if no Envoy with the node ID is connected. A NACK of the version is caught even
+	// if it was recorded before waiting started.
+	WaitForAck(nodeId, typeUrl, version string, timeout time.Duration) error
+
+	// Every connected Envoy sorted by the node ID.
+	Nodes() []Node
+
+	OnStreamOpen(streamId int64)
+	OnStreamClosed(streamId int64)
+	OnStreamRequest(streamId int64, req *discovery.DiscoveryRequest)
+
+	// Records the version sent with the nonce of the response so a NACK of the nonce can be matched to the version.
+	OnStreamResponse(streamId int64, res *discovery.DiscoveryResponse)
+}
+
+// An Envoy connected to the control plane.
+type Node struct {
+	Id string
+
+	// The version of Envoy from the node's metadata. Empty if the Envoy did not send it.
+	EnvoyVersion string
+
+	// When the oldest open stream of the node was opened.
+	ConnectedAt time.Time
+
+	// The latest ACK or NACK of every resource type indexed by the type URL.
+	Acks map[string]Ack
+}
+
+type Ack struct {
+	// For a NACK, this is the last version the Envoy accepted rather than the rejected version.
+	Version string
+
+	// For a NACK, the version which was rejected. Empty if the response which was NACKed is unknown.
+	Rejected string
+
+	Nacked bool
+	Detail string
+	At     time.Time
+
+	// The order in which the ACK or NACK was recorded.
+	seq uint64
+}
+
+type stream struct {
+	// Empty until the first request of the stream.
+	nodeId   string
+	openedAt time.Time
+
+	// The responses which have not been answered yet in the order they were sent indexed by the type URL.
+	sent map[string][]sentResponse
+}
+
+type sentResponse struct {
+	nonce   string
+	version string
+}
+
+type ackTracker struct {
+	// Every open stream indexed by the stream ID.
+	streams map[int64]*stream
+
+	// The latest ACK or NACK of every resource type indexed by the node ID and then the type URL.
+	acks map[string]map[string]Ack
+
+	// The Envoy version of every node indexed by the node ID.
+	envoyVersions map[string]string
+
+	// Closed and replaced whenever an ACK or NACK is recorded.
+	changed chan struct{}
+
+	seq uint64
+
+	lock sync.Mutex
+}
+
+func NewAckTracker() AckTracker {
+	return &ackTracker{
+		streams:       map[int64]*stream{},
+		acks:          map[string]map[string]Ack{},
+		envoyVersions: map[string]string{},
+		changed:       make(chan struct{}),
+	}
+}
+
+func (a *ackTracker) OnStreamOpen(streamId int64) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.streams[streamId] = &stream{openedAt: time.Now().UTC(), sent: map[string][]sentResponse{}}
+}
+
+func (a *ackTracker) OnStreamClosed(streamId int64) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	delete(a.streams, streamId)
+	a.notify()
+}
+
+func (a *ackTracker) OnStreamRequest(streamId int64, req *discovery.DiscoveryRequest) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	s, ok := a.streams[streamId]
+	if !ok {
+		return
+	}
+
+	// The node is only guaranteed to be on the first request of a stream.
+	if req.GetNode().GetId() != "" {
+		s.nodeId = req.GetNode().GetId()
+		if version := envoyVersion(req.GetNode()); version != "" {
+			a.envoyVersions[s.nodeId] = version
+		}
+	}
+
+	// Requests without a nonce are initial requests rather than responses to a snapshot.
+	if s.nodeId == "" || req.GetResponseNonce() == "" {
+		return
+	}
+
+	if _, ok := a.acks[s.nodeId]; !ok {
+		a.acks[s.nodeId] = map[string]Ack{}
+	}
+
+	ack := Ack{
+		Version: req.GetVersionInfo(),
+		Nacked:  req.GetErrorDetail() != nil,
+		Detail:  req.GetErrorDetail().GetMessage(),
+		At:      time.Now().UTC(),
+	}
+
+	// Envoy only answers the latest response it received so every response sent before the answered one is dropped.
+	sent := s.sent[req.GetTypeUrl()]
+	for i, v := range sent {
+		if v.nonce == req.GetResponseNonce() {
+			if ack.Nacked {
+				ack.Rejected = v.version
+			}
+			s.sent[req.GetTypeUrl()] = sent[i+1:]
+			break
+		}
+	}
+
+	a.seq++
+	ack.seq = a.seq
+	a.acks[s.nodeId][req.GetTypeUrl()] = ack
+
+	a.notify()
+}
+
+func (a *ackTracker) OnStreamResponse(streamId int64, res *discovery.DiscoveryResponse) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	s, ok := a.streams[streamId]
+	if !ok {
+		return
+	}
+
+	s.sent[res.GetTypeUrl()] = append(s.sent[res.GetTypeUrl()], sentResponse{nonce: res.GetNonce(), version: res.GetVersionInfo()})
+}
+
+func (a *ackTracker) Nodes() []Node {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	nodes := map[string]*Node{}
+	for _, s := range a.streams {
+		if s.nodeId == "" {
+			continue
+		}
+
+		node, ok := nodes[s.nodeId]
+		if !ok {
+			node = &Node{
+				Id:           s.nodeId,
+				EnvoyVersion: a.envoyVersions[s.nodeId],
+				ConnectedAt:  s.openedAt,
+				Acks:         make(map[string]Ack, len(a.acks[s.nodeId])),
+			}
+			for k, v := range a.acks[s.nodeId] {
+				node.Acks[k] = v
+			}
+			nodes[s.nodeId] = node
+		}
+
+		if s.openedAt.Before(node.ConnectedAt) {
+			node.ConnectedAt = s.openedAt
+		}
+	}
+
+	output := make([]Node, 0, len(nodes))
+	for _, v := range nodes {
+		output = append(output, *v)
+	}
+	sort.Slice(output, func(i, j int) bool {
+		return output[i].Id < output[j].Id
+	})
+
+	return output
+}
+
+func (a *ackTracker) WaitForAck(nodeId, typeUrl, version string, timeout time.Duration) error {
+	a.lock.Lock()
+	start := a.seq
+	a.lock.Unlock()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		a.lock.Lock()
+		connected := a.connected(nodeId)
+		latest, ok := a.acks[nodeId][typeUrl]
+		changed := a.changed
+		a.lock.Unlock()
+
+		if ok && !latest.Nacked && latest.Version == version {
+			return nil
+		}
+
+		if !connected {
+			return except.NewError("no Envoy with node ID %s is connected", except.ErrNotFound, nodeId)
+		}
+
+		// A NACK of another version received while waiting means the version will not be ACKed either as the Envoy
+		// only answers the latest response.
+		if ok && latest.Nacked && (latest.Rejected == version || latest.seq > start) {
+			return except.NewError("Envoy with node ID %s rejected version %s: %s", except.ErrInvalid, nodeId, version, latest.Detail)
+		}
+
+		select {
+		case <-changed:
+		case <-timer.C:
+			return except.NewError("Envoy with node ID %s did not ACK version %s after %s", except.ErrTimeout, nodeId, version, timeout)
+		}
+	}
+}
+
+func (a *ackTracker) connected(nodeId string) bool {
+	for _, v := range a.streams {
+		if v.nodeId == nodeId {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *ackTracker) notify() {
+	close(a.changed)
+	a.changed = make(chan struct{})
+}
+
+// The semantic version Envoy reports in its node or the free-form version if it has none.
+func envoyVersion(node *core.Node) string {
+	if v := node.GetUserAgentBuildVersion().GetVersion(); v != nil {
+		return fmt.Sprintf("%d.%d.%d", v.MajorNumber, v.MinorNumber, v.Patch)
+	}
+	return node.GetUserAgentVersion()
+}
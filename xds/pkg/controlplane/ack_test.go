@@ -0,0 +1,171 @@
+package controlplane
+
+import (
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	discovery "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
+	typev3 "github.com/envoyproxy/go-control-plane/envoy/type/v3"
+	"github.com/envoyproxy/go-control-plane/pkg/resource/v3"
+	"github.com/kage-cloud/kage/core/except"
+	"github.com/stretchr/testify/suite"
+	"google.golang.org/genproto/googleapis/rpc/status"
+	"testing"
+	"time"
+)
+
+type AckTestSuite struct {
+	suite.Suite
+}
+
+func (a *AckTestSuite) TestWaitForAck() {
+	// -- Given
+	//
+	given := NewAckTracker()
+	given.OnStreamOpen(1)
+	given.OnStreamRequest(1, &discovery.DiscoveryRequest{Node: &core.Node{Id: "node"}, TypeUrl: resource.RouteType})
+
+	// -- When
+	//
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		given.OnStreamRequest(1, &discovery.DiscoveryRequest{TypeUrl: resource.RouteType, VersionInfo: "v1", ResponseNonce: "1"})
+	}()
+	err := given.WaitForAck("node", resource.RouteType, "v1", time.Second)
+
+	// -- Then
+	//
+	a.NoError(err)
+}
+
+func (a *AckTestSuite) TestWaitForAckNack() {
+	// -- Given
+	//
+	given := NewAckTracker()
+	given.OnStreamOpen(1)
+	given.OnStreamRequest(1, &discovery.DiscoveryRequest{Node: &core.Node{Id: "node"}, TypeUrl: resource.RouteType})
+
+	// -- When
+	//
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		given.OnStreamRequest(1, &discovery.DiscoveryRequest{
+			TypeUrl:       resource.RouteType,
+			VersionInfo:   "v1",
+			ResponseNonce: "2",
+			ErrorDetail:   &status.Status{Message: "bad route"},
+		})
+	}()
+	err := given.WaitForAck("node", resource.RouteType, "v2", time.Second)
+
+	// -- Then
+	//
+	if a.Error(err) {
+		a.Equal(except.ErrInvalid, except.Reason(err))
+	}
+}
+
+func (a *AckTestSuite) TestWaitForAckEarlyNack() {
+	// -- Given
+	//
+	given := NewAckTracker()
+	given.OnStreamOpen(1)
+	given.OnStreamRequest(1, &discovery.DiscoveryRequest{Node: &core.Node{Id: "node"}, TypeUrl: resource.RouteType})
+	given.OnStreamResponse(1, &discovery.DiscoveryResponse{TypeUrl: resource.RouteType, VersionInfo: "v1", Nonce: "1"})
+	given.OnStreamResponse(1, &discovery.DiscoveryResponse{TypeUrl: resource.RouteType, VersionInfo: "v2", Nonce: "2"})
+	given.OnStreamRequest(1, &discovery.DiscoveryRequest{
+		TypeUrl:       resource.RouteType,
+		VersionInfo:   "v0",
+		ResponseNonce: "2",
+		ErrorDetail:   &status.Status{Message: "bad route"},
+	})
+
+	// -- When
+	//
+	err := given.WaitForAck("node", resource.RouteType, "v2", time.Second)
+
+	// -- Then
+	//
+	if a.Error(err) {
+		a.Equal(except.ErrInvalid, except.Reason(err))
+	}
+	a.Equal("v2", given.Nodes()[0].Acks[resource.RouteType].Rejected)
+}
+
+func (a *AckTestSuite) TestWaitForAckNotConnected() {
+	// -- Given
+	//
+	given := NewAckTracker()
+
+	// -- When
+	//
+	err := given.WaitForAck("node", resource.RouteType, "v1", time.Second)
+
+	// -- Then
+	//
+	if a.Error(err) {
+		a.Equal(except.ErrNotFound, except.Reason(err))
+	}
+}
+
+func (a *AckTestSuite) TestWaitForAckTimeout() {
+	// -- Given
+	//
+	given := NewAckTracker()
+	given.OnStreamOpen(1)
+	given.OnStreamRequest(1, &discovery.DiscoveryRequest{Node: &core.Node{Id: "node"}, TypeUrl: resource.RouteType})
+
+	// -- When
+	//
+	err := given.WaitForAck("node", resource.RouteType, "v1", 10*time.Millisecond)
+
+	// -- Then
+	//
+	if a.Error(err) {
+		a.Equal(except.ErrTimeout, except.Reason(err))
+	}
+}
+
+func (a *AckTestSuite) TestNodes() {
+	// -- Given
+	//
+	given := NewAckTracker()
+	given.OnStreamOpen(1)
+	given.OnStreamRequest(1, &discovery.DiscoveryRequest{
+		Node: &core.Node{
+			Id: "node",
+			UserAgentVersionType: &core.Node_UserAgentBuildVersion{
+				UserAgentBuildVersion: &core.BuildVersion{Version: &typev3.SemanticVersion{MajorNumber: 1, MinorNumber: 15}},
+			},
+		},
+		TypeUrl: resource.RouteType,
+	})
+	given.OnStreamRequest(1, &discovery.DiscoveryRequest{TypeUrl: resource.RouteType, VersionInfo: "v1", ResponseNonce: "1"})
+	given.OnStreamRequest(1, &discovery.DiscoveryRequest{
+		TypeUrl:       resource.ListenerType,
+		ResponseNonce: "2",
+		ErrorDetail:   &status.Status{Message: "bad listener"},
+	})
+	given.OnStreamOpen(2)
+	given.OnStreamOpen(3)
+	given.OnStreamRequest(3, &discovery.DiscoveryRequest{Node: &core.Node{Id: "closed"}})
+	given.OnStreamClosed(3)
+
+	// -- When
+	//
+	actual := given.Nodes()
+
+	// -- Then
+	//
+	if a.Len(actual, 1) {
+		a.Equal("node", actual[0].Id)
+		a.Equal("1.15.0", actual[0].EnvoyVersion)
+		a.False(actual[0].ConnectedAt.IsZero())
+		a.Equal("v1", actual[0].Acks[resource.RouteType].Version)
+		a.False(actual[0].Acks[resource.RouteType].Nacked)
+		a.True(actual[0].Acks[resource.ListenerType].Nacked)
+		a.Equal("bad listener", actual[0].Acks[resource.ListenerType].Detail)
+	}
+}
+
+func TestAckTestSuite(t *testing.T) {
+	suite.Run(t, new(AckTestSuite))
+}
@@ -0,0 +1,420 @@
+package controlplane
+
+import (
+	"context"
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	cds "github.com/envoyproxy/go-control-plane/envoy/service/cluster/v3"
+	discovery "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
+	eds "github.com/envoyproxy/go-control-plane/envoy/service/endpoint/v3"
+	lds "github.com/envoyproxy/go-control-plane/envoy/service/listener/v3"
+	rds "github.com/envoyproxy/go-control-plane/envoy/service/route/v3"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/types"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/v3"
+	"github.com/envoyproxy/go-control-plane/pkg/resource/v3"
+	serverv3 "github.com/envoyproxy/go-control-plane/pkg/server/v3"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/kage-cloud/kage/core/except"
+	"github.com/kage-cloud/kage/xds/pkg/snap"
+	"github.com/kage-cloud/kage/xds/pkg/snap/store"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"io"
+	"sort"
+	"strconv"
+	"sync/atomic"
+)
+
+// Serves the incremental xDS protocol from the EnvoyStates of the StoreClient so only the resources which changed are
+// sent to each Envoy. The state-of-the-world protocol is served by the wrapped server for Envoys which do not request
+// deltas.
+func NewDeltaServer(server serverv3.Server, storeClient snap.StoreClient, ackTracker AckTracker) serverv3.Server {
+	return &deltaServer{
+		Server:      server,
+		storeClient: storeClient,
+		ackTracker:  ackTracker,
+	}
+}
+
+type deltaServer struct {
+	serverv3.Server
+
+	storeClient snap.StoreClient
+	ackTracker  AckTracker
+
+	// Delta streams are numbered downwards from -1 so they never collide with the state-of-the-world streams.
+	streamCount int64
+}
+
+// Clusters are sent before their endpoints and listeners before their routes so an ADS stream applies them in order.
+var deltaTypeOrder = []string{resource.ClusterType, resource.EndpointType, resource.ListenerType, resource.RouteType}
+
+type deltaStream interface {
+	Context() context.Context
+	Send(*discovery.DeltaDiscoveryResponse) error
+	Recv() (*discovery.DeltaDiscoveryRequest, error)
+}
+
+// The resources of one type the Envoy subscribed to on a stream.
+type deltaSubscription struct {
+	typeUrl string
+
+	// Wildcard subscriptions receive every resource of the type.
+	wildcard bool
+	names    map[string]bool
+
+	// The version of every resource the Envoy ACKed indexed by the resource name.
+	versions map[string]string
+
+	// The changes of every response which has not been answered yet in the order they were sent.
+	pending []pendingResponse
+}
+
+// The resources of a response. Removed resources have an empty version.
+type pendingResponse struct {
+	nonce    string
+	versions map[string]string
+}
+
+func (d *deltaServer) DeltaAggregatedResources(stream discovery.AggregatedDiscoveryService_DeltaAggregatedResourcesServer) error {
+	return d.process(stream, resource.AnyType)
+}
+
+func (d *deltaServer) DeltaEndpoints(stream eds.EndpointDiscoveryService_DeltaEndpointsServer) error {
+	return d.process(stream, resource.EndpointType)
+}
+
+func (d *deltaServer) DeltaClusters(stream cds.ClusterDiscoveryService_DeltaClustersServer) error {
+	return d.process(stream, resource.ClusterType)
+}
+
+func (d *deltaServer) DeltaRoutes(stream rds.RouteDiscoveryService_DeltaRoutesServer) error {
+	return d.process(stream, resource.RouteType)
+}
+
+func (d *deltaServer) DeltaListeners(stream lds.ListenerDiscoveryService_DeltaListenersServer) error {
+	return d.process(stream, resource.ListenerType)
+}
+
+// Handles the requests of a stream and pushes the changed resources whenever the Envoy's state changes. The type URL
+// is empty for ADS streams which carry every type.
+func (d *deltaServer) process(stream deltaStream, typeUrl string) error {
+	streamId := atomic.AddInt64(&d.streamCount, -1)
+	d.ackTracker.OnStreamOpen(streamId)
+	defer d.ackTracker.OnStreamClosed(streamId)
+
+	ctx := stream.Context()
+	reqs := make(chan *discovery.DeltaDiscoveryRequest)
+	errs := make(chan error, 1)
+	go func() {
+		for {
+			req, err := stream.Recv()
+			if err != nil {
+				errs <- err
+				return
+			}
+			select {
+			case reqs <- req:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var nodeId string
+	var watch <-chan struct{}
+	subs := map[string]*deltaSubscription{}
+
+	// The system version sent with every nonce that has not been answered yet.
+	sent := map[string]string{}
+
+	// The last system version the Envoy ACKed indexed by the type URL.
+	acked := map[string]string{}
+	nonce := 0
+	send := func(sub *deltaSubscription) error {
+		state, err := d.storeClient.Get(nodeId)
+		if err != nil && except.Reason(err) != except.ErrNotFound {
+			return err
+		}
+
+		res, err := d.diff(sub, state)
+		if err != nil || res == nil {
+			return err
+		}
+
+		nonce++
+		res.Nonce = strconv.Itoa(nonce)
+		sent[res.Nonce] = res.SystemVersionInfo
+		sub.sent(res)
+		d.ackTracker.OnStreamResponse(streamId, &discovery.DiscoveryResponse{
+			TypeUrl:     res.TypeUrl,
+			VersionInfo: res.SystemVersionInfo,
+			Nonce:       res.Nonce,
+		})
+		return stream.Send(res)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-errs:
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		case req := <-reqs:
+			if nodeId == "" {
+				nodeId = req.GetNode().GetId()
+				if nodeId == "" {
+					return status.Error(codes.InvalidArgument, "the node ID is required on the first request")
+				}
+				if err := authorizeNode(ctx, nodeId); err != nil {
+					return err
+				}
+				var cancel func()
+				watch, cancel = d.storeClient.Watch(nodeId)
+				defer cancel()
+
+				// Ties the stream to the node so it counts as connected before its first ACK.
+				d.ackTracker.OnStreamRequest(streamId, &discovery.DiscoveryRequest{Node: &core.Node{Id: nodeId}})
+			}
+
+			if req.TypeUrl == "" {
+				req.TypeUrl = typeUrl
+			}
+			if req.TypeUrl == "" {
+				return status.Error(codes.InvalidArgument, "the type URL is required on ADS streams")
+			}
+
+			sub, ok := subs[req.TypeUrl]
+			if req.ResponseNonce != "" {
+				d.ack(streamId, nodeId, req, sub, sent, acked)
+			}
+
+			if !ok {
+				sub = newDeltaSubscription(req)
+				subs[req.TypeUrl] = sub
+			} else if len(req.ResourceNamesSubscribe) == 0 && len(req.ResourceNamesUnsubscribe) == 0 {
+				// An ACK or NACK without any change to the subscription.
+				continue
+			}
+			sub.update(req)
+
+			if err := send(sub); err != nil {
+				return err
+			}
+		case <-watch:
+			for _, v := range deltaTypeOrder {
+				if sub, ok := subs[v]; ok {
+					if err := send(sub); err != nil {
+						return err
+					}
+				}
+			}
+		}
+	}
+}
+
+// Records the ACK or NACK with the AckTracker as a state-of-the-world request. Like state-of-the-world NACKs, a NACK
+// is recorded with the last version the Envoy accepted. The resource versions of the response are only kept for the
+// subscription if they are ACKed.
+func (d *deltaServer) ack(streamId int64, nodeId string, req *discovery.DeltaDiscoveryRequest, sub *deltaSubscription, sent, acked map[string]string) {
+	version, ok := sent[req.ResponseNonce]
+	if !ok {
+		return
+	}
+	delete(sent, req.ResponseNonce)
+
+	if sub != nil {
+		sub.answered(req.ResponseNonce, req.ErrorDetail == nil)
+	}
+
+	if req.ErrorDetail != nil {
+		log.WithField("node_id", nodeId).
+			WithField("type_url", req.TypeUrl).
+			WithField("version", version).
+			WithField("error", req.ErrorDetail.GetMessage()).
+			Warn("Envoy rejected the delta update.")
+		version = acked[req.TypeUrl]
+	} else {
+		acked[req.TypeUrl] = version
+	}
+
+	d.ackTracker.OnStreamRequest(streamId, &discovery.DiscoveryRequest{
+		Node:          &core.Node{Id: nodeId},
+		TypeUrl:       req.TypeUrl,
+		VersionInfo:   version,
+		ResponseNonce: req.ResponseNonce,
+		ErrorDetail:   req.ErrorDetail,
+	})
+}
+
+// The resources of the subscription which were added, changed, or removed since the Envoy's versions. Nil if nothing
+// changed.
+func (d *deltaServer) diff(sub *deltaSubscription, state *store.EnvoyState) (*discovery.DeltaDiscoveryResponse, error) {
+	resources, err := stateResources(state, sub.typeUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	// Resources which are in flight are not sent again.
+	known := sub.known()
+
+	res := &discovery.DeltaDiscoveryResponse{TypeUrl: sub.typeUrl}
+	if state != nil {
+		res.SystemVersionInfo = state.Versions[sub.typeUrl]
+	}
+
+	names := make([]string, 0, len(resources))
+	for k := range resources {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if !sub.wildcard && !sub.names[name] {
+			continue
+		}
+
+		version, err := snap.ResourceVersion(resources[name])
+		if err != nil {
+			return nil, err
+		}
+		if known[name] == version {
+			continue
+		}
+
+		any, err := ptypes.MarshalAny(resources[name])
+		if err != nil {
+			return nil, err
+		}
+
+		res.Resources = append(res.Resources, &discovery.Resource{
+			Name:     name,
+			Version:  version,
+			Resource: any,
+		})
+	}
+
+	for name := range known {
+		if _, ok := resources[name]; !ok {
+			res.RemovedResources = append(res.RemovedResources, name)
+		}
+	}
+	sort.Strings(res.RemovedResources)
+
+	if len(res.Resources) == 0 && len(res.RemovedResources) == 0 {
+		return nil, nil
+	}
+	return res, nil
+}
+
+// Listeners and clusters are wildcard subscriptions when the first request names no resources.
+func newDeltaSubscription(req *discovery.DeltaDiscoveryRequest) *deltaSubscription {
+	sub := &deltaSubscription{
+		typeUrl:  req.TypeUrl,
+		names:    map[string]bool{},
+		versions: map[string]string{},
+	}
+
+	if len(req.ResourceNamesSubscribe) == 0 && (req.TypeUrl == resource.ListenerType || req.TypeUrl == resource.ClusterType) {
+		sub.wildcard = true
+	}
+
+	for k, v := range req.InitialResourceVersions {
+		sub.versions[k] = v
+	}
+
+	return sub
+}
+
+func (d *deltaSubscription) update(req *discovery.DeltaDiscoveryRequest) {
+	for _, name := range req.ResourceNamesSubscribe {
+		if name == "*" {
+			d.wildcard = true
+			continue
+		}
+		d.names[name] = true
+	}
+
+	for _, name := range req.ResourceNamesUnsubscribe {
+		if name == "*" {
+			d.wildcard = false
+			continue
+		}
+		delete(d.names, name)
+
+		// The Envoy forgets unsubscribed resources so they are sent again if it resubscribes.
+		delete(d.versions, name)
+		for _, v := range d.pending {
+			delete(v.versions, name)
+		}
+	}
+}
+
+// Records the resources of the response until it is answered.
+func (d *deltaSubscription) sent(res *discovery.DeltaDiscoveryResponse) {
+	versions := make(map[string]string, len(res.Resources)+len(res.RemovedResources))
+	for _, v := range res.Resources {
+		versions[v.Name] = v.Version
+	}
+	for _, v := range res.RemovedResources {
+		versions[v] = ""
+	}
+	d.pending = append(d.pending, pendingResponse{nonce: res.Nonce, versions: versions})
+}
+
+// Keeps the resource versions of the response with the nonce if it was ACKed and drops them if it was NACKed.
+func (d *deltaSubscription) answered(nonce string, acked bool) {
+	for i, v := range d.pending {
+		if v.nonce != nonce {
+			continue
+		}
+
+		if acked {
+			applyVersions(d.versions, v.versions)
+		}
+		d.pending = append(d.pending[:i], d.pending[i+1:]...)
+		return
+	}
+}
+
+// The versions the Envoy will have once every response in flight is ACKed.
+func (d *deltaSubscription) known() map[string]string {
+	known := make(map[string]string, len(d.versions))
+	applyVersions(known, d.versions)
+	for _, v := range d.pending {
+		applyVersions(known, v.versions)
+	}
+	return known
+}
+
+func applyVersions(dst, src map[string]string) {
+	for k, v := range src {
+		if v == "" {
+			delete(dst, k)
+		} else {
+			dst[k] = v
+		}
+	}
+}
+
+// The resources of the type served for the state indexed by their names. Empty if the state is nil.
+func stateResources(state *store.EnvoyState, typeUrl string) (map[string]types.Resource, error) {
+	resources := map[string]types.Resource{}
+	if state == nil {
+		return resources, nil
+	}
+
+	all, err := snap.Resources(state)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, v := range all[typeUrl] {
+		resources[cache.GetResourceName(v)] = v
+	}
+
+	return resources, nil
+}
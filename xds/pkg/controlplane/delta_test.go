@@ -0,0 +1,359 @@
+package controlplane
+
+import (
+	"context"
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	endpoint "github.com/envoyproxy/go-control-plane/envoy/config/endpoint/v3"
+	listener "github.com/envoyproxy/go-control-plane/envoy/config/listener/v3"
+	discovery "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
+	lds "github.com/envoyproxy/go-control-plane/envoy/service/listener/v3"
+	"github.com/envoyproxy/go-control-plane/pkg/resource/v3"
+	serverv3 "github.com/envoyproxy/go-control-plane/pkg/server/v3"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/kage-cloud/kage/xds/pkg/snap"
+	"github.com/kage-cloud/kage/xds/pkg/snap/store"
+	"github.com/kage-cloud/kage/xds/pkg/util/envoyutil"
+	"github.com/stretchr/testify/suite"
+	"google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc"
+	"net"
+	"testing"
+	"time"
+)
+
+type DeltaTestSuite struct {
+	suite.Suite
+	storeClient snap.StoreClient
+	ackTracker  AckTracker
+	grpcServer  *grpc.Server
+	conn        *grpc.ClientConn
+	ctx         context.Context
+	cancel      context.CancelFunc
+}
+
+func (d *DeltaTestSuite) SetupTest() {
+	var err error
+	d.storeClient, err = snap.NewStoreClient(&snap.StoreClientSpec{PersistentStore: store.NewInMemoryStore()})
+	d.Require().NoError(err)
+	d.ackTracker = NewAckTracker()
+
+	sotw := serverv3.NewServer(context.Background(), d.storeClient.SnapshotCache(), newCallbacks(d.ackTracker))
+	server := NewDeltaServer(sotw, d.storeClient, d.ackTracker)
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	d.Require().NoError(err)
+
+	d.grpcServer = grpc.NewServer()
+	discovery.RegisterAggregatedDiscoveryServiceServer(d.grpcServer, server)
+	lds.RegisterListenerDiscoveryServiceServer(d.grpcServer, server)
+	go func() {
+		_ = d.grpcServer.Serve(lis)
+	}()
+
+	d.conn, err = grpc.Dial(lis.Addr().String(), grpc.WithInsecure())
+	d.Require().NoError(err)
+
+	d.ctx, d.cancel = context.WithTimeout(context.Background(), 5*time.Second)
+}
+
+func (d *DeltaTestSuite) TearDownTest() {
+	d.cancel()
+	_ = d.conn.Close()
+	d.grpcServer.Stop()
+}
+
+func (d *DeltaTestSuite) TestListenersWildcard() {
+	// -- Given
+	//
+	d.Require().NoError(d.storeClient.Set(&store.EnvoyState{
+		NodeId:    "node",
+		Listeners: []*listener.Listener{portListener("a", 8080), portListener("b", 8081)},
+	}))
+
+	stream, err := lds.NewListenerDiscoveryServiceClient(d.conn).DeltaListeners(d.ctx)
+	d.Require().NoError(err)
+
+	// -- When
+	//
+	d.Require().NoError(stream.Send(&discovery.DeltaDiscoveryRequest{Node: &core.Node{Id: "node"}}))
+	actual, err := stream.Recv()
+
+	// -- Then
+	//
+	if d.NoError(err) {
+		d.Equal(resource.ListenerType, actual.TypeUrl)
+		d.Equal([]string{"a", "b"}, resourceNames(actual))
+		d.Empty(actual.RemovedResources)
+	}
+}
+
+func (d *DeltaTestSuite) TestEndpointsOnlyChanged() {
+	// -- Given
+	//
+	d.Require().NoError(d.storeClient.Set(&store.EnvoyState{
+		NodeId:    "node",
+		Endpoints: []*endpoint.ClusterLoadAssignment{lbEndpoint("a", "10.0.0.1"), lbEndpoint("b", "10.0.0.2")},
+	}))
+
+	stream, err := discovery.NewAggregatedDiscoveryServiceClient(d.conn).DeltaAggregatedResources(d.ctx)
+	d.Require().NoError(err)
+	d.Require().NoError(stream.Send(&discovery.DeltaDiscoveryRequest{
+		Node:                   &core.Node{Id: "node"},
+		TypeUrl:                resource.EndpointType,
+		ResourceNamesSubscribe: []string{"a", "b"},
+	}))
+	initial, err := stream.Recv()
+	d.Require().NoError(err)
+	d.Require().Equal([]string{"a", "b"}, resourceNames(initial))
+	d.Require().NoError(stream.Send(&discovery.DeltaDiscoveryRequest{TypeUrl: resource.EndpointType, ResponseNonce: initial.Nonce}))
+
+	// -- When
+	//
+	d.Require().NoError(d.storeClient.Set(&store.EnvoyState{
+		NodeId:    "node",
+		Endpoints: []*endpoint.ClusterLoadAssignment{lbEndpoint("a", "10.0.0.3"), lbEndpoint("b", "10.0.0.2")},
+	}))
+	actual, err := stream.Recv()
+
+	// -- Then
+	//
+	if d.NoError(err) {
+		d.Equal(resource.EndpointType, actual.TypeUrl)
+		d.Equal([]string{"a"}, resourceNames(actual))
+		d.Empty(actual.RemovedResources)
+		d.NotEqual(initial.Resources[0].Version, actual.Resources[0].Version)
+	}
+}
+
+func (d *DeltaTestSuite) TestRemovedResources() {
+	// -- Given
+	//
+	d.Require().NoError(d.storeClient.Set(&store.EnvoyState{
+		NodeId:    "node",
+		Listeners: []*listener.Listener{portListener("a", 8080), portListener("b", 8081)},
+	}))
+
+	stream, err := lds.NewListenerDiscoveryServiceClient(d.conn).DeltaListeners(d.ctx)
+	d.Require().NoError(err)
+	d.Require().NoError(stream.Send(&discovery.DeltaDiscoveryRequest{Node: &core.Node{Id: "node"}}))
+	_, err = stream.Recv()
+	d.Require().NoError(err)
+
+	// -- When
+	//
+	d.Require().NoError(d.storeClient.Set(&store.EnvoyState{
+		NodeId:    "node",
+		Listeners: []*listener.Listener{portListener("a", 8080)},
+	}))
+	actual, err := stream.Recv()
+
+	// -- Then
+	//
+	if d.NoError(err) {
+		d.Empty(actual.Resources)
+		d.Equal([]string{"b"}, actual.RemovedResources)
+	}
+}
+
+func (d *DeltaTestSuite) TestInitialResourceVersions() {
+	// -- Given
+	//
+	d.Require().NoError(d.storeClient.Set(&store.EnvoyState{
+		NodeId:    "node",
+		Listeners: []*listener.Listener{portListener("a", 8080), portListener("b", 8081)},
+	}))
+	version, err := snap.ResourceVersion(portListener("a", 8080))
+	d.Require().NoError(err)
+
+	stream, err := lds.NewListenerDiscoveryServiceClient(d.conn).DeltaListeners(d.ctx)
+	d.Require().NoError(err)
+
+	// -- When
+	//
+	d.Require().NoError(stream.Send(&discovery.DeltaDiscoveryRequest{
+		Node:                    &core.Node{Id: "node"},
+		InitialResourceVersions: map[string]string{"a": version},
+	}))
+	actual, err := stream.Recv()
+
+	// -- Then
+	//
+	if d.NoError(err) {
+		d.Equal([]string{"b"}, resourceNames(actual))
+	}
+}
+
+func (d *DeltaTestSuite) TestAck() {
+	// -- Given
+	//
+	d.Require().NoError(d.storeClient.Set(&store.EnvoyState{
+		NodeId:    "node",
+		Listeners: []*listener.Listener{portListener("a", 8080)},
+	}))
+	state, err := d.storeClient.Get("node")
+	d.Require().NoError(err)
+
+	stream, err := lds.NewListenerDiscoveryServiceClient(d.conn).DeltaListeners(d.ctx)
+	d.Require().NoError(err)
+	d.Require().NoError(stream.Send(&discovery.DeltaDiscoveryRequest{Node: &core.Node{Id: "node"}}))
+	res, err := stream.Recv()
+	d.Require().NoError(err)
+
+	// -- When
+	//
+	d.Require().NoError(stream.Send(&discovery.DeltaDiscoveryRequest{ResponseNonce: res.Nonce}))
+	err = d.ackTracker.WaitForAck("node", resource.ListenerType, state.Versions[resource.ListenerType], time.Second)
+
+	// -- Then
+	//
+	d.Equal(state.Versions[resource.ListenerType], res.SystemVersionInfo)
+	d.NoError(err)
+}
+
+func (d *DeltaTestSuite) TestEndpointsMerged() {
+	// -- Given
+	//
+	d.Require().NoError(d.storeClient.Set(&store.EnvoyState{
+		NodeId:    "node",
+		Endpoints: envoyutil.MergeClusterLoadAssignments([]*endpoint.ClusterLoadAssignment{lbEndpoint("a", "10.0.0.1"), lbEndpoint("a", "10.0.0.2")}),
+	}))
+
+	stream, err := discovery.NewAggregatedDiscoveryServiceClient(d.conn).DeltaAggregatedResources(d.ctx)
+	d.Require().NoError(err)
+
+	// -- When
+	//
+	d.Require().NoError(stream.Send(&discovery.DeltaDiscoveryRequest{
+		Node:                   &core.Node{Id: "node"},
+		TypeUrl:                resource.EndpointType,
+		ResourceNamesSubscribe: []string{"a"},
+	}))
+	actual, err := stream.Recv()
+
+	// -- Then
+	//
+	if d.NoError(err) && d.Equal([]string{"a"}, resourceNames(actual)) {
+		cla := &endpoint.ClusterLoadAssignment{}
+		d.Require().NoError(ptypes.UnmarshalAny(actual.Resources[0].Resource, cla))
+		if d.Len(cla.Endpoints, 1) {
+			d.Len(cla.Endpoints[0].LbEndpoints, 2)
+		}
+	}
+}
+
+func (d *DeltaTestSuite) TestNackResends() {
+	// -- Given
+	//
+	d.Require().NoError(d.storeClient.Set(&store.EnvoyState{
+		NodeId:    "node",
+		Listeners: []*listener.Listener{portListener("a", 8080)},
+	}))
+
+	stream, err := lds.NewListenerDiscoveryServiceClient(d.conn).DeltaListeners(d.ctx)
+	d.Require().NoError(err)
+	d.Require().NoError(stream.Send(&discovery.DeltaDiscoveryRequest{Node: &core.Node{Id: "node"}}))
+	initial, err := stream.Recv()
+	d.Require().NoError(err)
+	d.Require().NoError(stream.Send(&discovery.DeltaDiscoveryRequest{
+		ResponseNonce: initial.Nonce,
+		ErrorDetail:   &status.Status{Message: "bad listener"},
+	}))
+	d.Require().Error(d.ackTracker.WaitForAck("node", resource.ListenerType, initial.SystemVersionInfo, time.Second))
+
+	// -- When
+	//
+	d.Require().NoError(d.storeClient.Set(&store.EnvoyState{
+		NodeId:    "node",
+		Listeners: []*listener.Listener{portListener("a", 8080), portListener("b", 8081)},
+	}))
+	actual, err := stream.Recv()
+
+	// -- Then
+	//
+	if d.NoError(err) {
+		d.Equal([]string{"a", "b"}, resourceNames(actual))
+	}
+}
+
+func (d *DeltaTestSuite) TestAckKeepsVersions() {
+	// -- Given
+	//
+	d.Require().NoError(d.storeClient.Set(&store.EnvoyState{
+		NodeId:    "node",
+		Listeners: []*listener.Listener{portListener("a", 8080)},
+	}))
+
+	stream, err := lds.NewListenerDiscoveryServiceClient(d.conn).DeltaListeners(d.ctx)
+	d.Require().NoError(err)
+	d.Require().NoError(stream.Send(&discovery.DeltaDiscoveryRequest{Node: &core.Node{Id: "node"}}))
+	initial, err := stream.Recv()
+	d.Require().NoError(err)
+	d.Require().NoError(stream.Send(&discovery.DeltaDiscoveryRequest{ResponseNonce: initial.Nonce}))
+	d.Require().NoError(d.ackTracker.WaitForAck("node", resource.ListenerType, initial.SystemVersionInfo, time.Second))
+
+	// -- When
+	//
+	d.Require().NoError(d.storeClient.Set(&store.EnvoyState{
+		NodeId:    "node",
+		Listeners: []*listener.Listener{portListener("a", 8080), portListener("b", 8081)},
+	}))
+	actual, err := stream.Recv()
+
+	// -- Then
+	//
+	if d.NoError(err) {
+		d.Equal([]string{"b"}, resourceNames(actual))
+	}
+}
+
+func resourceNames(res *discovery.DeltaDiscoveryResponse) []string {
+	names := make([]string, 0, len(res.Resources))
+	for _, v := range res.Resources {
+		names = append(names, v.Name)
+	}
+	return names
+}
+
+func lbEndpoint(clusterName, address string) *endpoint.ClusterLoadAssignment {
+	return &endpoint.ClusterLoadAssignment{
+		ClusterName: clusterName,
+		Endpoints: []*endpoint.LocalityLbEndpoints{
+			{
+				LbEndpoints: []*endpoint.LbEndpoint{
+					{
+						HostIdentifier: &endpoint.LbEndpoint_Endpoint{
+							Endpoint: &endpoint.Endpoint{
+								Address: &core.Address{
+									Address: &core.Address_SocketAddress{
+										SocketAddress: &core.SocketAddress{
+											Address:       address,
+											PortSpecifier: &core.SocketAddress_PortValue{PortValue: 8080},
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func portListener(name string, port uint32) *listener.Listener {
+	return &listener.Listener{
+		Name: name,
+		Address: &core.Address{
+			Address: &core.Address_SocketAddress{
+				SocketAddress: &core.SocketAddress{
+					Address:       "0.0.0.0",
+					PortSpecifier: &core.SocketAddress_PortValue{PortValue: port},
+				},
+			},
+		},
+	}
+}
+
+func TestDeltaTestSuite(t *testing.T) {
+	suite.Run(t, new(DeltaTestSuite))
+}
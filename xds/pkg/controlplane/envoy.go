@@ -3,6 +3,7 @@ package controlplane
 import (
 	"context"
 	"fmt"
+	cds "github.com/envoyproxy/go-control-plane/envoy/service/cluster/v3"
 	discovery "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
 	eds "github.com/envoyproxy/go-control-plane/envoy/service/endpoint/v3"
 	lds "github.com/envoyproxy/go-control-plane/envoy/service/listener/v3"
@@ -13,7 +14,9 @@ import (
 	"github.com/kage-cloud/kage/xds/pkg/snap"
 	log "github.com/sirupsen/logrus"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 	"net"
+	"sync"
 	"time"
 )
 
@@ -24,57 +27,99 @@ type Envoy interface {
 }
 
 type envoyControlPlane struct {
-	StoreClient snap.StoreClient `inject:"StoreClient"`
-	Config      *config.Config   `inject:"Config"`
+	StoreClient   snap.StoreClient `inject:"StoreClient"`
+	Config        *config.Config   `inject:"Config"`
+	AckTracker    AckTracker       `inject:"AckTracker"`
+	CertAuthority CertAuthority    `inject:"CertAuthority"`
 }
 
+// Records the streams and requests of the state-of-the-world server with the AckTracker and rejects the requests of
+// nodes whose client certificate was issued for another node.
 type cb struct {
+	AckTracker AckTracker
+
+	// The contexts of the open streams indexed by their stream IDs.
+	streams map[int64]context.Context
+	lock    sync.Mutex
+}
+
+func newCallbacks(ackTracker AckTracker) *cb {
+	return &cb{
+		AckTracker: ackTracker,
+		streams:    map[int64]context.Context{},
+	}
 }
 
-func (c cb) OnStreamOpen(ctx context.Context, i int64, s string) error {
-	fmt.Println("on stream open!!!", i, s)
+func (c *cb) OnStreamOpen(ctx context.Context, streamId int64, typeUrl string) error {
+	log.WithField("stream_id", streamId).WithField("type_url", typeUrl).Debug("Opened xDS stream.")
+	c.lock.Lock()
+	c.streams[streamId] = ctx
+	c.lock.Unlock()
+	c.AckTracker.OnStreamOpen(streamId)
 	return nil
 }
 
-func (c cb) OnStreamClosed(i int64) {
-	fmt.Println("on stream closed!!!")
+func (c *cb) OnStreamClosed(streamId int64) {
+	log.WithField("stream_id", streamId).Debug("Closed xDS stream.")
+	c.lock.Lock()
+	delete(c.streams, streamId)
+	c.lock.Unlock()
+	c.AckTracker.OnStreamClosed(streamId)
 }
 
-func (c cb) OnStreamRequest(i int64, request *discovery.DiscoveryRequest) error {
-	fmt.Println("on stream req!!!")
+func (c *cb) OnStreamRequest(streamId int64, req *discovery.DiscoveryRequest) error {
+	c.lock.Lock()
+	ctx, ok := c.streams[streamId]
+	c.lock.Unlock()
+	if ok {
+		if err := authorizeNode(ctx, req.GetNode().GetId()); err != nil {
+			return err
+		}
+	}
+	c.AckTracker.OnStreamRequest(streamId, req)
 	return nil
 }
 
-func (c cb) OnStreamResponse(i int64, request *discovery.DiscoveryRequest, response *discovery.DiscoveryResponse) {
-	fmt.Println("on stream resp!!!")
+func (c *cb) OnStreamResponse(streamId int64, _ *discovery.DiscoveryRequest, res *discovery.DiscoveryResponse) {
+	c.AckTracker.OnStreamResponse(streamId, res)
 }
 
-func (c cb) OnFetchRequest(ctx context.Context, request *discovery.DiscoveryRequest) error {
-	fmt.Println("on fetch req!!!")
-	return nil
+func (c *cb) OnFetchRequest(ctx context.Context, req *discovery.DiscoveryRequest) error {
+	return authorizeNode(ctx, req.GetNode().GetId())
 }
 
-func (c cb) OnFetchResponse(request *discovery.DiscoveryRequest, response *discovery.DiscoveryResponse) {
-	fmt.Println("on fetch resp!!!")
+func (c *cb) OnFetchResponse(*discovery.DiscoveryRequest, *discovery.DiscoveryResponse) {
 }
 
 func (e *envoyControlPlane) StartAsync() error {
-	server := serverv3.NewServer(context.Background(), e.StoreClient.SnapshotCache(), cb{})
+	sotw := serverv3.NewServer(context.Background(), e.StoreClient.SnapshotCache(), newCallbacks(e.AckTracker))
+	server := NewDeltaServer(sotw, e.StoreClient, e.AckTracker)
+
+	opts := make([]grpc.ServerOption, 0)
+	if e.Config.Xds.Tls.Enabled {
+		conf, err := e.CertAuthority.ServerConfig()
+		if err != nil {
+			return err
+		}
+		opts = append(opts, grpc.Creds(credentials.NewTLS(conf)))
+	}
 
-	grpcServer := grpc.NewServer()
+	grpcServer := grpc.NewServer(opts...)
 
 	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", e.Config.Xds.Port))
 	if err != nil {
 		return err
 	}
 
+	discovery.RegisterAggregatedDiscoveryServiceServer(grpcServer, server)
+	cds.RegisterClusterDiscoveryServiceServer(grpcServer, server)
 	eds.RegisterEndpointDiscoveryServiceServer(grpcServer, server)
 	rds.RegisterRouteDiscoveryServiceServer(grpcServer, server)
 	lds.RegisterListenerDiscoveryServiceServer(grpcServer, server)
 
 	errChan := make(chan error)
 	go func() {
-		log.WithField("port", e.Config.Xds.Port).Info("Started control plane server.")
+		log.WithField("port", e.Config.Xds.Port).WithField("tls", e.Config.Xds.Tls.Enabled).Info("Started control plane server.")
 		err := grpcServer.Serve(lis)
 		if err != nil {
 			errChan <- err
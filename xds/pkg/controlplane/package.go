@@ -5,8 +5,14 @@ import "github.com/eddieowens/axon"
 type Package struct {
 }
 
+func ackTrackerFactory(_ axon.Injector, _ axon.Args) axon.Instance {
+	return axon.StructPtr(NewAckTracker())
+}
+
 func (p *Package) Bindings() []axon.Binding {
 	return []axon.Binding{
 		axon.Bind(EnvoyControlPlaneKey).To().StructPtr(new(envoyControlPlane)),
+		axon.Bind(CertAuthorityKey).To().StructPtr(new(certAuthority)),
+		axon.Bind(AckTrackerKey).To().Factory(ackTrackerFactory).WithoutArgs(),
 	}
 }
@@ -0,0 +1,245 @@
+package controlplane
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"github.com/kage-cloud/kage/core/except"
+	"github.com/kage-cloud/kage/core/kube"
+	"github.com/kage-cloud/kage/xds/pkg/config"
+	"github.com/kage-cloud/kage/xds/pkg/model/consts"
+	"github.com/kage-cloud/kage/xds/pkg/util/certutil"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"io/ioutil"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"net"
+	"sync"
+)
+
+const CertAuthorityKey = "CertAuthority"
+
+// Holds the CA and certificate of the xDS server and issues the client certificates of the kage-meshes.
+type CertAuthority interface {
+	// The TLS config of the xDS server. Clients must present a certificate signed by the CA.
+	ServerConfig() (*tls.Config, error)
+
+	// Issues a client certificate for the node ID.
+	IssueClientCert(nodeId string) (*ClientCert, error)
+}
+
+// The PEM encoded client certificate and key of a kage-mesh and the CA of the xDS server.
+type ClientCert struct {
+	Cert []byte
+	Key  []byte
+	Ca   []byte
+}
+
+type certAuthority struct {
+	KubeClient kube.Client    `inject:"KubeClient"`
+	Config     *config.Config `inject:"Config"`
+
+	authority *certutil.Authority
+	server    *tls.Certificate
+	lock      sync.Mutex
+}
+
+func (c *certAuthority) ServerConfig() (*tls.Config, error) {
+	if err := c.load(); err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(c.authority.Cert)
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{*c.server},
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+func (c *certAuthority) IssueClientCert(nodeId string) (*ClientCert, error) {
+	if err := c.load(); err != nil {
+		return nil, err
+	}
+
+	cert, key, err := c.authority.Issue(&certutil.CertSpec{CommonName: nodeId, Client: true})
+	if err != nil {
+		return nil, err
+	}
+
+	return &ClientCert{
+		Cert: cert,
+		Key:  key,
+		Ca:   c.authority.CertPem,
+	}, nil
+}
+
+// Loads the CA and server certificate from the configured files or, if any are empty, from the Secret. The Secret is
+// created if it does not exist.
+func (c *certAuthority) load() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.authority != nil {
+		return nil
+	}
+
+	conf := c.Config.Xds.Tls
+	var data map[string][]byte
+	var err error
+	if conf.CertFile != "" && conf.KeyFile != "" && conf.CaFile != "" && conf.CaKeyFile != "" {
+		data, err = readFiles(map[string]string{
+			corev1.TLSCertKey:        conf.CertFile,
+			corev1.TLSPrivateKeyKey:  conf.KeyFile,
+			consts.XdsTlsFieldCaCert: conf.CaFile,
+			consts.XdsTlsFieldCaKey:  conf.CaKeyFile,
+		})
+	} else {
+		data, err = c.secretData()
+	}
+	if err != nil {
+		return err
+	}
+
+	authority, err := certutil.ParseAuthority(data[consts.XdsTlsFieldCaCert], data[consts.XdsTlsFieldCaKey])
+	if err != nil {
+		return err
+	}
+
+	server, err := tls.X509KeyPair(data[corev1.TLSCertKey], data[corev1.TLSPrivateKeyKey])
+	if err != nil {
+		return except.NewError("the xDS server's certificate is invalid: %s", except.ErrInvalid, err.Error())
+	}
+
+	c.authority = authority
+	c.server = &server
+	return nil
+}
+
+func (c *certAuthority) secretData() (map[string][]byte, error) {
+	name := c.Config.Xds.Tls.SecretName
+	namespace := c.KubeClient.ApiConfig().GetNamespace()
+	secrets := c.KubeClient.Api().CoreV1().Secrets(namespace)
+
+	secret, err := secrets.Get(name, metav1.GetOptions{})
+	if err == nil {
+		return secret.Data, nil
+	}
+	if !errors.IsNotFound(err) {
+		return nil, err
+	}
+
+	data, err := c.generate()
+	if err != nil {
+		return nil, err
+	}
+
+	secret = &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+			Labels: map[string]string{
+				consts.LabelKeyDomain: consts.Domain,
+			},
+		},
+		Type: corev1.SecretTypeOpaque,
+		Data: data,
+	}
+
+	if _, err := secrets.Create(secret); err != nil {
+		if !errors.IsAlreadyExists(err) {
+			return nil, err
+		}
+		// Another replica of the control plane generated the certificates first.
+		secret, err = secrets.Get(name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		return secret.Data, nil
+	}
+
+	log.WithField("name", name).
+		WithField("namespace", namespace).
+		Info("Generated the CA and certificate of the xDS server.")
+
+	return data, nil
+}
+
+// Generates a CA and a server certificate for the xDS address signed by it.
+func (c *certAuthority) generate() (map[string][]byte, error) {
+	authority, err := certutil.NewAuthority("kage-xds-ca")
+	if err != nil {
+		return nil, err
+	}
+
+	spec := &certutil.CertSpec{CommonName: "kage-xds"}
+	if ip := net.ParseIP(c.Config.Xds.Address); ip != nil {
+		spec.Ips = []net.IP{ip}
+	} else if c.Config.Xds.Address != "" {
+		spec.DnsNames = []string{c.Config.Xds.Address}
+	}
+
+	cert, key, err := authority.Issue(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	caKey, err := authority.KeyPem()
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string][]byte{
+		corev1.TLSCertKey:        cert,
+		corev1.TLSPrivateKeyKey:  key,
+		consts.XdsTlsFieldCaCert: authority.CertPem,
+		consts.XdsTlsFieldCaKey:  caKey,
+	}, nil
+}
+
+func readFiles(files map[string]string) (map[string][]byte, error) {
+	data := make(map[string][]byte, len(files))
+	for k, v := range files {
+		b, err := ioutil.ReadFile(v)
+		if err != nil {
+			return nil, err
+		}
+		data[k] = b
+	}
+	return data, nil
+}
+
+// Rejects the node ID if the stream is over TLS and its client certificate was not issued for the node ID. Streams
+// over plaintext are not checked.
+func authorizeNode(ctx context.Context, nodeId string) error {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return nil
+	}
+
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok {
+		return nil
+	}
+
+	if len(info.State.VerifiedChains) == 0 || len(info.State.VerifiedChains[0]) == 0 {
+		return status.Error(codes.Unauthenticated, "a verified client certificate is required")
+	}
+
+	if identity := info.State.VerifiedChains[0][0].Subject.CommonName; identity != nodeId {
+		log.WithField("node_id", nodeId).
+			WithField("identity", identity).
+			Warn("Rejected xDS stream with a client certificate for another node.")
+		return status.Errorf(codes.PermissionDenied, "the client certificate of %s cannot be used for node %s", identity, nodeId)
+	}
+
+	return nil
+}
@@ -0,0 +1,201 @@
+package controlplane
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	listener "github.com/envoyproxy/go-control-plane/envoy/config/listener/v3"
+	discovery "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
+	lds "github.com/envoyproxy/go-control-plane/envoy/service/listener/v3"
+	"github.com/envoyproxy/go-control-plane/pkg/resource/v3"
+	serverv3 "github.com/envoyproxy/go-control-plane/pkg/server/v3"
+	"github.com/kage-cloud/kage/xds/pkg/config"
+	"github.com/kage-cloud/kage/xds/pkg/snap"
+	"github.com/kage-cloud/kage/xds/pkg/snap/store"
+	"github.com/kage-cloud/kage/xds/pkg/util/certutil"
+	"github.com/stretchr/testify/suite"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type TlsTestSuite struct {
+	suite.Suite
+	dir           string
+	certAuthority *certAuthority
+	grpcServer    *grpc.Server
+	addr          string
+	ctx           context.Context
+	cancel        context.CancelFunc
+}
+
+func (t *TlsTestSuite) SetupTest() {
+	var err error
+	t.dir, err = ioutil.TempDir("", "kage-xds-tls")
+	t.Require().NoError(err)
+
+	ca, err := certutil.NewAuthority("kage-xds-ca")
+	t.Require().NoError(err)
+	caKey, err := ca.KeyPem()
+	t.Require().NoError(err)
+	cert, key, err := ca.Issue(&certutil.CertSpec{CommonName: "kage-xds", Ips: []net.IP{net.ParseIP("127.0.0.1")}})
+	t.Require().NoError(err)
+
+	conf := config.XdsTls{
+		Enabled:   true,
+		CertFile:  t.writeFile("tls.crt", cert),
+		KeyFile:   t.writeFile("tls.key", key),
+		CaFile:    t.writeFile("ca.crt", ca.CertPem),
+		CaKeyFile: t.writeFile("ca.key", caKey),
+	}
+	t.certAuthority = &certAuthority{Config: &config.Config{Xds: config.Xds{Tls: conf}}}
+
+	storeClient, err := snap.NewStoreClient(&snap.StoreClientSpec{PersistentStore: store.NewInMemoryStore()})
+	t.Require().NoError(err)
+	t.Require().NoError(storeClient.Set(&store.EnvoyState{
+		NodeId:    "node",
+		Listeners: []*listener.Listener{portListener("a", 8080)},
+	}))
+
+	ackTracker := NewAckTracker()
+	sotw := serverv3.NewServer(context.Background(), storeClient.SnapshotCache(), newCallbacks(ackTracker))
+	server := NewDeltaServer(sotw, storeClient, ackTracker)
+
+	serverConf, err := t.certAuthority.ServerConfig()
+	t.Require().NoError(err)
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	t.Require().NoError(err)
+	t.addr = lis.Addr().String()
+
+	t.grpcServer = grpc.NewServer(grpc.Creds(credentials.NewTLS(serverConf)))
+	lds.RegisterListenerDiscoveryServiceServer(t.grpcServer, server)
+	go func() {
+		_ = t.grpcServer.Serve(lis)
+	}()
+
+	t.ctx, t.cancel = context.WithTimeout(context.Background(), 5*time.Second)
+}
+
+func (t *TlsTestSuite) TearDownTest() {
+	t.cancel()
+	t.grpcServer.Stop()
+	_ = os.RemoveAll(t.dir)
+}
+
+func (t *TlsTestSuite) TestDelta() {
+	// -- Given
+	//
+	conn := t.dial("node")
+	defer conn.Close()
+
+	stream, err := lds.NewListenerDiscoveryServiceClient(conn).DeltaListeners(t.ctx)
+	t.Require().NoError(err)
+
+	// -- When
+	//
+	t.Require().NoError(stream.Send(&discovery.DeltaDiscoveryRequest{Node: &core.Node{Id: "node"}}))
+	actual, err := stream.Recv()
+
+	// -- Then
+	//
+	if t.NoError(err) {
+		t.Equal([]string{"a"}, resourceNames(actual))
+	}
+}
+
+func (t *TlsTestSuite) TestDeltaOtherNode() {
+	// -- Given
+	//
+	conn := t.dial("other")
+	defer conn.Close()
+
+	stream, err := lds.NewListenerDiscoveryServiceClient(conn).DeltaListeners(t.ctx)
+	t.Require().NoError(err)
+
+	// -- When
+	//
+	t.Require().NoError(stream.Send(&discovery.DeltaDiscoveryRequest{Node: &core.Node{Id: "node"}}))
+	_, err = stream.Recv()
+
+	// -- Then
+	//
+	t.Equal(codes.PermissionDenied, status.Code(err))
+}
+
+func (t *TlsTestSuite) TestSotw() {
+	// -- Given
+	//
+	conn := t.dial("node")
+	defer conn.Close()
+
+	stream, err := lds.NewListenerDiscoveryServiceClient(conn).StreamListeners(t.ctx)
+	t.Require().NoError(err)
+
+	// -- When
+	//
+	t.Require().NoError(stream.Send(&discovery.DiscoveryRequest{Node: &core.Node{Id: "node"}, TypeUrl: resource.ListenerType}))
+	actual, err := stream.Recv()
+
+	// -- Then
+	//
+	if t.NoError(err) {
+		t.Len(actual.Resources, 1)
+	}
+}
+
+func (t *TlsTestSuite) TestSotwOtherNode() {
+	// -- Given
+	//
+	conn := t.dial("other")
+	defer conn.Close()
+
+	stream, err := lds.NewListenerDiscoveryServiceClient(conn).StreamListeners(t.ctx)
+	t.Require().NoError(err)
+
+	// -- When
+	//
+	t.Require().NoError(stream.Send(&discovery.DiscoveryRequest{Node: &core.Node{Id: "node"}, TypeUrl: resource.ListenerType}))
+	_, err = stream.Recv()
+
+	// -- Then
+	//
+	t.Equal(codes.PermissionDenied, status.Code(err))
+}
+
+// Dials the server with a client certificate issued for the node ID.
+func (t *TlsTestSuite) dial(nodeId string) *grpc.ClientConn {
+	clientCert, err := t.certAuthority.IssueClientCert(nodeId)
+	t.Require().NoError(err)
+
+	pair, err := tls.X509KeyPair(clientCert.Cert, clientCert.Key)
+	t.Require().NoError(err)
+
+	roots := x509.NewCertPool()
+	t.Require().True(roots.AppendCertsFromPEM(clientCert.Ca))
+
+	conn, err := grpc.Dial(t.addr, grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{
+		Certificates: []tls.Certificate{pair},
+		RootCAs:      roots,
+	})))
+	t.Require().NoError(err)
+	return conn
+}
+
+func (t *TlsTestSuite) writeFile(name string, content []byte) string {
+	p := filepath.Join(t.dir, name)
+	t.Require().NoError(ioutil.WriteFile(p, content, 0600))
+	return p
+}
+
+func TestTlsTestSuite(t *testing.T) {
+	suite.Run(t, new(TlsTestSuite))
+}
@@ -0,0 +1,279 @@
+package crd
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/kage-cloud/kage/core/kube/ktypes"
+	"github.com/kage-cloud/kage/xds/pkg/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"strings"
+)
+
+const (
+	Group   = "kage.cloud"
+	Version = "v1alpha1"
+
+	KindCanary = "Canary"
+)
+
+var GroupVersion = schema.GroupVersion{Group: Group, Version: Version}
+
+var CanaryResource = GroupVersion.WithResource("canaries")
+
+// A canary defined as a custom resource rather than by annotations on the canary controller. The resource is mapped
+// onto the same annotations so both are handled identically.
+type Canary struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   CanarySpec   `json:"spec"`
+	Status CanaryStatus `json:"status,omitempty"`
+}
+
+type CanarySpec struct {
+	// The controller being replaced. Must be in the same namespace as the Canary.
+	Source ObjRef `json:"source"`
+
+	// The controller running the new version. Must be in the same namespace as the Canary.
+	Canary ObjRef `json:"canary"`
+
+	// The share of traffic sent to the canary when there are no steps.
+	RoutingPercentage uint32 `json:"routingPercentage,omitempty"`
+
+	Steps []Step `json:"steps,omitempty"`
+
+	Mode meta.CanaryMode `json:"mode,omitempty"`
+
+	// Requests matching any of the rules are always sent to the canary.
+	Match []Match `json:"match,omitempty"`
+
+	Sticky *Sticky `json:"sticky,omitempty"`
+
+	Analysis *Analysis `json:"analysis,omitempty"`
+
+	Resiliency *Resiliency `json:"resiliency,omitempty"`
+
+	Faults *Faults `json:"faults,omitempty"`
+}
+
+type ObjRef struct {
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+}
+
+type Step struct {
+	Weight uint32          `json:"weight"`
+	Pause  metav1.Duration `json:"pause"`
+}
+
+type Match struct {
+	Type  meta.RuleType `json:"type"`
+	Name  string        `json:"name"`
+	Value string        `json:"value"`
+}
+
+type Sticky struct {
+	Type meta.RuleType `json:"type"`
+	Name string        `json:"name"`
+}
+
+type Analysis struct {
+	MinRequests          uint64   `json:"minRequests,omitempty"`
+	MaxSuccessRateDrop   float64  `json:"maxSuccessRateDrop,omitempty"`
+	LatencyPercentile    float64  `json:"latencyPercentile,omitempty"`
+	MaxLatencyIncreaseMs float64  `json:"maxLatencyIncreaseMs,omitempty"`
+	Metrics              []string `json:"metrics,omitempty"`
+}
+
+type Resiliency struct {
+	Source *ClusterPolicy `json:"source,omitempty"`
+	Canary *ClusterPolicy `json:"canary,omitempty"`
+}
+
+type ClusterPolicy struct {
+	Timeout            *metav1.Duration `json:"timeout,omitempty"`
+	RetryOn            []string         `json:"retryOn,omitempty"`
+	NumRetries         uint32           `json:"numRetries,omitempty"`
+	MaxConnections     uint32           `json:"maxConnections,omitempty"`
+	MaxPendingRequests uint32           `json:"maxPendingRequests,omitempty"`
+	MaxRequests        uint32           `json:"maxRequests,omitempty"`
+}
+
+func (c *ClusterPolicy) toMeta() meta.ClusterPolicy {
+	if c == nil {
+		return meta.ClusterPolicy{}
+	}
+
+	policy := meta.ClusterPolicy{
+		RetryOn:    c.RetryOn,
+		NumRetries: c.NumRetries,
+		CircuitBreaker: meta.CircuitBreaker{
+			MaxConnections:     c.MaxConnections,
+			MaxPendingRequests: c.MaxPendingRequests,
+			MaxRequests:        c.MaxRequests,
+		},
+	}
+	if c.Timeout != nil {
+		policy.Timeout = c.Timeout.Duration.String()
+	}
+	return policy
+}
+
+type Faults struct {
+	Enabled bool   `json:"enabled,omitempty"`
+	Source  *Fault `json:"source,omitempty"`
+	Canary  *Fault `json:"canary,omitempty"`
+}
+
+type Fault struct {
+	Delay           *metav1.Duration `json:"delay,omitempty"`
+	DelayPercentage uint32           `json:"delayPercentage,omitempty"`
+	AbortStatus     uint32           `json:"abortStatus,omitempty"`
+	AbortPercentage uint32           `json:"abortPercentage,omitempty"`
+}
+
+func (f *Fault) toMeta() meta.Fault {
+	if f == nil {
+		return meta.Fault{}
+	}
+
+	fault := meta.Fault{
+		DelayPercentage: f.DelayPercentage,
+		AbortStatus:     f.AbortStatus,
+		AbortPercentage: f.AbortPercentage,
+	}
+	if f.Delay != nil {
+		fault.Delay = f.Delay.Duration.String()
+	}
+	return fault
+}
+
+type CanaryStatus struct {
+	Phase              meta.Phase `json:"phase,omitempty"`
+	Weight             uint32     `json:"weight"`
+	MeshName           string     `json:"meshName,omitempty"`
+	NodeId             string     `json:"nodeId,omitempty"`
+	LastTransitionTime string     `json:"lastTransitionTime,omitempty"`
+	Message            string     `json:"message,omitempty"`
+}
+
+func FromUnstructured(u *unstructured.Unstructured) (*Canary, error) {
+	b, err := u.MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+
+	canary := new(Canary)
+	if err := json.Unmarshal(b, canary); err != nil {
+		return nil, fmt.Errorf("invalid %s %s: %s", KindCanary, u.GetName(), err.Error())
+	}
+
+	return canary, nil
+}
+
+// Maps the resource onto the canary annotations. Returns an error if the spec is invalid.
+func (c *Canary) ToMeta() (*meta.Canary, error) {
+	spec := c.Spec
+	canary := &meta.Canary{
+		SourceObj:         meta.ObjRef{Name: spec.Source.Name, Kind: spec.Source.Kind, Namespace: c.Namespace},
+		CanaryObj:         meta.ObjRef{Name: spec.Canary.Name, Kind: spec.Canary.Kind, Namespace: c.Namespace},
+		RoutingPercentage: spec.RoutingPercentage,
+		Mode:              spec.Mode,
+		Resource:          c.Name,
+	}
+
+	for _, v := range []meta.ObjRef{canary.SourceObj, canary.CanaryObj} {
+		if v.Name == "" {
+			return nil, fmt.Errorf("the source and canary must both have a name")
+		}
+		if !ktypes.IsController(ktypes.Kind(v.Kind)) {
+			return nil, fmt.Errorf(`"%s" is not a supported controller kind`, v.Kind)
+		}
+	}
+
+	for _, v := range spec.Steps {
+		canary.Steps = append(canary.Steps, meta.Step{Weight: v.Weight, Pause: v.Pause.Duration}.String())
+	}
+
+	for _, v := range spec.Match {
+		// Lists are stored as comma separated annotations.
+		if strings.Contains(v.Value, ",") {
+			return nil, fmt.Errorf(`the value of match %s cannot contain a comma`, v.Name)
+		}
+		canary.Rules = append(canary.Rules, meta.Rule{Type: v.Type, Name: v.Name, Value: v.Value}.String())
+	}
+
+	if spec.Sticky != nil {
+		canary.Sticky = meta.Sticky{Type: spec.Sticky.Type, Name: spec.Sticky.Name}.String()
+	}
+
+	if spec.Analysis != nil {
+		canary.Analysis = meta.Analysis{
+			MinRequests:          spec.Analysis.MinRequests,
+			MaxSuccessRateDrop:   spec.Analysis.MaxSuccessRateDrop,
+			LatencyPercentile:    spec.Analysis.LatencyPercentile,
+			MaxLatencyIncreaseMs: spec.Analysis.MaxLatencyIncreaseMs,
+			Metrics:              spec.Analysis.Metrics,
+		}
+	}
+
+	if spec.Resiliency != nil {
+		canary.Resiliency = meta.Resiliency{
+			Source: spec.Resiliency.Source.toMeta(),
+			Canary: spec.Resiliency.Canary.toMeta(),
+		}
+	}
+
+	if spec.Faults != nil {
+		canary.Faults = meta.Faults{
+			Enabled: spec.Faults.Enabled,
+			Source:  spec.Faults.Source.toMeta(),
+			Canary:  spec.Faults.Canary.toMeta(),
+		}
+	}
+
+	if _, err := canary.RolloutSteps(); err != nil {
+		return nil, err
+	}
+
+	if _, err := canary.RoutingRules(); err != nil {
+		return nil, err
+	}
+
+	if _, err := canary.StickyKey(); err != nil {
+		return nil, err
+	}
+
+	if _, err := canary.CanaryMode(); err != nil {
+		return nil, err
+	}
+
+	if err := canary.Resiliency.Validate(); err != nil {
+		return nil, err
+	}
+
+	if err := canary.Faults.Validate(); err != nil {
+		return nil, err
+	}
+
+	return canary, nil
+}
+
+func StatusFromMeta(status *meta.Status) CanaryStatus {
+	return CanaryStatus{
+		Phase:              status.Phase,
+		Weight:             status.Weight,
+		MeshName:           status.MeshName,
+		NodeId:             status.NodeId,
+		LastTransitionTime: status.LastTransitionUtc,
+		Message:            status.Message,
+	}
+}
+
+// The status as an unstructured map to be set on the resource.
+func (c CanaryStatus) ToUnstructured() (map[string]interface{}, error) {
+	return runtime.DefaultUnstructuredConverter.ToUnstructured(&c)
+}
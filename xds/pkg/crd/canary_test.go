@@ -0,0 +1,201 @@
+package crd
+
+import (
+	"github.com/kage-cloud/kage/xds/pkg/meta"
+	"github.com/stretchr/testify/suite"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"testing"
+	"time"
+)
+
+type CanaryTestSuite struct {
+	suite.Suite
+}
+
+func (c *CanaryTestSuite) TestToMeta() {
+	// -- Given
+	//
+	given := &Canary{
+		ObjectMeta: metav1.ObjectMeta{Name: "nginx", Namespace: "default"},
+		Spec: CanarySpec{
+			Source: ObjRef{Kind: "Deployment", Name: "nginx"},
+			Canary: ObjRef{Kind: "Deployment", Name: "nginx-canary"},
+			Steps: []Step{
+				{Weight: 5, Pause: metav1.Duration{Duration: 5 * time.Minute}},
+				{Weight: 50, Pause: metav1.Duration{Duration: 10 * time.Minute}},
+			},
+			Match: []Match{
+				{Type: meta.RuleTypeHeader, Name: "x-canary", Value: "true"},
+			},
+			Sticky: &Sticky{Type: meta.RuleTypeCookie, Name: "session"},
+		},
+	}
+
+	expected := &meta.Canary{
+		SourceObj: meta.ObjRef{Name: "nginx", Kind: "Deployment", Namespace: "default"},
+		CanaryObj: meta.ObjRef{Name: "nginx-canary", Kind: "Deployment", Namespace: "default"},
+		Steps:     []string{"5:5m0s", "50:10m0s"},
+		Rules:     []string{"header:x-canary=true"},
+		Sticky:    "cookie:session",
+		Resource:  "nginx",
+	}
+
+	// -- When
+	//
+	actual, err := given.ToMeta()
+
+	// -- Then
+	//
+	if c.NoError(err) {
+		c.Equal(expected, actual)
+
+		steps, _ := actual.RolloutSteps()
+		c.Equal([]meta.Step{{Weight: 5, Pause: 5 * time.Minute}, {Weight: 50, Pause: 10 * time.Minute}}, steps)
+	}
+}
+
+func (c *CanaryTestSuite) TestToMetaResiliency() {
+	// -- Given
+	//
+	given := &Canary{
+		ObjectMeta: metav1.ObjectMeta{Name: "nginx", Namespace: "default"},
+		Spec: CanarySpec{
+			Source: ObjRef{Kind: "Deployment", Name: "nginx"},
+			Canary: ObjRef{Kind: "Deployment", Name: "nginx-canary"},
+			Resiliency: &Resiliency{
+				Canary: &ClusterPolicy{
+					Timeout:        &metav1.Duration{Duration: 2 * time.Second},
+					RetryOn:        []string{"5xx", "reset"},
+					NumRetries:     3,
+					MaxConnections: 10,
+				},
+			},
+		},
+	}
+
+	expected := meta.Resiliency{
+		Canary: meta.ClusterPolicy{
+			Timeout:        "2s",
+			RetryOn:        []string{"5xx", "reset"},
+			NumRetries:     3,
+			CircuitBreaker: meta.CircuitBreaker{MaxConnections: 10},
+		},
+	}
+
+	// -- When
+	//
+	actual, err := given.ToMeta()
+
+	// -- Then
+	//
+	if c.NoError(err) {
+		c.Equal(expected, actual.Resiliency)
+
+		timeout, err := actual.Resiliency.Canary.RequestTimeout()
+		c.NoError(err)
+		c.Equal(2*time.Second, timeout)
+	}
+}
+
+func (c *CanaryTestSuite) TestToMetaFaults() {
+	// -- Given
+	//
+	given := &Canary{
+		ObjectMeta: metav1.ObjectMeta{Name: "nginx", Namespace: "default"},
+		Spec: CanarySpec{
+			Source: ObjRef{Kind: "Deployment", Name: "nginx"},
+			Canary: ObjRef{Kind: "Deployment", Name: "nginx-canary"},
+			Faults: &Faults{
+				Enabled: true,
+				Canary: &Fault{
+					Delay:           &metav1.Duration{Duration: 500 * time.Millisecond},
+					DelayPercentage: 10,
+					AbortStatus:     503,
+					AbortPercentage: 5,
+				},
+			},
+		},
+	}
+
+	expected := meta.Faults{
+		Enabled: true,
+		Canary:  meta.Fault{Delay: "500ms", DelayPercentage: 10, AbortStatus: 503, AbortPercentage: 5},
+	}
+
+	// -- When
+	//
+	actual, err := given.ToMeta()
+
+	// -- Then
+	//
+	if c.NoError(err) {
+		c.Equal(expected, actual.Faults)
+		c.False(actual.Faults.Source.IsSet())
+		c.True(actual.Faults.Canary.IsSet())
+	}
+}
+
+func (c *CanaryTestSuite) TestToMetaInvalid() {
+	// -- Given
+	//
+	given := []CanarySpec{
+		{Source: ObjRef{Kind: "Deployment", Name: "nginx"}, Canary: ObjRef{Kind: "Service", Name: "nginx-canary"}},
+		{Source: ObjRef{Kind: "Deployment"}, Canary: ObjRef{Kind: "Deployment", Name: "nginx-canary"}},
+		{
+			Source: ObjRef{Kind: "Deployment", Name: "nginx"},
+			Canary: ObjRef{Kind: "Deployment", Name: "nginx-canary"},
+			Match:  []Match{{Type: meta.RuleTypeQuery, Name: "q", Value: "a,b"}},
+		},
+		{
+			Source: ObjRef{Kind: "Deployment", Name: "nginx"},
+			Canary: ObjRef{Kind: "Deployment", Name: "nginx-canary"},
+			Sticky: &Sticky{Type: meta.RuleTypeQuery, Name: "user"},
+		},
+		{
+			Source: ObjRef{Kind: "Deployment", Name: "nginx"},
+			Canary: ObjRef{Kind: "Deployment", Name: "nginx-canary"},
+			Faults: &Faults{Canary: &Fault{AbortStatus: 503, AbortPercentage: 150}},
+		},
+	}
+
+	for _, v := range given {
+		// -- When
+		//
+		_, err := (&Canary{Spec: v}).ToMeta()
+
+		// -- Then
+		//
+		c.Error(err)
+	}
+}
+
+func (c *CanaryTestSuite) TestFromUnstructured() {
+	// -- Given
+	//
+	given := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "kage.cloud/v1alpha1",
+		"kind":       "Canary",
+		"metadata":   map[string]interface{}{"name": "nginx", "namespace": "default"},
+		"spec": map[string]interface{}{
+			"source": map[string]interface{}{"kind": "Deployment", "name": "nginx"},
+			"canary": map[string]interface{}{"kind": "Deployment", "name": "nginx-canary"},
+			"steps":  []interface{}{map[string]interface{}{"weight": int64(25), "pause": "1m"}},
+		},
+	}}
+
+	// -- When
+	//
+	actual, err := FromUnstructured(given)
+
+	// -- Then
+	//
+	if c.NoError(err) {
+		c.Equal("nginx", actual.Name)
+		c.Equal([]Step{{Weight: 25, Pause: metav1.Duration{Duration: time.Minute}}}, actual.Spec.Steps)
+	}
+}
+
+func TestCanaryTestSuite(t *testing.T) {
+	suite.Run(t, new(CanaryTestSuite))
+}
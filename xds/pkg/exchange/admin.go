@@ -1,6 +1,50 @@
 package exchange
 
+import "time"
+
 type GetAdminRequest struct {
 	Namespace  string `param:"namespace"`
 	CanaryName string `param:"canary_name"`
 }
+
+// The versions of the resources currently served to a node.
+type NodeVersions struct {
+	NodeId string `json:"node_id"`
+
+	// The version of each resource type indexed by the type URL.
+	Versions map[string]string `json:"versions"`
+
+	UpdatedAt time.Time `json:"updated_at"`
+
+	// Why the node's snapshot references resources it does not have. Empty if the snapshot is consistent.
+	ConsistencyError string `json:"consistency_error,omitempty"`
+}
+
+type ListNodeVersionsResponse struct {
+	Data []NodeVersions `json:"data"`
+}
+
+// An Envoy connected to the control plane.
+type NodeDetails struct {
+	NodeId       string    `json:"node_id"`
+	EnvoyVersion string    `json:"envoy_version,omitempty"`
+	ConnectedAt  time.Time `json:"connected_at"`
+
+	// The latest ACK or NACK of every resource type indexed by the type URL.
+	Acks map[string]AckDetails `json:"acks"`
+}
+
+type AckDetails struct {
+	// For a NACK, this is the last version the Envoy accepted.
+	Version string `json:"version"`
+
+	// For a NACK, the version which was rejected if known.
+	Rejected string    `json:"rejected,omitempty"`
+	Nacked   bool      `json:"nacked"`
+	Error    string    `json:"error,omitempty"`
+	At       time.Time `json:"at"`
+}
+
+type ListNodesResponse struct {
+	Data []NodeDetails `json:"data"`
+}
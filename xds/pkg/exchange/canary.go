@@ -1,42 +1,82 @@
 package exchange
 
-import (
-	"github.com/kage-cloud/kage/core/except"
-	"github.com/kage-cloud/kage/core/kube/ktypes"
-)
+import "github.com/kage-cloud/kage/core/except"
 
-type Canary struct {
-	Name              string `json:"name"`
-	TargetDeploy      string `json:"target_deploy"`
-	RoutingPercentage uint32 `json:"routing_percentage"`
+type PromoteCanaryRequest struct {
+	Name      string `param:"name"`
+	Namespace string `param:"namespace"`
 }
 
-type CreateCanaryRequest struct {
-	Name                    string      `param:"name"`
-	Namespace               string      `param:"namespace"`
-	Kind                    ktypes.Kind `param:"kind"`
-	CanaryRoutingPercentage uint32      `json:"canary_routing_percentage"`
+func (p *PromoteCanaryRequest) Validate() error {
+	if p.Name == "" {
+		return except.NewError("Name field is required.", except.ErrInvalid)
+	}
+	if p.Namespace == "" {
+		return except.NewError("Namespace field is required.", except.ErrInvalid)
+	}
+	return nil
 }
 
-func (c *CreateCanaryRequest) Validate() error {
-	if c.Name == "" {
+type AbortCanaryRequest struct {
+	Name      string `param:"name"`
+	Namespace string `param:"namespace"`
+	Reason    string `json:"reason"`
+}
+
+func (a *AbortCanaryRequest) Validate() error {
+	if a.Name == "" {
 		return except.NewError("Name field is required.", except.ErrInvalid)
 	}
-	if c.Namespace == "" {
+	if a.Namespace == "" {
 		return except.NewError("Namespace field is required.", except.ErrInvalid)
 	}
-	if !ktypes.IsController(c.Kind) {
-		return except.NewError("%s is not a valid controller. A controller is anything that controls a pod e.g. a "+
-			"Deployment, StatefulSet, or even a Pod.", except.ErrInvalid)
-	}
 	return nil
 }
 
-type CreateCanaryResponse struct {
-	Data *Canary `json:"data"`
+type ObjRef struct {
+	Name      string `json:"name"`
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace"`
+}
+
+type CanaryDetails struct {
+	Source ObjRef `json:"source"`
+	Canary ObjRef `json:"canary"`
+
+	// Empty until the kage-mesh for the canary is created.
+	NodeId string `json:"node_id,omitempty"`
+
+	// The weight of traffic currently routed to the canary by the kage-mesh.
+	Weight uint32 `json:"weight"`
+	Phase  string `json:"phase,omitempty"`
+
+	// Whether faults are being injected into the source and canary's traffic.
+	FaultsEnabled bool `json:"faults_enabled"`
+}
+
+type ListCanariesRequest struct {
+	Namespace string `query:"namespace"`
 }
 
-type DeleteCanaryRequest struct {
+type ListCanariesResponse struct {
+	Data []CanaryDetails `json:"data"`
+}
+
+type GetCanaryRequest struct {
 	Name      string `param:"name"`
 	Namespace string `param:"namespace"`
 }
+
+func (g *GetCanaryRequest) Validate() error {
+	if g.Name == "" {
+		return except.NewError("Name field is required.", except.ErrInvalid)
+	}
+	if g.Namespace == "" {
+		return except.NewError("Namespace field is required.", except.ErrInvalid)
+	}
+	return nil
+}
+
+type GetCanaryResponse struct {
+	Data *CanaryDetails `json:"data"`
+}
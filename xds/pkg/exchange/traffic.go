@@ -1,9 +1,57 @@
 package exchange
 
+import (
+	"github.com/kage-cloud/kage/core/except"
+	"github.com/kage-cloud/kage/xds/pkg/model"
+)
+
+// Changes the percentage of traffic sent to a canary.
 type DirectTrafficRequest struct {
-	EndpointName string `json:"endpoint_name" param:"endpoint_name"`
-	Percentage   uint32 `json:"percentage"`
+	Name       string  `param:"name"`
+	Namespace  string  `param:"namespace"`
+	Percentage *uint32 `json:"percentage"`
+}
+
+func (d *DirectTrafficRequest) Validate() error {
+	if d.Name == "" {
+		return except.NewError("Name field is required.", except.ErrInvalid)
+	}
+	if d.Namespace == "" {
+		return except.NewError("Namespace field is required.", except.ErrInvalid)
+	}
+	if d.Percentage == nil {
+		return except.NewError("Percentage field is required.", except.ErrInvalid)
+	}
+	if *d.Percentage > model.TotalRoutingWeight {
+		return except.NewError("Percentage field cannot exceed %d.", except.ErrInvalid, model.TotalRoutingWeight)
+	}
+	return nil
 }
 
 type DirectTrafficResponse struct {
+	Data *CanaryDetails `json:"data"`
+}
+
+// Switches the fault injection of a canary on or off.
+type ToggleFaultsRequest struct {
+	Name      string `param:"name"`
+	Namespace string `param:"namespace"`
+	Enabled   *bool  `json:"enabled"`
+}
+
+func (t *ToggleFaultsRequest) Validate() error {
+	if t.Name == "" {
+		return except.NewError("Name field is required.", except.ErrInvalid)
+	}
+	if t.Namespace == "" {
+		return except.NewError("Namespace field is required.", except.ErrInvalid)
+	}
+	if t.Enabled == nil {
+		return except.NewError("Enabled field is required.", except.ErrInvalid)
+	}
+	return nil
+}
+
+type ToggleFaultsResponse struct {
+	Data *CanaryDetails `json:"data"`
 }
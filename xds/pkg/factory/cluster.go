@@ -0,0 +1,144 @@
+package factory
+
+import (
+	cluster "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
+	envcore "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/wrappers"
+	"github.com/kage-cloud/kage/xds/pkg/meta"
+	"github.com/kage-cloud/kage/xds/pkg/model"
+	"time"
+)
+
+const ClusterFactoryKey = "ClusterFactory"
+
+type ClusterFactory interface {
+	// The EDS clusters of the source, canary, every other variant, and the sticky cluster if the kage-mesh has one.
+	// Each cluster has its circuit breaker thresholds with the sticky cluster using the canary's.
+	FromXdsConfig(xdsConfig *meta.XdsConfig) []*cluster.Cluster
+}
+
+// If ads is true, the endpoints are requested over the ADS stream. If delta is true, they are requested over the
+// incremental xDS protocol.
+func NewClusterFactory(ads, delta bool) ClusterFactory {
+	return &clusterFactory{ads: ads, delta: delta}
+}
+
+type clusterFactory struct {
+	ads   bool
+	delta bool
+}
+
+func (c *clusterFactory) FromXdsConfig(xdsConfig *meta.XdsConfig) []*cluster.Cluster {
+	clusters := []*cluster.Cluster{
+		c.eds(xdsConfig.Source.ClusterName, cluster.Cluster_ROUND_ROBIN, c.circuitBreakers(xdsConfig, xdsConfig.Source.ClusterName)),
+		c.eds(xdsConfig.Canary.ClusterName, cluster.Cluster_ROUND_ROBIN, c.circuitBreakers(xdsConfig, xdsConfig.Canary.ClusterName)),
+	}
+
+	for _, v := range xdsConfig.VariantClusters() {
+		if v != xdsConfig.Canary.ClusterName {
+			clusters = append(clusters, c.eds(v, cluster.Cluster_ROUND_ROBIN, c.circuitBreakers(xdsConfig, v)))
+		}
+	}
+
+	if xdsConfig.Sticky.ClusterName != "" {
+		sticky := c.eds(xdsConfig.Sticky.ClusterName, cluster.Cluster_RING_HASH, c.circuitBreakers(xdsConfig, xdsConfig.Canary.ClusterName))
+		// The split between the source and canary is done by the locality weights of the sticky endpoints.
+		sticky.CommonLbConfig = &cluster.Cluster_CommonLbConfig{
+			LocalityConfigSpecifier: &cluster.Cluster_CommonLbConfig_LocalityWeightedLbConfig_{
+				LocalityWeightedLbConfig: &cluster.Cluster_CommonLbConfig_LocalityWeightedLbConfig{},
+			},
+		}
+		clusters = append(clusters, sticky)
+	}
+
+	return clusters
+}
+
+// The protocol spoken to the endpoints is set on the cluster of each port by PortCluster.
+func (c *clusterFactory) eds(name string, lbPolicy cluster.Cluster_LbPolicy, circuitBreakers *cluster.CircuitBreakers) *cluster.Cluster {
+	return &cluster.Cluster{
+		Name:                 name,
+		ConnectTimeout:       ptypes.DurationProto(time.Second),
+		ClusterDiscoveryType: &cluster.Cluster_Type{Type: cluster.Cluster_EDS},
+		LbPolicy:             lbPolicy,
+		CircuitBreakers:      circuitBreakers,
+		EdsClusterConfig: &cluster.Cluster_EdsClusterConfig{
+			EdsConfig: xdsConfigSource(c.ads, c.delta),
+		},
+	}
+}
+
+// A copy of the cluster which serves the port. Requests are sent to the endpoints over HTTP/2 for grpc and http2 ports
+// and over HTTP/1 for http ports as the application only speaks the protocol its port declares. TCP ports set neither.
+func PortCluster(c *cluster.Cluster, port uint32, protocol model.PortProtocol) *cluster.Cluster {
+	out := proto.Clone(c).(*cluster.Cluster)
+	out.Name = model.PortName(c.Name, port)
+	out.ProtocolSelection = cluster.Cluster_USE_CONFIGURED_PROTOCOL
+	out.HttpProtocolOptions = nil
+	out.Http2ProtocolOptions = nil
+
+	switch protocol {
+	case model.PortProtocolGrpc, model.PortProtocolHttp2:
+		out.Http2ProtocolOptions = &envcore.Http2ProtocolOptions{}
+	case model.PortProtocolHttp:
+		out.HttpProtocolOptions = &envcore.Http1ProtocolOptions{}
+	}
+
+	return out
+}
+
+// Nil if the cluster has no thresholds in which case Envoy's defaults are used.
+func (c *clusterFactory) circuitBreakers(xdsConfig *meta.XdsConfig, name string) *cluster.CircuitBreakers {
+	cb, ok := xdsConfig.CircuitBreakers[name]
+	if !ok {
+		return nil
+	}
+
+	return &cluster.CircuitBreakers{
+		Thresholds: []*cluster.CircuitBreakers_Thresholds{
+			{
+				MaxConnections:     &wrappers.UInt32Value{Value: cb.MaxConnections},
+				MaxPendingRequests: &wrappers.UInt32Value{Value: cb.MaxPendingRequests},
+				MaxRequests:        &wrappers.UInt32Value{Value: cb.MaxRequests},
+			},
+		},
+	}
+}
+
+// The config source of the kage-mesh's control plane. If ads is true, the resource is requested over the ADS stream
+// set up by the bootstrap. Otherwise, the resource is requested over its own incremental stream if delta is true.
+func xdsConfigSource(ads, delta bool) *envcore.ConfigSource {
+	if ads {
+		return &envcore.ConfigSource{
+			ResourceApiVersion:    envcore.ApiVersion_V3,
+			ConfigSourceSpecifier: &envcore.ConfigSource_Ads{Ads: &envcore.AggregatedConfigSource{}},
+		}
+	}
+
+	apiType := envcore.ApiConfigSource_GRPC
+	if delta {
+		apiType = envcore.ApiConfigSource_DELTA_GRPC
+	}
+
+	return &envcore.ConfigSource{
+		ResourceApiVersion: envcore.ApiVersion_V3,
+		ConfigSourceSpecifier: &envcore.ConfigSource_ApiConfigSource{
+			ApiConfigSource: &envcore.ApiConfigSource{
+				ApiType:             apiType,
+				TransportApiVersion: envcore.ApiVersion_V3,
+				GrpcServices: []*envcore.GrpcService{
+					{
+						TargetSpecifier: &envcore.GrpcService_EnvoyGrpc_{
+							EnvoyGrpc: &envcore.GrpcService_EnvoyGrpc{
+								ClusterName: model.XdsClusterName,
+							},
+						},
+					},
+				},
+				SetNodeOnFirstMessageOnly: true,
+			},
+		},
+	}
+}
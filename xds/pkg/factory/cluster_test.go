@@ -0,0 +1,156 @@
+package factory
+
+import (
+	cluster "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
+	envcore "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	"github.com/kage-cloud/kage/xds/pkg/meta"
+	"github.com/kage-cloud/kage/xds/pkg/model"
+	"github.com/stretchr/testify/suite"
+	"testing"
+)
+
+type ClusterTestSuite struct {
+	suite.Suite
+	factory ClusterFactory
+}
+
+func (c *ClusterTestSuite) SetupTest() {
+	c.factory = NewClusterFactory(false, false)
+}
+
+func (c *ClusterTestSuite) TestFromXdsConfig() {
+	// -- Given
+	//
+	given := &meta.XdsConfig{
+		XdsId:    meta.XdsId{NodeId: "node"},
+		Canary:   meta.EnvoyConfig{ClusterName: "canary"},
+		Source:   meta.EnvoyConfig{ClusterName: "source"},
+		Sticky:   meta.EnvoyConfig{ClusterName: "sticky"},
+		Variants: map[string]string{"nginx-canary": "canary", "nginx-canary-b": "canary-1"},
+		CircuitBreakers: map[string]meta.CircuitBreaker{
+			"canary": {MaxConnections: 10, MaxPendingRequests: 20, MaxRequests: 30},
+		},
+	}
+
+	// -- When
+	//
+	actual := c.factory.FromXdsConfig(given)
+
+	// -- Then
+	//
+	if c.Len(actual, 4) {
+		c.Equal("source", actual[0].Name)
+		c.Nil(actual[0].CircuitBreakers)
+
+		c.Equal("canary", actual[1].Name)
+		c.Equal(cluster.Cluster_EDS, actual[1].GetType())
+		c.Equal(uint32(10), actual[1].CircuitBreakers.Thresholds[0].MaxConnections.Value)
+
+		c.Equal("canary-1", actual[2].Name)
+
+		c.Equal("sticky", actual[3].Name)
+		c.Equal(cluster.Cluster_RING_HASH, actual[3].LbPolicy)
+		c.NotNil(actual[3].CommonLbConfig.GetLocalityWeightedLbConfig())
+		c.Equal(uint32(30), actual[3].CircuitBreakers.Thresholds[0].MaxRequests.Value)
+	}
+}
+
+func (c *ClusterTestSuite) TestFromXdsConfigLegacy() {
+	// -- Given
+	//
+	given := &meta.XdsConfig{
+		XdsId:  meta.XdsId{NodeId: "node"},
+		Canary: meta.EnvoyConfig{ClusterName: "canary"},
+		Source: meta.EnvoyConfig{ClusterName: "source"},
+	}
+
+	// -- When
+	//
+	actual := c.factory.FromXdsConfig(given)
+
+	// -- Then
+	//
+	if c.Len(actual, 2) {
+		c.Equal("source", actual[0].Name)
+		c.Equal("canary", actual[1].Name)
+		for _, v := range actual {
+			c.NoError(v.Validate())
+		}
+	}
+}
+
+func (c *ClusterTestSuite) TestFromXdsConfigAds() {
+	// -- Given
+	//
+	given := &meta.XdsConfig{
+		XdsId:  meta.XdsId{NodeId: "node"},
+		Canary: meta.EnvoyConfig{ClusterName: "canary"},
+		Source: meta.EnvoyConfig{ClusterName: "source"},
+	}
+
+	// -- When
+	//
+	actual := NewClusterFactory(true, false).FromXdsConfig(given)
+
+	// -- Then
+	//
+	for _, v := range actual {
+		c.NotNil(v.EdsClusterConfig.EdsConfig.GetAds())
+		c.Nil(v.EdsClusterConfig.EdsConfig.GetApiConfigSource())
+	}
+}
+
+func (c *ClusterTestSuite) TestFromXdsConfigDelta() {
+	// -- Given
+	//
+	given := &meta.XdsConfig{
+		XdsId:  meta.XdsId{NodeId: "node"},
+		Canary: meta.EnvoyConfig{ClusterName: "canary"},
+		Source: meta.EnvoyConfig{ClusterName: "source"},
+	}
+
+	// -- When
+	//
+	actual := NewClusterFactory(false, true).FromXdsConfig(given)
+
+	// -- Then
+	//
+	for _, v := range actual {
+		c.Equal(envcore.ApiConfigSource_DELTA_GRPC, v.EdsClusterConfig.EdsConfig.GetApiConfigSource().GetApiType())
+	}
+}
+
+func (c *ClusterTestSuite) TestPortCluster() {
+	// -- Given
+	//
+	given := c.factory.FromXdsConfig(&meta.XdsConfig{
+		Canary: meta.EnvoyConfig{ClusterName: "canary"},
+		Source: meta.EnvoyConfig{ClusterName: "source"},
+	})[0]
+
+	// -- When
+	//
+	grpc := PortCluster(given, 9090, model.PortProtocolGrpc)
+	http := PortCluster(given, 8080, model.PortProtocolHttp)
+	tcp := PortCluster(given, 5432, model.PortProtocolTcp)
+
+	// -- Then
+	//
+	c.Equal("source|9090", grpc.Name)
+	c.NotNil(grpc.Http2ProtocolOptions)
+	c.Nil(grpc.HttpProtocolOptions)
+	c.Equal(cluster.Cluster_USE_CONFIGURED_PROTOCOL, grpc.ProtocolSelection)
+
+	c.Equal("source|8080", http.Name)
+	c.NotNil(http.HttpProtocolOptions)
+	c.Nil(http.Http2ProtocolOptions)
+
+	c.Nil(tcp.HttpProtocolOptions)
+	c.Nil(tcp.Http2ProtocolOptions)
+
+	c.Equal("source", given.Name)
+}
+
+func TestClusterTestSuite(t *testing.T) {
+	suite.Run(t, new(ClusterTestSuite))
+}
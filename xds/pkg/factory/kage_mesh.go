@@ -15,6 +15,13 @@ const KageMeshFactoryKey = "KageMeshFactory"
 type KageMeshFactory interface {
 	Deploy(name string, xdsAnno *meta.XdsConfig) *appsv1.Deployment
 	BaselineConfigMap(name string, content []byte) *corev1.ConfigMap
+
+	// The Secret of the kage-mesh's xDS client certificate, key, and the CA of the xDS server.
+	XdsTlsSecret(name string, cert, key, ca []byte) *corev1.Secret
+
+	// Mounts the Secret of the xDS client certificate into the kage-mesh's container. Does nothing if it is already
+	// mounted.
+	MountXdsTls(dep *appsv1.Deployment, secretName string)
 }
 
 type kageMeshFactory struct {
@@ -31,6 +38,47 @@ func (k *kageMeshFactory) BaselineConfigMap(name string, content []byte) *corev1
 	}
 }
 
+func (k *kageMeshFactory) XdsTlsSecret(name string, cert, key, ca []byte) *corev1.Secret {
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+		},
+		Type: corev1.SecretTypeTLS,
+		Data: map[string][]byte{
+			corev1.TLSCertKey:        cert,
+			corev1.TLSPrivateKeyKey:  key,
+			consts.XdsTlsFieldCaCert: ca,
+		},
+	}
+}
+
+func (k *kageMeshFactory) MountXdsTls(dep *appsv1.Deployment, secretName string) {
+	spec := &dep.Spec.Template.Spec
+	for _, v := range spec.Volumes {
+		if v.Name == consts.XdsTlsVolumeName {
+			return
+		}
+	}
+
+	spec.Volumes = append(spec.Volumes, corev1.Volume{
+		Name: consts.XdsTlsVolumeName,
+		VolumeSource: corev1.VolumeSource{
+			Secret: &corev1.SecretVolumeSource{
+				SecretName: secretName,
+				Optional:   pointer.BoolPtr(false),
+			},
+		},
+	})
+
+	for i := range spec.Containers {
+		spec.Containers[i].VolumeMounts = append(spec.Containers[i].VolumeMounts, corev1.VolumeMount{
+			Name:      consts.XdsTlsVolumeName,
+			ReadOnly:  true,
+			MountPath: consts.XdsTlsMountPath,
+		})
+	}
+}
+
 func (k *kageMeshFactory) Deploy(name string, xdsAnno *meta.XdsConfig) *appsv1.Deployment {
 	labels := meta.ToMap(&xdsAnno.XdsId)
 
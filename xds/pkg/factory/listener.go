@@ -6,67 +6,136 @@ import (
 	envcore "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
 	listener "github.com/envoyproxy/go-control-plane/envoy/config/listener/v3"
 	fileaccessloggers "github.com/envoyproxy/go-control-plane/envoy/extensions/access_loggers/file/v3"
+	fault "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/fault/v3"
+	grpcstats "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/grpc_stats/v3"
 	hcm "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/http_connection_manager/v3"
+	tcp "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/tcp_proxy/v3"
 	"github.com/envoyproxy/go-control-plane/pkg/wellknown"
+	"github.com/golang/protobuf/proto"
 	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/wrappers"
+	"github.com/kage-cloud/kage/core/except"
 	"github.com/kage-cloud/kage/xds/pkg/model"
+	"sort"
 )
 
 const ListenerFactoryKey = "ListenerFactory"
 
 type ListenerFactory interface {
-	Listener(name string, port uint32, protocol envcore.SocketAddress_Protocol) (*listener.Listener, error)
+	// Routes the HTTP requests on the port by the routes of the kage-mesh. HTTP/2 and gRPC ports only accept HTTP/2 and
+	// gRPC ports also record the stats of each gRPC method by its status code. The fault filter injects nothing unless
+	// a route or weighted cluster overrides it with a fault.
+	Listener(name string, port uint32, protocol envcore.SocketAddress_Protocol, appProtocol model.PortProtocol) (*listener.Listener, error)
+
+	// Forwards the raw TCP connections on the port to the clusters split by their weights. Clusters without any weight
+	// are left out.
+	TcpProxy(name string, port uint32, protocol envcore.SocketAddress_Protocol, weights map[string]uint32) (*listener.Listener, error)
 }
 
-func NewListenerFactory() ListenerFactory {
-	return new(listenerFactory)
+// If ads is true, the routes are requested over the ADS stream. If delta is true, they are requested over the
+// incremental xDS protocol.
+func NewListenerFactory(ads, delta bool) ListenerFactory {
+	return &listenerFactory{ads: ads, delta: delta}
 }
 
 type listenerFactory struct {
+	ads   bool
+	delta bool
 }
 
-func (l *listenerFactory) Listener(name string, port uint32, protocol envcore.SocketAddress_Protocol) (*listener.Listener, error) {
-	accesslogFilter := &fileaccessloggers.FileAccessLog{
-		Path: "/dev/stdout",
+func (l *listenerFactory) TcpProxy(name string, port uint32, protocol envcore.SocketAddress_Protocol, weights map[string]uint32) (*listener.Listener, error) {
+	names := make([]string, 0, len(weights))
+	for k, v := range weights {
+		if v > 0 {
+			names = append(names, k)
+		}
 	}
-	alfAny, err := ptypes.MarshalAny(accesslogFilter)
+	sort.Strings(names)
+
+	proxy := &tcp.TcpProxy{
+		StatPrefix: "tcp",
+	}
+
+	switch len(names) {
+	case 0:
+		return nil, except.NewError("No clusters to forward the TCP connections on port %d to", except.ErrInvalid, port)
+	case 1:
+		proxy.ClusterSpecifier = &tcp.TcpProxy_Cluster{Cluster: names[0]}
+	default:
+		clusters := make([]*tcp.TcpProxy_WeightedCluster_ClusterWeight, len(names))
+		for i, v := range names {
+			clusters[i] = &tcp.TcpProxy_WeightedCluster_ClusterWeight{
+				Name:   v,
+				Weight: weights[v],
+			}
+		}
+		proxy.ClusterSpecifier = &tcp.TcpProxy_WeightedClusters{
+			WeightedClusters: &tcp.TcpProxy_WeightedCluster{Clusters: clusters},
+		}
+	}
+
+	return l.listener(name, port, protocol, wellknown.TCPProxy, proxy)
+}
+
+func (l *listenerFactory) Listener(name string, port uint32, protocol envcore.SocketAddress_Protocol, appProtocol model.PortProtocol) (*listener.Listener, error) {
+	httpFilters := make([]*hcm.HttpFilter, 0, 3)
+	codec := hcm.HttpConnectionManager_AUTO
+	switch appProtocol {
+	case model.PortProtocolGrpc:
+		grpcStats, err := ptypes.MarshalAny(&grpcstats.FilterConfig{
+			PerMethodStatSpecifier: &grpcstats.FilterConfig_StatsForAllMethods{
+				StatsForAllMethods: &wrappers.BoolValue{Value: true},
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+		httpFilters = append(httpFilters, &hcm.HttpFilter{
+			Name:       wellknown.HTTPGRPCStats,
+			ConfigType: &hcm.HttpFilter_TypedConfig{TypedConfig: grpcStats},
+		})
+		codec = hcm.HttpConnectionManager_HTTP2
+	case model.PortProtocolHttp2:
+		codec = hcm.HttpConnectionManager_HTTP2
+	}
+
+	faultAny, err := ptypes.MarshalAny(&fault.HTTPFault{})
 	if err != nil {
 		return nil, err
 	}
+	httpFilters = append(httpFilters,
+		&hcm.HttpFilter{
+			Name:       wellknown.Fault,
+			ConfigType: &hcm.HttpFilter_TypedConfig{TypedConfig: faultAny},
+		},
+		&hcm.HttpFilter{Name: wellknown.Router},
+	)
+
 	manager := &hcm.HttpConnectionManager{
 		StatPrefix: "http",
+		CodecType:  codec,
 		RouteSpecifier: &hcm.HttpConnectionManager_Rds{
 			Rds: &hcm.Rds{
-				RouteConfigName: "nginx-nginx-kage-canary",
-				ConfigSource: &envcore.ConfigSource{
-					ResourceApiVersion: envcore.ApiVersion_V3,
-					ConfigSourceSpecifier: &envcore.ConfigSource_ApiConfigSource{
-						ApiConfigSource: &envcore.ApiConfigSource{
-							ApiType:             envcore.ApiConfigSource_GRPC,
-							TransportApiVersion: envcore.ApiVersion_V3,
-							GrpcServices: []*envcore.GrpcService{
-								{
-									TargetSpecifier: &envcore.GrpcService_EnvoyGrpc_{
-										EnvoyGrpc: &envcore.GrpcService_EnvoyGrpc{
-											ClusterName: model.XdsClusterName,
-										},
-									},
-								},
-							},
-							SetNodeOnFirstMessageOnly: true,
-						},
-					},
-				},
-			},
-		},
-		HttpFilters: []*hcm.HttpFilter{
-			{
-				Name: wellknown.Router,
+				RouteConfigName: model.RouteConfigName,
+				ConfigSource:    xdsConfigSource(l.ads, l.delta),
 			},
 		},
+		HttpFilters: httpFilters,
+	}
+
+	return l.listener(name, port, protocol, wellknown.HTTPConnectionManager, manager)
+}
+
+func (l *listenerFactory) listener(name string, port uint32, protocol envcore.SocketAddress_Protocol, filterName string, filter proto.Message) (*listener.Listener, error) {
+	accesslogFilter := &fileaccessloggers.FileAccessLog{
+		Path: "/dev/stdout",
+	}
+	alfAny, err := ptypes.MarshalAny(accesslogFilter)
+	if err != nil {
+		return nil, err
 	}
 
-	hcmAny, err := ptypes.MarshalAny(manager)
+	filterAny, err := ptypes.MarshalAny(filter)
 	if err != nil {
 		return nil, err
 	}
@@ -94,9 +163,9 @@ func (l *listenerFactory) Listener(name string, port uint32, protocol envcore.So
 			{
 				Filters: []*listener.Filter{
 					{
-						Name: wellknown.HTTPConnectionManager,
+						Name: filterName,
 						ConfigType: &listener.Filter_TypedConfig{
-							TypedConfig: hcmAny,
+							TypedConfig: filterAny,
 						},
 					},
 				},
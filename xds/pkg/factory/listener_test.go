@@ -0,0 +1,159 @@
+package factory
+
+import (
+	envcore "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	hcm "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/http_connection_manager/v3"
+	tcp "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/tcp_proxy/v3"
+	"github.com/envoyproxy/go-control-plane/pkg/wellknown"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/kage-cloud/kage/core/except"
+	"github.com/kage-cloud/kage/xds/pkg/model"
+	"github.com/kage-cloud/kage/xds/pkg/util/envoyutil"
+	"github.com/stretchr/testify/suite"
+	"testing"
+)
+
+type ListenerTestSuite struct {
+	suite.Suite
+	factory ListenerFactory
+}
+
+func (l *ListenerTestSuite) SetupTest() {
+	l.factory = NewListenerFactory(false, false)
+}
+
+func (l *ListenerTestSuite) TestListener() {
+	// -- Given
+	//
+
+	// -- When
+	//
+	actual, err := l.factory.Listener("listener-8080", 8080, envcore.SocketAddress_TCP, model.PortProtocolHttp)
+
+	// -- Then
+	//
+	if l.NoError(err) {
+		filter := actual.FilterChains[0].Filters[0]
+		l.Equal(wellknown.HTTPConnectionManager, filter.Name)
+		l.NoError(ptypes.UnmarshalAny(filter.GetTypedConfig(), new(hcm.HttpConnectionManager)))
+		l.False(envoyutil.IsTcpProxy(actual))
+		l.True(envoyutil.ListenerMatchesPort(8080, actual))
+	}
+}
+
+func (l *ListenerTestSuite) TestListenerGrpc() {
+	// -- Given
+	//
+
+	// -- When
+	//
+	actual, err := l.factory.Listener("listener-9090", 9090, envcore.SocketAddress_TCP, model.PortProtocolGrpc)
+
+	// -- Then
+	//
+	if l.NoError(err) {
+		manager := new(hcm.HttpConnectionManager)
+		if l.NoError(ptypes.UnmarshalAny(actual.FilterChains[0].Filters[0].GetTypedConfig(), manager)) {
+			l.Equal(hcm.HttpConnectionManager_HTTP2, manager.CodecType)
+			if l.Len(manager.HttpFilters, 3) {
+				l.Equal(wellknown.HTTPGRPCStats, manager.HttpFilters[0].Name)
+				l.Equal(wellknown.Fault, manager.HttpFilters[1].Name)
+				l.Equal(wellknown.Router, manager.HttpFilters[2].Name)
+			}
+		}
+	}
+}
+
+func (l *ListenerTestSuite) TestListenerAds() {
+	// -- Given
+	//
+	factory := NewListenerFactory(true, false)
+
+	// -- When
+	//
+	actual, err := factory.Listener("listener-8080", 8080, envcore.SocketAddress_TCP, model.PortProtocolHttp)
+
+	// -- Then
+	//
+	if l.NoError(err) {
+		manager := new(hcm.HttpConnectionManager)
+		if l.NoError(ptypes.UnmarshalAny(actual.FilterChains[0].Filters[0].GetTypedConfig(), manager)) {
+			l.Equal(model.RouteConfigName, manager.GetRds().RouteConfigName)
+			l.NotNil(manager.GetRds().ConfigSource.GetAds())
+		}
+	}
+}
+
+func (l *ListenerTestSuite) TestTcpProxyWeighted() {
+	// -- Given
+	//
+	given := map[string]uint32{
+		"source":   70,
+		"canary":   30,
+		"canary-b": 0,
+	}
+
+	// -- When
+	//
+	actual, err := l.factory.TcpProxy("listener-6379", 6379, envcore.SocketAddress_TCP, given)
+
+	// -- Then
+	//
+	if l.NoError(err) {
+		l.True(envoyutil.IsTcpProxy(actual))
+		l.True(envoyutil.ListenerMatchesPort(6379, actual))
+
+		proxy := new(tcp.TcpProxy)
+		if l.NoError(ptypes.UnmarshalAny(actual.FilterChains[0].Filters[0].GetTypedConfig(), proxy)) {
+			clusters := proxy.GetWeightedClusters().GetClusters()
+			if l.Len(clusters, 2) {
+				l.Equal("canary", clusters[0].Name)
+				l.Equal(uint32(30), clusters[0].Weight)
+				l.Equal("source", clusters[1].Name)
+				l.Equal(uint32(70), clusters[1].Weight)
+			}
+		}
+	}
+}
+
+func (l *ListenerTestSuite) TestTcpProxySingleCluster() {
+	// -- Given
+	//
+	given := map[string]uint32{
+		"source": 100,
+		"canary": 0,
+	}
+
+	// -- When
+	//
+	actual, err := l.factory.TcpProxy("listener-6379", 6379, envcore.SocketAddress_TCP, given)
+
+	// -- Then
+	//
+	if l.NoError(err) {
+		proxy := new(tcp.TcpProxy)
+		if l.NoError(ptypes.UnmarshalAny(actual.FilterChains[0].Filters[0].GetTypedConfig(), proxy)) {
+			l.Equal("source", proxy.GetCluster())
+		}
+	}
+}
+
+func (l *ListenerTestSuite) TestTcpProxyNoClusters() {
+	// -- Given
+	//
+	given := map[string]uint32{
+		"source": 0,
+	}
+
+	// -- When
+	//
+	_, err := l.factory.TcpProxy("listener-6379", 6379, envcore.SocketAddress_TCP, given)
+
+	// -- Then
+	//
+	l.Equal(except.ErrInvalid, except.Reason(err))
+}
+
+func TestListenerTestSuite(t *testing.T) {
+	suite.Run(t, new(ListenerTestSuite))
+}
@@ -1,13 +1,27 @@
 package factory
 
-import "github.com/eddieowens/axon"
+import (
+	"github.com/eddieowens/axon"
+	"github.com/kage-cloud/kage/xds/pkg/config"
+)
 
 type Package struct {
 }
 
+func clusterFactoryFactory(inj axon.Injector, _ axon.Args) axon.Instance {
+	conf := inj.GetStructPtr(config.ConfigKey).(*config.Config)
+	return axon.StructPtr(NewClusterFactory(conf.Xds.Ads, conf.Xds.Delta))
+}
+
+func listenerFactoryFactory(inj axon.Injector, _ axon.Args) axon.Instance {
+	conf := inj.GetStructPtr(config.ConfigKey).(*config.Config)
+	return axon.StructPtr(NewListenerFactory(conf.Xds.Ads, conf.Xds.Delta))
+}
+
 func (p *Package) Bindings() []axon.Binding {
 	return []axon.Binding{
-		axon.Bind(ListenerFactoryKey).To().StructPtr(NewListenerFactory()),
+		axon.Bind(ClusterFactoryKey).To().Factory(clusterFactoryFactory).WithoutArgs(),
+		axon.Bind(ListenerFactoryKey).To().Factory(listenerFactoryFactory).WithoutArgs(),
 		axon.Bind(EndpointFactoryKey).To().StructPtr(NewEndpointFactory()),
 		axon.Bind(RouteFactoryKey).To().StructPtr(NewRouteFactory()),
 		axon.Bind(KageMeshFactoryKey).To().StructPtr(new(kageMeshFactory)),
@@ -2,14 +2,32 @@ package factory
 
 import (
 	"fmt"
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
 	route "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
+	commonfault "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/common/fault/v3"
+	fault "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/fault/v3"
+	matcher "github.com/envoyproxy/go-control-plane/envoy/type/matcher/v3"
+	envoytype "github.com/envoyproxy/go-control-plane/envoy/type/v3"
+	"github.com/envoyproxy/go-control-plane/pkg/wellknown"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/any"
 	"github.com/golang/protobuf/ptypes/wrappers"
+	"github.com/kage-cloud/kage/xds/pkg/meta"
 	"github.com/kage-cloud/kage/xds/pkg/model"
+	"regexp"
+	"strings"
 )
 
 const RouteFactoryKey = "RouteFactory"
 
 type RouteFactory interface {
+	// Splits the traffic between the target, canary, and any other variants by their routing weights. Requests matching
+	// any of the mesh's rules are always sent to the canary and requests matching a variant's rules to that variant. If
+	// the mesh is sticky, the traffic is sent to the sticky cluster instead. If the mesh is in shadow mode, all traffic
+	// is sent to the target and mirrored to the canary and variants. Routes to a single cluster use that cluster's
+	// policy while routes split between clusters use the canary's retries and the shortest timeout of the clusters.
+	// Each cluster's faults are injected into the requests routed to it except when sticky as the sticky cluster
+	// cannot tell the target and canary apart.
 	FromPercentage(meshConfig *model.MeshConfig) []*route.RouteConfiguration
 }
 
@@ -21,45 +39,299 @@ type routeFactory struct {
 }
 
 func (r *routeFactory) FromPercentage(meshConfig *model.MeshConfig) []*route.RouteConfiguration {
-	name := fmt.Sprintf("%s-%s", meshConfig.Target.Name, meshConfig.Canary.Name)
+	// Envoy uses the first matching route so the rules must come before the weighted route.
+	routes := make([]*route.Route, 0, len(meshConfig.Rules)+1)
+	for i, v := range meshConfig.Rules {
+		routes = append(routes, r.rule(fmt.Sprintf("%s-rule-%d", meshConfig.Canary.Name, i), meshConfig.Canary, v))
+	}
+	for _, variant := range meshConfig.Variants {
+		for i, v := range variant.Rules {
+			routes = append(routes, r.rule(fmt.Sprintf("%s-rule-%d", variant.Name, i), variant.MeshCluster, v))
+		}
+	}
+
+	if meshConfig.Shadow {
+		routes = append(routes, r.shadow(meshConfig))
+	} else if meshConfig.Sticky != nil {
+		routes = append(routes, r.sticky(meshConfig.Target.Name, meshConfig.Sticky, r.sharedPolicy(meshConfig)))
+	} else {
+		routes = append(routes, r.weighted(meshConfig))
+	}
+
 	return []*route.RouteConfiguration{
 		{
-			Name: name,
+			Name: model.RouteConfigName,
 			VirtualHosts: []*route.VirtualHost{
 				{
-					Name:    name,
-					Domains: []string{""},
-					Routes: []*route.Route{
-						{
-							Name: meshConfig.Target.Name,
-							Match: &route.RouteMatch{
-								PathSpecifier: &route.RouteMatch_Prefix{
-									Prefix: "/",
-								},
-							},
-							Action: &route.Route_Route{
-								Route: &route.RouteAction{
-									ClusterSpecifier: &route.RouteAction_WeightedClusters{
-										WeightedClusters: &route.WeightedCluster{
-											Clusters: []*route.WeightedCluster_ClusterWeight{
-												{
-													Name:   meshConfig.Target.Name,
-													Weight: &wrappers.UInt32Value{Value: meshConfig.Target.RoutingWeight},
-												},
-												{
-													Name:   meshConfig.Canary.Name,
-													Weight: &wrappers.UInt32Value{Value: meshConfig.Canary.RoutingWeight},
-												},
-											},
-											TotalWeight: &wrappers.UInt32Value{Value: meshConfig.TotalRoutingWeight},
-										},
-									},
-								},
-							},
-						},
+					Name:    model.RouteConfigName,
+					Domains: []string{"*"},
+					Routes:  routes,
+				},
+			},
+		},
+	}
+}
+
+func (r *routeFactory) weighted(meshConfig *model.MeshConfig) *route.Route {
+	clusters := []*route.WeightedCluster_ClusterWeight{
+		{
+			Name:                 meshConfig.Target.Name,
+			Weight:               &wrappers.UInt32Value{Value: meshConfig.Target.RoutingWeight},
+			TypedPerFilterConfig: r.faultConfig(meshConfig.Target.Fault),
+		},
+		{
+			Name:                 meshConfig.Canary.Name,
+			Weight:               &wrappers.UInt32Value{Value: meshConfig.Canary.RoutingWeight},
+			TypedPerFilterConfig: r.faultConfig(meshConfig.Canary.Fault),
+		},
+	}
+	for _, v := range meshConfig.Variants {
+		clusters = append(clusters, &route.WeightedCluster_ClusterWeight{
+			Name:                 v.Name,
+			Weight:               &wrappers.UInt32Value{Value: v.RoutingWeight},
+			TypedPerFilterConfig: r.faultConfig(v.Fault),
+		})
+	}
+
+	return &route.Route{
+		Name: meshConfig.Target.Name,
+		Match: &route.RouteMatch{
+			PathSpecifier: &route.RouteMatch_Prefix{
+				Prefix: "/",
+			},
+		},
+		Action: &route.Route_Route{
+			Route: r.withPolicy(&route.RouteAction{
+				ClusterSpecifier: &route.RouteAction_WeightedClusters{
+					WeightedClusters: &route.WeightedCluster{
+						Clusters:    clusters,
+						TotalWeight: &wrappers.UInt32Value{Value: meshConfig.TotalRoutingWeight},
+					},
+				},
+			}, r.sharedPolicy(meshConfig)),
+		},
+	}
+}
+
+// Routes all requests to the target and mirrors the canary's routing weight of them to the canary. Each variant is
+// mirrored its own routing weight. Envoy discards the responses from the canary and variants.
+func (r *routeFactory) shadow(meshConfig *model.MeshConfig) *route.Route {
+	mirrors := []*route.RouteAction_RequestMirrorPolicy{r.mirror(meshConfig.Canary, meshConfig.TotalRoutingWeight)}
+	for _, v := range meshConfig.Variants {
+		mirrors = append(mirrors, r.mirror(v.MeshCluster, meshConfig.TotalRoutingWeight))
+	}
+
+	return &route.Route{
+		Name: meshConfig.Target.Name,
+		Match: &route.RouteMatch{
+			PathSpecifier: &route.RouteMatch_Prefix{
+				Prefix: "/",
+			},
+		},
+		Action: &route.Route_Route{
+			Route: r.withPolicy(&route.RouteAction{
+				ClusterSpecifier:      &route.RouteAction_Cluster{Cluster: meshConfig.Target.Name},
+				RequestMirrorPolicies: mirrors,
+			}, meshConfig.Target.Policy),
+		},
+		TypedPerFilterConfig: r.faultConfig(meshConfig.Target.Fault),
+	}
+}
+
+func (r *routeFactory) mirror(cluster model.MeshCluster, totalWeight uint32) *route.RouteAction_RequestMirrorPolicy {
+	mirrored := uint32(0)
+	if totalWeight > 0 {
+		mirrored = cluster.RoutingWeight * 10000 / totalWeight
+	}
+
+	return &route.RouteAction_RequestMirrorPolicy{
+		Cluster: cluster.Name,
+		RuntimeFraction: &core.RuntimeFractionalPercent{
+			DefaultValue: &envoytype.FractionalPercent{
+				Numerator:   mirrored,
+				Denominator: envoytype.FractionalPercent_TEN_THOUSAND,
+			},
+		},
+	}
+}
+
+// Routes to the sticky cluster by the hash of the sticky key. The split between the target and canary is done by the
+// locality weights of the sticky cluster's endpoints.
+func (r *routeFactory) sticky(name string, sticky *model.StickyCluster, policy *model.RoutePolicy) *route.Route {
+	hashPolicy := &route.RouteAction_HashPolicy{}
+	switch sticky.Key.Type {
+	case meta.RuleTypeCookie:
+		hashPolicy.PolicySpecifier = &route.RouteAction_HashPolicy_Cookie_{
+			Cookie: &route.RouteAction_HashPolicy_Cookie{Name: sticky.Key.Name},
+		}
+	default:
+		hashPolicy.PolicySpecifier = &route.RouteAction_HashPolicy_Header_{
+			Header: &route.RouteAction_HashPolicy_Header{HeaderName: sticky.Key.Name},
+		}
+	}
+
+	return &route.Route{
+		Name: name,
+		Match: &route.RouteMatch{
+			PathSpecifier: &route.RouteMatch_Prefix{
+				Prefix: "/",
+			},
+		},
+		Action: &route.Route_Route{
+			Route: r.withPolicy(&route.RouteAction{
+				ClusterSpecifier: &route.RouteAction_Cluster{Cluster: sticky.Name},
+				HashPolicy:       []*route.RouteAction_HashPolicy{hashPolicy},
+			}, policy),
+		},
+	}
+}
+
+func (r *routeFactory) rule(name string, cluster model.MeshCluster, rule meta.Rule) *route.Route {
+	match := &route.RouteMatch{
+		PathSpecifier: &route.RouteMatch_Prefix{
+			Prefix: "/",
+		},
+	}
+
+	switch rule.Type {
+	case meta.RuleTypeHeader:
+		match.Headers = []*route.HeaderMatcher{
+			{
+				Name:                 rule.Name,
+				HeaderMatchSpecifier: &route.HeaderMatcher_ExactMatch{ExactMatch: rule.Value},
+			},
+		}
+	case meta.RuleTypeHeaderRegex:
+		match.Headers = []*route.HeaderMatcher{
+			{
+				Name:                 rule.Name,
+				HeaderMatchSpecifier: &route.HeaderMatcher_SafeRegexMatch{SafeRegexMatch: r.regex(rule.Value)},
+			},
+		}
+	case meta.RuleTypeCookie:
+		// Envoy has no cookie matcher so the cookie is found within the Cookie header.
+		cookie := fmt.Sprintf(`(^|.*;\s*)%s=%s(;.*|$)`, regexp.QuoteMeta(rule.Name), regexp.QuoteMeta(rule.Value))
+		match.Headers = []*route.HeaderMatcher{
+			{
+				Name:                 "cookie",
+				HeaderMatchSpecifier: &route.HeaderMatcher_SafeRegexMatch{SafeRegexMatch: r.regex(cookie)},
+			},
+		}
+	case meta.RuleTypeGrpc:
+		// gRPC requests are sent to /<service>/<method>.
+		if method := rule.GrpcMethod(); method != "" {
+			match.PathSpecifier = &route.RouteMatch_Path{Path: fmt.Sprintf("/%s/%s", rule.Name, method)}
+		} else {
+			match.PathSpecifier = &route.RouteMatch_Prefix{Prefix: fmt.Sprintf("/%s/", rule.Name)}
+		}
+		match.Grpc = &route.RouteMatch_GrpcRouteMatchOptions{}
+	case meta.RuleTypeQuery:
+		match.QueryParameters = []*route.QueryParameterMatcher{
+			{
+				Name: rule.Name,
+				QueryParameterMatchSpecifier: &route.QueryParameterMatcher_StringMatch{
+					StringMatch: &matcher.StringMatcher{
+						MatchPattern: &matcher.StringMatcher_Exact{Exact: rule.Value},
 					},
 				},
 			},
+		}
+	}
+
+	return &route.Route{
+		Name:  name,
+		Match: match,
+		Action: &route.Route_Route{
+			Route: r.withPolicy(&route.RouteAction{
+				ClusterSpecifier: &route.RouteAction_Cluster{Cluster: cluster.Name},
+			}, cluster.Policy),
 		},
+		TypedPerFilterConfig: r.faultConfig(cluster.Fault),
+	}
+}
+
+// A route split between clusters can only have one timeout and retry policy. The canary's retries are used as the
+// canary is where the safety nets are needed along with the shortest timeout of the clusters. Nil if neither the
+// canary nor target has a policy.
+func (r *routeFactory) sharedPolicy(meshConfig *model.MeshConfig) *model.RoutePolicy {
+	policy := meshConfig.Canary.Policy
+	if policy == nil {
+		policy = meshConfig.Target.Policy
+	}
+	if policy == nil {
+		return nil
+	}
+
+	shared := *policy
+	clusters := []model.MeshCluster{meshConfig.Target, meshConfig.Canary}
+	for _, v := range meshConfig.Variants {
+		clusters = append(clusters, v.MeshCluster)
+	}
+	for _, v := range clusters {
+		if v.Policy != nil && v.Policy.Timeout > 0 && (shared.Timeout == 0 || v.Policy.Timeout < shared.Timeout) {
+			shared.Timeout = v.Policy.Timeout
+		}
+	}
+
+	return &shared
+}
+
+func (r *routeFactory) withPolicy(action *route.RouteAction, policy *model.RoutePolicy) *route.RouteAction {
+	if policy == nil {
+		return action
+	}
+
+	if policy.Timeout > 0 {
+		action.Timeout = ptypes.DurationProto(policy.Timeout)
+	}
+	if len(policy.RetryOn) > 0 {
+		action.RetryPolicy = &route.RetryPolicy{
+			RetryOn:    strings.Join(policy.RetryOn, ","),
+			NumRetries: &wrappers.UInt32Value{Value: policy.NumRetries},
+		}
+	}
+
+	return action
+}
+
+// Overrides the inert fault filter of the listener for the route or weighted cluster. Nil if there is no fault.
+func (r *routeFactory) faultConfig(f *model.Fault) map[string]*any.Any {
+	if f == nil {
+		return nil
+	}
+
+	httpFault := &fault.HTTPFault{}
+	if f.Delay > 0 && f.DelayPercentage > 0 {
+		httpFault.Delay = &commonfault.FaultDelay{
+			FaultDelaySecifier: &commonfault.FaultDelay_FixedDelay{FixedDelay: ptypes.DurationProto(f.Delay)},
+			Percentage:         r.percent(f.DelayPercentage),
+		}
+	}
+	if f.AbortStatus > 0 && f.AbortPercentage > 0 {
+		httpFault.Abort = &fault.FaultAbort{
+			ErrorType:  &fault.FaultAbort_HttpStatus{HttpStatus: f.AbortStatus},
+			Percentage: r.percent(f.AbortPercentage),
+		}
+	}
+	if httpFault.Delay == nil && httpFault.Abort == nil {
+		return nil
+	}
+
+	// The fault is a known message so marshalling cannot fail.
+	faultAny, _ := ptypes.MarshalAny(httpFault)
+	return map[string]*any.Any{wellknown.Fault: faultAny}
+}
+
+func (r *routeFactory) percent(percentage uint32) *envoytype.FractionalPercent {
+	return &envoytype.FractionalPercent{
+		Numerator:   percentage,
+		Denominator: envoytype.FractionalPercent_HUNDRED,
+	}
+}
+
+func (r *routeFactory) regex(regex string) *matcher.RegexMatcher {
+	return &matcher.RegexMatcher{
+		EngineType: &matcher.RegexMatcher_GoogleRe2{GoogleRe2: &matcher.RegexMatcher_GoogleRE2{}},
+		Regex:      regex,
 	}
 }
@@ -0,0 +1,438 @@
+package factory
+
+import (
+	route "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
+	fault "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/fault/v3"
+	"github.com/envoyproxy/go-control-plane/pkg/wellknown"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/kage-cloud/kage/xds/pkg/meta"
+	"github.com/kage-cloud/kage/xds/pkg/model"
+	"github.com/kage-cloud/kage/xds/pkg/util/envoyutil"
+	"github.com/stretchr/testify/suite"
+	"regexp"
+	"testing"
+	"time"
+)
+
+type RouteTestSuite struct {
+	suite.Suite
+	factory RouteFactory
+}
+
+func (r *RouteTestSuite) SetupTest() {
+	r.factory = NewRouteFactory()
+}
+
+func (r *RouteTestSuite) TestFromPercentageRules() {
+	// -- Given
+	//
+	given := &model.MeshConfig{
+		NodeId:             "node",
+		Canary:             model.MeshCluster{Name: "canary", RoutingWeight: 10},
+		Target:             model.MeshCluster{Name: "source", RoutingWeight: 90},
+		TotalRoutingWeight: model.TotalRoutingWeight,
+		Rules: []meta.Rule{
+			{Type: meta.RuleTypeHeader, Name: "x-canary", Value: "true"},
+			{Type: meta.RuleTypeQuery, Name: "canary", Value: "always"},
+		},
+	}
+
+	// -- When
+	//
+	actual := r.factory.FromPercentage(given)
+
+	// -- Then
+	//
+	if r.Len(actual, 1) && r.Len(actual[0].VirtualHosts, 1) {
+		routes := actual[0].VirtualHosts[0].Routes
+		if r.Len(routes, 3) {
+			r.Equal("x-canary", routes[0].Match.Headers[0].Name)
+			r.Equal("true", routes[0].Match.Headers[0].GetExactMatch())
+			r.Equal("canary", routes[0].GetRoute().GetCluster())
+
+			r.Equal("canary", routes[1].Match.QueryParameters[0].Name)
+			r.Equal("always", routes[1].Match.QueryParameters[0].GetStringMatch().GetExact())
+			r.Equal("canary", routes[1].GetRoute().GetCluster())
+
+			r.Len(routes[2].GetRoute().GetWeightedClusters().Clusters, 2)
+		}
+	}
+}
+
+func (r *RouteTestSuite) TestFromPercentageCookieRule() {
+	// -- Given
+	//
+	given := &model.MeshConfig{
+		Canary:             model.MeshCluster{Name: "canary"},
+		Target:             model.MeshCluster{Name: "source", RoutingWeight: model.TotalRoutingWeight},
+		TotalRoutingWeight: model.TotalRoutingWeight,
+		Rules: []meta.Rule{
+			{Type: meta.RuleTypeCookie, Name: "canary", Value: "on"},
+		},
+	}
+
+	// -- When
+	//
+	actual := r.factory.FromPercentage(given)
+
+	// -- Then
+	//
+	routes := actual[0].VirtualHosts[0].Routes
+	if r.Len(routes, 2) {
+		header := routes[0].Match.Headers[0]
+		r.Equal("cookie", header.Name)
+
+		regex := regexp.MustCompile("^(?:" + header.GetSafeRegexMatch().Regex + ")$")
+		r.True(regex.MatchString("canary=on"))
+		r.True(regex.MatchString("session=abc; canary=on; theme=dark"))
+		r.False(regex.MatchString("canary=off"))
+		r.False(regex.MatchString("notcanary=on"))
+	}
+}
+
+func (r *RouteTestSuite) TestFromPercentageGrpcRules() {
+	// -- Given
+	//
+	given := &model.MeshConfig{
+		Canary:             model.MeshCluster{Name: "canary"},
+		Target:             model.MeshCluster{Name: "source", RoutingWeight: model.TotalRoutingWeight},
+		TotalRoutingWeight: model.TotalRoutingWeight,
+		Rules: []meta.Rule{
+			{Type: meta.RuleTypeGrpc, Name: "helloworld.Greeter", Value: "SayHello"},
+			{Type: meta.RuleTypeGrpc, Name: "helloworld.Farewell", Value: "*"},
+		},
+	}
+
+	// -- When
+	//
+	actual := r.factory.FromPercentage(given)
+
+	// -- Then
+	//
+	routes := actual[0].VirtualHosts[0].Routes
+	if r.Len(routes, 3) {
+		r.Equal("/helloworld.Greeter/SayHello", routes[0].Match.GetPath())
+		r.NotNil(routes[0].Match.Grpc)
+		r.Equal("canary", routes[0].GetRoute().GetCluster())
+
+		r.Equal("/helloworld.Farewell/", routes[1].Match.GetPrefix())
+		r.NotNil(routes[1].Match.Grpc)
+	}
+}
+
+func (r *RouteTestSuite) TestFromPercentageNoRules() {
+	// -- Given
+	//
+	given := &model.MeshConfig{
+		Canary:             model.MeshCluster{Name: "canary", RoutingWeight: 50},
+		Target:             model.MeshCluster{Name: "source", RoutingWeight: 50},
+		TotalRoutingWeight: model.TotalRoutingWeight,
+	}
+
+	// -- When
+	//
+	actual := r.factory.FromPercentage(given)
+
+	// -- Then
+	//
+	routes := actual[0].VirtualHosts[0].Routes
+	if r.Len(routes, 1) {
+		r.IsType(new(route.Route_Route), routes[0].Action)
+		r.Equal("source", routes[0].Name)
+	}
+}
+
+func (r *RouteTestSuite) TestFromPercentageSticky() {
+	// -- Given
+	//
+	given := &model.MeshConfig{
+		Canary:             model.MeshCluster{Name: "canary", RoutingWeight: 10},
+		Target:             model.MeshCluster{Name: "source", RoutingWeight: 90},
+		TotalRoutingWeight: model.TotalRoutingWeight,
+		Sticky: &model.StickyCluster{
+			Name: "sticky",
+			Key:  meta.Sticky{Type: meta.RuleTypeHeader, Name: "x-user-id"},
+		},
+	}
+
+	// -- When
+	//
+	actual := r.factory.FromPercentage(given)
+
+	// -- Then
+	//
+	routes := actual[0].VirtualHosts[0].Routes
+	if r.Len(routes, 1) {
+		action := routes[0].GetRoute()
+		r.Equal("sticky", action.GetCluster())
+		if r.Len(action.HashPolicy, 1) {
+			r.Equal("x-user-id", action.HashPolicy[0].GetHeader().HeaderName)
+		}
+	}
+}
+
+func (r *RouteTestSuite) TestFromPercentageShadow() {
+	// -- Given
+	//
+	given := &model.MeshConfig{
+		Canary:             model.MeshCluster{Name: "canary", RoutingWeight: 25},
+		Target:             model.MeshCluster{Name: "source", RoutingWeight: 75},
+		TotalRoutingWeight: model.TotalRoutingWeight,
+		Shadow:             true,
+	}
+
+	// -- When
+	//
+	actual := r.factory.FromPercentage(given)
+
+	// -- Then
+	//
+	routes := actual[0].VirtualHosts[0].Routes
+	if r.Len(routes, 1) {
+		action := routes[0].GetRoute()
+		r.Equal("source", action.GetCluster())
+		if r.Len(action.RequestMirrorPolicies, 1) {
+			mirror := action.RequestMirrorPolicies[0]
+			r.Equal("canary", mirror.Cluster)
+			r.Equal(uint32(25), envoyutil.MirroredWeight(mirror, model.TotalRoutingWeight))
+		}
+	}
+}
+
+func (r *RouteTestSuite) TestFromPercentageVariants() {
+	// -- Given
+	//
+	given := &model.MeshConfig{
+		Canary:             model.MeshCluster{Name: "canary", RoutingWeight: 20},
+		Target:             model.MeshCluster{Name: "source", RoutingWeight: 50},
+		TotalRoutingWeight: model.TotalRoutingWeight,
+		Rules: []meta.Rule{
+			{Type: meta.RuleTypeHeader, Name: "x-variant", Value: "a"},
+		},
+		Variants: []model.MeshVariant{
+			{
+				MeshCluster: model.MeshCluster{Name: "canary-b", RoutingWeight: 30},
+				Rules: []meta.Rule{
+					{Type: meta.RuleTypeHeader, Name: "x-variant", Value: "b"},
+				},
+			},
+		},
+	}
+
+	// -- When
+	//
+	actual := r.factory.FromPercentage(given)
+
+	// -- Then
+	//
+	routes := actual[0].VirtualHosts[0].Routes
+	if r.Len(routes, 3) {
+		r.Equal("canary", routes[0].GetRoute().GetCluster())
+		r.Equal("canary-b", routes[1].GetRoute().GetCluster())
+		r.Equal("b", routes[1].Match.Headers[0].GetExactMatch())
+
+		weights := map[string]uint32{}
+		for _, v := range routes[2].GetRoute().GetWeightedClusters().Clusters {
+			weights[v.Name] = v.Weight.Value
+		}
+		r.Equal(map[string]uint32{"source": 50, "canary": 20, "canary-b": 30}, weights)
+	}
+}
+
+func (r *RouteTestSuite) TestFromPercentageShadowVariants() {
+	// -- Given
+	//
+	given := &model.MeshConfig{
+		Canary:             model.MeshCluster{Name: "canary", RoutingWeight: 10},
+		Target:             model.MeshCluster{Name: "source", RoutingWeight: 70},
+		TotalRoutingWeight: model.TotalRoutingWeight,
+		Shadow:             true,
+		Variants: []model.MeshVariant{
+			{MeshCluster: model.MeshCluster{Name: "canary-b", RoutingWeight: 20}},
+		},
+	}
+
+	// -- When
+	//
+	actual := r.factory.FromPercentage(given)
+
+	// -- Then
+	//
+	action := actual[0].VirtualHosts[0].Routes[0].GetRoute()
+	r.Equal("source", action.GetCluster())
+	if r.Len(action.RequestMirrorPolicies, 2) {
+		r.Equal("canary-b", action.RequestMirrorPolicies[1].Cluster)
+		r.Equal(uint32(20), envoyutil.MirroredWeight(action.RequestMirrorPolicies[1], model.TotalRoutingWeight))
+	}
+}
+
+func (r *RouteTestSuite) TestFromPercentagePolicies() {
+	// -- Given
+	//
+	given := &model.MeshConfig{
+		Canary: model.MeshCluster{
+			Name:          "canary",
+			RoutingWeight: 10,
+			Policy:        &model.RoutePolicy{Timeout: 2 * time.Second, RetryOn: []string{"5xx", "reset"}, NumRetries: 3},
+		},
+		Target: model.MeshCluster{
+			Name:          "source",
+			RoutingWeight: 90,
+			Policy:        &model.RoutePolicy{Timeout: 10 * time.Second},
+		},
+		TotalRoutingWeight: model.TotalRoutingWeight,
+		Rules: []meta.Rule{
+			{Type: meta.RuleTypeHeader, Name: "x-canary", Value: "true"},
+		},
+		Variants: []model.MeshVariant{
+			{MeshCluster: model.MeshCluster{Name: "canary-b", RoutingWeight: 0, Policy: &model.RoutePolicy{Timeout: time.Second}}},
+		},
+	}
+
+	// -- When
+	//
+	actual := r.factory.FromPercentage(given)
+
+	// -- Then
+	//
+	routes := actual[0].VirtualHosts[0].Routes
+	if r.Len(routes, 2) {
+		rule := routes[0].GetRoute()
+		r.Equal(int64(2), rule.Timeout.Seconds)
+		r.Equal("5xx,reset", rule.RetryPolicy.RetryOn)
+		r.Equal(uint32(3), rule.RetryPolicy.NumRetries.Value)
+
+		weighted := routes[1].GetRoute()
+		r.Equal(int64(1), weighted.Timeout.Seconds)
+		r.Equal("5xx,reset", weighted.RetryPolicy.RetryOn)
+	}
+}
+
+func (r *RouteTestSuite) TestFromPercentageZeroTimeout() {
+	// -- Given
+	//
+	given := &model.MeshConfig{
+		Canary: model.MeshCluster{
+			Name:          "canary",
+			RoutingWeight: 10,
+			Policy:        &model.RoutePolicy{RetryOn: []string{"5xx"}, NumRetries: 3},
+		},
+		Target: model.MeshCluster{
+			Name:          "source",
+			RoutingWeight: 90,
+			Policy:        &model.RoutePolicy{},
+		},
+		TotalRoutingWeight: model.TotalRoutingWeight,
+	}
+
+	// -- When
+	//
+	actual := r.factory.FromPercentage(given)
+
+	// -- Then
+	//
+	action := actual[0].VirtualHosts[0].Routes[0].GetRoute()
+	r.Nil(action.Timeout)
+	r.Equal("5xx", action.RetryPolicy.RetryOn)
+}
+
+func (r *RouteTestSuite) TestFromPercentageShadowPolicy() {
+	// -- Given
+	//
+	given := &model.MeshConfig{
+		Canary: model.MeshCluster{
+			Name:          "canary",
+			RoutingWeight: 10,
+			Policy:        &model.RoutePolicy{Timeout: 2 * time.Second, RetryOn: []string{"5xx"}, NumRetries: 3},
+		},
+		Target: model.MeshCluster{
+			Name:          "source",
+			RoutingWeight: 90,
+			Policy:        &model.RoutePolicy{Timeout: 10 * time.Second},
+		},
+		TotalRoutingWeight: model.TotalRoutingWeight,
+		Shadow:             true,
+	}
+
+	// -- When
+	//
+	actual := r.factory.FromPercentage(given)
+
+	// -- Then
+	//
+	action := actual[0].VirtualHosts[0].Routes[0].GetRoute()
+	r.Equal(int64(10), action.Timeout.Seconds)
+	r.Nil(action.RetryPolicy)
+}
+
+func (r *RouteTestSuite) TestFromPercentageFaults() {
+	// -- Given
+	//
+	given := &model.MeshConfig{
+		Canary: model.MeshCluster{
+			Name:          "canary",
+			RoutingWeight: 10,
+			Fault:         &model.Fault{AbortStatus: 503, AbortPercentage: 20},
+		},
+		Target: model.MeshCluster{
+			Name:          "source",
+			RoutingWeight: 90,
+			Fault:         &model.Fault{Delay: 500 * time.Millisecond, DelayPercentage: 5},
+		},
+		TotalRoutingWeight: model.TotalRoutingWeight,
+		Rules: []meta.Rule{
+			{Type: meta.RuleTypeHeader, Name: "x-canary", Value: "true"},
+		},
+	}
+
+	// -- When
+	//
+	actual := r.factory.FromPercentage(given)
+
+	// -- Then
+	//
+	routes := actual[0].VirtualHosts[0].Routes
+	if r.Len(routes, 2) {
+		rule := new(fault.HTTPFault)
+		if r.NoError(ptypes.UnmarshalAny(routes[0].TypedPerFilterConfig[wellknown.Fault], rule)) {
+			r.Equal(uint32(503), rule.Abort.GetHttpStatus())
+			r.Equal(uint32(20), rule.Abort.Percentage.Numerator)
+			r.Nil(rule.Delay)
+		}
+
+		clusters := routes[1].GetRoute().GetWeightedClusters().Clusters
+		source := new(fault.HTTPFault)
+		if r.NoError(ptypes.UnmarshalAny(clusters[0].TypedPerFilterConfig[wellknown.Fault], source)) {
+			r.Equal(int32(500*time.Millisecond), source.Delay.GetFixedDelay().Nanos)
+			r.Equal(uint32(5), source.Delay.Percentage.Numerator)
+			r.Nil(source.Abort)
+		}
+		canary := new(fault.HTTPFault)
+		if r.NoError(ptypes.UnmarshalAny(clusters[1].TypedPerFilterConfig[wellknown.Fault], canary)) {
+			r.Equal(uint32(503), canary.Abort.GetHttpStatus())
+		}
+	}
+}
+
+func (r *RouteTestSuite) TestFromPercentageStickyNoFaults() {
+	// -- Given
+	//
+	given := &model.MeshConfig{
+		Canary:             model.MeshCluster{Name: "canary", RoutingWeight: 10, Fault: &model.Fault{AbortStatus: 503, AbortPercentage: 100}},
+		Target:             model.MeshCluster{Name: "source", RoutingWeight: 90},
+		TotalRoutingWeight: model.TotalRoutingWeight,
+		Sticky:             &model.StickyCluster{Name: "sticky", Key: meta.Sticky{Type: meta.RuleTypeHeader, Name: "x-user-id"}},
+	}
+
+	// -- When
+	//
+	actual := r.factory.FromPercentage(given)
+
+	// -- Then
+	//
+	r.Empty(actual[0].VirtualHosts[0].Routes[0].TypedPerFilterConfig)
+}
+
+func TestRouteTestSuite(t *testing.T) {
+	suite.Run(t, new(RouteTestSuite))
+}
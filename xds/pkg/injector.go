@@ -6,7 +6,9 @@ import (
 	"github.com/kage-cloud/kage/xds/pkg/controller"
 	"github.com/kage-cloud/kage/xds/pkg/controlplane"
 	"github.com/kage-cloud/kage/xds/pkg/factory"
+	"github.com/kage-cloud/kage/xds/pkg/kubeinformer"
 	"github.com/kage-cloud/kage/xds/pkg/service"
+	"github.com/kage-cloud/kage/xds/pkg/webhook"
 )
 
 func InjectorFactory() axon.Injector {
@@ -16,6 +18,8 @@ func InjectorFactory() axon.Injector {
 		new(factory.Package),
 		new(config.Package),
 		new(controller.Package),
+		new(kubeinformer.Package),
+		new(webhook.Package),
 		new(Package),
 	))
 }
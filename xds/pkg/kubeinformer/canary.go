@@ -3,7 +3,6 @@ package kubeinformer
 import (
 	"context"
 	"github.com/kage-cloud/kage/core/kube"
-	"github.com/kage-cloud/kage/core/kube/kconfig"
 	"github.com/kage-cloud/kage/core/kube/kfilter"
 	"github.com/kage-cloud/kage/core/kube/kinformer"
 	"github.com/kage-cloud/kage/core/kube/ktypes"
@@ -25,10 +24,15 @@ var controllers = []ktypes.Kind{
 	ktypes.KindReplicaSet,
 }
 
+const CanaryKubeControllerKey = "CanaryKubeController"
+
 type Canary struct {
-	InformerClient  kube.InformerClient     `inject:"InformerClient"`
-	CanaryService   service.CanaryService   `inject:"CanaryService"`
-	KageMeshService service.KageMeshService `inject:"KageMeshService"`
+	InformerClient        kube.InformerClient           `inject:"InformerClient"`
+	CanaryService         service.CanaryService         `inject:"CanaryService"`
+	KageMeshService       service.KageMeshService       `inject:"KageMeshService"`
+	XdsService            service.XdsService            `inject:"XdsService"`
+	CanaryStatusService   service.CanaryStatusService   `inject:"CanaryStatusService"`
+	CanaryResourceService service.CanaryResourceService `inject:"CanaryResourceService"`
 }
 
 func (c *Canary) Inform(ctx context.Context) error {
@@ -52,23 +56,51 @@ func (c *Canary) canaryEventHandler() kinformer.InformEventHandler {
 	return &kinformer.InformEventHandlerFuncs{
 		OnWatch: func(event watch.Event) error {
 			switch event.Type {
+			case watch.Added:
+				c.addCanary(event.Object)
 			case watch.Deleted, watch.Error:
 				c.deleteCanary(event.Object)
+			case watch.Modified:
+				c.updateCanaryRules(event.Object)
+				c.syncResourceStatus(event.Object)
 			}
 			return nil
 		},
 	}
 }
 
-func (c *Canary) deleteCanary(obj runtime.Object) {
+func (c *Canary) addCanary(obj runtime.Object) {
 	canary := c.CanaryService.FetchForController(obj)
 	if canary == nil {
-		metaObj, ok := obj.(metav1.Object)
-		if ok {
-			logrus.WithField("name", metaObj.GetName()).
-				WithField("namespace", metaObj.GetNamespace()).
-				Debug("Canary deleted but did not have a valid annotation.")
-		}
+		return
+	}
+
+	status, err := c.CanaryStatusService.Fetch(obj)
+	if err != nil || status.Phase != "" {
+		return
+	}
+
+	if err := c.CanaryStatusService.Transition(canary, meta.PhasePending, "Waiting for the canary's pods."); err != nil {
+		logrus.WithField("name", canary.CanaryObj.Name).
+			WithField("namespace", canary.CanaryObj.Namespace).
+			WithError(err).
+			Error("Failed to mark the canary as pending.")
+	}
+}
+
+func (c *Canary) syncResourceStatus(obj runtime.Object) {
+	if err := c.CanaryResourceService.SyncStatus(obj); err != nil {
+		metaObj := obj.(metav1.Object)
+		logrus.WithField("name", metaObj.GetName()).
+			WithField("namespace", metaObj.GetNamespace()).
+			WithError(err).
+			Error("Failed to copy the canary's status onto its Canary resource.")
+	}
+}
+
+func (c *Canary) updateCanaryRules(obj runtime.Object) {
+	canary := c.CanaryService.FetchForController(obj)
+	if canary == nil || c.CanaryService.IsAborted(obj) {
 		return
 	}
 
@@ -77,16 +109,36 @@ func (c *Canary) deleteCanary(obj runtime.Object) {
 		logrus.WithField("name", canary.CanaryObj.Name).
 			WithField("namespace", canary.CanaryObj.Namespace).
 			WithError(err).
-			Error("Failed to fetch kage proxy for canary after it was deleted.")
+			Debug("Failed to fetch kage proxy for canary after it was updated.")
+		return
+	}
+
+	if err := c.XdsService.SetCanaryRules(canary, kageProxyAnno); err != nil {
+		logrus.WithField("name", canary.CanaryObj.Name).
+			WithField("namespace", canary.CanaryObj.Namespace).
+			WithField("rules", canary.Rules).
+			WithError(err).
+			Error("Failed to update the routing rules for canary.")
+	}
+}
+
+func (c *Canary) deleteCanary(obj runtime.Object) {
+	canary := c.CanaryService.FetchForController(obj)
+	if canary == nil {
+		metaObj, ok := obj.(metav1.Object)
+		if ok {
+			logrus.WithField("name", metaObj.GetName()).
+				WithField("namespace", metaObj.GetNamespace()).
+				Debug("Canary deleted but did not have a valid annotation.")
+		}
 		return
 	}
 
-	opt := kconfig.Opt{Namespace: canary.CanaryObj.Namespace}
-	if err := c.KageMeshService.Remove(kageProxyAnno, opt); err != nil {
+	// Only the canary's variant is removed so the other canaries of the source are undisturbed.
+	if err := c.KageMeshService.RemoveVariant(canary); err != nil {
 		logrus.WithField("name", canary.CanaryObj.Name).
 			WithField("namespace", canary.CanaryObj.Namespace).
-			WithField("proxy_name", kageProxyAnno.Name).
 			WithError(err).
-			Error("Failed to delete kage proxy for canary after it was deleted.")
+			Error("Failed to remove the canary from its kage proxy after it was deleted.")
 	}
 }
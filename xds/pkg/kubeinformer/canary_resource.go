@@ -0,0 +1,88 @@
+package kubeinformer
+
+import (
+	"context"
+	"github.com/kage-cloud/kage/core/kube"
+	"github.com/kage-cloud/kage/core/kube/kinformer"
+	"github.com/kage-cloud/kage/xds/pkg/crd"
+	"github.com/kage-cloud/kage/xds/pkg/service"
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"time"
+)
+
+const CanaryResourceKubeControllerKey = "CanaryResourceKubeController"
+
+// Watches Canary resources and applies them onto their canary controllers. Does nothing if the Canary CRD is not
+// installed in which case canaries can only be defined by annotations.
+type CanaryResource struct {
+	KubeClient            kube.Client                   `inject:"KubeClient"`
+	InformerClient        kube.InformerClient           `inject:"InformerClient"`
+	CanaryResourceService service.CanaryResourceService `inject:"CanaryResourceService"`
+}
+
+func (c *CanaryResource) Inform(ctx context.Context) error {
+	_, err := c.KubeClient.Api().Discovery().ServerResourcesForGroupVersion(crd.GroupVersion.String())
+	if err != nil {
+		if errors.IsNotFound(err) {
+			logrus.WithField("group_version", crd.GroupVersion.String()).
+				Info("The Canary CRD is not installed. Canaries can only be defined with annotations.")
+			return nil
+		}
+		return err
+	}
+
+	return c.InformerClient.InformResource(ctx, kinformer.ResourceInformerSpec{
+		Resource:      crd.CanaryResource,
+		BatchDuration: 5 * time.Second,
+		Handlers:      []kinformer.InformEventHandler{c.canaryResourceEventHandler()},
+	})
+}
+
+func (c *CanaryResource) canaryResourceEventHandler() kinformer.InformEventHandler {
+	return &kinformer.InformEventHandlerFuncs{
+		OnList: func(li metav1.ListInterface) error {
+			list, ok := li.(*unstructured.UnstructuredList)
+			if !ok {
+				return nil
+			}
+			for i := range list.Items {
+				c.apply(&list.Items[i])
+			}
+			return nil
+		},
+		OnWatch: func(event watch.Event) error {
+			switch event.Type {
+			case watch.Added, watch.Modified:
+				c.apply(event.Object)
+			case watch.Deleted:
+				c.remove(event.Object)
+			}
+			return nil
+		},
+	}
+}
+
+func (c *CanaryResource) apply(obj runtime.Object) {
+	if err := c.CanaryResourceService.Apply(obj); err != nil {
+		c.log(obj).WithError(err).Error("Failed to apply the Canary resource.")
+	}
+}
+
+func (c *CanaryResource) remove(obj runtime.Object) {
+	if err := c.CanaryResourceService.Remove(obj); err != nil {
+		c.log(obj).WithError(err).Error("Failed to abort the canary after its Canary resource was deleted.")
+	}
+}
+
+func (c *CanaryResource) log(obj runtime.Object) *logrus.Entry {
+	entry := logrus.NewEntry(logrus.StandardLogger())
+	if metaObj, ok := obj.(metav1.Object); ok {
+		entry = entry.WithField("name", metaObj.GetName()).WithField("namespace", metaObj.GetNamespace())
+	}
+	return entry
+}
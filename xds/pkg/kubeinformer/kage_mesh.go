@@ -102,6 +102,7 @@ func (k *KageMesh) addService(svc *corev1.Service) error {
 				xdsAnno.ServiceSelectors = map[string]map[string]string{}
 			}
 			xdsAnno.ServiceSelectors[svc.Name] = ktypes.PodSelectorAsSet(svc)
+			k.KageMeshService.MarshalXdsMeta(&mesh, xdsAnno)
 
 			if _, err := k.KubeClient.Update(&mesh, opt); err != nil {
 				logrus.WithError(err).
@@ -10,7 +10,8 @@ type Package struct {
 func (p *Package) Bindings() []axon.Binding {
 	return []axon.Binding{
 		axon.Bind(EnvoyKubeControllerKey).To().StructPtr(new(Envoy)),
-		axon.Bind(EndpointsKubeControllerKey).To().StructPtr(new(Endpoints)),
-		axon.Bind(KubeControllersKey).To().Keys(EnvoyKubeControllerKey, EndpointsKubeControllerKey),
+		axon.Bind(CanaryKubeControllerKey).To().StructPtr(new(Canary)),
+		axon.Bind(CanaryResourceKubeControllerKey).To().StructPtr(new(CanaryResource)),
+		axon.Bind(KubeControllersKey).To().Keys(EnvoyKubeControllerKey, CanaryKubeControllerKey, CanaryResourceKubeControllerKey),
 	}
 }
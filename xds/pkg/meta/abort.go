@@ -0,0 +1,13 @@
+package meta
+
+// Records that the canary was explicitly aborted. An aborted canary receives no traffic and is ignored by the rollout
+// engine.
+type Abort struct {
+	Aborted    bool   `json:"aborted"`
+	Reason     string `json:"abort_reason,omitempty"`
+	AbortedUtc string `json:"aborted_utc,omitempty"`
+}
+
+func (a *Abort) GetDomain() string {
+	return DomainCanary
+}
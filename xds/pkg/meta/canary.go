@@ -1,17 +1,118 @@
 package meta
 
+import "fmt"
+
+type CanaryMode string
+
+const (
+	// The canary serves its routing percentage of the live traffic.
+	CanaryModeWeighted CanaryMode = "weighted"
+
+	// The canary receives a mirror of its routing percentage of the source's traffic. The canary's responses are
+	// discarded and the source serves all of the live traffic.
+	CanaryModeShadow CanaryMode = "shadow"
+)
+
 type Canary struct {
 	SourceObj         ObjRef `json:"source_obj"`
 	CanaryObj         ObjRef `json:"canary_obj"`
 	RoutingPercentage uint32 `json:"routing_percentage"`
+
+	// The rollout schedule for the canary with each step in the form of <weight>:<pause> e.g. 5:5m,25:10m,100:0s. If
+	// empty, the canary stays at the RoutingPercentage.
+	Steps []string `json:"steps,omitempty"`
+
+	// Defaults to weighted. Switching modes only changes the kage-mesh's routes.
+	Mode CanaryMode `json:"mode,omitempty"`
+
+	// Rules which always send matching requests to the canary in the form of <type>:<name>=<value> e.g.
+	// header:x-canary=true,cookie:canary=always. The type is one of header, header-regex, cookie, query, or grpc where
+	// the name is the gRPC service and the value the method e.g. grpc:helloworld.Greeter=SayHello. Values cannot contain
+	// commas.
+	Rules []string `json:"rules,omitempty"`
+
+	// Keeps each user on the same variant for the whole rollout by hashing a header or cookie in the form of
+	// <type>:<name> e.g. header:x-user-id or cookie:session. As the weight increases, only the newly added share of
+	// users move to the canary.
+	Sticky string `json:"sticky,omitempty"`
+
+	// Overrides for the thresholds used to analyse the canary against the source.
+	Analysis Analysis `json:"analysis,omitempty"`
+
+	// Overrides for the timeouts, retries, and circuit breakers of the source and canary. The circuit breakers are set
+	// when the canary joins the kage-mesh.
+	Resiliency Resiliency `json:"resiliency,omitempty"`
+
+	// Delays or aborts a share of the requests to the source and canary while enabled. Toggling the faults only
+	// changes the kage-mesh's routes.
+	Faults Faults `json:"faults"`
+
+	// The name of the Canary resource which defines the canary. Empty if the canary was defined by hand.
+	Resource string `json:"resource,omitempty"`
+}
+
+type Analysis struct {
+	MinRequests          uint64  `json:"min_requests,omitempty"`
+	MaxSuccessRateDrop   float64 `json:"max_success_rate_drop,omitempty"`
+	LatencyPercentile    float64 `json:"latency_percentile,omitempty"`
+	MaxLatencyIncreaseMs float64 `json:"max_latency_increase_ms,omitempty"`
+
+	// The names of the provider metrics to evaluate e.g. the Prometheus queries. If empty, all are evaluated.
+	Metrics []string `json:"metrics,omitempty"`
 }
 
 func (c *Canary) GetDomain() string {
 	return DomainCanary
 }
 
+// Parses the rollout schedule. Every step's weight must be at most the total routing weight.
+func (c *Canary) RolloutSteps() ([]Step, error) {
+	steps := make([]Step, 0, len(c.Steps))
+	for _, v := range c.Steps {
+		step, err := ParseStep(v)
+		if err != nil {
+			return nil, err
+		}
+		if step.Weight > maxStepWeight {
+			return nil, fmt.Errorf(`the weight of step "%s" exceeds %d`, v, maxStepWeight)
+		}
+		steps = append(steps, *step)
+	}
+	return steps, nil
+}
+
 type ObjRef struct {
 	Name      string `json:"name"`
 	Kind      string `json:"kind"`
 	Namespace string `json:"namespace"`
 }
+
+func (c *Canary) RoutingRules() ([]Rule, error) {
+	rules := make([]Rule, 0, len(c.Rules))
+	for _, v := range c.Rules {
+		rule, err := ParseRule(v)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, *rule)
+	}
+	return rules, nil
+}
+
+func (c *Canary) CanaryMode() (CanaryMode, error) {
+	switch c.Mode {
+	case "", CanaryModeWeighted:
+		return CanaryModeWeighted, nil
+	case CanaryModeShadow:
+		return CanaryModeShadow, nil
+	}
+	return "", fmt.Errorf(`invalid mode "%s". Must be either %s or %s`, c.Mode, CanaryModeWeighted, CanaryModeShadow)
+}
+
+// Returns nil if the canary is not sticky.
+func (c *Canary) StickyKey() (*Sticky, error) {
+	if c.Sticky == "" {
+		return nil, nil
+	}
+	return ParseSticky(c.Sticky)
+}
@@ -0,0 +1,66 @@
+package meta
+
+import (
+	"fmt"
+	"time"
+)
+
+// Faults injected into the requests routed to the source and canary to test how gracefully they degrade.
+type Faults struct {
+	// Faults are only injected while enabled so they can be switched off without losing the settings. Always written
+	// so switching the faults off overwrites the annotation.
+	Enabled bool  `json:"enabled"`
+	Source  Fault `json:"source,omitempty"`
+	Canary  Fault `json:"canary,omitempty"`
+}
+
+type Fault struct {
+	// The fixed delay added to DelayPercentage of the requests e.g. 500ms.
+	Delay           string `json:"delay,omitempty"`
+	DelayPercentage uint32 `json:"delay_percentage,omitempty"`
+
+	// The HTTP status that AbortPercentage of the requests are answered with instead of being routed e.g. 503.
+	AbortStatus     uint32 `json:"abort_status,omitempty"`
+	AbortPercentage uint32 `json:"abort_percentage,omitempty"`
+}
+
+// The parsed Delay. 0 if the delay is not set.
+func (f Fault) FixedDelay() (time.Duration, error) {
+	if f.Delay == "" {
+		return 0, nil
+	}
+
+	delay, err := time.ParseDuration(f.Delay)
+	if err != nil || delay < 0 {
+		return 0, fmt.Errorf(`invalid delay "%s"`, f.Delay)
+	}
+	return delay, nil
+}
+
+// True if the fault delays or aborts any requests.
+func (f Fault) IsSet() bool {
+	return (f.Delay != "" && f.DelayPercentage > 0) || (f.AbortStatus != 0 && f.AbortPercentage > 0)
+}
+
+func (f Fault) Validate() error {
+	if _, err := f.FixedDelay(); err != nil {
+		return err
+	}
+	if f.DelayPercentage > 100 || f.AbortPercentage > 100 {
+		return fmt.Errorf("percentages must be between 0 and 100")
+	}
+	if f.AbortStatus != 0 && (f.AbortStatus < 200 || f.AbortStatus > 599) {
+		return fmt.Errorf("invalid abort status %d", f.AbortStatus)
+	}
+	return nil
+}
+
+func (f Faults) Validate() error {
+	if err := f.Source.Validate(); err != nil {
+		return fmt.Errorf("the source fault is invalid: %s", err.Error())
+	}
+	if err := f.Canary.Validate(); err != nil {
+		return fmt.Errorf("the canary fault is invalid: %s", err.Error())
+	}
+	return nil
+}
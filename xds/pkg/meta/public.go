@@ -3,9 +3,10 @@ package meta
 import "github.com/kage-cloud/kage/annos"
 
 const (
-	DomainBase   = "kage.cloud"
-	DomainCanary = "canary." + DomainBase
-	DomainXds    = "xds." + DomainBase
+	DomainBase    = "kage.cloud"
+	DomainCanary  = "canary." + DomainBase
+	DomainXds     = "xds." + DomainBase
+	DomainRollout = "rollout." + DomainBase
 )
 
 func ToMap(a Annotation) map[string]string {
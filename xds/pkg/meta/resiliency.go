@@ -0,0 +1,54 @@
+package meta
+
+import (
+	"fmt"
+	"time"
+)
+
+// The safety nets of the source and canary clusters. Anything left empty uses the default from the config.
+type Resiliency struct {
+	Source ClusterPolicy `json:"source,omitempty"`
+	Canary ClusterPolicy `json:"canary,omitempty"`
+}
+
+type ClusterPolicy struct {
+	// The timeout of a whole request including its retries e.g. 5s.
+	Timeout string `json:"timeout,omitempty"`
+
+	// The Envoy retry conditions e.g. 5xx,reset,connect-failure.
+	RetryOn []string `json:"retry_on,omitempty"`
+
+	NumRetries uint32 `json:"num_retries,omitempty"`
+
+	CircuitBreaker
+}
+
+// The circuit breaker thresholds of a cluster.
+type CircuitBreaker struct {
+	MaxConnections     uint32 `json:"max_connections,omitempty"`
+	MaxPendingRequests uint32 `json:"max_pending_requests,omitempty"`
+	MaxRequests        uint32 `json:"max_requests,omitempty"`
+}
+
+// The parsed Timeout. 0 if the timeout is not set.
+func (c ClusterPolicy) RequestTimeout() (time.Duration, error) {
+	if c.Timeout == "" {
+		return 0, nil
+	}
+
+	timeout, err := time.ParseDuration(c.Timeout)
+	if err != nil || timeout < 0 {
+		return 0, fmt.Errorf(`invalid timeout "%s"`, c.Timeout)
+	}
+	return timeout, nil
+}
+
+func (r Resiliency) Validate() error {
+	if _, err := r.Source.RequestTimeout(); err != nil {
+		return fmt.Errorf("the source has an %s", err.Error())
+	}
+	if _, err := r.Canary.RequestTimeout(); err != nil {
+		return fmt.Errorf("the canary has an %s", err.Error())
+	}
+	return nil
+}
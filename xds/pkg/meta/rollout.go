@@ -0,0 +1,81 @@
+package meta
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The max weight of a step. The same as model.TotalRoutingWeight which cannot be imported here.
+const maxStepWeight = 100
+
+// A single step of a progressive rollout. The canary receives Weight percent of the traffic for the Pause duration
+// before the rollout moves on to the next step.
+type Step struct {
+	Weight uint32
+	Pause  time.Duration
+}
+
+// The progress of a canary through its step schedule. Persisted on the canary controller so a restart of the xds
+// process resumes the rollout where it left off.
+type Rollout struct {
+	Step              int    `json:"step"`
+	StepStartedUtc    string `json:"step_started_utc"`
+	NextTransitionUtc string `json:"next_transition_utc"`
+	Complete          bool   `json:"complete"`
+
+	// Whether the canary failed its analysis and was rolled back.
+	Failed bool   `json:"failed"`
+	Reason string `json:"reason,omitempty"`
+
+	// The Envoy stats of the kage-mesh as JSON when the current step started so the analysis of the step only
+	// considers the traffic sent during it. Only valid for the kage-mesh with the CheckpointNodeId.
+	Checkpoint       string `json:"checkpoint,omitempty"`
+	CheckpointNodeId string `json:"checkpoint_node_id,omitempty"`
+}
+
+func (r *Rollout) GetDomain() string {
+	return DomainRollout
+}
+
+func (r *Rollout) Started() bool {
+	return r.StepStartedUtc != ""
+}
+
+func (r *Rollout) NextTransition() (time.Time, error) {
+	return time.Parse(time.RFC3339, r.NextTransitionUtc)
+}
+
+// Moves the rollout to the specified step which started at the specified time.
+func (r *Rollout) SetStep(idx int, step Step, started time.Time) {
+	started = started.UTC()
+	r.Step = idx
+	r.StepStartedUtc = started.Format(time.RFC3339)
+	r.NextTransitionUtc = started.Add(step.Pause).Format(time.RFC3339)
+}
+
+// Formats the step in the form of <weight>:<pause>.
+func (s Step) String() string {
+	return fmt.Sprintf("%d:%s", s.Weight, s.Pause)
+}
+
+// Parses a step in the form of <weight>:<pause> e.g. 25:10m.
+func ParseStep(s string) (*Step, error) {
+	spl := strings.Split(strings.TrimSpace(s), ":")
+	if len(spl) != 2 {
+		return nil, fmt.Errorf(`expected a step in the form of <weight>:<pause> but got "%s"`, s)
+	}
+
+	weight, err := strconv.ParseUint(spl[0], 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf(`invalid weight "%s" for step "%s"`, spl[0], s)
+	}
+
+	pause, err := time.ParseDuration(spl[1])
+	if err != nil {
+		return nil, fmt.Errorf(`invalid pause "%s" for step "%s"`, spl[1], s)
+	}
+
+	return &Step{Weight: uint32(weight), Pause: pause}, nil
+}
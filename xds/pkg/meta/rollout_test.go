@@ -0,0 +1,174 @@
+package meta
+
+import (
+	"github.com/stretchr/testify/suite"
+	"testing"
+	"time"
+)
+
+type RolloutTestSuite struct {
+	suite.Suite
+}
+
+func (r *RolloutTestSuite) TestParseStep() {
+	// -- Given
+	//
+	type test struct {
+		Given    string
+		Expected *Step
+	}
+
+	given := []test{
+		{Given: "25:10m", Expected: &Step{Weight: 25, Pause: 10 * time.Minute}},
+		{Given: " 5:30s ", Expected: &Step{Weight: 5, Pause: 30 * time.Second}},
+		{Given: "100:0s", Expected: &Step{Weight: 100}},
+		{Given: "25"},
+		{Given: "25:10m:5m"},
+		{Given: "a:10m"},
+		{Given: "-5:10m"},
+		{Given: "25:10"},
+		{Given: ""},
+	}
+
+	for _, v := range given {
+		// -- When
+		//
+		actual, err := ParseStep(v.Given)
+
+		// -- Then
+		//
+		if v.Expected == nil {
+			r.Error(err, v.Given)
+		} else if r.NoError(err, v.Given) {
+			r.Equal(v.Expected, actual, v.Given)
+		}
+	}
+}
+
+func (r *RolloutTestSuite) TestStepString() {
+	// -- Given
+	//
+	given := Step{Weight: 25, Pause: 90 * time.Second}
+
+	// -- When
+	//
+	actual, err := ParseStep(given.String())
+
+	// -- Then
+	//
+	if r.NoError(err) {
+		r.Equal(given, *actual)
+	}
+}
+
+func (r *RolloutTestSuite) TestRolloutSteps() {
+	// -- Given
+	//
+	given := &Canary{Steps: []string{"5:5m", "50:10m", "100:0s"}}
+
+	// -- When
+	//
+	actual, err := given.RolloutSteps()
+
+	// -- Then
+	//
+	if r.NoError(err) {
+		r.Equal([]Step{{Weight: 5, Pause: 5 * time.Minute}, {Weight: 50, Pause: 10 * time.Minute}, {Weight: 100}}, actual)
+	}
+}
+
+func (r *RolloutTestSuite) TestRolloutStepsInvalid() {
+	// -- Given
+	//
+	type test struct {
+		Given    []string
+		Expected string
+	}
+
+	given := []test{
+		{Given: []string{"5:5m", "101:1m"}, Expected: `the weight of step "101:1m" exceeds 100`},
+		{Given: []string{"5:5m", "50"}, Expected: `expected a step in the form of <weight>:<pause> but got "50"`},
+		{Given: []string{"5:forever"}, Expected: `invalid pause "forever" for step "5:forever"`},
+	}
+
+	for _, v := range given {
+		// -- When
+		//
+		_, err := (&Canary{Steps: v.Given}).RolloutSteps()
+
+		// -- Then
+		//
+		if r.Error(err) {
+			r.EqualError(err, v.Expected)
+		}
+	}
+}
+
+func (r *RolloutTestSuite) TestSetStep() {
+	// -- Given
+	//
+	given := &Rollout{}
+	started := time.Date(2020, 6, 1, 12, 0, 0, 0, time.FixedZone("EST", -5*60*60))
+
+	// -- When
+	//
+	given.SetStep(1, Step{Weight: 25, Pause: 10 * time.Minute}, started)
+
+	// -- Then
+	//
+	r.True(given.Started())
+	r.Equal(1, given.Step)
+	r.Equal("2020-06-01T17:00:00Z", given.StepStartedUtc)
+	next, err := given.NextTransition()
+	if r.NoError(err) {
+		r.True(next.Equal(started.Add(10 * time.Minute)))
+	}
+}
+
+func (r *RolloutTestSuite) TestRolloutResumes() {
+	// -- Given
+	//
+	given := &Rollout{
+		Checkpoint:       `{"canary":{"name":"canary","requests":10,"latency":{"buckets":[{"le":1,"count":10}],"count":10}}}`,
+		CheckpointNodeId: "node",
+	}
+	given.SetStep(2, Step{Weight: 50, Pause: time.Hour}, time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC))
+	annos := ToMap(given)
+
+	// -- When
+	//
+	actual := new(Rollout)
+	err := FromMap(annos, actual)
+
+	// -- Then
+	//
+	if r.NoError(err) {
+		r.Equal(given, actual)
+		next, err := actual.NextTransition()
+		r.NoError(err)
+		r.Equal(time.Date(2020, 6, 1, 13, 0, 0, 0, time.UTC), next)
+	}
+}
+
+func (r *RolloutTestSuite) TestRolloutNotStarted() {
+	// -- Given
+	//
+	given := new(Rollout)
+
+	// -- When
+	//
+	err := FromMap(map[string]string{}, given)
+
+	// -- Then
+	//
+	if r.NoError(err) {
+		r.False(given.Started())
+		r.False(given.Complete)
+		_, err = given.NextTransition()
+		r.Error(err)
+	}
+}
+
+func TestRolloutTestSuite(t *testing.T) {
+	suite.Run(t, new(RolloutTestSuite))
+}
@@ -0,0 +1,105 @@
+package meta
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+type RuleType string
+
+const (
+	// Matches requests with a header exactly equal to the value.
+	RuleTypeHeader RuleType = "header"
+
+	// Matches requests with a header matching the RE2 regex value.
+	RuleTypeHeaderRegex RuleType = "header-regex"
+
+	// Matches requests with a cookie exactly equal to the value.
+	RuleTypeCookie RuleType = "cookie"
+
+	// Matches requests with a query parameter exactly equal to the value.
+	RuleTypeQuery RuleType = "query"
+
+	// Matches gRPC requests to the service named by the rule e.g. grpc:helloworld.Greeter=SayHello. If the value is empty
+	// or *, every method of the service matches.
+	RuleTypeGrpc RuleType = "grpc"
+)
+
+// A rule which always sends matching requests to the canary regardless of the canary's routing weight.
+type Rule struct {
+	Type  RuleType
+	Name  string
+	Value string
+}
+
+// The method of the gRPC service the rule matches. Empty if every method matches.
+func (r Rule) GrpcMethod() string {
+	if r.Value == "*" {
+		return ""
+	}
+	return r.Value
+}
+
+// Formats the rule in the form of <type>:<name>=<value>.
+func (r Rule) String() string {
+	return fmt.Sprintf("%s:%s=%s", r.Type, r.Name, r.Value)
+}
+
+// Parses a rule in the form of <type>:<name>=<value> e.g. header:x-canary=true or cookie:canary=always.
+func ParseRule(s string) (*Rule, error) {
+	s = strings.TrimSpace(s)
+	spl := strings.SplitN(s, ":", 2)
+	if len(spl) != 2 {
+		return nil, fmt.Errorf(`expected a rule in the form of <type>:<name>=<value> but got "%s"`, s)
+	}
+
+	nameValue := strings.SplitN(spl[1], "=", 2)
+	if len(nameValue) != 2 || nameValue[0] == "" {
+		return nil, fmt.Errorf(`expected a rule in the form of <type>:<name>=<value> but got "%s"`, s)
+	}
+
+	rule := &Rule{Type: RuleType(spl[0]), Name: nameValue[0], Value: nameValue[1]}
+	switch rule.Type {
+	case RuleTypeHeader, RuleTypeCookie, RuleTypeQuery:
+	case RuleTypeHeaderRegex:
+		if _, err := regexp.Compile(rule.Value); err != nil {
+			return nil, fmt.Errorf(`invalid regex "%s" for rule "%s"`, rule.Value, s)
+		}
+	case RuleTypeGrpc:
+		if strings.Contains(rule.Name, "/") || strings.Contains(rule.Value, "/") {
+			return nil, fmt.Errorf(`expected a gRPC service and method without slashes for rule "%s"`, s)
+		}
+	default:
+		return nil, fmt.Errorf(`invalid type "%s" for rule "%s"`, spl[0], s)
+	}
+
+	return rule, nil
+}
+
+// The header or cookie hashed to keep a user on the same variant.
+type Sticky struct {
+	Type RuleType
+	Name string
+}
+
+// Formats the sticky key in the form of <type>:<name>.
+func (s Sticky) String() string {
+	return fmt.Sprintf("%s:%s", s.Type, s.Name)
+}
+
+// Parses a sticky key in the form of <type>:<name> where the type is either header or cookie e.g. header:x-user-id.
+func ParseSticky(s string) (*Sticky, error) {
+	s = strings.TrimSpace(s)
+	spl := strings.SplitN(s, ":", 2)
+	if len(spl) != 2 || spl[1] == "" {
+		return nil, fmt.Errorf(`expected a sticky key in the form of <type>:<name> but got "%s"`, s)
+	}
+
+	sticky := &Sticky{Type: RuleType(spl[0]), Name: spl[1]}
+	if sticky.Type != RuleTypeHeader && sticky.Type != RuleTypeCookie {
+		return nil, fmt.Errorf(`invalid type "%s" for sticky key "%s". Must be either header or cookie`, spl[0], s)
+	}
+
+	return sticky, nil
+}
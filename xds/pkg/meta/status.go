@@ -0,0 +1,74 @@
+package meta
+
+type Phase string
+
+const (
+	// The canary controller exists but kage has not started proxying it yet.
+	PhasePending Phase = "Pending"
+
+	// The kage-mesh for the canary is being created.
+	PhaseInitializing Phase = "Initializing"
+
+	// The canary is moving through its rollout schedule.
+	PhaseProgressing Phase = "Progressing"
+
+	// The canary is holding its current weight until it is advanced, promoted, or aborted.
+	PhasePaused Phase = "Paused"
+
+	// The canary's pod template is being copied onto the source.
+	PhasePromoting Phase = "Promoting"
+
+	// The canary was promoted to the source.
+	PhaseSucceeded Phase = "Succeeded"
+
+	// The canary failed its analysis or could not be promoted. All traffic is sent to the source.
+	PhaseFailed Phase = "Failed"
+
+	// The canary was explicitly aborted. All traffic is sent to the source.
+	PhaseAborted Phase = "Aborted"
+)
+
+// The phases each phase can move to. Every phase can also move to itself to update the rest of the status.
+var phaseTransitions = map[Phase][]Phase{
+	PhasePending:      {PhaseInitializing, PhaseProgressing, PhasePaused, PhaseFailed, PhaseAborted},
+	PhaseInitializing: {PhaseProgressing, PhasePaused, PhaseFailed, PhaseAborted},
+	PhaseProgressing:  {PhasePaused, PhasePromoting, PhaseFailed, PhaseAborted},
+	PhasePaused:       {PhaseProgressing, PhasePromoting, PhaseFailed, PhaseAborted},
+	PhasePromoting:    {PhaseSucceeded, PhaseFailed},
+	PhaseSucceeded:    {},
+	PhaseFailed:       {PhaseInitializing, PhasePromoting, PhaseAborted},
+	PhaseAborted:      {},
+}
+
+// The lifecycle of a canary as seen by kage. Persisted on the canary controller so users can follow what kage is doing
+// with their canary.
+type Status struct {
+	Phase  Phase  `json:"phase,omitempty"`
+	Weight uint32 `json:"weight"`
+
+	// The kage-mesh proxying the canary and the node ID of its Envoy.
+	MeshName string `json:"mesh_name,omitempty"`
+	NodeId   string `json:"mesh_node_id,omitempty"`
+
+	LastTransitionUtc string `json:"last_transition_utc,omitempty"`
+	Message           string `json:"message,omitempty"`
+}
+
+func (s *Status) GetDomain() string {
+	return DomainCanary
+}
+
+// Whether a canary in the phase can move to the next phase. A canary without a known phase can move to any phase.
+func (p Phase) CanTransition(next Phase) bool {
+	transitions, ok := phaseTransitions[p]
+	if !ok || p == next {
+		return true
+	}
+
+	for _, v := range transitions {
+		if v == next {
+			return true
+		}
+	}
+	return false
+}
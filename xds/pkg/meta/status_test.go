@@ -0,0 +1,47 @@
+package meta
+
+import (
+	"github.com/stretchr/testify/suite"
+	"testing"
+)
+
+type StatusTestSuite struct {
+	suite.Suite
+}
+
+func (s *StatusTestSuite) TestCanTransition() {
+	// -- Given
+	//
+	type test struct {
+		From     Phase
+		To       Phase
+		Expected bool
+	}
+
+	given := []test{
+		{From: "", To: PhaseProgressing, Expected: true},
+		{From: PhasePending, To: PhaseInitializing, Expected: true},
+		{From: PhaseProgressing, To: PhaseProgressing, Expected: true},
+		{From: PhaseProgressing, To: PhasePromoting, Expected: true},
+		{From: PhasePromoting, To: PhaseProgressing, Expected: false},
+		{From: PhaseSucceeded, To: PhaseAborted, Expected: false},
+		{From: PhaseAborted, To: PhaseProgressing, Expected: false},
+		{From: PhaseAborted, To: PhaseAborted, Expected: true},
+		{From: PhaseFailed, To: PhasePromoting, Expected: true},
+		{From: "Unknown", To: PhasePaused, Expected: true},
+	}
+
+	for _, v := range given {
+		// -- When
+		//
+		actual := v.From.CanTransition(v.To)
+
+		// -- Then
+		//
+		s.Equal(v.Expected, actual, "%s to %s", v.From, v.To)
+	}
+}
+
+func TestStatusTestSuite(t *testing.T) {
+	suite.Run(t, new(StatusTestSuite))
+}
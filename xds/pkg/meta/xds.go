@@ -1,5 +1,10 @@
 package meta
 
+import (
+	"fmt"
+	"sort"
+)
+
 type ControllerType string
 
 const (
@@ -38,16 +43,102 @@ type XdsConfig struct {
 	XdsId
 	Canary EnvoyConfig `json:"canary"`
 	Source EnvoyConfig `json:"source"`
+
+	// Combines the canary and source endpoints for sticky routing. Empty for kage-meshes created before sticky routing
+	// was supported.
+	Sticky EnvoyConfig `json:"sticky,omitempty"`
+
+	// The cluster of each canary of the source indexed by the name of the canary controller. Empty for kage-meshes
+	// created before multiple variants were supported in which case the canary cluster is the only variant.
+	Variants map[string]string `json:"variants,omitempty"`
+
+	// The circuit breaker thresholds indexed by the cluster name. Clusters without thresholds use Envoy's defaults.
+	CircuitBreakers map[string]CircuitBreaker `json:"circuit_breakers,omitempty"`
 }
 
 func (x *XdsConfig) GetDomain() string {
 	return DomainXds
 }
 
+// The cluster of the canary variant. False if the canary is not a variant of the kage-mesh.
+func (x *XdsConfig) VariantCluster(canaryName string) (string, bool) {
+	if len(x.Variants) == 0 {
+		return x.Canary.ClusterName, x.Canary.ClusterName != ""
+	}
+	cluster, ok := x.Variants[canaryName]
+	return cluster, ok
+}
+
+// Adds the canary as a variant and returns its cluster. The first variant uses the canary cluster and the others get
+// a cluster of their own.
+func (x *XdsConfig) AddVariant(canaryName string) string {
+	if cluster, ok := x.Variants[canaryName]; ok {
+		return cluster
+	}
+
+	cluster := x.Canary.ClusterName
+	if len(x.Variants) > 0 {
+		cluster = fmt.Sprintf("%s-%s", x.Canary.ClusterName, canaryName)
+	} else {
+		x.Variants = map[string]string{}
+	}
+	x.Variants[canaryName] = cluster
+
+	return cluster
+}
+
+// Removes the canary variant and returns its cluster. False if the canary was not a variant.
+func (x *XdsConfig) RemoveVariant(canaryName string) (string, bool) {
+	cluster, ok := x.Variants[canaryName]
+	if ok {
+		delete(x.Variants, canaryName)
+	}
+	return cluster, ok
+}
+
+// The names of the canary controllers which are variants of the kage-mesh in sorted order.
+func (x *XdsConfig) VariantNames() []string {
+	names := make([]string, 0, len(x.Variants))
+	for k := range x.Variants {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// The clusters of every variant in the order of their canary's name.
+func (x *XdsConfig) VariantClusters() []string {
+	if len(x.Variants) == 0 {
+		return []string{x.Canary.ClusterName}
+	}
+
+	clusters := make([]string, 0, len(x.Variants))
+	for _, name := range x.VariantNames() {
+		clusters = append(clusters, x.Variants[name])
+	}
+	return clusters
+}
+
+func (x *XdsConfig) SetCircuitBreaker(cluster string, cb CircuitBreaker) {
+	if x.CircuitBreakers == nil {
+		x.CircuitBreakers = map[string]CircuitBreaker{}
+	}
+	x.CircuitBreakers[cluster] = cb
+}
+
 type EnvoyConfig struct {
 	ClusterName string `json:"cluster_name"`
 }
 
+// Changes whenever the baseline config of the kage-mesh changes so its pods restart and load it.
+type BaselineChecksum struct {
+	Checksum string `json:"baseline_checksum"`
+}
+
+func (b *BaselineChecksum) GetDomain() string {
+	return DomainXds
+}
+
 type XdsMarker struct {
 	Type ControllerType `json:"type"`
 }
@@ -0,0 +1,93 @@
+package meta
+
+import (
+	"github.com/stretchr/testify/suite"
+	"testing"
+)
+
+type XdsTestSuite struct {
+	suite.Suite
+}
+
+func (x *XdsTestSuite) TestAddVariant() {
+	// -- Given
+	//
+	given := &XdsConfig{Canary: EnvoyConfig{ClusterName: "canary"}}
+
+	// -- When
+	//
+	first := given.AddVariant("nginx-a")
+	second := given.AddVariant("nginx-b")
+	again := given.AddVariant("nginx-a")
+
+	// -- Then
+	//
+	x.Equal("canary", first)
+	x.Equal("canary-nginx-b", second)
+	x.Equal("canary", again)
+	x.Equal([]string{"nginx-a", "nginx-b"}, given.VariantNames())
+	x.Equal([]string{"canary", "canary-nginx-b"}, given.VariantClusters())
+}
+
+func (x *XdsTestSuite) TestRemoveVariant() {
+	// -- Given
+	//
+	given := &XdsConfig{Canary: EnvoyConfig{ClusterName: "canary"}}
+	given.AddVariant("nginx-a")
+	given.AddVariant("nginx-b")
+
+	// -- When
+	//
+	cluster, ok := given.RemoveVariant("nginx-a")
+
+	// -- Then
+	//
+	x.True(ok)
+	x.Equal("canary", cluster)
+
+	_, ok = given.VariantCluster("nginx-a")
+	x.False(ok)
+
+	cluster, ok = given.VariantCluster("nginx-b")
+	x.True(ok)
+	x.Equal("canary-nginx-b", cluster)
+}
+
+func (x *XdsTestSuite) TestVariantClusterWithoutVariants() {
+	// -- Given
+	//
+	given := &XdsConfig{Canary: EnvoyConfig{ClusterName: "canary"}}
+
+	// -- When
+	//
+	cluster, ok := given.VariantCluster("nginx")
+
+	// -- Then
+	//
+	x.True(ok)
+	x.Equal("canary", cluster)
+	x.Equal([]string{"canary"}, given.VariantClusters())
+}
+
+func (x *XdsTestSuite) TestVariantsRoundTrip() {
+	// -- Given
+	//
+	given := &Xds{Name: "mesh", Config: XdsConfig{Canary: EnvoyConfig{ClusterName: "canary"}}}
+	given.Config.AddVariant("nginx-a")
+	given.Config.AddVariant("nginx-b")
+
+	// -- When
+	//
+	actual := new(Xds)
+	err := FromMap(ToMap(given), actual)
+
+	// -- Then
+	//
+	if x.NoError(err) {
+		x.Equal(given.Config.Variants, actual.Config.Variants)
+	}
+}
+
+func TestXdsTestSuite(t *testing.T) {
+	suite.Run(t, new(XdsTestSuite))
+}
@@ -1,5 +1,9 @@
 package model
 
 const (
-	XdsClusterName = "xds"
+	XdsClusterName     = "xds"
+	TotalRoutingWeight = 100
+
+	// The name of the route configuration the HTTP listeners of every kage-mesh request over RDS.
+	RouteConfigName = "kage-mesh"
 )
@@ -12,17 +12,77 @@ node:
   id: {{.NodeId}}
 
 dynamic_resources:
+{{- if .Ads}}
+  ads_config:
+    api_type: {{if .Delta}}DELTA_GRPC{{else}}GRPC{{end}}
+    transport_api_version: V3
+    set_node_on_first_message_only: true
+    grpc_services:
+      - envoy_grpc:
+          cluster_name: xds
+  cds_config:
+    resource_api_version: V3
+    ads: {}
+  lds_config:
+    resource_api_version: V3
+    ads: {}
+{{- else}}
+  cds_config:
+    resource_api_version: V3
+    api_config_source:
+      api_type: {{if .Delta}}DELTA_GRPC{{else}}GRPC{{end}}
+      transport_api_version: V3
+      set_node_on_first_message_only: true
+      grpc_services:
+        - envoy_grpc:
+            cluster_name: xds
   lds_config:
     resource_api_version: V3
     api_config_source:
-      api_type: GRPC
+      api_type: {{if .Delta}}DELTA_GRPC{{else}}GRPC{{end}}
       transport_api_version: V3
       set_node_on_first_message_only: true
       grpc_services:
         - envoy_grpc:
             cluster_name: xds
+{{- end}}
 static_resources:
+  listeners:
+    - name: ` + StatsListenerName + `
+      address:
+        socket_address:
+          address: 0.0.0.0
+          port_value: {{.StatsPort}}
+      filter_chains:
+        - filters:
+            - name: envoy.filters.network.http_connection_manager
+              typed_config:
+                "@type": type.googleapis.com/envoy.extensions.filters.network.http_connection_manager.v3.HttpConnectionManager
+                stat_prefix: kage_stats
+                route_config:
+                  virtual_hosts:
+                    - name: ` + StatsListenerName + `
+                      domains: ["*"]
+                      routes:
+                        - match:
+                            prefix: ` + StatsPath + `
+                          route:
+                            cluster: ` + AdminClusterName + `
+                http_filters:
+                  - name: envoy.filters.http.router
   clusters:
+    - connect_timeout: 1s
+      load_assignment:
+        cluster_name: ` + AdminClusterName + `
+        endpoints:
+          - lb_endpoints:
+              - endpoint:
+                  address:
+                    socket_address:
+                      address: 127.0.0.1
+                      port_value: {{.AdminPort}}
+      name: ` + AdminClusterName + `
+      type: STATIC
     - connect_timeout: 1s
       load_assignment:
         cluster_name: xds
@@ -36,34 +96,20 @@ static_resources:
       http2_protocol_options: {}
       name: xds
       type: LOGICAL_DNS
-    - name: {{.CanaryClusterName}}
-      connect_timeout: 1s
-      type: EDS
-      lb_policy: round_robin
-      http2_protocol_options: {}
-      eds_cluster_config:
-        eds_config:
-          resource_api_version: V3
-          api_config_source:
-            transport_api_version: V3
-            api_type: GRPC
-            set_node_on_first_message_only: true
-            grpc_services:
-              - envoy_grpc:
-                  cluster_name: xds
-    - name: {{.ServiceClusterName}}
-      connect_timeout: 1s
-      type: EDS
-      lb_policy: round_robin
-      http2_protocol_options: {}
-      eds_cluster_config:
-        eds_config:
-          resource_api_version: V3
-          api_config_source:
-            transport_api_version: V3
-            api_type: GRPC
-            set_node_on_first_message_only: true
-            grpc_services:
-              - envoy_grpc:
-                  cluster_name: xds
+{{- if .Tls}}
+      transport_socket:
+        name: envoy.transport_sockets.tls
+        typed_config:
+          "@type": type.googleapis.com/envoy.extensions.transport_sockets.tls.v3.UpstreamTlsContext
+          sni: {{.XdsAddress}}
+          common_tls_context:
+            tls_certificates:
+              - certificate_chain:
+                  filename: ` + XdsTlsMountPath + `/tls.crt
+                private_key:
+                  filename: ` + XdsTlsMountPath + `/tls.key
+            validation_context:
+              trusted_ca:
+                filename: ` + XdsTlsMountPath + `/` + XdsTlsFieldCaCert + `
+{{- end}}
 `
@@ -4,3 +4,20 @@ const (
 	BaselineConfigMapName      = "baseline"
 	BaselineConfigMapFieldName = "baseline.yaml"
 )
+
+// The Secret of a kage-mesh's xDS client certificate and where it is mounted in the kage-mesh. The certificate and key
+// are stored under the standard TLS Secret fields.
+const (
+	XdsTlsVolumeName  = "xds-tls"
+	XdsTlsMountPath   = "/etc/kage/xds-tls"
+	XdsTlsFieldCaCert = "ca.crt"
+	XdsTlsFieldCaKey  = "ca.key"
+)
+
+// The Envoy admin server of a kage-mesh only listens on localhost. The static stats listener exposes just the
+// Prometheus stats of the admin server so they can be scraped from outside the pod.
+const (
+	StatsListenerName = "kage-stats"
+	AdminClusterName  = "kage-admin"
+	StatsPath         = "/stats/prometheus"
+)
@@ -3,8 +3,10 @@ package model
 import (
 	"context"
 	"github.com/kage-cloud/kage/core/kube/kconfig"
+	"github.com/kage-cloud/kage/xds/pkg/meta"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	"time"
 )
 
 type MeshConfigAnnotation struct {
@@ -29,12 +31,63 @@ type MeshConfig struct {
 	Canary             MeshCluster
 	Target             MeshCluster
 	TotalRoutingWeight uint32
+
+	// Requests matching any of the rules are always sent to the canary.
+	Rules []meta.Rule
+
+	// If set, requests are routed to the sticky cluster by the hash of the key rather than split by weight.
+	Sticky *StickyCluster
+
+	// If true, the target serves all requests and the canary receives a mirror of its routing weight of the requests.
+	Shadow bool
+
+	// The other canaries of the target in an A/B/n experiment. Each is sent its own routing weight of the traffic.
+	Variants []MeshVariant
+}
+
+// Another canary of the target alongside the mesh's canary.
+type MeshVariant struct {
+	MeshCluster
+
+	// Requests matching any of the rules are always sent to the variant.
+	Rules []meta.Rule
+}
+
+// Combines the endpoints of the target and canary into a single consistent-hash cluster.
+type StickyCluster struct {
+	Name string
+	Key  meta.Sticky
 }
 
 // Binds together the Envoy cluster and the Kubernetes deployment.
 type MeshCluster struct {
 	Name          string
 	RoutingWeight uint32
+
+	// The timeout and retries of the routes to the cluster. Ignored if nil.
+	Policy *RoutePolicy
+
+	// The faults injected into the requests routed to the cluster. Ignored if nil.
+	Fault *Fault
+}
+
+type RoutePolicy struct {
+	// The timeout of a whole request including its retries. Envoy's default route timeout is used if 0.
+	Timeout time.Duration
+
+	// The Envoy retry conditions. No retries if empty.
+	RetryOn    []string
+	NumRetries uint32
+}
+
+type Fault struct {
+	// The fixed delay added to DelayPercentage of the requests. No delay if 0.
+	Delay           time.Duration
+	DelayPercentage uint32
+
+	// The HTTP status that AbortPercentage of the requests are answered with. No aborts if 0.
+	AbortStatus     uint32
+	AbortPercentage uint32
 }
 
 type MeshConfigSpec struct {
@@ -50,7 +103,7 @@ type DeleteKageMeshSpec struct {
 
 type KageMeshSpec struct {
 	Ctx            context.Context
-	Canary         *Canary
+	Canary         *meta.Canary
 	LockdownTarget bool
 	Opt            kconfig.Opt
 }
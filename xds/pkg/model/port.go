@@ -0,0 +1,31 @@
+package model
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Separates a resource's name from the port in the names of the resources served for each port. Kubernetes names
+// cannot contain it.
+const portSeparator = "|"
+
+// The name of the cluster, endpoints, or route configuration serving the port e.g. source|8080.
+func PortName(name string, port uint32) string {
+	return fmt.Sprintf("%s%s%d", name, portSeparator, port)
+}
+
+// Splits the name of a resource serving a port into the name it was derived from and the port. False if the name is
+// not of a port's resource.
+func SplitPortName(name string) (string, uint32, bool) {
+	idx := strings.LastIndex(name, portSeparator)
+	if idx < 0 {
+		return "", 0, false
+	}
+
+	port, err := strconv.ParseUint(name[idx+len(portSeparator):], 10, 32)
+	if err != nil {
+		return "", 0, false
+	}
+	return name[:idx], uint32(port), true
+}
@@ -0,0 +1,11 @@
+package model
+
+// The application protocol spoken on a port of a service.
+type PortProtocol string
+
+const (
+	PortProtocolHttp  PortProtocol = "http"
+	PortProtocolHttp2 PortProtocol = "http2"
+	PortProtocolGrpc  PortProtocol = "grpc"
+	PortProtocolTcp   PortProtocol = "tcp"
+)
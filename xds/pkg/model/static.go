@@ -1,12 +1,21 @@
 package model
 
+// The bootstrap of the kage-mesh's Envoy. Only the cluster of the control plane is static as the rest of the clusters
+// are served over CDS.
 type Baseline struct {
 	NodeId      string
 	NodeCluster string
 	XdsAddress  string
 	XdsPort     uint16
 	AdminPort   uint16
+	StatsPort   uint16
 
-	ServiceClusterName string
-	CanaryClusterName  string
+	// If true, every resource is requested over a single ADS stream.
+	Ads bool
+
+	// If true, the resources are requested over the incremental xDS protocol.
+	Delta bool
+
+	// If true, the control plane is reached over mutual TLS with the client certificate mounted in the kage-mesh.
+	Tls bool
 }
@@ -0,0 +1,180 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/kage-cloud/kage/core/except"
+	"github.com/kage-cloud/kage/core/kube/kconfig"
+	"github.com/kage-cloud/kage/xds/pkg/analysis"
+	"github.com/kage-cloud/kage/xds/pkg/config"
+	"github.com/kage-cloud/kage/xds/pkg/meta"
+	log "github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+const AnalysisServiceKey = "AnalysisService"
+
+type AnalysisService interface {
+	// Compares the canary's traffic against the source's traffic since the rollout's checkpoint. If no checkpoint
+	// exists, all traffic since the kage-mesh started is used. The result is combined with the result of every
+	// configured analysis provider. Sticky canaries are only analysed by the providers.
+	Analyze(canary *meta.Canary, rollout *meta.Rollout) (*analysis.Result, error)
+
+	// Records the current stats of the canary's kage-mesh on the rollout so subsequent analyses only consider new
+	// traffic. The checkpoint is persisted along with the rollout.
+	Checkpoint(canary *meta.Canary, rollout *meta.Rollout) error
+}
+
+type analysisService struct {
+	Config            *config.Config       `inject:"Config"`
+	KubeReaderService KubeReaderService    `inject:"KubeReaderService"`
+	KageMeshService   KageMeshService      `inject:"KageMeshService"`
+	StatsClient       analysis.StatsClient `inject:"StatsClient"`
+	Providers         []analysis.Provider  `inject:"AnalysisProviders"`
+}
+
+func (a *analysisService) Analyze(canary *meta.Canary, rollout *meta.Rollout) (*analysis.Result, error) {
+	xdsAnno, err := a.KageMeshService.FetchForCanary(canary)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]*analysis.Result, 0, len(a.Providers)+1)
+
+	// Sticky traffic goes through a single Envoy cluster so the source and canary stats cannot be told apart.
+	if canary.Sticky == "" {
+		stats, err := a.scrape(xdsAnno, kconfig.Opt{Namespace: canary.SourceObj.Namespace})
+		if err != nil {
+			return nil, err
+		}
+
+		stats = stats.Since(a.checkpoint(canary, rollout, xdsAnno.Config.NodeId))
+
+		cluster, _ := xdsAnno.Config.VariantCluster(canary.CanaryObj.Name)
+		results = append(results, analysis.Compare(stats[xdsAnno.Config.Source.ClusterName], stats[cluster], a.thresholds(canary)))
+	}
+
+	target := analysis.TargetFromCanary(canary)
+	for _, provider := range a.Providers {
+		providerRes, err := provider.Evaluate(target)
+		if err != nil {
+			return nil, except.NewError("analysis provider %s failed: %s", except.ErrInternalError, provider.Name(), err.Error())
+		}
+		results = append(results, providerRes)
+	}
+
+	res := analysis.Combine(results...)
+
+	log.WithField("name", canary.CanaryObj.Name).
+		WithField("namespace", canary.CanaryObj.Namespace).
+		WithField("verdict", res.Verdict).
+		WithField("reasons", res.Reasons).
+		Debug("Analysed canary.")
+
+	return res, nil
+}
+
+func (a *analysisService) Checkpoint(canary *meta.Canary, rollout *meta.Rollout) error {
+	xdsAnno, err := a.KageMeshService.FetchForCanary(canary)
+	if err != nil {
+		return err
+	}
+
+	stats, err := a.scrape(xdsAnno, kconfig.Opt{Namespace: canary.SourceObj.Namespace})
+	if err != nil {
+		return err
+	}
+
+	b, err := json.Marshal(stats)
+	if err != nil {
+		return err
+	}
+
+	rollout.Checkpoint = string(b)
+	rollout.CheckpointNodeId = xdsAnno.Config.NodeId
+
+	return nil
+}
+
+// The stats recorded on the rollout for the kage-mesh with the node ID. Nil if there are none e.g. as the kage-mesh
+// was recreated since.
+func (a *analysisService) checkpoint(canary *meta.Canary, rollout *meta.Rollout, nodeId string) analysis.MeshStats {
+	if rollout.Checkpoint == "" || rollout.CheckpointNodeId != nodeId {
+		return nil
+	}
+
+	stats := analysis.MeshStats{}
+	if err := json.Unmarshal([]byte(rollout.Checkpoint), &stats); err != nil {
+		log.WithField("name", canary.CanaryObj.Name).
+			WithField("namespace", canary.CanaryObj.Namespace).
+			WithError(err).
+			Debug("Ignoring the canary's invalid stats checkpoint. The analysis will use all recorded traffic.")
+		return nil
+	}
+
+	return stats
+}
+
+// Scrapes the stats from every running kage-mesh pod and merges them together.
+func (a *analysisService) scrape(xdsAnno *meta.Xds, opt kconfig.Opt) (analysis.MeshStats, error) {
+	selector := labels.SelectorFromValidatedSet(meta.ToMap(&xdsAnno.Config.XdsId))
+	pods, err := a.KubeReaderService.ListPods(selector, opt)
+	if err != nil {
+		return nil, err
+	}
+
+	clusters := append([]string{xdsAnno.Config.Source.ClusterName}, xdsAnno.Config.VariantClusters()...)
+	stats := analysis.MeshStats{}
+	scraped := 0
+	for _, pod := range pods {
+		if pod.Status.PodIP == "" {
+			continue
+		}
+
+		addr := fmt.Sprintf("%s:%d", pod.Status.PodIP, a.Config.Xds.StatsPort)
+		podStats, err := a.StatsClient.Fetch(addr, clusters...)
+		if err != nil {
+			log.WithField("name", pod.Name).
+				WithField("namespace", pod.Namespace).
+				WithField("addr", addr).
+				WithError(err).
+				Debug("Failed to scrape stats from kage-mesh pod.")
+			continue
+		}
+
+		stats.Merge(podStats)
+		scraped++
+	}
+
+	if scraped == 0 {
+		return nil, except.NewError("no stats could be scraped for node ID %s", except.ErrNotFound, xdsAnno.Config.NodeId)
+	}
+
+	return stats, nil
+}
+
+func (a *analysisService) thresholds(canary *meta.Canary) *analysis.Thresholds {
+	conf := a.Config.Analysis
+	thresholds := &analysis.Thresholds{
+		MinRequests:          conf.MinRequests,
+		MaxSuccessRateDrop:   conf.MaxSuccessRateDrop,
+		LatencyPercentile:    conf.LatencyPercentile,
+		MaxLatencyIncreaseMs: conf.MaxLatencyIncreaseMs,
+	}
+
+	overrides := canary.Analysis
+	if overrides.MinRequests != 0 {
+		thresholds.MinRequests = overrides.MinRequests
+	}
+	if overrides.MaxSuccessRateDrop != 0 {
+		thresholds.MaxSuccessRateDrop = overrides.MaxSuccessRateDrop
+	}
+	if overrides.LatencyPercentile != 0 {
+		thresholds.LatencyPercentile = overrides.LatencyPercentile
+	}
+	if overrides.MaxLatencyIncreaseMs != 0 {
+		thresholds.MaxLatencyIncreaseMs = overrides.MaxLatencyIncreaseMs
+	}
+
+	return thresholds
+}
@@ -1,24 +1,458 @@
 package service
 
 import (
+	"github.com/kage-cloud/kage/core/except"
 	"github.com/kage-cloud/kage/core/kube"
+	"github.com/kage-cloud/kage/core/kube/kconfig"
+	"github.com/kage-cloud/kage/core/kube/kstream"
 	"github.com/kage-cloud/kage/core/kube/ktypes"
+	"github.com/kage-cloud/kage/core/kube/kubeutil"
+	"github.com/kage-cloud/kage/xds/pkg/crd"
 	"github.com/kage-cloud/kage/xds/pkg/meta"
+	"github.com/kage-cloud/kage/xds/pkg/model"
+	log "github.com/sirupsen/logrus"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/util/retry"
+	"sort"
+	"time"
 )
 
 const CanaryServiceKey = "CanaryService"
 
+const promoteReadyTimeout = 5 * time.Minute
+
 type CanaryService interface {
 	FetchForPod(pod *corev1.Pod) *meta.Canary
 	FetchForController(obj runtime.Object) *meta.Canary
+
+	// Fetches the canary controller with the specified name regardless of its kind.
+	Get(name string, opt kconfig.Opt) (*meta.Canary, error)
+
+	// Makes the canary the new source. The canary's pod template is copied onto the source and, once the source is
+	// ready, all of the canary's traffic is sent back to it. The canary is then removed from its kage-mesh which is torn
+	// down along with the proxying of its services if the canary was its last variant.
+	Promote(canary *meta.Canary) error
+
+	// Sends all traffic back to the source and waits for the kage-mesh to ACK the change before releasing the proxied
+	// services. The reason is recorded on the canary. Safe to retry if it fails part way through.
+	Abort(canary *meta.Canary, reason string) error
+
+	// Whether the canary controller has been aborted.
+	IsAborted(obj runtime.Object) bool
+
+	// Lists every canary controller in the namespace. Lists all namespaces if the namespace is empty.
+	List(opt kconfig.Opt) ([]meta.Canary, error)
+
+	// Saves the routing percentage onto the canary controller and sends that weight of traffic to the canary. A
+	// canary with a rollout schedule overrides the percentage at its next step.
+	SetRoutingPercentage(canary *meta.Canary, percentage uint32) error
+
+	// Switches the canary's fault injection on or off and updates the kage-mesh's routes to match. A canary defined by
+	// a Canary resource has the resource updated instead so the change is not undone by the next apply.
+	SetFaultsEnabled(canary *meta.Canary, enabled bool) error
 }
 
 type canaryService struct {
-	KubeReaderService KubeReaderService `inject:"KubeReaderService"`
-	KubeClient        kube.Client       `inject:"KubeClient"`
+	KubeReaderService   KubeReaderService   `inject:"KubeReaderService"`
+	KubeClient          kube.Client         `inject:"KubeClient"`
+	KageMeshService     KageMeshService     `inject:"KageMeshService"`
+	XdsService          XdsService          `inject:"XdsService"`
+	CanaryStatusService CanaryStatusService `inject:"CanaryStatusService"`
+	EventRecorder       kube.EventRecorder  `inject:"EventRecorder"`
+}
+
+func (c *canaryService) Get(name string, opt kconfig.Opt) (*meta.Canary, error) {
+	return fetchCanary(c.KubeReaderService, name, opt)
+}
+
+func (c *canaryService) List(opt kconfig.Opt) ([]meta.Canary, error) {
+	canaries := make([]meta.Canary, 0)
+	for _, kind := range controllerKinds {
+		li, err := c.KubeReaderService.List(canarySelector, kind, opt)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, obj := range kstream.StreamFromList(li).Collect().Objects() {
+			if canary := c.FetchForController(obj); canary != nil {
+				canaries = append(canaries, *canary)
+			}
+		}
+	}
+
+	sort.Slice(canaries, func(i, j int) bool {
+		if canaries[i].CanaryObj.Namespace != canaries[j].CanaryObj.Namespace {
+			return canaries[i].CanaryObj.Namespace < canaries[j].CanaryObj.Namespace
+		}
+		return canaries[i].CanaryObj.Name < canaries[j].CanaryObj.Name
+	})
+
+	return canaries, nil
+}
+
+func (c *canaryService) SetRoutingPercentage(canary *meta.Canary, percentage uint32) error {
+	if percentage > model.TotalRoutingWeight {
+		return except.NewError("routing percentage %d exceeds the max of %d", except.ErrInvalid, percentage, model.TotalRoutingWeight)
+	}
+
+	opt := kconfig.Opt{Namespace: canary.CanaryObj.Namespace}
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		obj, err := c.KubeClient.Get(canary.CanaryObj.Name, ktypes.Kind(canary.CanaryObj.Kind), opt)
+		if err != nil {
+			return err
+		}
+
+		if c.IsAborted(obj) {
+			return except.NewError("the canary %s has been aborted", except.ErrConflict, canary.CanaryObj.Name)
+		}
+
+		status, err := c.CanaryStatusService.Fetch(obj)
+		if err != nil {
+			return err
+		}
+
+		if !status.Phase.CanTransition(meta.PhaseProgressing) {
+			return except.NewError("the routing percentage of canary %s cannot be changed while it is %s", except.ErrConflict, canary.CanaryObj.Name, status.Phase)
+		}
+
+		current := c.FetchForController(obj)
+		if current == nil {
+			return except.NewError("%s %s is no longer a canary", except.ErrNotFound, canary.CanaryObj.Kind, canary.CanaryObj.Name)
+		}
+		current.RoutingPercentage = percentage
+
+		metaObj := obj.(metav1.Object)
+		metaObj.SetAnnotations(meta.Merge(metaObj.GetAnnotations(), current))
+		_, err = c.KubeClient.Update(obj, opt)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	canary.RoutingPercentage = percentage
+
+	xdsAnno, err := c.KageMeshService.FetchForCanary(canary)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			// Without a kage-mesh, no traffic is proxied yet so only the saved percentage changes.
+			return nil
+		}
+		return err
+	}
+
+	if err := c.XdsService.SetCanaryWeight(canary, xdsAnno, percentage); err != nil {
+		return err
+	}
+
+	if err := c.XdsService.AwaitMesh(xdsAnno.Config.NodeId); err != nil {
+		if except.Reason(err) != except.ErrNotFound {
+			return err
+		}
+		// A disconnected Envoy will fetch the new weight on reconnect.
+		log.WithField("name", canary.CanaryObj.Name).
+			WithField("namespace", canary.CanaryObj.Namespace).
+			WithField("node_id", xdsAnno.Config.NodeId).
+			Warn("No kage-mesh is connected to ACK the canary's new routing percentage.")
+	}
+
+	log.WithField("name", canary.CanaryObj.Name).
+		WithField("namespace", canary.CanaryObj.Namespace).
+		WithField("percentage", percentage).
+		Info("Changed the routing percentage of canary.")
+
+	return nil
+}
+
+func (c *canaryService) SetFaultsEnabled(canary *meta.Canary, enabled bool) error {
+	if canary.Resource != "" {
+		if err := c.setResourceFaultsEnabled(canary, enabled); err != nil {
+			return err
+		}
+		canary.Faults.Enabled = enabled
+		return nil
+	}
+
+	opt := kconfig.Opt{Namespace: canary.CanaryObj.Namespace}
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		obj, err := c.KubeClient.Get(canary.CanaryObj.Name, ktypes.Kind(canary.CanaryObj.Kind), opt)
+		if err != nil {
+			return err
+		}
+
+		current := c.FetchForController(obj)
+		if current == nil {
+			return except.NewError("%s %s is no longer a canary", except.ErrNotFound, canary.CanaryObj.Kind, canary.CanaryObj.Name)
+		}
+		current.Faults.Enabled = enabled
+
+		metaObj := obj.(metav1.Object)
+		metaObj.SetAnnotations(meta.Merge(metaObj.GetAnnotations(), current))
+		_, err = c.KubeClient.Update(obj, opt)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	canary.Faults.Enabled = enabled
+
+	xdsAnno, err := c.KageMeshService.FetchForCanary(canary)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			// Without a kage-mesh, no traffic is proxied yet so the faults are injected once it is created.
+			return nil
+		}
+		return err
+	}
+
+	if err := c.XdsService.SetCanaryRules(canary, xdsAnno); err != nil {
+		return err
+	}
+
+	log.WithField("name", canary.CanaryObj.Name).
+		WithField("namespace", canary.CanaryObj.Namespace).
+		WithField("enabled", enabled).
+		Info("Toggled the fault injection of canary.")
+
+	return nil
+}
+
+// The Canary resource informer applies the change onto the canary controller which then updates the routes.
+func (c *canaryService) setResourceFaultsEnabled(canary *meta.Canary, enabled bool) error {
+	client := c.KubeClient.Dynamic().Resource(crd.CanaryResource).Namespace(canary.CanaryObj.Namespace)
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		u, err := client.Get(canary.Resource, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+
+		if err := unstructured.SetNestedField(u.Object, enabled, "spec", "faults", "enabled"); err != nil {
+			return err
+		}
+
+		_, err = client.Update(u, metav1.UpdateOptions{})
+		return err
+	})
+}
+
+func (c *canaryService) Promote(canary *meta.Canary) error {
+	if err := c.CanaryStatusService.Transition(canary, meta.PhasePromoting, "Copying the canary onto the source."); err != nil {
+		return err
+	}
+
+	if err := c.promote(canary); err != nil {
+		c.EventRecorder.Warning(canaryEventObj(c.KubeReaderService, canary), EventReasonCanaryPromoteFailed, "Failed to promote the canary to %s: %s", canary.SourceObj.Name, err.Error())
+		if statusErr := c.CanaryStatusService.Transition(canary, meta.PhaseFailed, "Failed to promote: "+err.Error()); statusErr != nil {
+			log.WithField("name", canary.CanaryObj.Name).
+				WithField("namespace", canary.CanaryObj.Namespace).
+				WithError(statusErr).
+				Error("Failed to record the failed promotion of the canary.")
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (c *canaryService) promote(canary *meta.Canary) error {
+	sourceOpt := kconfig.Opt{Namespace: canary.SourceObj.Namespace}
+	canaryOpt := kconfig.Opt{Namespace: canary.CanaryObj.Namespace}
+	sourceKind := ktypes.Kind(canary.SourceObj.Kind)
+
+	canaryObj, err := c.KubeReaderService.Get(canary.CanaryObj.Name, ktypes.Kind(canary.CanaryObj.Kind), canaryOpt)
+	if err != nil {
+		return err
+	}
+
+	sourceObj, err := c.KubeReaderService.Get(canary.SourceObj.Name, sourceKind, sourceOpt)
+	if err != nil {
+		return err
+	}
+	sourceObj = sourceObj.DeepCopyObject()
+
+	canaryTemplate := kubeutil.PodTemplate(canaryObj)
+	sourceTemplate := kubeutil.PodTemplate(sourceObj)
+	if canaryTemplate == nil || sourceTemplate == nil {
+		return except.NewError("a %s canary of a %s cannot be promoted as they do not both have a pod template", except.ErrUnsupported, canary.CanaryObj.Kind, canary.SourceObj.Kind)
+	}
+
+	// The traffic is only moved onto the source once its pods run the canary's template.
+	if !kubeutil.RollsOutTemplate(sourceObj) {
+		return except.NewError("the %s %s cannot be promoted onto as it does not replace its pods when its pod template changes", except.ErrUnsupported, canary.SourceObj.Kind, canary.SourceObj.Name)
+	}
+
+	// The labels of the source are kept so its selector still matches its pods.
+	sourceTemplate.Spec = *canaryTemplate.Spec.DeepCopy()
+	sourceTemplate.Annotations = labels.Merge(sourceTemplate.Annotations, canaryTemplate.Annotations)
+
+	if _, err := c.KubeClient.Update(sourceObj, sourceOpt); err != nil {
+		return err
+	}
+
+	log.WithField("name", canary.SourceObj.Name).
+		WithField("namespace", canary.SourceObj.Namespace).
+		WithField("canary", canary.CanaryObj.Name).
+		Info("Promoting canary. Waiting for the source to be ready.")
+
+	if err := c.KubeClient.WaitTillReady(canary.SourceObj.Name, sourceKind, promoteReadyTimeout, sourceOpt); err != nil {
+		return err
+	}
+
+	xdsAnno, err := c.KageMeshService.FetchForCanary(canary)
+	if err != nil {
+		return err
+	}
+
+	if err := c.routeToSource(canary, xdsAnno); err != nil {
+		return err
+	}
+
+	// Recorded before the canary is deleted so watchers of the canary see it succeed.
+	if err := c.CanaryStatusService.Transition(canary, meta.PhaseSucceeded, "Promoted to the source."); err != nil {
+		return err
+	}
+
+	err = c.KubeClient.Delete(canary.CanaryObj.Name, ktypes.Kind(canary.CanaryObj.Kind), canaryOpt)
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+
+	// The other variants of the source carry on against the promoted source.
+	if err := c.KageMeshService.RemoveVariant(canary); err != nil {
+		return err
+	}
+
+	log.WithField("name", canary.SourceObj.Name).
+		WithField("namespace", canary.SourceObj.Namespace).
+		WithField("canary", canary.CanaryObj.Name).
+		Info("Promoted canary.")
+
+	return nil
+}
+
+func (c *canaryService) Abort(canary *meta.Canary, reason string) error {
+	message := "Aborted."
+	if reason != "" {
+		message = "Aborted: " + reason
+	}
+
+	if err := c.CanaryStatusService.Transition(canary, meta.PhaseAborted, message); err != nil {
+		return err
+	}
+
+	if err := c.abort(canary, reason); err != nil {
+		c.EventRecorder.Warning(canaryEventObj(c.KubeReaderService, canary), EventReasonCanaryAbortFailed, "Failed to send all traffic back to %s: %s", canary.SourceObj.Name, err.Error())
+		return err
+	}
+
+	return nil
+}
+
+func (c *canaryService) abort(canary *meta.Canary, reason string) error {
+	if err := c.saveAbort(canary, reason, time.Now()); err != nil {
+		return err
+	}
+
+	xdsAnno, err := c.KageMeshService.FetchForCanary(canary)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			// Without a kage-mesh, nothing is proxied so the traffic is already going to the services' pods.
+			return nil
+		}
+		return err
+	}
+
+	if err := c.routeToSource(canary, xdsAnno); err != nil {
+		return err
+	}
+
+	if err := c.XdsService.AwaitMesh(xdsAnno.Config.NodeId); err != nil {
+		if except.Reason(err) != except.ErrNotFound {
+			return err
+		}
+		// A disconnected Envoy will fetch the latest snapshot on reconnect and releasing the services bypasses it
+		// regardless.
+		log.WithField("name", canary.CanaryObj.Name).
+			WithField("namespace", canary.CanaryObj.Namespace).
+			WithField("node_id", xdsAnno.Config.NodeId).
+			Warn("No kage-mesh is connected to ACK the aborted canary's routes.")
+	}
+
+	// The other variants of the source still need their traffic proxied.
+	if len(xdsAnno.Config.VariantNames()) > 1 {
+		log.WithField("name", canary.CanaryObj.Name).
+			WithField("namespace", canary.CanaryObj.Namespace).
+			WithField("reason", reason).
+			Info("Aborted canary. The services stay proxied for the other variants.")
+		return nil
+	}
+
+	if err := c.KageMeshService.Release(xdsAnno, kconfig.Opt{Namespace: canary.SourceObj.Namespace}); err != nil {
+		return err
+	}
+
+	log.WithField("name", canary.CanaryObj.Name).
+		WithField("namespace", canary.CanaryObj.Namespace).
+		WithField("reason", reason).
+		Info("Aborted canary.")
+
+	return nil
+}
+
+func (c *canaryService) IsAborted(obj runtime.Object) bool {
+	metaObj, ok := obj.(metav1.Object)
+	if !ok {
+		return false
+	}
+
+	abort := new(meta.Abort)
+	if err := meta.FromMap(metaObj.GetAnnotations(), abort); err != nil {
+		return false
+	}
+
+	return abort.Aborted
+}
+
+// Sends all traffic to the source. The canary's routing rules are dropped as they would otherwise keep sending traffic
+// to the canary.
+func (c *canaryService) routeToSource(canary *meta.Canary, xdsAnno *meta.Xds) error {
+	source := *canary
+	source.Rules = nil
+	source.Mode = meta.CanaryModeWeighted
+	return c.XdsService.SetCanaryWeight(&source, xdsAnno, 0)
+}
+
+func (c *canaryService) saveAbort(canary *meta.Canary, reason string, now time.Time) error {
+	opt := kconfig.Opt{Namespace: canary.CanaryObj.Namespace}
+	// Read from the API rather than the informer cache as the status of the canary was just updated.
+	obj, err := c.KubeClient.Get(canary.CanaryObj.Name, ktypes.Kind(canary.CanaryObj.Kind), opt)
+	if err != nil {
+		return err
+	}
+	metaObj := obj.(metav1.Object)
+
+	abort := new(meta.Abort)
+	if err := meta.FromMap(metaObj.GetAnnotations(), abort); err != nil {
+		return except.NewError("canary has unexpected abort annotations: %s", except.ErrInvalid, err.Error())
+	}
+
+	if !abort.Aborted {
+		abort.Aborted = true
+		abort.AbortedUtc = now.UTC().Format(time.RFC3339)
+	}
+
+	if reason != "" {
+		abort.Reason = reason
+	}
+
+	metaObj.SetAnnotations(meta.Merge(metaObj.GetAnnotations(), abort))
+
+	_, err = c.KubeClient.Update(obj, opt)
+	return err
 }
 
 func (c *canaryService) FetchForController(obj runtime.Object) *meta.Canary {
@@ -27,7 +461,7 @@ func (c *canaryService) FetchForController(obj runtime.Object) *meta.Canary {
 		return nil
 	}
 
-	canary, err := c.unmarshalAnno(metaObj)
+	canary, err := unmarshalCanary(metaObj)
 	if err != nil {
 		return nil
 	}
@@ -48,7 +482,7 @@ func (c *canaryService) getCanaryAnnoForPod(pod *corev1.Pod) *meta.Canary {
 			return true, nil
 		}
 
-		canaryAnno, err = c.unmarshalAnno(metaObj)
+		canaryAnno, err = unmarshalCanary(metaObj)
 		if err != nil {
 			return true, nil
 		}
@@ -63,7 +497,28 @@ func (c *canaryService) getCanaryAnnoForPod(pod *corev1.Pod) *meta.Canary {
 	return canaryAnno
 }
 
-func (c *canaryService) unmarshalAnno(metaObj metav1.Object) (*meta.Canary, error) {
+// Fetches the canary controller with the specified name regardless of its kind.
+func fetchCanary(reader KubeReaderService, name string, opt kconfig.Opt) (*meta.Canary, error) {
+	for _, kind := range controllerKinds {
+		obj, err := reader.Get(name, kind, opt)
+		if err != nil {
+			continue
+		}
+
+		metaObj, ok := obj.(metav1.Object)
+		if !ok || !canarySelector.Matches(labels.Set(metaObj.GetLabels())) {
+			continue
+		}
+
+		if canary, err := unmarshalCanary(metaObj); err == nil {
+			return canary, nil
+		}
+	}
+
+	return nil, except.NewError("canary %s could not be found", except.ErrNotFound, name)
+}
+
+func unmarshalCanary(metaObj metav1.Object) (*meta.Canary, error) {
 	canaryAnno := new(meta.Canary)
 	if err := meta.FromMap(metaObj.GetAnnotations(), canaryAnno); err != nil {
 		return nil, err
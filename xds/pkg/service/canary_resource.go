@@ -0,0 +1,164 @@
+package service
+
+import (
+	"github.com/kage-cloud/kage/core/except"
+	"github.com/kage-cloud/kage/core/kube"
+	"github.com/kage-cloud/kage/core/kube/kconfig"
+	"github.com/kage-cloud/kage/core/kube/ktypes"
+	"github.com/kage-cloud/kage/xds/pkg/crd"
+	"github.com/kage-cloud/kage/xds/pkg/meta"
+	log "github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"reflect"
+)
+
+const CanaryResourceServiceKey = "CanaryResourceService"
+
+// Maps Canary resources onto the annotations of their canary controllers so a canary defined by a resource is handled
+// the same as one defined by hand.
+type CanaryResourceService interface {
+	// Writes the canary defined by the resource onto the canary controller.
+	Apply(obj runtime.Object) error
+
+	// Aborts the canary defined by the resource.
+	Remove(obj runtime.Object) error
+
+	// Copies the status of the canary controller onto the Canary resource which defines it. Does nothing if the canary
+	// was defined by hand.
+	SyncStatus(obj runtime.Object) error
+}
+
+type canaryResourceService struct {
+	KubeClient          kube.Client         `inject:"KubeClient"`
+	CanaryService       CanaryService       `inject:"CanaryService"`
+	CanaryStatusService CanaryStatusService `inject:"CanaryStatusService"`
+	EventRecorder       kube.EventRecorder  `inject:"EventRecorder"`
+}
+
+func (c *canaryResourceService) Apply(obj runtime.Object) error {
+	res, err := c.fromObject(obj)
+	if err != nil {
+		return err
+	}
+
+	canary, err := res.ToMeta()
+	if err != nil {
+		c.EventRecorder.Warning(obj, EventReasonResourceInvalid, "%s", err.Error())
+		return except.NewError("invalid %s %s: %s", except.ErrInvalid, crd.KindCanary, res.Name, err.Error())
+	}
+
+	opt := kconfig.Opt{Namespace: res.Namespace}
+	controller, err := c.KubeClient.Get(canary.CanaryObj.Name, ktypes.Kind(canary.CanaryObj.Kind), opt)
+	if err != nil {
+		return err
+	}
+	metaObj := controller.(metav1.Object)
+
+	// Dropping the previous canary annotations stops fields removed from the spec from lingering.
+	annos := map[string]string{}
+	for k, v := range metaObj.GetAnnotations() {
+		annos[k] = v
+	}
+	prev := new(meta.Canary)
+	if err := meta.FromMap(annos, prev); err == nil {
+		for k := range meta.ToMap(prev) {
+			delete(annos, k)
+		}
+	}
+
+	annos = meta.Merge(annos, canary)
+	lbls := meta.Merge(metaObj.GetLabels(), &meta.CanaryMarker{Canary: true})
+
+	if reflect.DeepEqual(annos, metaObj.GetAnnotations()) && reflect.DeepEqual(lbls, metaObj.GetLabels()) {
+		return nil
+	}
+
+	metaObj.SetAnnotations(annos)
+	metaObj.SetLabels(lbls)
+	if _, err := c.KubeClient.Update(controller, opt); err != nil {
+		return err
+	}
+
+	c.EventRecorder.Normal(obj, EventReasonResourceApplied, "Applied the canary onto %s %s.", canary.CanaryObj.Kind, canary.CanaryObj.Name)
+
+	log.WithField("name", res.Name).
+		WithField("namespace", res.Namespace).
+		WithField("canary", canary.CanaryObj.Name).
+		Info("Applied Canary resource.")
+
+	return nil
+}
+
+func (c *canaryResourceService) Remove(obj runtime.Object) error {
+	res, err := c.fromObject(obj)
+	if err != nil {
+		return err
+	}
+
+	opt := kconfig.Opt{Namespace: res.Namespace}
+	controller, err := c.KubeClient.Get(res.Spec.Canary.Name, ktypes.Kind(res.Spec.Canary.Kind), opt)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+
+	canary := c.CanaryService.FetchForController(controller)
+	if canary == nil || canary.Resource != res.Name || c.CanaryService.IsAborted(controller) {
+		return nil
+	}
+
+	return c.CanaryService.Abort(canary, "The Canary resource was deleted.")
+}
+
+func (c *canaryResourceService) SyncStatus(obj runtime.Object) error {
+	canary := c.CanaryService.FetchForController(obj)
+	if canary == nil || canary.Resource == "" {
+		return nil
+	}
+
+	status, err := c.CanaryStatusService.Fetch(obj)
+	if err != nil {
+		return err
+	}
+
+	client := c.KubeClient.Dynamic().Resource(crd.CanaryResource).Namespace(canary.CanaryObj.Namespace)
+	u, err := client.Get(canary.Resource, metav1.GetOptions{})
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+
+	next, err := crd.StatusFromMeta(status).ToUnstructured()
+	if err != nil {
+		return err
+	}
+
+	if prev, ok := u.Object["status"]; ok && reflect.DeepEqual(prev, next) {
+		return nil
+	}
+
+	u.Object["status"] = next
+	_, err = client.UpdateStatus(u, metav1.UpdateOptions{})
+	return err
+}
+
+func (c *canaryResourceService) fromObject(obj runtime.Object) (*crd.Canary, error) {
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return nil, except.NewError("%T is not a %s resource", except.ErrInvalid, obj, crd.KindCanary)
+	}
+
+	res, err := crd.FromUnstructured(u)
+	if err != nil {
+		return nil, except.NewError("%s", except.ErrInvalid, err.Error())
+	}
+
+	return res, nil
+}
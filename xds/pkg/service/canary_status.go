@@ -0,0 +1,152 @@
+package service
+
+import (
+	"github.com/kage-cloud/kage/core/except"
+	"github.com/kage-cloud/kage/core/kube"
+	"github.com/kage-cloud/kage/core/kube/kconfig"
+	"github.com/kage-cloud/kage/core/kube/ktypes"
+	"github.com/kage-cloud/kage/xds/pkg/meta"
+	log "github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/util/retry"
+	"time"
+)
+
+const CanaryStatusServiceKey = "CanaryStatusService"
+
+// The state machine for the lifecycle of a canary. The status is written back to the canary controller as annotations.
+type CanaryStatusService interface {
+	// Fetches the persisted status of the canary controller.
+	Fetch(obj runtime.Object) (*meta.Status, error)
+
+	// Moves the canary to the phase with the message. Returns an ErrConflict if the canary cannot move from its current
+	// phase to the specified phase.
+	Transition(canary *meta.Canary, phase meta.Phase, message string) error
+
+	// Records the weight of traffic sent to the canary without changing its phase.
+	SetWeight(canary *meta.Canary, weight uint32) error
+
+	// Records that the canary is proxied by the kage-mesh. A pending or initializing canary moves on to progressing if
+	// it has a rollout schedule and paused otherwise.
+	Proxied(canary *meta.Canary, xdsAnno *meta.Xds) error
+}
+
+type canaryStatusService struct {
+	KubeClient    kube.Client        `inject:"KubeClient"`
+	EventRecorder kube.EventRecorder `inject:"EventRecorder"`
+}
+
+func (c *canaryStatusService) Fetch(obj runtime.Object) (*meta.Status, error) {
+	metaObj, ok := obj.(metav1.Object)
+	if !ok {
+		return nil, except.NewError("%T is not a valid kube meta object", except.ErrInvalid, obj)
+	}
+
+	status := new(meta.Status)
+	if err := meta.FromMap(metaObj.GetAnnotations(), status); err != nil {
+		return nil, except.NewError("canary has unexpected status annotations: %s", except.ErrInvalid, err.Error())
+	}
+
+	return status, nil
+}
+
+func (c *canaryStatusService) Transition(canary *meta.Canary, phase meta.Phase, message string) error {
+	return c.update(canary, func(status *meta.Status) error {
+		return c.transition(canary, status, phase, message)
+	})
+}
+
+func (c *canaryStatusService) SetWeight(canary *meta.Canary, weight uint32) error {
+	return c.update(canary, func(status *meta.Status) error {
+		status.Weight = weight
+		return nil
+	})
+}
+
+func (c *canaryStatusService) Proxied(canary *meta.Canary, xdsAnno *meta.Xds) error {
+	return c.update(canary, func(status *meta.Status) error {
+		status.MeshName = xdsAnno.Name
+		status.NodeId = xdsAnno.Config.NodeId
+
+		switch status.Phase {
+		case "", meta.PhasePending, meta.PhaseInitializing:
+		default:
+			return nil
+		}
+
+		status.Weight = canary.RoutingPercentage
+		if len(canary.Steps) > 0 {
+			return c.transition(canary, status, meta.PhaseProgressing, "Starting the rollout schedule.")
+		}
+		return c.transition(canary, status, meta.PhasePaused, "Holding the routing percentage until the canary is promoted or aborted.")
+	})
+}
+
+func (c *canaryStatusService) transition(canary *meta.Canary, status *meta.Status, phase meta.Phase, message string) error {
+	if !status.Phase.CanTransition(phase) {
+		return except.NewError("canary %s cannot move from %s to %s", except.ErrConflict, canary.CanaryObj.Name, status.Phase, phase)
+	}
+
+	if status.Phase != phase {
+		log.WithField("name", canary.CanaryObj.Name).
+			WithField("namespace", canary.CanaryObj.Namespace).
+			WithField("from", status.Phase).
+			WithField("to", phase).
+			WithField("message", message).
+			Info("Canary changed phase.")
+		status.LastTransitionUtc = time.Now().UTC().Format(time.RFC3339)
+	}
+
+	status.Phase = phase
+	status.Message = message
+	return nil
+}
+
+// Applies the mutation to the latest status of the canary controller. The controller is only updated if the status
+// changed.
+func (c *canaryStatusService) update(canary *meta.Canary, mutate func(status *meta.Status) error) error {
+	opt := kconfig.Opt{Namespace: canary.CanaryObj.Namespace}
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		obj, err := c.KubeClient.Get(canary.CanaryObj.Name, ktypes.Kind(canary.CanaryObj.Kind), opt)
+		if err != nil {
+			return err
+		}
+
+		status, err := c.Fetch(obj)
+		if err != nil {
+			return err
+		}
+
+		prev := *status
+		if err := mutate(status); err != nil {
+			return err
+		}
+
+		if prev == *status {
+			return nil
+		}
+
+		metaObj := obj.(metav1.Object)
+		metaObj.SetAnnotations(meta.Merge(metaObj.GetAnnotations(), status))
+
+		if _, err := c.KubeClient.Update(obj, opt); err != nil {
+			return err
+		}
+
+		if prev.Phase != status.Phase {
+			c.recordTransition(obj, status)
+		}
+		return nil
+	})
+}
+
+func (c *canaryStatusService) recordTransition(obj runtime.Object, status *meta.Status) {
+	reason := phaseEventReason(status.Phase)
+	switch status.Phase {
+	case meta.PhaseFailed, meta.PhaseAborted:
+		c.EventRecorder.Warning(obj, reason, "%s", status.Message)
+	default:
+		c.EventRecorder.Normal(obj, reason, "%s", status.Message)
+	}
+}
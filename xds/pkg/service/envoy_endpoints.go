@@ -10,6 +10,7 @@ import (
 	"github.com/kage-cloud/kage/core/kube/ktypes/objconv"
 	"github.com/kage-cloud/kage/xds/pkg/factory"
 	"github.com/kage-cloud/kage/xds/pkg/meta"
+	"github.com/kage-cloud/kage/xds/pkg/model"
 	"github.com/kage-cloud/kage/xds/pkg/snap"
 	"github.com/kage-cloud/kage/xds/pkg/snap/store"
 	"github.com/kage-cloud/kage/xds/pkg/util"
@@ -17,6 +18,7 @@ import (
 	"github.com/opencontainers/runc/Godeps/_workspace/src/github.com/Sirupsen/logrus"
 	log "github.com/sirupsen/logrus"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 )
@@ -30,25 +32,26 @@ type CanaryEndpointsService interface {
 }
 
 type canaryEndpointsService struct {
-	KubeReaderService KubeReaderService       `inject:"KubeReaderService"`
-	LockdownService   ProxyService            `inject:"ProxyService"`
-	EndpointFactory   factory.EndpointFactory `inject:"EndpointFactory"`
-	ListenerFactory   factory.ListenerFactory `inject:"ListenerFactory"`
-	StoreClient       snap.StoreClient        `inject:"StoreClient"`
-	KageMeshService   KageMeshService         `inject:"KageMeshService"`
-	CanaryService     CanaryService           `inject:"CanaryService"`
+	KubeReaderService   KubeReaderService       `inject:"KubeReaderService"`
+	LockdownService     ProxyService            `inject:"ProxyService"`
+	EndpointFactory     factory.EndpointFactory `inject:"EndpointFactory"`
+	ListenerFactory     factory.ListenerFactory `inject:"ListenerFactory"`
+	StoreClient         snap.StoreClient        `inject:"StoreClient"`
+	KageMeshService     KageMeshService         `inject:"KageMeshService"`
+	CanaryService       CanaryService           `inject:"CanaryService"`
+	CanaryStatusService CanaryStatusService     `inject:"CanaryStatusService"`
 }
 
 func (c *canaryEndpointsService) StorePod(pod *corev1.Pod) error {
-	meshes, err := c.KageMeshService.ListXdsForPod(pod)
-	if err != nil {
-		return err
-	}
-
 	canaryAnno := c.CanaryService.FetchForPod(pod)
 	if canaryAnno == nil {
+		meshes, err := c.KageMeshService.ListXdsForPod(pod)
+		if err != nil {
+			return err
+		}
+
 		for _, mesh := range meshes {
-			if err := c.storePod(meta.SourceControllerType, &mesh, pod); err != nil {
+			if err := c.storePod(mesh.Config.Source.ClusterName, &mesh, pod); err != nil {
 				return err
 			}
 		}
@@ -56,21 +59,40 @@ func (c *canaryEndpointsService) StorePod(pod *corev1.Pod) error {
 		return nil
 	}
 
-	if len(meshes) == 0 {
-		xdsAnno, err := c.KageMeshService.CreateForCanary(canaryAnno)
-		if err != nil {
+	// Every variant of a source shares the source's kage-mesh so the canary's pods only belong to that one.
+	xdsAnno, err := c.KageMeshService.FetchForCanary(canaryAnno)
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+
+	cluster, ok := "", false
+	if xdsAnno != nil {
+		cluster, ok = xdsAnno.Config.VariantCluster(canaryAnno.CanaryObj.Name)
+	}
+
+	if !ok {
+		if err := c.CanaryStatusService.Transition(canaryAnno, meta.PhaseInitializing, "Creating the kage-mesh."); err != nil {
 			return err
 		}
-		meshes = append(meshes, *xdsAnno)
-	}
 
-	for _, mesh := range meshes {
-		if err := c.storePod(meta.CanaryControllerType, &mesh, pod); err != nil {
+		xdsAnno, err = c.KageMeshService.CreateForCanary(canaryAnno)
+		if err != nil {
+			if statusErr := c.CanaryStatusService.Transition(canaryAnno, meta.PhaseFailed, "Failed to create the kage-mesh: "+err.Error()); statusErr != nil {
+				log.WithField("name", canaryAnno.CanaryObj.Name).
+					WithField("namespace", canaryAnno.CanaryObj.Namespace).
+					WithError(statusErr).
+					Error("Failed to record the failed initialization of the canary.")
+			}
 			return err
 		}
+		cluster, _ = xdsAnno.Config.VariantCluster(canaryAnno.CanaryObj.Name)
 	}
 
-	return nil
+	if err := c.storePod(cluster, xdsAnno, pod); err != nil {
+		return err
+	}
+
+	return c.CanaryStatusService.Proxied(canaryAnno, xdsAnno)
 }
 
 func (c *canaryEndpointsService) Clean(nodeId string) error {
@@ -80,6 +102,14 @@ func (c *canaryEndpointsService) Clean(nodeId string) error {
 func (c *canaryEndpointsService) RemovePod(pod *corev1.Pod) error {
 	states := c.findStatesByAddress(pod.Status.PodIP)
 
+	// The sticky cluster names indexed by the node ID.
+	stickyClusters := map[string]string{}
+	if meshes, err := c.KageMeshService.ListXdsForPod(pod); err == nil {
+		for _, v := range meshes {
+			stickyClusters[v.Config.NodeId] = v.Config.Sticky.ClusterName
+		}
+	}
+
 	for _, state := range states {
 		if state.Endpoints == nil {
 			state.Endpoints = make([]*endpoint.ClusterLoadAssignment, 0)
@@ -95,18 +125,19 @@ func (c *canaryEndpointsService) RemovePod(pod *corev1.Pod) error {
 					changed = true
 					state.Listeners = envoyutil.RemoveListenerPort(uint32(cp.ContainerPort), state.Listeners)
 				}
-				if envoyutil.ContainsEndpointAddr(pod.Status.PodIP, state.Endpoints) {
-					changed = true
-					state.Endpoints = envoyutil.RemoveEndpointAddr(pod.Status.PodIP, state.Endpoints)
-				}
 			}
 		}
+		if envoyutil.ContainsEndpointAddr(pod.Status.PodIP, state.Endpoints) {
+			changed = true
+			state.Endpoints = envoyutil.RemoveEndpointAddr(pod.Status.PodIP, state.Endpoints)
+		}
 
 		if changed {
 			log.WithField("node_id", state.NodeId).
 				WithField("pod", pod.Name).
 				WithField("namespace", pod.Namespace).
 				Debug("Removing pod from control plane.")
+			state.Endpoints = envoyutil.RefreshStickyEndpoints(stickyClusters[state.NodeId], state.Endpoints)
 			err := c.StoreClient.Set(&state)
 			if err != nil {
 				return err
@@ -117,7 +148,14 @@ func (c *canaryEndpointsService) RemovePod(pod *corev1.Pod) error {
 	return nil
 }
 
-func (c *canaryEndpointsService) storePod(controllerType meta.ControllerType, xdsAnno *meta.Xds, pod *corev1.Pod) error {
+// A port of a pod which the kage-mesh listens on.
+type meshPort struct {
+	Port        int32
+	Protocol    corev1.Protocol
+	AppProtocol model.PortProtocol
+}
+
+func (c *canaryEndpointsService) storePod(cluster string, xdsAnno *meta.Xds, pod *corev1.Pod) error {
 	state, err := c.StoreClient.Get(xdsAnno.Config.NodeId)
 	opt := kconfig.Opt{Namespace: pod.Namespace}
 	if err != nil {
@@ -130,25 +168,15 @@ func (c *canaryEndpointsService) storePod(controllerType meta.ControllerType, xd
 		state.Listeners = make([]*listener.Listener, 0)
 	}
 
-	changed := false
-	for _, container := range pod.Spec.Containers {
-		for _, cp := range container.Ports {
-			err, changed = c.updateState(state, cp.Protocol, cp.ContainerPort, pod, xdsAnno, controllerType)
-			if err != nil {
-				log.WithField("container", container.Name).
-					WithField("pod", pod.Name).
-					WithField("namespace", pod.Namespace).
-					WithField("node_id", xdsAnno.Config.NodeId).
-					WithField("protocol", cp.Protocol).
-					WithField("port", cp.ContainerPort).
-					WithField("ip", pod.Status.PodIP).
-					WithError(err).
-					Debug("Failed to add pod to Envoy config.")
-				continue
-			}
-		}
+	// TCP proxies split the connections the same way the routes split the requests.
+	tcpWeights := envoyutil.DefaultRouteWeights(state.Routes, model.TotalRoutingWeight)
+	if len(tcpWeights) == 0 {
+		tcpWeights[xdsAnno.Config.Source.ClusterName] = model.TotalRoutingWeight
 	}
 
+	changed := false
+
+	// The services' ports are added first as their names declare the protocol for every pod they select.
 	svcsLi, err := c.KubeReaderService.ListSelected(pod.Labels, ktypes.KindService, opt)
 	if err != nil {
 		log.WithError(err).
@@ -158,7 +186,8 @@ func (c *canaryEndpointsService) storePod(controllerType meta.ControllerType, xd
 	} else {
 		for _, s := range svcsLi.(*corev1.ServiceList).Items {
 			for _, port := range s.Spec.Ports {
-				err, changed = c.updateState(state, port.Protocol, port.TargetPort.IntVal, pod, xdsAnno, controllerType)
+				mp := meshPort{Port: port.TargetPort.IntVal, Protocol: port.Protocol, AppProtocol: util.PortProtocol(port.Name)}
+				portChanged, err := c.updateState(state, mp, pod, cluster, tcpWeights)
 				if err != nil {
 					log.WithField("service", s.Name).
 						WithField("pod", pod.Name).
@@ -171,7 +200,28 @@ func (c *canaryEndpointsService) storePod(controllerType meta.ControllerType, xd
 						Debug("Failed to add pod's service to Envoy config.")
 					continue
 				}
+				changed = changed || portChanged
+			}
+		}
+	}
+
+	for _, container := range pod.Spec.Containers {
+		for _, cp := range container.Ports {
+			mp := meshPort{Port: cp.ContainerPort, Protocol: cp.Protocol, AppProtocol: util.PortProtocol(cp.Name)}
+			portChanged, err := c.updateState(state, mp, pod, cluster, tcpWeights)
+			if err != nil {
+				log.WithField("container", container.Name).
+					WithField("pod", pod.Name).
+					WithField("namespace", pod.Namespace).
+					WithField("node_id", xdsAnno.Config.NodeId).
+					WithField("protocol", cp.Protocol).
+					WithField("port", cp.ContainerPort).
+					WithField("ip", pod.Status.PodIP).
+					WithError(err).
+					Debug("Failed to add pod to Envoy config.")
+				continue
 			}
+			changed = changed || portChanged
 		}
 	}
 
@@ -180,6 +230,7 @@ func (c *canaryEndpointsService) storePod(controllerType meta.ControllerType, xd
 			WithField("pod", pod.Name).
 			WithField("namespace", pod.Namespace).
 			Debug("Adding pod to control plane.")
+		state.Endpoints = envoyutil.RefreshStickyEndpoints(xdsAnno.Config.Sticky.ClusterName, state.Endpoints)
 		err = c.StoreClient.Set(state)
 		if err != nil {
 			return err
@@ -188,39 +239,44 @@ func (c *canaryEndpointsService) storePod(controllerType meta.ControllerType, xd
 	return nil
 }
 
-func (c *canaryEndpointsService) updateState(state *store.EnvoyState, protocol corev1.Protocol, port int32, pod *corev1.Pod, xdsMeta *meta.Xds, controllerType meta.ControllerType) (error, bool) {
-	proto, err := util.KubeProtocolToSocketAddressProtocol(protocol)
+func (c *canaryEndpointsService) updateState(state *store.EnvoyState, port meshPort, pod *corev1.Pod, cluster string, tcpWeights map[string]uint32) (bool, error) {
+	proto, err := util.KubeProtocolToSocketAddressProtocol(port.Protocol)
 	changed := false
 	podIp := pod.Status.PodIP
 	if err != nil {
-		log.WithField("port", port).
+		log.WithField("port", port.Port).
 			WithField("ip", podIp).
 			WithField("node_id", state.NodeId).
 			WithField("protocol", proto).
 			Debug("Protocol is not supported")
 	}
-	if !envoyutil.ContainsListenerPort(uint32(port), state.Listeners) {
-		list, err := c.ListenerFactory.Listener(fmt.Sprintf("listener-%d", port), uint32(port), proto)
+	if !envoyutil.ContainsListenerPort(uint32(port.Port), state.Listeners) {
+		var list *listener.Listener
+		if port.AppProtocol == model.PortProtocolTcp {
+			list, err = c.ListenerFactory.TcpProxy(listenerName(uint32(port.Port)), uint32(port.Port), proto, tcpWeights)
+		} else {
+			list, err = c.ListenerFactory.Listener(listenerName(uint32(port.Port)), uint32(port.Port), proto, port.AppProtocol)
+		}
 		if err != nil {
-			return err, false
+			return false, err
 		}
 		state.Listeners = append(state.Listeners, list)
 		changed = true
 	}
 
-	envoyConf := xdsMeta.Config.Source
-	if controllerType == meta.CanaryControllerType {
-		envoyConf = xdsMeta.Config.Canary
-	}
-
-	if !envoyutil.ContainsEndpointAddr(podIp, state.Endpoints) {
-		ep := c.EndpointFactory.Endpoint(envoyConf.ClusterName, proto, pod.Status.PodIP, uint32(port))
-		logrus.WithField("cluster", envoyConf.ClusterName).WithField("pod", pod.Name).Debug("Adding endpoint from pod.")
-		state.Endpoints = append(state.Endpoints, ep)
+	// The pod has an endpoint on every port as each port is served its own cluster.
+	if !envoyutil.ContainsEndpoint(cluster, podIp, uint32(port.Port), state.Endpoints) {
+		ep := c.EndpointFactory.Endpoint(cluster, proto, pod.Status.PodIP, uint32(port.Port))
+		logrus.WithField("cluster", cluster).WithField("pod", pod.Name).WithField("port", port.Port).Debug("Adding endpoint from pod.")
+		state.Endpoints = envoyutil.MergeClusterLoadAssignments(append(state.Endpoints, ep))
 		changed = true
 	}
 
-	return nil, changed
+	return changed, nil
+}
+
+func listenerName(port uint32) string {
+	return fmt.Sprintf("listener-%d", port)
 }
 
 func (c *canaryEndpointsService) getServicesForLabels(set labels.Set, namespace string) ([]corev1.Service, error) {
@@ -31,9 +31,10 @@ func (e *envoyInformerService) GetOrInitXds(canary metav1.Object) (*meta.Xds, er
 	return xdsAnno, err
 }
 
-func (e *envoyInformerService) storePods(pods []corev1.Pod, xdsAnno *meta.Xds, controllerType meta.ControllerType) error {
-	for _, v := range pods {
-		if err := e.EnvoyEndpointsService.StorePod(controllerType, xdsAnno, &v); err != nil {
+func (e *envoyInformerService) storePods(pods []corev1.Pod) error {
+	for i := range pods {
+		v := &pods[i]
+		if err := e.EnvoyEndpointsService.StorePod(v); err != nil {
 			log.WithField("namespace", v.Namespace).
 				WithField("name", v.Name).
 				Error("Failed to add pod to mesh endpoints.")
@@ -3,6 +3,8 @@ package service
 import (
 	route "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
 	"github.com/kage-cloud/kage/core/except"
+	"github.com/kage-cloud/kage/xds/pkg/meta"
+	"github.com/kage-cloud/kage/xds/pkg/model"
 	"github.com/kage-cloud/kage/xds/pkg/snap/snaputil"
 	"github.com/kage-cloud/kage/xds/pkg/snap/store"
 	"github.com/kage-cloud/kage/xds/pkg/util/envoyutil"
@@ -13,11 +15,46 @@ const EnvoyStateServiceKey = "EnvoyStateService"
 type EnvoyStateService interface {
 	// Safely finds the canary's weighted traffic routing. If the weight is not available, an error is returned.
 	FetchCanaryRouteWeight(state *store.EnvoyState) (uint32, error)
+
+	// Finds the weight of the canary variant's cluster for the kage-mesh. The weight is taken from the weighted route,
+	// the mirror policy if the kage-mesh is in shadow mode, or the weight of the cluster's locality in the sticky
+	// cluster if it is sticky.
+	FetchClusterWeight(state *store.EnvoyState, xdsConfig *meta.XdsConfig, cluster string) (uint32, error)
 }
 
 type envoyStateService struct {
 }
 
+func (e *envoyStateService) FetchClusterWeight(state *store.EnvoyState, xdsConfig *meta.XdsConfig, name string) (uint32, error) {
+	for _, r := range envoyutil.AggAllRoutes(state.Routes) {
+		action := r.GetRoute()
+		if action == nil {
+			continue
+		}
+
+		if action.GetCluster() != "" && action.GetCluster() == xdsConfig.Sticky.ClusterName {
+			sticky, _ := envoyutil.FindClusterLoadAssignment(xdsConfig.Sticky.ClusterName, state.Endpoints)
+			if sticky == nil {
+				break
+			}
+			return envoyutil.StickyWeights(sticky)[name], nil
+		}
+
+		for _, mirror := range action.GetRequestMirrorPolicies() {
+			if mirror.GetCluster() == name {
+				return envoyutil.MirroredWeight(mirror, model.TotalRoutingWeight), nil
+			}
+		}
+
+		for _, cluster := range action.GetWeightedClusters().GetClusters() {
+			if cluster.GetName() == name && cluster.GetWeight() != nil {
+				return cluster.GetWeight().GetValue(), nil
+			}
+		}
+	}
+	return 0, except.NewError("No routes to cluster %s found for %s", except.ErrNotFound, name, state.NodeId)
+}
+
 func (e *envoyStateService) FetchCanaryRouteWeight(state *store.EnvoyState) (uint32, error) {
 	routes := envoyutil.AggAllRoutes(state.Routes)
 	for _, r := range routes {
@@ -0,0 +1,45 @@
+package service
+
+import (
+	"github.com/kage-cloud/kage/core/kube"
+	"github.com/kage-cloud/kage/core/kube/kconfig"
+	"github.com/kage-cloud/kage/core/kube/ktypes"
+	"github.com/kage-cloud/kage/xds/pkg/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+const (
+	EventReasonServiceProxied       kube.EventReason = "ServiceProxied"
+	EventReasonServiceProxyFailed   kube.EventReason = "ServiceProxyFailed"
+	EventReasonServiceReleased      kube.EventReason = "ServiceReleased"
+	EventReasonServiceReleaseFailed kube.EventReason = "ServiceReleaseFailed"
+	EventReasonMeshCreated          kube.EventReason = "MeshCreated"
+	EventReasonMeshCreateFailed     kube.EventReason = "MeshCreateFailed"
+	EventReasonMeshRemoved          kube.EventReason = "MeshRemoved"
+	EventReasonMeshRemoveFailed     kube.EventReason = "MeshRemoveFailed"
+	EventReasonVariantAdded         kube.EventReason = "VariantAdded"
+	EventReasonVariantAddFailed     kube.EventReason = "VariantAddFailed"
+	EventReasonVariantRemoved       kube.EventReason = "VariantRemoved"
+	EventReasonVariantRemoveFailed  kube.EventReason = "VariantRemoveFailed"
+	EventReasonCanaryPromoteFailed  kube.EventReason = "CanaryPromoteFailed"
+	EventReasonCanaryAbortFailed    kube.EventReason = "CanaryAbortFailed"
+
+	// Recorded on Canary resources.
+	EventReasonResourceInvalid kube.EventReason = "InvalidSpec"
+	EventReasonResourceApplied kube.EventReason = "Applied"
+)
+
+// The reason for the event recorded when a canary moves to the phase e.g. CanaryProgressing.
+func phaseEventReason(phase meta.Phase) kube.EventReason {
+	return kube.EventReason("Canary" + string(phase))
+}
+
+// The canary controller to record events against. Returns nil if it no longer exists, in which case the event is
+// dropped.
+func canaryEventObj(reader KubeReaderService, canary *meta.Canary) runtime.Object {
+	obj, err := reader.Get(canary.CanaryObj.Name, ktypes.Kind(canary.CanaryObj.Kind), kconfig.Opt{Namespace: canary.CanaryObj.Namespace})
+	if err != nil {
+		return nil
+	}
+	return obj
+}
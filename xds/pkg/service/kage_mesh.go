@@ -1,16 +1,22 @@
 package service
 
 import (
+	"crypto/sha256"
 	"fmt"
+	endpoint "github.com/envoyproxy/go-control-plane/envoy/config/endpoint/v3"
 	"github.com/google/uuid"
 	"github.com/kage-cloud/kage/core/except"
 	"github.com/kage-cloud/kage/core/kube"
 	"github.com/kage-cloud/kage/core/kube/kconfig"
 	"github.com/kage-cloud/kage/core/kube/kstream"
 	"github.com/kage-cloud/kage/core/kube/ktypes"
+	"github.com/kage-cloud/kage/core/kube/kubeutil"
+	"github.com/kage-cloud/kage/xds/pkg/config"
+	"github.com/kage-cloud/kage/xds/pkg/controlplane"
 	"github.com/kage-cloud/kage/xds/pkg/factory"
 	"github.com/kage-cloud/kage/xds/pkg/meta"
 	"github.com/kage-cloud/kage/xds/pkg/snap"
+	"github.com/kage-cloud/kage/xds/pkg/snap/store"
 	"github.com/sirupsen/logrus"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
@@ -18,6 +24,8 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/util/retry"
+	"sort"
 	"strings"
 )
 
@@ -26,6 +34,8 @@ const KageMeshServiceKey = "KageMeshService"
 var KageProxySelector = labels.SelectorFromValidatedSet(meta.ToMap(&meta.MeshMarker{IsMesh: true}))
 
 type KageMeshService interface {
+	// Creates the kage-mesh for the canary's source. If the source already has a kage-mesh, the canary is added to it
+	// as another variant with its own cluster and the kage-mesh is restarted to load the cluster.
 	CreateForCanary(canary *meta.Canary) (*meta.Xds, error)
 	FetchForCanary(canary *meta.Canary) (*meta.Xds, error)
 
@@ -33,19 +43,35 @@ type KageMeshService interface {
 	UnmarshalXdsMeta(obj metav1.Object) (*meta.Xds, error)
 	TargetsPod(xdsAnno *meta.Xds, pod *corev1.Pod) bool
 
+	// Releases the services proxied by the kage-mesh and deletes the kage-mesh along with its baseline ConfigMap and
+	// xDS client certificate. Does nothing if the kage-mesh has already been removed.
 	Remove(xds *meta.Xds, opt kconfig.Opt) error
+
+	// Removes the canary from the kage-mesh of its source. Its weight goes back to the source and the services which
+	// only select its pods are released. The other variants keep their clusters, weights, and services. The kage-mesh
+	// is removed along with its last variant.
+	RemoveVariant(canary *meta.Canary) error
+
+	// Releases the services proxied by the kage-mesh so they route directly to their pods again. The kage-mesh itself
+	// is left running.
+	Release(xds *meta.Xds, opt kconfig.Opt) error
 	ListXdsForPod(pod *corev1.Pod) ([]meta.Xds, error)
 
 	// TODO: make sure to handle service removal from the service selector. should we sync all services??
 }
 
 type kageMeshService struct {
-	KubeClient        kube.Client             `inject:"KubeClient"`
-	KubeReaderService KubeReaderService       `inject:"KubeReaderService"`
-	KageMeshFactory   factory.KageMeshFactory `inject:"KageMeshFactory"`
-	MeshConfigService MeshConfigService       `inject:"MeshConfigService"`
-	ProxyService      ProxyService            `inject:"ProxyService"`
-	StoreClient       snap.StoreClient        `inject:"StoreClient"`
+	KubeClient        kube.Client                `inject:"KubeClient"`
+	KubeReaderService KubeReaderService          `inject:"KubeReaderService"`
+	KageMeshFactory   factory.KageMeshFactory    `inject:"KageMeshFactory"`
+	ClusterFactory    factory.ClusterFactory     `inject:"ClusterFactory"`
+	MeshConfigService MeshConfigService          `inject:"MeshConfigService"`
+	ProxyService      ProxyService               `inject:"ProxyService"`
+	StoreClient       snap.StoreClient           `inject:"StoreClient"`
+	EventRecorder     kube.EventRecorder         `inject:"EventRecorder"`
+	XdsService        XdsService                 `inject:"XdsService"`
+	Config            *config.Config             `inject:"Config"`
+	CertAuthority     controlplane.CertAuthority `inject:"CertAuthority"`
 }
 
 func (k *kageMeshService) initServiceSelectors(ref meta.ObjRef) (map[string]map[string]string, error) {
@@ -90,9 +116,59 @@ func (k *kageMeshService) FetchForCanary(canary *meta.Canary) (*meta.Xds, error)
 func (k *kageMeshService) Remove(xds *meta.Xds, opt kconfig.Opt) error {
 	dep, err := k.KubeReaderService.GetDeploy(xds.Name, opt)
 	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+
+	if err := k.remove(dep, xds, opt); err != nil {
+		k.EventRecorder.Warning(dep, EventReasonMeshRemoveFailed, "Failed to remove the kage-mesh: %s", err.Error())
+		return err
+	}
+
+	k.EventRecorder.Normal(dep, EventReasonMeshRemoved, "Removed the kage-mesh and released its services.")
+	return nil
+}
+
+func (k *kageMeshService) remove(dep *appsv1.Deployment, xds *meta.Xds, opt kconfig.Opt) error {
+	if err := k.releaseForDeploy(dep, opt); err != nil {
+		return err
+	}
+
+	if err := k.StoreClient.Delete(xds.Config.NodeId); err != nil {
+		return err
+	}
+
+	if err := k.KubeClient.DeleteDeploy(dep.Name, opt); err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+
+	if err := k.KubeClient.DeleteConfigMap(dep.Name, opt); err != nil && !errors.IsNotFound(err) {
 		return err
 	}
 
+	err := k.KubeClient.Api().CoreV1().Secrets(opt.Namespace).Delete(dep.Name, &metav1.DeleteOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+
+	return nil
+}
+
+func (k *kageMeshService) Release(xds *meta.Xds, opt kconfig.Opt) error {
+	dep, err := k.KubeReaderService.GetDeploy(xds.Name, opt)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+
+	return k.releaseForDeploy(dep, opt)
+}
+
+func (k *kageMeshService) releaseForDeploy(dep *appsv1.Deployment, opt kconfig.Opt) error {
 	proxiedSvcs, err := k.listProxiedServicesForDeploy(dep)
 	if err != nil {
 		return err
@@ -108,7 +184,7 @@ func (k *kageMeshService) Remove(xds *meta.Xds, opt kconfig.Opt) error {
 		}
 	}
 
-	return k.StoreClient.Delete(xds.Config.NodeId)
+	return nil
 }
 
 func (k *kageMeshService) ListXdsForPod(pod *corev1.Pod) ([]meta.Xds, error) {
@@ -129,18 +205,321 @@ func (k *kageMeshService) CreateForCanary(canary *meta.Canary) (*meta.Xds, error
 	if errors.IsNotFound(err) {
 		kageMeshDeploy, xdsAnno, err = k.createKageMeshDeploy(kageMeshName, canary, opt)
 		if err != nil {
+			k.EventRecorder.Warning(canaryEventObj(k.KubeReaderService, canary), EventReasonMeshCreateFailed, "Failed to create the kage-mesh %s: %s", kageMeshName, err.Error())
 			return nil, err
 		}
+
+		k.EventRecorder.Normal(kageMeshDeploy, EventReasonMeshCreated, "Created the kage-mesh for canary %s of %s.", canary.CanaryObj.Name, canary.SourceObj.Name)
+		k.EventRecorder.Normal(canaryEventObj(k.KubeReaderService, canary), EventReasonMeshCreated, "Created the kage-mesh %s with node ID %s.", kageMeshName, xdsAnno.Config.NodeId)
 	} else {
 		xdsAnno, err = k.UnmarshalXdsMeta(kageMeshDeploy)
 		if err != nil {
 			return nil, err
 		}
+
+		if _, ok := xdsAnno.Config.VariantCluster(canary.CanaryObj.Name); !ok {
+			xdsAnno, err = k.addVariant(kageMeshName, canary, opt)
+			if err != nil {
+				k.EventRecorder.Warning(kageMeshDeploy, EventReasonVariantAddFailed, "Failed to add canary %s as a variant: %s", canary.CanaryObj.Name, err.Error())
+				return nil, err
+			}
+		}
+	}
+
+	return xdsAnno, nil
+}
+
+func (k *kageMeshService) addVariant(name string, canary *meta.Canary, opt kconfig.Opt) (*meta.Xds, error) {
+	svcSelectors, err := k.initServiceSelectors(canary.CanaryObj)
+	if err != nil {
+		return nil, err
+	}
+
+	var xdsAnno *meta.Xds
+	var dep *appsv1.Deployment
+	var cluster string
+	err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		obj, err := k.KubeClient.Get(name, ktypes.KindDeployment, opt)
+		if err != nil {
+			return err
+		}
+		dep = obj.(*appsv1.Deployment)
+
+		xdsAnno, err = k.UnmarshalXdsMeta(dep)
+		if err != nil {
+			return err
+		}
+
+		cluster = xdsAnno.Config.AddVariant(canary.CanaryObj.Name)
+		xdsAnno.Config.SetCircuitBreaker(cluster, circuitBreaker(k.Config.Resiliency, canary.Resiliency.Canary))
+		if xdsAnno.ServiceSelectors == nil {
+			xdsAnno.ServiceSelectors = map[string]map[string]string{}
+		}
+		for svc, selector := range svcSelectors {
+			if _, ok := xdsAnno.ServiceSelectors[svc]; !ok {
+				xdsAnno.ServiceSelectors[svc] = selector
+			}
+		}
+
+		// The variant's cluster must be served before the pods are restarted onto a new baseline.
+		if err := k.setClusters(&xdsAnno.Config); err != nil {
+			return err
+		}
+
+		baseline, err := k.MeshConfigService.FromXdsConfig(&xdsAnno.Config)
+		if err != nil {
+			return err
+		}
+
+		if _, err := k.KubeClient.UpsertConfigMap(k.KageMeshFactory.BaselineConfigMap(name, baseline), opt); err != nil {
+			return err
+		}
+
+		if err := k.mountXdsTls(name, xdsAnno.Config.NodeId, dep, opt); err != nil {
+			return err
+		}
+
+		k.MarshalXdsMeta(dep, xdsAnno)
+		// The variant's cluster is served over CDS so the baseline only changes for kage-meshes created before the
+		// clusters were. Their pods are restarted once onto the new baseline to start requesting the clusters.
+		dep.Spec.Template.Annotations = meta.Merge(dep.Spec.Template.Annotations, &meta.BaselineChecksum{
+			Checksum: fmt.Sprintf("%x", sha256.Sum256(baseline)),
+		})
+
+		dep, err = k.KubeClient.UpdateDeploy(dep, opt)
+		return err
+	})
+	if err != nil {
+		return nil, err
 	}
 
+	k.EventRecorder.Normal(dep, EventReasonVariantAdded, "Added canary %s as a variant with the cluster %s.", canary.CanaryObj.Name, cluster)
+
+	logrus.WithField("name", name).
+		WithField("namespace", opt.Namespace).
+		WithField("canary", canary.CanaryObj.Name).
+		WithField("cluster", cluster).
+		Info("Added canary variant to kage-mesh.")
+
 	return xdsAnno, nil
 }
 
+func (k *kageMeshService) RemoveVariant(canary *meta.Canary) error {
+	name := k.genKageMeshName(&canary.SourceObj)
+	opt := kconfig.Opt{Namespace: canary.CanaryObj.Namespace}
+	dep, err := k.KubeReaderService.GetDeploy(name, opt)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+
+	xdsAnno, err := k.UnmarshalXdsMeta(dep)
+	if err != nil {
+		return err
+	}
+
+	if _, ok := xdsAnno.Config.VariantCluster(canary.CanaryObj.Name); !ok {
+		return nil
+	}
+
+	if len(xdsAnno.Config.VariantNames()) <= 1 {
+		return k.Remove(xdsAnno, opt)
+	}
+
+	if err := k.removeVariant(name, canary, opt); err != nil {
+		k.EventRecorder.Warning(dep, EventReasonVariantRemoveFailed, "Failed to remove the canary variant %s: %s", canary.CanaryObj.Name, err.Error())
+		return err
+	}
+
+	k.EventRecorder.Normal(dep, EventReasonVariantRemoved, "Removed the canary variant %s.", canary.CanaryObj.Name)
+	return nil
+}
+
+func (k *kageMeshService) removeVariant(name string, canary *meta.Canary, opt kconfig.Opt) error {
+	var xdsAnno *meta.Xds
+	var cluster string
+	var orphaned []string
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		obj, err := k.KubeClient.Get(name, ktypes.KindDeployment, opt)
+		if err != nil {
+			return err
+		}
+		dep := obj.(*appsv1.Deployment)
+
+		xdsAnno, err = k.UnmarshalXdsMeta(dep)
+		if err != nil {
+			return err
+		}
+
+		cluster, _ = xdsAnno.Config.RemoveVariant(canary.CanaryObj.Name)
+		delete(xdsAnno.Config.CircuitBreakers, cluster)
+
+		orphaned = k.orphanedServices(xdsAnno, opt)
+		for _, svc := range orphaned {
+			delete(xdsAnno.ServiceSelectors, svc)
+		}
+
+		if err := k.mountXdsTls(name, xdsAnno.Config.NodeId, dep, opt); err != nil {
+			return err
+		}
+
+		k.MarshalXdsMeta(dep, xdsAnno)
+		_, err = k.KubeClient.UpdateDeploy(dep, opt)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if cluster != "" {
+		if err := k.removeClusterEndpoints(xdsAnno.Config.NodeId, cluster); err != nil {
+			return err
+		}
+	}
+
+	if err := k.XdsService.SyncVariants(xdsAnno, opt); err != nil {
+		return err
+	}
+
+	// The routes no longer reference the variant's cluster so it can be removed.
+	if err := k.setClusters(&xdsAnno.Config); err != nil {
+		return err
+	}
+
+	for _, svcName := range orphaned {
+		if err := k.releaseOrphanedService(name, svcName, opt); err != nil {
+			return err
+		}
+	}
+
+	// Kage-meshes created before the clusters were served over CDS keep the variant's cluster without any endpoints or
+	// routes until their pods next restart.
+	baseline, err := k.MeshConfigService.FromXdsConfig(&xdsAnno.Config)
+	if err != nil {
+		return err
+	}
+
+	if _, err := k.KubeClient.UpsertConfigMap(k.KageMeshFactory.BaselineConfigMap(name, baseline), opt); err != nil {
+		return err
+	}
+
+	logrus.WithField("name", name).
+		WithField("namespace", opt.Namespace).
+		WithField("canary", canary.CanaryObj.Name).
+		WithField("released_services", orphaned).
+		Info("Removed canary variant from kage-mesh.")
+
+	return nil
+}
+
+// The services of the kage-mesh which select neither the pods of the source nor the pods of any remaining variant. If
+// the pods of any of them cannot be found, every service is kept.
+func (k *kageMeshService) orphanedServices(xdsAnno *meta.Xds, opt kconfig.Opt) []string {
+	refs := []meta.ObjRef{xdsAnno.Canary.SourceObj}
+	for _, name := range xdsAnno.Config.VariantNames() {
+		canary, err := fetchCanary(k.KubeReaderService, name, opt)
+		if err != nil {
+			return nil
+		}
+		refs = append(refs, canary.CanaryObj)
+	}
+
+	podSets := make([]labels.Set, 0, len(refs))
+	for _, ref := range refs {
+		obj, err := k.KubeReaderService.Get(ref.Name, ktypes.Kind(ref.Kind), opt)
+		if err != nil {
+			return nil
+		}
+
+		if pod, ok := obj.(*corev1.Pod); ok {
+			podSets = append(podSets, pod.Labels)
+		} else if tmpl := kubeutil.PodTemplate(obj); tmpl != nil {
+			podSets = append(podSets, tmpl.Labels)
+		}
+	}
+
+	orphaned := make([]string, 0)
+	for svc, selector := range xdsAnno.ServiceSelectors {
+		if len(selector) == 0 {
+			continue
+		}
+
+		matched := false
+		for _, set := range podSets {
+			if labels.SelectorFromValidatedSet(selector).Matches(set) {
+				matched = true
+				break
+			}
+		}
+
+		if !matched {
+			orphaned = append(orphaned, svc)
+		}
+	}
+	sort.Strings(orphaned)
+
+	return orphaned
+}
+
+// Releases the service unless another kage-mesh still proxies it.
+func (k *kageMeshService) releaseOrphanedService(meshName, svcName string, opt kconfig.Opt) error {
+	obj, err := k.KubeReaderService.Get(svcName, ktypes.KindService, opt)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	svc := obj.(*corev1.Service)
+
+	meshes, err := k.listDeploysForProxiedService(svc)
+	if err != nil {
+		return err
+	}
+
+	for _, v := range meshes.Items {
+		if v.Name != meshName {
+			return nil
+		}
+	}
+
+	return k.ProxyService.ReleaseService(svc, opt)
+}
+
+func (k *kageMeshService) removeClusterEndpoints(nodeId, cluster string) error {
+	state, err := k.StoreClient.Get(nodeId)
+	if err != nil {
+		if except.Reason(err) == except.ErrNotFound {
+			return nil
+		}
+		return err
+	}
+
+	endpoints := make([]*endpoint.ClusterLoadAssignment, 0, len(state.Endpoints))
+	for _, v := range state.Endpoints {
+		if v != nil && v.ClusterName != cluster {
+			endpoints = append(endpoints, v)
+		}
+	}
+
+	// The store keeps the previous endpoints if none are set.
+	if len(endpoints) == len(state.Endpoints) || len(endpoints) == 0 {
+		return nil
+	}
+
+	return k.StoreClient.Set(&store.EnvoyState{NodeId: nodeId, Endpoints: endpoints})
+}
+
+// Serves the clusters of the kage-mesh over CDS.
+func (k *kageMeshService) setClusters(xdsConfig *meta.XdsConfig) error {
+	return k.StoreClient.Set(&store.EnvoyState{
+		NodeId:   xdsConfig.NodeId,
+		Clusters: k.ClusterFactory.FromXdsConfig(xdsConfig),
+	})
+}
+
 func (k *kageMeshService) removeForService(svc *corev1.Service, opt kconfig.Opt) error {
 	meshes, err := k.listDeploysForProxiedService(svc)
 	if err != nil {
@@ -245,6 +624,9 @@ func (k *kageMeshService) createKageMeshDeploy(name string, canary *meta.Canary,
 			Source: meta.EnvoyConfig{
 				ClusterName: "source",
 			},
+			Sticky: meta.EnvoyConfig{
+				ClusterName: "sticky",
+			},
 		},
 	}
 
@@ -263,6 +645,11 @@ func (k *kageMeshService) createKageMeshDeploy(name string, canary *meta.Canary,
 	}
 
 	xdsAnno.ServiceSelectors = canarySvcSelectors
+	cluster := xdsAnno.Config.AddVariant(canary.CanaryObj.Name)
+
+	// The source's circuit breaker is set by the canary which creates the kage-mesh.
+	xdsAnno.Config.SetCircuitBreaker(xdsAnno.Config.Source.ClusterName, circuitBreaker(k.Config.Resiliency, canary.Resiliency.Source))
+	xdsAnno.Config.SetCircuitBreaker(cluster, circuitBreaker(k.Config.Resiliency, canary.Resiliency.Canary))
 
 	baseline, err := k.MeshConfigService.FromXdsConfig(&xdsAnno.Config)
 	if err != nil {
@@ -276,14 +663,52 @@ func (k *kageMeshService) createKageMeshDeploy(name string, canary *meta.Canary,
 	}
 
 	dep := k.KageMeshFactory.Deploy(name, &xdsAnno.Config)
+	if err := k.mountXdsTls(name, xdsAnno.Config.NodeId, dep, opt); err != nil {
+		return nil, nil, err
+	}
+	k.MarshalXdsMeta(dep, xdsAnno)
 	dep, err = k.KubeClient.CreateDeploy(dep, opt)
 	if err != nil {
 		return nil, nil, err
 	}
 
+	// The envoy state is only saved once there is a kage-mesh to serve it to.
+	if err := k.setClusters(&xdsAnno.Config); err != nil {
+		return nil, nil, err
+	}
+
 	return dep, xdsAnno, nil
 }
 
+// Issues the kage-mesh's xDS client certificate into a Secret named after the kage-mesh and mounts it into the
+// Deployment. The certificate is only issued if the Secret does not exist yet. Does nothing if the xDS server does not
+// use TLS.
+func (k *kageMeshService) mountXdsTls(name, nodeId string, dep *appsv1.Deployment, opt kconfig.Opt) error {
+	if !k.Config.Xds.Tls.Enabled {
+		return nil
+	}
+
+	secrets := k.KubeClient.Api().CoreV1().Secrets(opt.Namespace)
+	if _, err := secrets.Get(name, metav1.GetOptions{}); err != nil {
+		if !errors.IsNotFound(err) {
+			return err
+		}
+
+		cert, err := k.CertAuthority.IssueClientCert(nodeId)
+		if err != nil {
+			return err
+		}
+
+		_, err = secrets.Create(k.KageMeshFactory.XdsTlsSecret(name, cert.Cert, cert.Key, cert.Ca))
+		if err != nil && !errors.IsAlreadyExists(err) {
+			return err
+		}
+	}
+
+	k.KageMeshFactory.MountXdsTls(dep, name)
+	return nil
+}
+
 func (k *kageMeshService) MarshalXdsMeta(obj metav1.Object, xds *meta.Xds) {
 	obj.SetAnnotations(meta.Merge(obj.GetAnnotations(), xds))
 	obj.SetLabels(meta.Merge(obj.GetLabels(), &xds.Config.XdsId))
@@ -20,7 +20,8 @@ type ProxyService interface {
 	// Removes the selector from the service stopping it from editing the endpoints file.
 	ProxyService(svc *corev1.Service, replacement labels.Set) error
 
-	// Re-adds the removed selector to the service allowing it to go back to editing the endpoints file.
+	// Re-adds the removed selector to the service allowing it to go back to editing the endpoints file. Does nothing if
+	// the service is not proxied.
 	ReleaseService(svc *corev1.Service, opt kconfig.Opt) error
 
 	GetSelector(svc *corev1.Service) (labels.Selector, error)
@@ -33,9 +34,10 @@ type ProxyService interface {
 }
 
 type proxyService struct {
-	KubeClient        kube.Client       `inject:"KubeClient"`
-	KubeReaderService KubeReaderService `inject:"KubeReaderService"`
-	WatchService      WatchService      `inject:"WatchService"`
+	KubeClient        kube.Client        `inject:"KubeClient"`
+	KubeReaderService KubeReaderService  `inject:"KubeReaderService"`
+	WatchService      WatchService       `inject:"WatchService"`
+	EventRecorder     kube.EventRecorder `inject:"EventRecorder"`
 }
 
 func (l *proxyService) GetSelector(svc *corev1.Service) (labels.Selector, error) {
@@ -75,9 +77,13 @@ func (l *proxyService) ProxyService(svc *corev1.Service, replacement labels.Set)
 	l.saveProxyMeta(svc, lockdown)
 
 	if _, err := l.KubeClient.UpdateService(svc, opt); err != nil {
+		l.EventRecorder.Warning(svc, EventReasonServiceProxyFailed, "Failed to route the service through the kage-mesh: %s", err.Error())
 		return err
 	}
 
+	l.EventRecorder.Normal(svc, EventReasonServiceProxied, "Replaced the selector %s with %s to route the service through the kage-mesh.",
+		labels.FormatLabels(lockdown.DeletedSelector), labels.FormatLabels(replacement))
+
 	log.WithField("name", svc.Name).WithField("namespace", svc.Namespace).Debug("Locked down service.")
 
 	return nil
@@ -86,12 +92,18 @@ func (l *proxyService) ProxyService(svc *corev1.Service, replacement labels.Set)
 func (l *proxyService) ReleaseService(svc *corev1.Service, opt kconfig.Opt) error {
 	deepCopy := svc.DeepCopy()
 	lockdown := l.getLockDownMeta(deepCopy)
+	if lockdown == nil {
+		return nil
+	}
 
 	deepCopy.Spec.Selector = lockdown.DeletedSelector
 	l.removeLockdownMeta(deepCopy)
 	if _, err := l.KubeClient.UpdateService(deepCopy, opt); err != nil {
+		l.EventRecorder.Warning(svc, EventReasonServiceReleaseFailed, "Failed to restore the selector %s: %s", labels.FormatLabels(lockdown.DeletedSelector), err.Error())
 		return err
 	}
+
+	l.EventRecorder.Normal(svc, EventReasonServiceReleased, "Restored the selector %s so the service no longer routes through the kage-mesh.", labels.FormatLabels(lockdown.DeletedSelector))
 	return nil
 }
 
@@ -8,7 +8,6 @@ import (
 	"github.com/kage-cloud/kage/xds/pkg/model"
 	"github.com/kage-cloud/kage/xds/pkg/model/consts"
 	"github.com/kage-cloud/kage/xds/pkg/snap"
-	"github.com/kage-cloud/kage/xds/pkg/util"
 	appsv1 "k8s.io/api/apps/v1"
 	"text/template"
 )
@@ -39,13 +38,15 @@ func (m *meshConfigService) FromXdsConfig(xdsAnno *meta.XdsConfig) ([]byte, erro
 	buf := bytes.NewBuffer([]byte{})
 
 	baseline := model.Baseline{
-		NodeId:             xdsAnno.NodeId,
-		NodeCluster:        xdsAnno.Source.ClusterName,
-		XdsAddress:         m.Config.Xds.Address,
-		XdsPort:            m.Config.Xds.Port,
-		AdminPort:          m.Config.Xds.AdminPort,
-		ServiceClusterName: xdsAnno.Source.ClusterName,
-		CanaryClusterName:  xdsAnno.Canary.ClusterName,
+		NodeId:      xdsAnno.NodeId,
+		NodeCluster: xdsAnno.Source.ClusterName,
+		XdsAddress:  m.Config.Xds.Address,
+		XdsPort:     m.Config.Xds.Port,
+		AdminPort:   m.Config.Xds.AdminPort,
+		StatsPort:   m.Config.Xds.StatsPort,
+		Ads:         m.Config.Xds.Ads,
+		Delta:       m.Config.Xds.Delta,
+		Tls:         m.Config.Xds.Tls.Enabled,
 	}
 
 	if err := t.Execute(buf, baseline); err != nil {
@@ -66,13 +67,15 @@ func (m *meshConfigService) BaselineConfig(meshConfig *model.MeshConfig) ([]byte
 	buf := bytes.NewBuffer([]byte{})
 
 	baseline := model.Baseline{
-		NodeId:             meshConfig.NodeId,
-		NodeCluster:        meshConfig.Canary.Name,
-		XdsAddress:         m.Config.Xds.Address,
-		XdsPort:            m.Config.Xds.Port,
-		AdminPort:          m.Config.Xds.AdminPort,
-		ServiceClusterName: meshConfig.Target.Name,
-		CanaryClusterName:  meshConfig.Canary.Name,
+		NodeId:      meshConfig.NodeId,
+		NodeCluster: meshConfig.Canary.Name,
+		XdsAddress:  m.Config.Xds.Address,
+		XdsPort:     m.Config.Xds.Port,
+		AdminPort:   m.Config.Xds.AdminPort,
+		StatsPort:   m.Config.Xds.StatsPort,
+		Ads:         m.Config.Xds.Ads,
+		Delta:       m.Config.Xds.Delta,
+		Tls:         m.Config.Xds.Tls.Enabled,
 	}
 
 	if err := t.Execute(buf, baseline); err != nil {
@@ -83,26 +86,29 @@ func (m *meshConfigService) BaselineConfig(meshConfig *model.MeshConfig) ([]byte
 }
 
 func (m *meshConfigService) Get(kageMeshDeploy *appsv1.Deployment) (*model.MeshConfig, error) {
-	kageMeshMeta, err := util.MeshConfigAnnotation(kageMeshDeploy.Annotations)
-	if err != nil {
+	xdsAnno := new(meta.Xds)
+	if err := meta.FromMap(kageMeshDeploy.Annotations, xdsAnno); err != nil {
 		return nil, err
 	}
 
-	state, err := m.StoreClient.Get(kageMeshMeta.NodeId)
+	state, err := m.StoreClient.Get(xdsAnno.Config.NodeId)
 	if err != nil {
 		return nil, err
 	}
 
 	weight, err := m.EnvoyStateService.FetchCanaryRouteWeight(state)
+	if err != nil {
+		return nil, err
+	}
 
 	meshConfig := &model.MeshConfig{
-		NodeId: kageMeshMeta.NodeId,
+		NodeId: xdsAnno.Config.NodeId,
 		Canary: model.MeshCluster{
-			Name:          kageMeshMeta.CanaryClusterName,
+			Name:          xdsAnno.Config.Canary.ClusterName,
 			RoutingWeight: weight,
 		},
 		Target: model.MeshCluster{
-			Name:          kageMeshMeta.TargetClusterName,
+			Name:          xdsAnno.Config.Source.ClusterName,
 			RoutingWeight: model.TotalRoutingWeight - weight,
 		},
 		TotalRoutingWeight: model.TotalRoutingWeight,
@@ -4,6 +4,7 @@ import (
 	"github.com/eddieowens/axon"
 	"github.com/kage-cloud/kage/core/kube"
 	"github.com/kage-cloud/kage/core/kube/kconfig"
+	"github.com/kage-cloud/kage/xds/pkg/analysis"
 	"github.com/kage-cloud/kage/xds/pkg/config"
 	"github.com/kage-cloud/kage/xds/pkg/snap"
 	"github.com/kage-cloud/kage/xds/pkg/snap/store"
@@ -21,6 +22,12 @@ const StoreClientKey = "StoreClient"
 
 const InformerClientKey = "InformerClient"
 
+const StatsClientKey = "StatsClient"
+
+const AnalysisProvidersKey = "AnalysisProviders"
+
+const EventRecorderKey = "EventRecorder"
+
 func kubeClientFactory(inj axon.Injector, _ axon.Args) axon.Instance {
 	conf := inj.GetStructPtr(config.ConfigKey).(*config.Config)
 	spec := kube.ClientSpec{
@@ -50,6 +57,16 @@ func kubeClientFactory(inj axon.Injector, _ axon.Args) axon.Instance {
 	return axon.StructPtr(k)
 }
 
+func eventRecorderFactory(inj axon.Injector, _ axon.Args) axon.Instance {
+	conf := inj.GetStructPtr(config.ConfigKey).(*config.Config)
+	client := inj.GetStructPtr(KubeClientKey).(kube.Client)
+	return axon.StructPtr(kube.NewEventRecorder(client, kube.EventRecorderSpec{
+		Component: "kage-xds",
+		Qps:       conf.Kube.EventQps,
+		Burst:     conf.Kube.EventBurst,
+	}))
+}
+
 func persistentEnvoyStoreFactory(inj axon.Injector, _ axon.Args) axon.Instance {
 	client := inj.GetStructPtr(KubeClientKey).(kube.Client)
 	var persStore store.EnvoyStatePersistentStore
@@ -71,9 +88,11 @@ func persistentEnvoyStoreFactory(inj axon.Injector, _ axon.Args) axon.Instance {
 }
 
 func storeClientFactory(inj axon.Injector, _ axon.Args) axon.Instance {
+	conf := inj.GetStructPtr(config.ConfigKey).(*config.Config)
 	persStore := inj.GetStructPtr(PersistentEnvoyStateStoreKey).(store.EnvoyStatePersistentStore)
 	spec := &snap.StoreClientSpec{
 		PersistentStore: persStore,
+		Ads:             conf.Xds.Ads,
 	}
 
 	s, err := snap.NewStoreClient(spec)
@@ -89,25 +108,68 @@ func informerClientFactory(inj axon.Injector, _ axon.Args) axon.Instance {
 	return axon.StructPtr(kube.NewInformerClient(client))
 }
 
+func statsClientFactory(inj axon.Injector, _ axon.Args) axon.Instance {
+	conf := inj.GetStructPtr(config.ConfigKey).(*config.Config)
+	return axon.StructPtr(analysis.NewStatsClient(&analysis.StatsClientSpec{Timeout: conf.Analysis.ScrapeTimeout}))
+}
+
+func analysisProvidersFactory(inj axon.Injector, _ axon.Args) axon.Instance {
+	conf := inj.GetStructPtr(config.ConfigKey).(*config.Config)
+	providers := make([]analysis.Provider, 0)
+
+	promConf := conf.Analysis.Prometheus
+	if promConf.Address != "" {
+		queries := make([]analysis.PrometheusQuery, 0, len(promConf.Queries))
+		for _, v := range promConf.Queries {
+			queries = append(queries, analysis.PrometheusQuery{
+				Name:  v.Name,
+				Query: v.Query,
+				Min:   v.Min,
+				Max:   v.Max,
+			})
+		}
+
+		prom, err := analysis.NewPrometheusProvider(&analysis.PrometheusProviderSpec{
+			Address: promConf.Address,
+			Timeout: promConf.Timeout,
+			Queries: queries,
+		})
+		if err != nil {
+			// The queries are validated when the config is loaded so this is never expected.
+			log.WithError(err).Error("Failed to configure Prometheus analysis provider")
+			return axon.Any(providers)
+		}
+
+		log.WithField("address", promConf.Address).
+			WithField("queries", len(queries)).
+			Info("Configured Prometheus analysis provider")
+		providers = append(providers, prom)
+	}
+
+	return axon.Any(providers)
+}
+
 func (p *Package) Bindings() []axon.Binding {
 	return []axon.Binding{
-		axon.Bind(EndpointsControllerServiceKey).To().StructPtr(new(endpointsControllerService)),
 		axon.Bind(CanaryServiceKey).To().StructPtr(new(canaryService)),
 		axon.Bind(EnvoyStateServiceKey).To().StructPtr(new(envoyStateService)),
-		axon.Bind(EnvoyEndpointControllerKey).To().StructPtr(new(envoyEndpointController)),
 		axon.Bind(XdsServiceKey).To().StructPtr(new(xdsService)),
 		axon.Bind(WatchServiceKey).To().StructPtr(new(watchService)),
-		axon.Bind(CanaryControllerServiceKey).To().StructPtr(new(canaryControllerService)),
-		axon.Bind(StateSyncServiceKey).To().StructPtr(new(stateSyncService)),
 		axon.Bind(MeshConfigServiceKey).To().StructPtr(new(meshConfigService)),
 		axon.Bind(KageMeshServiceKey).To().StructPtr(new(kageMeshService)),
 		axon.Bind(KubeReaderServiceKey).To().StructPtr(new(kubeReaderService)),
 		axon.Bind(CanaryEndpointsServiceKey).To().StructPtr(new(canaryEndpointsService)),
 		axon.Bind(ProxyServiceKey).To().StructPtr(new(proxyService)),
-		axon.Bind(KageServiceKey).To().Factory(kageServiceFactory).WithoutArgs(),
+		axon.Bind(RolloutServiceKey).To().StructPtr(new(rolloutService)),
+		axon.Bind(AnalysisServiceKey).To().StructPtr(new(analysisService)),
+		axon.Bind(CanaryStatusServiceKey).To().StructPtr(new(canaryStatusService)),
+		axon.Bind(CanaryResourceServiceKey).To().StructPtr(new(canaryResourceService)),
 		axon.Bind(KubeClientKey).To().Factory(kubeClientFactory).WithoutArgs(),
 		axon.Bind(PersistentEnvoyStateStoreKey).To().Factory(persistentEnvoyStoreFactory).WithoutArgs(),
 		axon.Bind(StoreClientKey).To().Factory(storeClientFactory).WithoutArgs(),
 		axon.Bind(InformerClientKey).To().Factory(informerClientFactory).WithoutArgs(),
+		axon.Bind(EventRecorderKey).To().Factory(eventRecorderFactory).WithoutArgs(),
+		axon.Bind(StatsClientKey).To().Factory(statsClientFactory).WithoutArgs(),
+		axon.Bind(AnalysisProvidersKey).To().Factory(analysisProvidersFactory).WithoutArgs(),
 	}
 }
@@ -0,0 +1,72 @@
+package service
+
+import (
+	"github.com/kage-cloud/kage/core/except"
+	"github.com/kage-cloud/kage/xds/pkg/config"
+	"github.com/kage-cloud/kage/xds/pkg/meta"
+	"github.com/kage-cloud/kage/xds/pkg/model"
+)
+
+// The timeout and retries of the routes to a cluster. Anything the canary does not override uses the default from the
+// config.
+func routePolicy(conf config.Resiliency, overrides meta.ClusterPolicy) (*model.RoutePolicy, error) {
+	timeout, err := overrides.RequestTimeout()
+	if err != nil {
+		return nil, except.NewError("%s", except.ErrInvalid, err.Error())
+	}
+
+	policy := &model.RoutePolicy{
+		Timeout:    conf.Timeout,
+		RetryOn:    conf.RetryOn,
+		NumRetries: conf.NumRetries,
+	}
+	if timeout != 0 {
+		policy.Timeout = timeout
+	}
+	if len(overrides.RetryOn) > 0 {
+		policy.RetryOn = overrides.RetryOn
+	}
+	if overrides.NumRetries != 0 {
+		policy.NumRetries = overrides.NumRetries
+	}
+
+	return policy, nil
+}
+
+// The circuit breaker thresholds of a cluster. Anything the canary does not override uses the default from the config.
+func circuitBreaker(conf config.Resiliency, overrides meta.ClusterPolicy) meta.CircuitBreaker {
+	cb := meta.CircuitBreaker{
+		MaxConnections:     conf.MaxConnections,
+		MaxPendingRequests: conf.MaxPendingRequests,
+		MaxRequests:        conf.MaxRequests,
+	}
+	if overrides.MaxConnections != 0 {
+		cb.MaxConnections = overrides.MaxConnections
+	}
+	if overrides.MaxPendingRequests != 0 {
+		cb.MaxPendingRequests = overrides.MaxPendingRequests
+	}
+	if overrides.MaxRequests != 0 {
+		cb.MaxRequests = overrides.MaxRequests
+	}
+	return cb
+}
+
+// The fault injected into the requests routed to a cluster. Nil if the faults are disabled or the fault injects nothing.
+func meshFault(faults meta.Faults, fault meta.Fault) (*model.Fault, error) {
+	if !faults.Enabled || !fault.IsSet() {
+		return nil, nil
+	}
+
+	delay, err := fault.FixedDelay()
+	if err != nil {
+		return nil, except.NewError("%s", except.ErrInvalid, err.Error())
+	}
+
+	return &model.Fault{
+		Delay:           delay,
+		DelayPercentage: fault.DelayPercentage,
+		AbortStatus:     fault.AbortStatus,
+		AbortPercentage: fault.AbortPercentage,
+	}, nil
+}
@@ -0,0 +1,322 @@
+package service
+
+import (
+	"fmt"
+	"github.com/kage-cloud/kage/core/except"
+	"github.com/kage-cloud/kage/core/kube"
+	"github.com/kage-cloud/kage/core/kube/kconfig"
+	"github.com/kage-cloud/kage/core/kube/kstream"
+	"github.com/kage-cloud/kage/core/kube/ktypes"
+	"github.com/kage-cloud/kage/xds/pkg/analysis"
+	"github.com/kage-cloud/kage/xds/pkg/meta"
+	log "github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"strings"
+	"time"
+)
+
+const RolloutServiceKey = "RolloutService"
+
+const rolloutSyncInterval = 5 * time.Second
+
+var canarySelector = labels.SelectorFromValidatedSet(meta.ToMap(&meta.CanaryMarker{Canary: true}))
+
+var controllerKinds = []ktypes.Kind{
+	ktypes.KindStatefulSet,
+	ktypes.KindDaemonSet,
+	ktypes.KindDeployment,
+	ktypes.KindPod,
+	ktypes.KindReplicaSet,
+}
+
+type RolloutService interface {
+	// Starts the rollout engine. Every canary with a step schedule is periodically checked and moved on to its next
+	// step once the pause of the current step has elapsed.
+	Start() error
+
+	// Immediately moves the canary controller on to the next step of its schedule.
+	Advance(obj runtime.Object) error
+
+	// Fetches the persisted rollout progress of the canary controller.
+	Fetch(obj runtime.Object) (*meta.Rollout, error)
+}
+
+type rolloutService struct {
+	KubeClient          kube.Client         `inject:"KubeClient"`
+	KubeReaderService   KubeReaderService   `inject:"KubeReaderService"`
+	CanaryService       CanaryService       `inject:"CanaryService"`
+	KageMeshService     KageMeshService     `inject:"KageMeshService"`
+	XdsService          XdsService          `inject:"XdsService"`
+	AnalysisService     AnalysisService     `inject:"AnalysisService"`
+	CanaryStatusService CanaryStatusService `inject:"CanaryStatusService"`
+}
+
+func (r *rolloutService) Start() error {
+	go func() {
+		ticker := time.NewTicker(rolloutSyncInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			r.sync()
+		}
+	}()
+
+	log.WithField("interval", rolloutSyncInterval).Info("Started rollout engine.")
+
+	return nil
+}
+
+func (r *rolloutService) Advance(obj runtime.Object) error {
+	canary := r.CanaryService.FetchForController(obj)
+	if canary == nil {
+		return except.NewError("not a valid canary", except.ErrInvalid)
+	}
+
+	if r.CanaryService.IsAborted(obj) {
+		return except.NewError("the canary %s has been aborted", except.ErrConflict, canary.CanaryObj.Name)
+	}
+
+	status, err := r.CanaryStatusService.Fetch(obj)
+	if err != nil {
+		return err
+	}
+
+	if !status.Phase.CanTransition(meta.PhaseProgressing) {
+		return except.NewError("the canary %s cannot be advanced while it is %s", except.ErrConflict, canary.CanaryObj.Name, status.Phase)
+	}
+
+	steps, err := r.steps(canary)
+	if err != nil {
+		return err
+	}
+
+	rollout, err := r.Fetch(obj)
+	if err != nil {
+		return err
+	}
+
+	return r.next(obj, canary, steps, rollout, time.Now())
+}
+
+func (r *rolloutService) Fetch(obj runtime.Object) (*meta.Rollout, error) {
+	metaObj, ok := obj.(metav1.Object)
+	if !ok {
+		return nil, except.NewError("%T is not a valid kube meta object", except.ErrInvalid, obj)
+	}
+
+	rollout := new(meta.Rollout)
+	if err := meta.FromMap(metaObj.GetAnnotations(), rollout); err != nil {
+		return nil, except.NewError("canary has unexpected rollout annotations: %s", except.ErrInvalid, err.Error())
+	}
+
+	return rollout, nil
+}
+
+func (r *rolloutService) sync() {
+	for _, kind := range controllerKinds {
+		li, err := r.KubeReaderService.List(canarySelector, kind, kconfig.Opt{})
+		if err != nil {
+			log.WithField("kind", kind).WithError(err).Debug("Failed to list canaries for rollout.")
+			continue
+		}
+
+		for _, obj := range kstream.StreamFromList(li).Collect().Objects() {
+			if err := r.reconcile(obj, time.Now()); err != nil {
+				metaObj := obj.(metav1.Object)
+				log.WithField("name", metaObj.GetName()).
+					WithField("namespace", metaObj.GetNamespace()).
+					WithError(err).
+					Error("Failed to progress the canary rollout.")
+			}
+		}
+	}
+}
+
+func (r *rolloutService) reconcile(obj runtime.Object, now time.Time) error {
+	canary := r.CanaryService.FetchForController(obj)
+	if canary == nil || len(canary.Steps) == 0 || r.CanaryService.IsAborted(obj) {
+		return nil
+	}
+
+	steps, err := r.steps(canary)
+	if err != nil {
+		return err
+	}
+
+	rollout, err := r.Fetch(obj)
+	if err != nil {
+		return err
+	}
+
+	if rollout.Complete || rollout.Failed {
+		return nil
+	}
+
+	status, err := r.CanaryStatusService.Fetch(obj)
+	if err != nil {
+		return err
+	}
+
+	// The rollout must not change the weight of a canary which is being promoted or has failed.
+	if !status.Phase.CanTransition(meta.PhaseProgressing) {
+		return nil
+	}
+
+	if !rollout.Started() {
+		return r.apply(obj, canary, steps, rollout, 0, now)
+	}
+
+	nextTransition, err := rollout.NextTransition()
+	if err != nil {
+		return except.NewError("canary has an invalid next transition time: %s", except.ErrInvalid, err.Error())
+	}
+
+	if now.Before(nextTransition) {
+		return nil
+	}
+
+	res, err := r.AnalysisService.Analyze(canary, rollout)
+	if err != nil {
+		return err
+	}
+
+	switch res.Verdict {
+	case analysis.VerdictFail:
+		return r.rollback(obj, canary, rollout, strings.Join(res.Reasons, "; "))
+	case analysis.VerdictInconclusive:
+		log.WithField("name", canary.CanaryObj.Name).
+			WithField("namespace", canary.CanaryObj.Namespace).
+			WithField("reasons", res.Reasons).
+			Debug("Canary analysis is inconclusive. Holding the current step.")
+		return r.CanaryStatusService.Transition(canary, meta.PhaseProgressing, "Holding the current step as the analysis is inconclusive: "+strings.Join(res.Reasons, "; "))
+	}
+
+	return r.next(obj, canary, steps, rollout, now)
+}
+
+// Sends all traffic back to the source and stops the rollout.
+func (r *rolloutService) rollback(obj runtime.Object, canary *meta.Canary, rollout *meta.Rollout, reason string) error {
+	if err := r.setWeight(canary, 0); err != nil {
+		return err
+	}
+
+	if err := r.CanaryStatusService.Transition(canary, meta.PhaseFailed, "Failed analysis: "+reason); err != nil {
+		return err
+	}
+
+	rollout.Failed = true
+	rollout.Reason = reason
+
+	log.WithField("name", canary.CanaryObj.Name).
+		WithField("namespace", canary.CanaryObj.Namespace).
+		WithField("reason", reason).
+		Warn("Canary failed analysis and was rolled back.")
+
+	return r.save(obj, rollout)
+}
+
+func (r *rolloutService) next(obj runtime.Object, canary *meta.Canary, steps []meta.Step, rollout *meta.Rollout, now time.Time) error {
+	if rollout.Complete || rollout.Failed {
+		return except.NewError("the rollout for %s has already finished", except.ErrConflict, canary.CanaryObj.Name)
+	}
+
+	idx := rollout.Step + 1
+	if !rollout.Started() {
+		idx = 0
+	}
+
+	if idx >= len(steps) {
+		if err := r.CanaryStatusService.Transition(canary, meta.PhasePaused, "Completed the rollout schedule. Holding the final weight until the canary is promoted or aborted."); err != nil {
+			return err
+		}
+
+		rollout.Complete = true
+		log.WithField("name", canary.CanaryObj.Name).
+			WithField("namespace", canary.CanaryObj.Namespace).
+			Info("Canary rollout completed.")
+		return r.save(obj, rollout)
+	}
+
+	return r.apply(obj, canary, steps, rollout, idx, now)
+}
+
+func (r *rolloutService) apply(obj runtime.Object, canary *meta.Canary, steps []meta.Step, rollout *meta.Rollout, idx int, now time.Time) error {
+	step := steps[idx]
+
+	if err := r.setWeight(canary, step.Weight); err != nil {
+		return err
+	}
+
+	message := fmt.Sprintf("Moved to step %d of %d.", idx+1, len(steps))
+	if err := r.CanaryStatusService.Transition(canary, meta.PhaseProgressing, message); err != nil {
+		return err
+	}
+
+	if err := r.AnalysisService.Checkpoint(canary, rollout); err != nil {
+		log.WithField("name", canary.CanaryObj.Name).
+			WithField("namespace", canary.CanaryObj.Namespace).
+			WithError(err).
+			Debug("Failed to checkpoint the canary's stats. The next analysis will use all recorded traffic.")
+	}
+
+	rollout.SetStep(idx, step, now)
+
+	log.WithField("name", canary.CanaryObj.Name).
+		WithField("namespace", canary.CanaryObj.Namespace).
+		WithField("step", idx).
+		WithField("weight", step.Weight).
+		WithField("next_transition", rollout.NextTransitionUtc).
+		Info("Canary rollout moved to the next step.")
+
+	return r.save(obj, rollout)
+}
+
+func (r *rolloutService) setWeight(canary *meta.Canary, weight uint32) error {
+	xdsAnno, err := r.KageMeshService.FetchForCanary(canary)
+	if err != nil {
+		return err
+	}
+
+	if err := r.XdsService.SetCanaryWeight(canary, xdsAnno, weight); err != nil {
+		return err
+	}
+
+	// The analysis of the next step must only see traffic sent at the new weight.
+	if err := r.XdsService.AwaitMesh(xdsAnno.Config.NodeId); err != nil {
+		if except.Reason(err) != except.ErrNotFound {
+			return err
+		}
+		log.WithField("name", canary.CanaryObj.Name).
+			WithField("namespace", canary.CanaryObj.Namespace).
+			WithField("node_id", xdsAnno.Config.NodeId).
+			Warn("No kage-mesh is connected to ACK the canary's new weight.")
+	}
+
+	return nil
+}
+
+func (r *rolloutService) save(obj runtime.Object, rollout *meta.Rollout) error {
+	metaObj := obj.(metav1.Object)
+	opt := kconfig.Opt{Namespace: metaObj.GetNamespace()}
+
+	// The status of the canary may have been updated since obj was read.
+	latest, err := r.KubeClient.Get(metaObj.GetName(), ktypes.KindFromObject(obj), opt)
+	if err != nil {
+		return err
+	}
+	latestMeta := latest.(metav1.Object)
+	latestMeta.SetAnnotations(meta.Merge(latestMeta.GetAnnotations(), rollout))
+
+	_, err = r.KubeClient.Update(latest, opt)
+	return err
+}
+
+func (r *rolloutService) steps(canary *meta.Canary) ([]meta.Step, error) {
+	steps, err := canary.RolloutSteps()
+	if err != nil {
+		return nil, except.NewError("canary has an invalid rollout schedule: %s", except.ErrInvalid, err.Error())
+	}
+
+	return steps, nil
+}
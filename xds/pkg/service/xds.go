@@ -1,33 +1,61 @@
 package service
 
 import (
-	"context"
+	endpoint "github.com/envoyproxy/go-control-plane/envoy/config/endpoint/v3"
+	listener "github.com/envoyproxy/go-control-plane/envoy/config/listener/v3"
+	route "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
+	"github.com/envoyproxy/go-control-plane/pkg/resource/v3"
 	"github.com/kage-cloud/kage/core/except"
 	"github.com/kage-cloud/kage/core/kube/kconfig"
-	"github.com/kage-cloud/kage/core/kube/kubeutil"
+	"github.com/kage-cloud/kage/xds/pkg/config"
+	"github.com/kage-cloud/kage/xds/pkg/controlplane"
 	"github.com/kage-cloud/kage/xds/pkg/factory"
+	"github.com/kage-cloud/kage/xds/pkg/meta"
 	"github.com/kage-cloud/kage/xds/pkg/model"
-	"github.com/kage-cloud/kage/xds/pkg/model/envoyepctlr"
-	"github.com/kage-cloud/kage/xds/pkg/model/xds"
 	"github.com/kage-cloud/kage/xds/pkg/snap"
 	"github.com/kage-cloud/kage/xds/pkg/snap/store"
+	"github.com/kage-cloud/kage/xds/pkg/util/envoyutil"
 	log "github.com/sirupsen/logrus"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"time"
 )
 
 const XdsServiceKey = "XdsService"
 
 type XdsService interface {
-	StartControlPlane(ctx context.Context, spec *xds.ControlPlaneSpec) error
 	StopControlPlane(nodeId string) error
 	SetRoutingWeight(meshConfig *model.MeshConfig) error
+
+	// Sends the weight worth of traffic to the canary's cluster of the kage-mesh and the rest to the source cluster.
+	// The other variants of the kage-mesh keep their weights and take their share from the source. Requests matching
+	// the canary's routing rules are always sent to the canary. If the canary is sticky, the weight applies to the
+	// share of users rather than the share of requests. If the canary is in shadow mode, the weight is the share of
+	// requests mirrored to the canary.
+	SetCanaryWeight(canary *meta.Canary, xdsAnno *meta.Xds, weight uint32) error
+
+	// Updates the kage-mesh with the canary's current routing rules without changing the routing weight.
+	SetCanaryRules(canary *meta.Canary, xdsAnno *meta.Xds) error
+
+	// Rebuilds the routes of the kage-mesh from its current variants. The weight of variants which were removed goes
+	// back to the source.
+	SyncVariants(xdsAnno *meta.Xds, opt kconfig.Opt) error
+
+	// Blocks until the kage-mesh ACKs its current listeners, routes, and endpoints or the ACK timeout is reached. The
+	// types the kage-mesh has not ACKed before are skipped as it is sent their latest version when it subscribes.
+	// Returns an except.ErrNotFound error if the kage-mesh is not connected and an except.ErrInvalid error if it
+	// rejected the update.
+	AwaitMesh(nodeId string) error
 }
 
 type xdsService struct {
-	EnvoyEndpointController EnvoyEndpointController `inject:"EnvoyEndpointController"`
-	WatchService            WatchService            `inject:"WatchService"`
-	RouteFactory            factory.RouteFactory    `inject:"RouteFactory"`
-	StoreClient             snap.StoreClient        `inject:"StoreClient"`
+	WatchService        WatchService            `inject:"WatchService"`
+	RouteFactory        factory.RouteFactory    `inject:"RouteFactory"`
+	ListenerFactory     factory.ListenerFactory `inject:"ListenerFactory"`
+	StoreClient         snap.StoreClient        `inject:"StoreClient"`
+	EnvoyStateService   EnvoyStateService       `inject:"EnvoyStateService"`
+	CanaryStatusService CanaryStatusService     `inject:"CanaryStatusService"`
+	KubeReaderService   KubeReaderService       `inject:"KubeReaderService"`
+	Config              *config.Config          `inject:"Config"`
+	AckTracker          controlplane.AckTracker `inject:"AckTracker"`
 }
 
 func (x *xdsService) StopControlPlane(nodeId string) error {
@@ -41,68 +69,307 @@ func (x *xdsService) StopControlPlane(nodeId string) error {
 func (x *xdsService) SetRoutingWeight(meshConfig *model.MeshConfig) error {
 	routes := x.RouteFactory.FromPercentage(meshConfig)
 
+	listeners, err := x.tcpProxies(meshConfig.NodeId, routes)
+	if err != nil {
+		return err
+	}
+
 	state := &store.EnvoyState{
-		NodeId: meshConfig.NodeId,
-		Routes: routes,
+		NodeId:    meshConfig.NodeId,
+		Routes:    routes,
+		Listeners: listeners,
+	}
+
+	if meshConfig.Sticky != nil {
+		endpoints, err := x.stickyEndpoints(meshConfig)
+		if err != nil {
+			return err
+		}
+		state.Endpoints = endpoints
 	}
 
 	return x.StoreClient.Set(state)
 }
 
-func (x *xdsService) StartControlPlane(ctx context.Context, spec *xds.ControlPlaneSpec) error {
-	if x.controlPlaneExists(spec.MeshConfig.NodeId) {
-		return except.NewError("The control plane for canary %s already exists", except.ErrAlreadyExists, spec.CanaryDeploy.Name)
+// The listeners of the kage-mesh with its TCP proxies split the same way as the routes. TCP connections cannot be
+// mirrored or matched by rules so only the catch-all route is followed. Nil if the kage-mesh has no TCP proxies.
+func (x *xdsService) tcpProxies(nodeId string, routes []*route.RouteConfiguration) ([]*listener.Listener, error) {
+	state, err := x.StoreClient.Get(nodeId)
+	if err != nil {
+		if except.Reason(err) == except.ErrNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	weights := envoyutil.DefaultRouteWeights(routes, model.TotalRoutingWeight)
+	found := false
+	listeners := make([]*listener.Listener, len(state.Listeners))
+	for i, v := range state.Listeners {
+		listeners[i] = v
+		if !envoyutil.IsTcpProxy(v) {
+			continue
+		}
+
+		addr := v.GetAddress().GetSocketAddress()
+		proxy, err := x.ListenerFactory.TcpProxy(listenerName(addr.GetPortValue()), addr.GetPortValue(), addr.GetProtocol(), weights)
+		if err != nil {
+			return nil, err
+		}
+		listeners[i] = proxy
+		found = true
+	}
+
+	if !found {
+		return nil, nil
+	}
+	return listeners, nil
+}
+
+// Replaces the sticky cluster's endpoints with the current endpoints of the target, canary, and variants weighted by
+// the mesh's routing weights.
+func (x *xdsService) stickyEndpoints(meshConfig *model.MeshConfig) ([]*endpoint.ClusterLoadAssignment, error) {
+	endpoints := make([]*endpoint.ClusterLoadAssignment, 0)
+	state, err := x.StoreClient.Get(meshConfig.NodeId)
+	if err == nil {
+		endpoints = append(endpoints, state.Endpoints...)
+	} else if except.Reason(err) != except.ErrNotFound {
+		return nil, err
+	}
+
+	weights := map[string]uint32{
+		meshConfig.Target.Name: meshConfig.Target.RoutingWeight,
+		meshConfig.Canary.Name: meshConfig.Canary.RoutingWeight,
+	}
+	for _, v := range meshConfig.Variants {
+		weights[v.Name] = v.RoutingWeight
+	}
+
+	sticky := envoyutil.StickyEndpoints(meshConfig.Sticky.Name, endpoints, weights)
+
+	if _, idx := envoyutil.FindClusterLoadAssignment(sticky.ClusterName, endpoints); idx >= 0 {
+		endpoints[idx] = sticky
+	} else {
+		endpoints = append(endpoints, sticky)
 	}
 
-	if err := x.SetRoutingWeight(&spec.MeshConfig); err != nil {
+	return endpoints, nil
+}
+
+func (x *xdsService) SetCanaryRules(canary *meta.Canary, xdsAnno *meta.Xds) error {
+	state, err := x.StoreClient.Get(xdsAnno.Config.NodeId)
+	if err != nil {
+		return err
+	}
+
+	cluster, ok := xdsAnno.Config.VariantCluster(canary.CanaryObj.Name)
+	if !ok {
+		return except.NewError("canary %s is not a variant of the kage-mesh %s", except.ErrNotFound, canary.CanaryObj.Name, xdsAnno.Name)
+	}
+
+	weight, err := x.EnvoyStateService.FetchClusterWeight(state, &xdsAnno.Config, cluster)
+	if err != nil {
 		return err
 	}
 
-	canSelector, err := metav1.LabelSelectorAsSelector(spec.CanaryDeploy.Spec.Selector)
+	return x.SetCanaryWeight(canary, xdsAnno, weight)
+}
+
+func (x *xdsService) SyncVariants(xdsAnno *meta.Xds, opt kconfig.Opt) error {
+	names := xdsAnno.Config.VariantNames()
+	if len(names) == 0 {
+		return nil
+	}
+
+	canary, err := fetchCanary(x.KubeReaderService, names[0], opt)
 	if err != nil {
 		return err
 	}
 
-	targetSelector, err := metav1.LabelSelectorAsSelector(spec.TargetDeploy.Spec.Selector)
+	return x.SetCanaryRules(canary, xdsAnno)
+}
+
+func (x *xdsService) AwaitMesh(nodeId string) error {
+	state, err := x.StoreClient.Get(nodeId)
 	if err != nil {
 		return err
 	}
 
-	ns := kubeutil.DeploymentPodNamespace(spec.TargetDeploy)
-	opt := kconfig.Opt{Namespace: ns}
-
-	eepcSpec := &envoyepctlr.Spec{
-		NodeId: spec.MeshConfig.NodeId,
-		PodClusters: []envoyepctlr.PodCluster{
-			{
-				Selector: targetSelector,
-				Name:     spec.MeshConfig.Target.Name,
-			},
-			{
-				Selector: canSelector,
-				Name:     spec.MeshConfig.Canary.Name,
-			},
+	var node *controlplane.Node
+	for _, v := range x.AckTracker.Nodes() {
+		if v.Id == nodeId {
+			node = &v
+			break
+		}
+	}
+	if node == nil {
+		return except.NewError("no kage-mesh with node ID %s is connected", except.ErrNotFound, nodeId)
+	}
+
+	deadline := time.Now().Add(x.Config.Xds.AckTimeout)
+	for _, typeUrl := range []string{resource.ListenerType, resource.RouteType, resource.EndpointType} {
+		if _, ok := node.Acks[typeUrl]; !ok {
+			continue
+		}
+
+		if err := x.AckTracker.WaitForAck(nodeId, typeUrl, state.Versions[typeUrl], time.Until(deadline)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (x *xdsService) SetCanaryWeight(canary *meta.Canary, xdsAnno *meta.Xds, weight uint32) error {
+	if weight > model.TotalRoutingWeight {
+		return except.NewError("weight %d exceeds the max weight of %d", except.ErrInvalid, weight, model.TotalRoutingWeight)
+	}
+
+	rules, err := canary.RoutingRules()
+	if err != nil {
+		return except.NewError("canary has invalid routing rules: %s", except.ErrInvalid, err.Error())
+	}
+
+	cluster, ok := xdsAnno.Config.VariantCluster(canary.CanaryObj.Name)
+	if !ok {
+		return except.NewError("canary %s is not a variant of the kage-mesh %s", except.ErrNotFound, canary.CanaryObj.Name, xdsAnno.Name)
+	}
+
+	variants, err := x.variants(canary, xdsAnno)
+	if err != nil {
+		return err
+	}
+
+	total := weight
+	for _, v := range variants {
+		total += v.RoutingWeight
+	}
+	if total > model.TotalRoutingWeight {
+		return except.NewError("the variants of %s would be sent a weight of %d which exceeds the max weight of %d", except.ErrInvalid, canary.SourceObj.Name, total, model.TotalRoutingWeight)
+	}
+
+	canaryPolicy, err := routePolicy(x.Config.Resiliency, canary.Resiliency.Canary)
+	if err != nil {
+		return err
+	}
+
+	sourcePolicy, err := routePolicy(x.Config.Resiliency, canary.Resiliency.Source)
+	if err != nil {
+		return err
+	}
+
+	canaryFault, err := meshFault(canary.Faults, canary.Faults.Canary)
+	if err != nil {
+		return err
+	}
+
+	sourceFault, err := meshFault(canary.Faults, canary.Faults.Source)
+	if err != nil {
+		return err
+	}
+
+	meshConfig := &model.MeshConfig{
+		NodeId: xdsAnno.Config.NodeId,
+		Canary: model.MeshCluster{
+			Name:          cluster,
+			RoutingWeight: weight,
+			Policy:        canaryPolicy,
+			Fault:         canaryFault,
 		},
-		Opt: opt,
+		Target: model.MeshCluster{
+			Name:          xdsAnno.Config.Source.ClusterName,
+			RoutingWeight: model.TotalRoutingWeight - total,
+			Policy:        sourcePolicy,
+			Fault:         sourceFault,
+		},
+		TotalRoutingWeight: model.TotalRoutingWeight,
+		Rules:              rules,
+		Variants:           variants,
+	}
+
+	mode, err := canary.CanaryMode()
+	if err != nil {
+		return except.NewError("canary has an invalid mode: %s", except.ErrInvalid, err.Error())
+	}
+	meshConfig.Shadow = mode == meta.CanaryModeShadow
+
+	stickyKey, err := canary.StickyKey()
+	if err != nil {
+		return except.NewError("canary has an invalid sticky key: %s", except.ErrInvalid, err.Error())
+	}
+
+	if stickyKey != nil && !meshConfig.Shadow {
+		if xdsAnno.Config.Sticky.ClusterName == "" {
+			return except.NewError("the kage-mesh for %s was created without a sticky cluster. Recreate the canary to use sticky routing", except.ErrUnsupported, canary.CanaryObj.Name)
+		}
+		meshConfig.Sticky = &model.StickyCluster{
+			Name: xdsAnno.Config.Sticky.ClusterName,
+			Key:  *stickyKey,
+		}
 	}
 
-	if err := x.EnvoyEndpointController.StartAsync(ctx, eepcSpec); err != nil {
+	if err := x.SetRoutingWeight(meshConfig); err != nil {
 		return err
 	}
 
-	log.WithField("name", spec.CanaryDeploy.Name).
-		WithField("namespace", spec.CanaryDeploy.Namespace).
-		WithField("node_id", spec.MeshConfig.NodeId).
-		Debug("Added canary to control plane.")
+	// The routes are already in place so the canary's status is left behind rather than failing the change.
+	if err := x.CanaryStatusService.SetWeight(canary, weight); err != nil {
+		log.WithField("name", canary.CanaryObj.Name).
+			WithField("namespace", canary.CanaryObj.Namespace).
+			WithField("weight", weight).
+			WithError(err).
+			Warn("Failed to record the weight of the canary.")
+	}
 
 	return nil
 }
 
-func (x *xdsService) controlPlaneExists(nodeId string) bool {
-	_, err := x.StoreClient.Get(nodeId)
-	exists := err == nil
-	if !exists {
-		log.WithField("node_id", nodeId).WithError(err).Debug("Control plane doesn't exist")
+// The other variants of the kage-mesh with their current weights, routing rules, policies, and faults. A variant whose
+// controller cannot be found keeps its weight but loses its rules, policy, and faults.
+func (x *xdsService) variants(canary *meta.Canary, xdsAnno *meta.Xds) ([]model.MeshVariant, error) {
+	names := xdsAnno.Config.VariantNames()
+	variants := make([]model.MeshVariant, 0, len(names))
+	if len(names) <= 1 {
+		return variants, nil
+	}
+
+	state, err := x.StoreClient.Get(xdsAnno.Config.NodeId)
+	if err != nil && except.Reason(err) != except.ErrNotFound {
+		return nil, err
 	}
-	return exists
+
+	opt := kconfig.Opt{Namespace: canary.CanaryObj.Namespace}
+	for _, name := range names {
+		if name == canary.CanaryObj.Name {
+			continue
+		}
+
+		variant := model.MeshVariant{MeshCluster: model.MeshCluster{Name: xdsAnno.Config.Variants[name]}}
+		if state != nil {
+			// A variant without routes yet has no weight.
+			variant.RoutingWeight, _ = x.EnvoyStateService.FetchClusterWeight(state, &xdsAnno.Config, variant.Name)
+		}
+
+		other, err := fetchCanary(x.KubeReaderService, name, opt)
+		if err == nil {
+			variant.Rules, err = other.RoutingRules()
+		}
+		if err == nil {
+			variant.Policy, err = routePolicy(x.Config.Resiliency, other.Resiliency.Canary)
+		}
+		if err == nil {
+			variant.Fault, err = meshFault(other.Faults, other.Faults.Canary)
+		}
+		if err != nil {
+			log.WithField("name", name).
+				WithField("namespace", opt.Namespace).
+				WithField("node_id", xdsAnno.Config.NodeId).
+				WithError(err).
+				Debug("Failed to fetch the routing rules of the variant.")
+		}
+
+		variants = append(variants, variant)
+	}
+
+	return variants, nil
 }
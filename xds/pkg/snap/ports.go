@@ -0,0 +1,282 @@
+package snap
+
+import (
+	cluster "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
+	endpoint "github.com/envoyproxy/go-control-plane/envoy/config/endpoint/v3"
+	listener "github.com/envoyproxy/go-control-plane/envoy/config/listener/v3"
+	route "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
+	hcm "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/http_connection_manager/v3"
+	tcp "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/tcp_proxy/v3"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/types"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/v3"
+	"github.com/envoyproxy/go-control-plane/pkg/resource/v3"
+	"github.com/envoyproxy/go-control-plane/pkg/wellknown"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/kage-cloud/kage/core/except"
+	"github.com/kage-cloud/kage/xds/pkg/factory"
+	"github.com/kage-cloud/kage/xds/pkg/model"
+	"github.com/kage-cloud/kage/xds/pkg/snap/store"
+	"github.com/kage-cloud/kage/xds/pkg/util/envoyutil"
+)
+
+// A port the kage-mesh listens on.
+type listenerPort struct {
+	port     uint32
+	protocol model.PortProtocol
+
+	// The route configuration of an HTTP listener. Empty for TCP proxies.
+	routeConfig string
+}
+
+// The resources served to the Envoy of the state indexed by their type URL. The state holds one cluster per variant
+// whose endpoints are on every port of its pods so each port the kage-mesh listens on is served a cluster, endpoints,
+// and route configuration of its own which only have the endpoints on that port. The listeners and TCP proxies are
+// pointed at the resources of their port. States without clusters are served as they are as the clusters of older
+// kage-meshes are in their bootstraps. A kage-mesh's listeners and routes are set over several calls so only the routes
+// referenced by a listener are served and HTTP listeners are held back until their routes are set.
+func Resources(state *store.EnvoyState) (map[string][]types.Resource, error) {
+	endpoints := envoyutil.MergeClusterLoadAssignments(state.Endpoints)
+	if len(state.Clusters) == 0 {
+		listeners, routes := referencedRoutes(state.Listeners, state.Routes)
+		return resourcesOf(listeners, routes, endpoints, state.Clusters), nil
+	}
+
+	clusterNames := make(map[string]bool, len(state.Clusters))
+	for _, v := range state.Clusters {
+		clusterNames[v.Name] = true
+	}
+
+	listeners := make([]*listener.Listener, 0, len(state.Listeners))
+	ports := make([]listenerPort, 0, len(state.Listeners))
+	for _, v := range state.Listeners {
+		l, port, err := listenerForPort(v, clusterNames)
+		if err != nil {
+			return nil, err
+		}
+		listeners = append(listeners, l)
+		if port != nil {
+			ports = append(ports, *port)
+		}
+	}
+
+	clusters, clas := portClusters(state.Clusters, endpoints, ports)
+	listeners, routes := referencedRoutes(listeners, portRoutes(state.Routes, ports, clusterNames))
+
+	return resourcesOf(listeners, routes, clas, clusters), nil
+}
+
+// Points the HTTP listener at its port's route configuration or the TCP proxy at its port's clusters. Nil if the
+// listener has no port.
+func listenerForPort(l *listener.Listener, clusters map[string]bool) (*listener.Listener, *listenerPort, error) {
+	addr := l.GetAddress().GetSocketAddress()
+	if addr == nil {
+		return l, nil, nil
+	}
+
+	out := proto.Clone(l).(*listener.Listener)
+	port := &listenerPort{port: addr.GetPortValue(), protocol: model.PortProtocolHttp}
+	for _, fc := range out.FilterChains {
+		for _, f := range fc.Filters {
+			var filter proto.Message
+			switch f.Name {
+			case wellknown.TCPProxy:
+				proxy := &tcp.TcpProxy{}
+				if err := ptypes.UnmarshalAny(f.GetTypedConfig(), proxy); err != nil {
+					return nil, nil, except.NewError("listener %s has an invalid TCP proxy: %s", except.ErrInvalid, l.Name, err.Error())
+				}
+
+				switch cs := proxy.ClusterSpecifier.(type) {
+				case *tcp.TcpProxy_Cluster:
+					cs.Cluster = portCluster(cs.Cluster, port.port, clusters)
+				case *tcp.TcpProxy_WeightedClusters:
+					for _, v := range cs.WeightedClusters.GetClusters() {
+						v.Name = portCluster(v.Name, port.port, clusters)
+					}
+				}
+				port.protocol = model.PortProtocolTcp
+				filter = proxy
+			case wellknown.HTTPConnectionManager:
+				manager := &hcm.HttpConnectionManager{}
+				if err := ptypes.UnmarshalAny(f.GetTypedConfig(), manager); err != nil {
+					return nil, nil, except.NewError("listener %s has an invalid HTTP connection manager: %s", except.ErrInvalid, l.Name, err.Error())
+				}
+
+				if rds := manager.GetRds(); rds != nil {
+					port.routeConfig = rds.RouteConfigName
+					rds.RouteConfigName = model.PortName(rds.RouteConfigName, port.port)
+				}
+				if manager.CodecType == hcm.HttpConnectionManager_HTTP2 {
+					port.protocol = model.PortProtocolHttp2
+				}
+				filter = manager
+			default:
+				continue
+			}
+
+			typedConfig, err := ptypes.MarshalAny(filter)
+			if err != nil {
+				return nil, nil, err
+			}
+			f.ConfigType = &listener.Filter_TypedConfig{TypedConfig: typedConfig}
+		}
+	}
+
+	return out, port, nil
+}
+
+// Every cluster for every port along with the endpoints of each which are on its port.
+func portClusters(clusters []*cluster.Cluster, endpoints []*endpoint.ClusterLoadAssignment, ports []listenerPort) ([]*cluster.Cluster, []*endpoint.ClusterLoadAssignment) {
+	outClusters := make([]*cluster.Cluster, 0, len(clusters)*len(ports))
+	outEndpoints := make([]*endpoint.ClusterLoadAssignment, 0, len(clusters)*len(ports))
+	for _, c := range clusters {
+		cla, _ := envoyutil.FindClusterLoadAssignment(c.Name, endpoints)
+		for _, p := range ports {
+			pc := factory.PortCluster(c, p.port, p.protocol)
+			outClusters = append(outClusters, pc)
+
+			if pc.GetType() == cluster.Cluster_EDS {
+				outEndpoints = append(outEndpoints, portEndpoints(pc.Name, cla, p.port))
+			}
+		}
+	}
+	return outClusters, outEndpoints
+}
+
+// The endpoints of the ClusterLoadAssignment on the port. Localities without any endpoints on the port are left out.
+func portEndpoints(name string, cla *endpoint.ClusterLoadAssignment, port uint32) *endpoint.ClusterLoadAssignment {
+	out := &endpoint.ClusterLoadAssignment{ClusterName: name}
+	if cla == nil {
+		return out
+	}
+	out.Policy = cla.Policy
+
+	for _, locality := range cla.Endpoints {
+		lbEndpoints := make([]*endpoint.LbEndpoint, 0, len(locality.LbEndpoints))
+		for _, v := range locality.LbEndpoints {
+			if v.GetEndpoint().GetAddress().GetSocketAddress().GetPortValue() == port {
+				lbEndpoints = append(lbEndpoints, v)
+			}
+		}
+		if len(lbEndpoints) == 0 {
+			continue
+		}
+
+		out.Endpoints = append(out.Endpoints, &endpoint.LocalityLbEndpoints{
+			Locality:            locality.Locality,
+			LbEndpoints:         lbEndpoints,
+			LoadBalancingWeight: locality.LoadBalancingWeight,
+			Priority:            locality.Priority,
+			Proximity:           locality.Proximity,
+		})
+	}
+	return out
+}
+
+// The route configuration of every HTTP port sending the requests to the clusters of the port.
+func portRoutes(routes []*route.RouteConfiguration, ports []listenerPort, clusters map[string]bool) []*route.RouteConfiguration {
+	out := make([]*route.RouteConfiguration, 0, len(ports))
+	for _, p := range ports {
+		if p.routeConfig == "" {
+			continue
+		}
+
+		var rc *route.RouteConfiguration
+		for _, v := range routes {
+			if v.Name == p.routeConfig {
+				rc = proto.Clone(v).(*route.RouteConfiguration)
+				break
+			}
+		}
+		if rc == nil {
+			continue
+		}
+
+		rc.Name = model.PortName(rc.Name, p.port)
+		for _, vh := range rc.VirtualHosts {
+			for _, r := range vh.Routes {
+				action := r.GetRoute()
+				if action == nil {
+					continue
+				}
+
+				if cs, ok := action.ClusterSpecifier.(*route.RouteAction_Cluster); ok {
+					cs.Cluster = portCluster(cs.Cluster, p.port, clusters)
+				}
+				for _, v := range action.GetWeightedClusters().GetClusters() {
+					v.Name = portCluster(v.Name, p.port, clusters)
+				}
+				for _, v := range action.RequestMirrorPolicies {
+					v.Cluster = portCluster(v.Cluster, p.port, clusters)
+				}
+			}
+		}
+		out = append(out, rc)
+	}
+	return out
+}
+
+// The listeners whose routes are all in routes and the routes those listeners reference.
+func referencedRoutes(listeners []*listener.Listener, routes []*route.RouteConfiguration) ([]*listener.Listener, []*route.RouteConfiguration) {
+	names := make(map[string]bool, len(routes))
+	for _, v := range routes {
+		names[v.Name] = true
+	}
+
+	outListeners := make([]*listener.Listener, 0, len(listeners))
+	referenced := map[string]bool{}
+	for _, l := range listeners {
+		refs := cache.GetResourceReferences(map[string]types.Resource{l.Name: l})
+
+		missing := false
+		for k := range refs {
+			missing = missing || !names[k]
+		}
+		if missing {
+			continue
+		}
+
+		outListeners = append(outListeners, l)
+		for k := range refs {
+			referenced[k] = true
+		}
+	}
+
+	outRoutes := make([]*route.RouteConfiguration, 0, len(referenced))
+	for _, v := range routes {
+		if referenced[v.Name] {
+			outRoutes = append(outRoutes, v)
+		}
+	}
+	return outListeners, outRoutes
+}
+
+// The port's cluster of the cluster. Clusters which are not in clusters are left as they are.
+func portCluster(name string, port uint32, clusters map[string]bool) string {
+	if !clusters[name] {
+		return name
+	}
+	return model.PortName(name, port)
+}
+
+func resourcesOf(listeners []*listener.Listener, routes []*route.RouteConfiguration, endpoints []*endpoint.ClusterLoadAssignment, clusters []*cluster.Cluster) map[string][]types.Resource {
+	resources := map[string][]types.Resource{
+		resource.ListenerType: make([]types.Resource, 0, len(listeners)),
+		resource.RouteType:    make([]types.Resource, 0, len(routes)),
+		resource.EndpointType: make([]types.Resource, 0, len(endpoints)),
+		resource.ClusterType:  make([]types.Resource, 0, len(clusters)),
+	}
+	for _, v := range listeners {
+		resources[resource.ListenerType] = append(resources[resource.ListenerType], v)
+	}
+	for _, v := range routes {
+		resources[resource.RouteType] = append(resources[resource.RouteType], v)
+	}
+	for _, v := range endpoints {
+		resources[resource.EndpointType] = append(resources[resource.EndpointType], v)
+	}
+	for _, v := range clusters {
+		resources[resource.ClusterType] = append(resources[resource.ClusterType], v)
+	}
+	return resources
+}
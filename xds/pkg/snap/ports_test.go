@@ -0,0 +1,222 @@
+package snap
+
+import (
+	cluster "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	endpoint "github.com/envoyproxy/go-control-plane/envoy/config/endpoint/v3"
+	listener "github.com/envoyproxy/go-control-plane/envoy/config/listener/v3"
+	route "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
+	tcp "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/tcp_proxy/v3"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/types"
+	"github.com/envoyproxy/go-control-plane/pkg/resource/v3"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/kage-cloud/kage/xds/pkg/factory"
+	"github.com/kage-cloud/kage/xds/pkg/meta"
+	"github.com/kage-cloud/kage/xds/pkg/model"
+	"github.com/kage-cloud/kage/xds/pkg/snap/store"
+	"github.com/kage-cloud/kage/xds/pkg/util/envoyutil"
+	"github.com/stretchr/testify/suite"
+	"testing"
+)
+
+type PortsTestSuite struct {
+	suite.Suite
+}
+
+func (p *PortsTestSuite) TestResourcesHttpAndTcpPorts() {
+	// -- Given
+	//
+	listenerFactory := factory.NewListenerFactory(true, false)
+	endpointFactory := factory.NewEndpointFactory()
+
+	httpListener, err := listenerFactory.Listener("listener-8080", 8080, core.SocketAddress_TCP, model.PortProtocolHttp)
+	p.Require().NoError(err)
+	tcpListener, err := listenerFactory.TcpProxy("listener-9000", 9000, core.SocketAddress_TCP, map[string]uint32{"source": 100})
+	p.Require().NoError(err)
+
+	given := &store.EnvoyState{
+		NodeId:    "node",
+		Listeners: []*listener.Listener{httpListener, tcpListener},
+		Routes:    []*route.RouteConfiguration{weightedRoutes("*", map[string]uint32{"source": 80, "canary": 20})},
+		Endpoints: envoyutil.MergeClusterLoadAssignments([]*endpoint.ClusterLoadAssignment{
+			endpointFactory.Endpoint("source", core.SocketAddress_TCP, "10.0.0.1", 8080),
+			endpointFactory.Endpoint("source", core.SocketAddress_TCP, "10.0.0.1", 9000),
+		}),
+		Clusters: factory.NewClusterFactory(true, false).FromXdsConfig(&meta.XdsConfig{
+			XdsId:  meta.XdsId{NodeId: "node"},
+			Canary: meta.EnvoyConfig{ClusterName: "canary"},
+			Source: meta.EnvoyConfig{ClusterName: "source"},
+		}),
+	}
+
+	// -- When
+	//
+	actual, err := Resources(given)
+
+	// -- Then
+	//
+	p.Require().NoError(err)
+	p.ElementsMatch([]string{"source|8080", "source|9000", "canary|8080", "canary|9000"}, names(actual[resource.ClusterType]))
+
+	for _, v := range actual[resource.ClusterType] {
+		c := v.(*cluster.Cluster)
+		if c.Name == "source|8080" {
+			p.NotNil(c.HttpProtocolOptions)
+		}
+		if c.Name == "source|9000" {
+			p.Nil(c.HttpProtocolOptions)
+			p.Nil(c.Http2ProtocolOptions)
+		}
+	}
+
+	clas := map[string]*endpoint.ClusterLoadAssignment{}
+	for _, v := range actual[resource.EndpointType] {
+		clas[v.(*endpoint.ClusterLoadAssignment).ClusterName] = v.(*endpoint.ClusterLoadAssignment)
+	}
+	p.Equal([]uint32{8080}, ports(clas["source|8080"]))
+	p.Equal([]uint32{9000}, ports(clas["source|9000"]))
+	p.Empty(ports(clas["canary|8080"]))
+
+	if p.Len(actual[resource.RouteType], 1) {
+		rc := actual[resource.RouteType][0].(*route.RouteConfiguration)
+		p.Equal("kage-mesh|8080", rc.Name)
+		weighted := rc.VirtualHosts[0].Routes[0].GetRoute().GetWeightedClusters().GetClusters()
+		p.ElementsMatch([]string{"source|8080", "canary|8080"}, []string{weighted[0].Name, weighted[1].Name})
+	}
+
+	if p.Len(actual[resource.ListenerType], 2) {
+		proxy := &tcp.TcpProxy{}
+		filter := actual[resource.ListenerType][1].(*listener.Listener).FilterChains[0].Filters[0]
+		p.Require().NoError(ptypes.UnmarshalAny(filter.GetTypedConfig(), proxy))
+		p.Equal("source|9000", proxy.GetCluster())
+	}
+
+	p.Equal("kage-mesh", given.Routes[0].Name)
+	p.Equal("source", given.Clusters[0].Name)
+}
+
+func (p *PortsTestSuite) TestResourcesWithoutClusters() {
+	// -- Given
+	//
+	httpListener, err := factory.NewListenerFactory(true, false).Listener("a", 8080, core.SocketAddress_TCP, model.PortProtocolHttp)
+	p.Require().NoError(err)
+
+	given := &store.EnvoyState{
+		NodeId:    "node",
+		Listeners: []*listener.Listener{httpListener},
+		Routes:    []*route.RouteConfiguration{weightedRoutes("*", map[string]uint32{"source": 100})},
+		Endpoints: []*endpoint.ClusterLoadAssignment{podEndpoint("source", "10.0.0.1")},
+	}
+
+	// -- When
+	//
+	actual, err := Resources(given)
+
+	// -- Then
+	//
+	p.Require().NoError(err)
+	p.Equal([]string{"a-8080"}, names(actual[resource.ListenerType]))
+	p.Equal([]string{"kage-mesh"}, names(actual[resource.RouteType]))
+	p.Equal([]string{"source"}, names(actual[resource.EndpointType]))
+	p.Empty(actual[resource.ClusterType])
+}
+
+func (p *PortsTestSuite) TestSetHoldsBackListenersWithoutRoutes() {
+	// -- Given
+	//
+	sc, err := NewStoreClient(&StoreClientSpec{PersistentStore: store.NewInMemoryStore()})
+	p.Require().NoError(err)
+
+	listenerFactory := factory.NewListenerFactory(true, false)
+	httpListener, err := listenerFactory.Listener("listener-8080", 8080, core.SocketAddress_TCP, model.PortProtocolHttp)
+	p.Require().NoError(err)
+	tcpListener, err := listenerFactory.TcpProxy("listener-9000", 9000, core.SocketAddress_TCP, map[string]uint32{"source": 100})
+	p.Require().NoError(err)
+
+	p.Require().NoError(sc.Set(&store.EnvoyState{
+		NodeId: "node",
+		Clusters: factory.NewClusterFactory(true, false).FromXdsConfig(&meta.XdsConfig{
+			Canary: meta.EnvoyConfig{ClusterName: "canary"},
+			Source: meta.EnvoyConfig{ClusterName: "source"},
+		}),
+	}))
+
+	// -- When
+	//
+	err = sc.Set(&store.EnvoyState{NodeId: "node", Listeners: []*listener.Listener{httpListener, tcpListener}})
+
+	// -- Then
+	//
+	if p.NoError(err) {
+		snapshot, _ := sc.SnapshotCache().GetSnapshot("node")
+		p.ElementsMatch([]string{"listener-9000-9000"}, keys(snapshot.Resources[types.Listener].Items))
+		p.Empty(snapshot.Resources[types.Route].Items)
+	}
+
+	// -- When
+	//
+	err = sc.Set(&store.EnvoyState{
+		NodeId: "node",
+		Routes: []*route.RouteConfiguration{weightedRoutes("*", map[string]uint32{"source": 100})},
+	})
+
+	// -- Then
+	//
+	if p.NoError(err) {
+		snapshot, _ := sc.SnapshotCache().GetSnapshot("node")
+		p.ElementsMatch([]string{"listener-8080-8080", "listener-9000-9000"}, keys(snapshot.Resources[types.Listener].Items))
+		p.ElementsMatch([]string{"kage-mesh|8080"}, keys(snapshot.Resources[types.Route].Items))
+	}
+}
+
+func (p *PortsTestSuite) TestSplitPortName() {
+	// -- When
+	//
+	name, port, ok := model.SplitPortName(model.PortName("source", 8080))
+
+	// -- Then
+	//
+	p.True(ok)
+	p.Equal("source", name)
+	p.Equal(uint32(8080), port)
+
+	_, _, ok = model.SplitPortName("source")
+	p.False(ok)
+}
+
+func names(resources []types.Resource) []string {
+	out := make([]string, 0, len(resources))
+	for _, v := range resources {
+		switch r := v.(type) {
+		case *cluster.Cluster:
+			out = append(out, r.Name)
+		case *endpoint.ClusterLoadAssignment:
+			out = append(out, r.ClusterName)
+		case *route.RouteConfiguration:
+			out = append(out, r.Name)
+		case *listener.Listener:
+			out = append(out, r.Name)
+		}
+	}
+	return out
+}
+
+func keys(resources map[string]types.Resource) []string {
+	out := make([]string, 0, len(resources))
+	for k := range resources {
+		out = append(out, k)
+	}
+	return out
+}
+
+func ports(cla *endpoint.ClusterLoadAssignment) []uint32 {
+	out := make([]uint32, 0)
+	for _, v := range envoyutil.AggAllEndpoints([]*endpoint.ClusterLoadAssignment{cla}) {
+		out = append(out, v.GetAddress().GetSocketAddress().GetPortValue())
+	}
+	return out
+}
+
+func TestPortsTestSuite(t *testing.T) {
+	suite.Run(t, new(PortsTestSuite))
+}
@@ -2,14 +2,18 @@ package snap
 
 import (
 	"fmt"
+	cluster "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
 	endpoint "github.com/envoyproxy/go-control-plane/envoy/config/endpoint/v3"
 	listener "github.com/envoyproxy/go-control-plane/envoy/config/listener/v3"
 	route "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
 	"github.com/envoyproxy/go-control-plane/pkg/cache/types"
 	"github.com/envoyproxy/go-control-plane/pkg/cache/v3"
+	"github.com/envoyproxy/go-control-plane/pkg/resource/v3"
+	"github.com/golang/protobuf/proto"
 	"github.com/google/uuid"
 	"github.com/kage-cloud/kage/core/except"
 	"github.com/kage-cloud/kage/xds/pkg/snap/store"
+	"github.com/kage-cloud/kage/xds/pkg/util/envoyutil"
 	"github.com/opencontainers/runc/Godeps/_workspace/src/github.com/Sirupsen/logrus"
 	log "github.com/sirupsen/logrus"
 	"sync"
@@ -21,6 +25,7 @@ import (
 // ConfigMaps.
 type StoreClient interface {
 	// Overwrite the current EnvoyState. For all unset fields on the EnvoyState, the previous EnvoyState will be used.
+	// Returns an except.ErrInvalid error if the resulting EnvoyState fails Validate or its snapshot is not Consistent.
 	Set(state *store.EnvoyState) error
 
 	// Get the entirety of the EnvoyState.
@@ -29,15 +34,21 @@ type StoreClient interface {
 	// Delete an EnvoyState with the specified name.
 	Delete(nodeId string) error
 
-	// Loads the entirety of the EnvoyState from the persistent Store into the StoreClient.
+	// Loads the entirety of the EnvoyState from the persistent Store into the StoreClient. States which can't be set
+	// are logged and skipped.
 	Load() error
 
+	// A copy of every EnvoyState indexed by the node ID.
 	List() map[string]store.EnvoyState
 
 	// Reload a singular Node ID from the persistent store.
 	Reload(nodeId string) error
 
 	SnapshotCache() cache.SnapshotCache
+
+	// Signals the channel whenever the EnvoyState of the node is set or deleted. Signals are coalesced while the
+	// previous one has not been received. Call the returned func to stop watching.
+	Watch(nodeId string) (<-chan struct{}, func())
 }
 
 type storeClient struct {
@@ -53,16 +64,59 @@ type storeClient struct {
 	syncChan chan string
 
 	lock sync.RWMutex
+
+	// The channels of the watchers of every node indexed by the node ID.
+	watchers map[string]map[chan struct{}]bool
+
+	watchLock sync.Mutex
 }
 
 func (s *storeClient) List() map[string]store.EnvoyState {
-	return s.CurrentStates
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	states := make(map[string]store.EnvoyState, len(s.CurrentStates))
+	for k, v := range s.CurrentStates {
+		states[k] = v
+	}
+	return states
 }
 
 func (s *storeClient) SnapshotCache() cache.SnapshotCache {
 	return s.Cache
 }
 
+func (s *storeClient) Watch(nodeId string) (<-chan struct{}, func()) {
+	s.watchLock.Lock()
+	defer s.watchLock.Unlock()
+
+	ch := make(chan struct{}, 1)
+	if s.watchers[nodeId] == nil {
+		s.watchers[nodeId] = map[chan struct{}]bool{}
+	}
+	s.watchers[nodeId][ch] = true
+
+	return ch, func() {
+		s.watchLock.Lock()
+		defer s.watchLock.Unlock()
+		delete(s.watchers[nodeId], ch)
+		if len(s.watchers[nodeId]) == 0 {
+			delete(s.watchers, nodeId)
+		}
+	}
+}
+
+func (s *storeClient) notify(nodeId string) {
+	s.watchLock.Lock()
+	defer s.watchLock.Unlock()
+	for ch := range s.watchers[nodeId] {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
 func (s *storeClient) Reload(nodeId string) error {
 	state, err := s.PersistentStore.Fetch(nodeId)
 	if err != nil {
@@ -77,7 +131,7 @@ func (s *storeClient) Reload(nodeId string) error {
 		return nil
 	}
 
-	return s.set(state)
+	return s.set(migrate(state))
 }
 
 func (s *storeClient) Stop() {
@@ -114,6 +168,7 @@ func (s *storeClient) Delete(nodeId string) error {
 	s.Cache.ClearSnapshot(nodeId)
 
 	delete(s.CurrentStates, nodeId)
+	s.notify(nodeId)
 
 	log.WithField("node_id", nodeId).Debug("Deleted envoy state.")
 
@@ -129,15 +184,41 @@ func (s *storeClient) Load() error {
 	s.lock.Lock()
 	defer s.lock.Unlock()
 
-	for _, state := range states {
-		if err := s.set(&state); err != nil {
-			return err
+	// One bad state shouldn't keep the rest of the kage-meshes from being served.
+	for i := range states {
+		if err := s.set(migrate(&states[i])); err != nil {
+			log.WithField("node_id", states[i].NodeId).WithError(err).Error("Skipped loading envoy state.")
 		}
 	}
 
 	return nil
 }
 
+// Upgrades a persisted state to pass Validate. Older kage-meshes were given routes with an empty domain and a
+// ClusterLoadAssignment for every pod so the empty domains are replaced by the wildcard and the endpoints of each
+// cluster are merged. The persisted resources are not modified.
+func migrate(state *store.EnvoyState) *store.EnvoyState {
+	out := *state
+	out.Endpoints = envoyutil.MergeClusterLoadAssignments(state.Endpoints)
+
+	out.Routes = make([]*route.RouteConfiguration, len(state.Routes))
+	for i, rc := range state.Routes {
+		out.Routes[i] = rc
+		for j, vh := range rc.VirtualHosts {
+			for k, d := range vh.Domains {
+				if d != "" {
+					continue
+				}
+				if out.Routes[i] == rc {
+					out.Routes[i] = proto.Clone(rc).(*route.RouteConfiguration)
+				}
+				out.Routes[i].VirtualHosts[j].Domains[k] = "*"
+			}
+		}
+	}
+	return &out
+}
+
 func (s *storeClient) Get(nodeId string) (*store.EnvoyState, error) {
 	s.lock.RLock()
 	defer s.lock.RUnlock()
@@ -154,24 +235,59 @@ func (s *storeClient) get(nodeId string) (*store.EnvoyState, error) {
 
 func (s *storeClient) Set(state *store.EnvoyState) error {
 	s.lock.Lock()
-	s.lock.Unlock()
+	defer s.lock.Unlock()
+
+	prevState, _ := s.get(state.NodeId)
+	merged := &store.EnvoyState{NodeId: state.NodeId}
+	merged.Listeners = s.listeners(prevState, state.Listeners)
+	merged.Routes = s.routes(prevState, state.Routes)
+	merged.Endpoints = s.endpoints(prevState, state.Endpoints)
+	merged.Clusters = s.clusters(prevState, state.Clusters)
+	if err := Validate(merged); err != nil {
+		log.WithField("node_id", state.NodeId).WithError(err).Error("Rejected invalid envoy state.")
+		return err
+	}
+
 	return s.set(state)
 }
 
 func (s *storeClient) set(state *store.EnvoyState) error {
 	log.WithField("node_id", state.NodeId).Debug("Saving envoy state")
 	prevState, _ := s.get(state.NodeId)
-	routes, routeResources := s.routes(prevState, state.Routes)
-	listeners, listenerResources := s.listeners(prevState, state.Listeners)
-	endpoints, endpointResources := s.endpoints(prevState, state.Endpoints)
 
 	compositeState := &store.EnvoyState{
 		NodeId:               state.NodeId,
 		UuidVersion:          uuid.New().String(),
 		CreationTimestampUtc: time.Now().UTC(),
-		Listeners:            listeners,
-		Routes:               routes,
-		Endpoints:            endpoints,
+		Listeners:            s.listeners(prevState, state.Listeners),
+		Routes:               s.routes(prevState, state.Routes),
+		Endpoints:            s.endpoints(prevState, state.Endpoints),
+		Clusters:             s.clusters(prevState, state.Clusters),
+	}
+
+	resources, err := Resources(compositeState)
+	if err != nil {
+		return err
+	}
+
+	versions, err := typeVersions(resources)
+	if err != nil {
+		return err
+	}
+	compositeState.Versions = versions
+
+	snapshot := cache.Snapshot{}
+	snapshot.Resources[types.Endpoint] = cache.NewResources(versions[resource.EndpointType], resources[resource.EndpointType])
+	snapshot.Resources[types.Cluster] = cache.NewResources(versions[resource.ClusterType], resources[resource.ClusterType])
+	snapshot.Resources[types.Route] = cache.NewResources(versions[resource.RouteType], resources[resource.RouteType])
+	snapshot.Resources[types.Listener] = cache.NewResources(versions[resource.ListenerType], resources[resource.ListenerType])
+
+	// The Envoy would wait forever for the resources it was told to request.
+	if err := Consistent(&snapshot); err != nil {
+		log.WithField("node_id", state.NodeId).
+			WithError(err).
+			Error("Rejected envoy state which references resources it does not have.")
+		return except.NewError("envoy state for node %s is inconsistent: %s", except.ErrInvalid, state.NodeId, err.Error())
 	}
 
 	handler, err := s.PersistentStore.Save(compositeState)
@@ -180,15 +296,6 @@ func (s *storeClient) set(state *store.EnvoyState) error {
 		return err
 	}
 
-	snapshot := cache.NewSnapshot(
-		"1",
-		endpointResources,
-		nil,
-		routeResources,
-		listenerResources,
-		nil,
-	)
-
 	if err := s.Cache.SetSnapshot(state.NodeId, snapshot); err != nil {
 		log.WithField("node_id", state.NodeId).WithError(err).Debug("Failed to save envoy state in the cache.")
 		_ = handler.Revert()
@@ -196,61 +303,82 @@ func (s *storeClient) set(state *store.EnvoyState) error {
 	}
 
 	s.CurrentStates[state.NodeId] = *compositeState
+	s.notify(state.NodeId)
 
 	log.WithField("node_id", state.NodeId).Debug("Saved envoy state")
 
 	return nil
 }
 
-func (s *storeClient) routes(prevState *store.EnvoyState, routes []*route.RouteConfiguration) ([]*route.RouteConfiguration, []types.Resource) {
+func (s *storeClient) routes(prevState *store.EnvoyState, routes []*route.RouteConfiguration) []*route.RouteConfiguration {
 	if len(routes) <= 0 && prevState != nil {
 		routes = prevState.Routes
 	}
-	resources := make([]types.Resource, 0, len(routes))
-
-	for i := range routes {
-		resources = append(resources, routes[i])
-	}
-	return routes, resources
+	return routes
 }
 
-func (s *storeClient) endpoints(prevState *store.EnvoyState, endpoints []*endpoint.ClusterLoadAssignment) ([]*endpoint.ClusterLoadAssignment, []types.Resource) {
+func (s *storeClient) endpoints(prevState *store.EnvoyState, endpoints []*endpoint.ClusterLoadAssignment) []*endpoint.ClusterLoadAssignment {
 	if len(endpoints) <= 0 && prevState != nil {
 		endpoints = prevState.Endpoints
 	}
-	resources := make([]types.Resource, 0, len(endpoints))
-
-	for i := range endpoints {
-		resources = append(resources, endpoints[i])
-	}
-	return endpoints, resources
+	return endpoints
 }
 
-func (s *storeClient) listeners(prevState *store.EnvoyState, listeners []*listener.Listener) ([]*listener.Listener, []types.Resource) {
+func (s *storeClient) listeners(prevState *store.EnvoyState, listeners []*listener.Listener) []*listener.Listener {
 	if len(listeners) <= 0 && prevState != nil {
 		listeners = prevState.Listeners
 	}
-	resources := make([]types.Resource, 0, len(listeners))
+	return listeners
+}
 
-	for i := range listeners {
-		resources = append(resources, listeners[i])
+func (s *storeClient) clusters(prevState *store.EnvoyState, clusters []*cluster.Cluster) []*cluster.Cluster {
+	if len(clusters) <= 0 && prevState != nil {
+		clusters = prevState.Clusters
 	}
-	return listeners, resources
+	return clusters
+}
+
+// The version of each resource type indexed by its type URL.
+func typeVersions(resources map[string][]types.Resource) (map[string]string, error) {
+	versions := make(map[string]string, len(resources))
+	for k, v := range resources {
+		version, err := TypeVersion(v)
+		if err != nil {
+			return nil, err
+		}
+		versions[k] = version
+	}
+	return versions, nil
+}
+
+// Checks that the snapshot has every endpoint its clusters and every route its listeners reference. The endpoints
+// are not checked if the snapshot has no clusters as the clusters of older kage-meshes are in their bootstraps.
+func Consistent(snapshot *cache.Snapshot) error {
+	check := *snapshot
+	if len(check.Resources[types.Cluster].Items) == 0 {
+		check.Resources[types.Endpoint] = cache.Resources{}
+	}
+	return check.Consistent()
 }
 
 type StoreClientSpec struct {
 	PersistentStore store.EnvoyStatePersistentStore
+
+	// Holds back the responses to each Envoy until every resource it requested is in its snapshot so the updates over
+	// the ADS stream are applied in order.
+	Ads bool
 }
 
 // Create a new StoreClient to save the EnvoyStates and update the Envoy Snapshot cache.
 func NewStoreClient(spec *StoreClientSpec) (StoreClient, error) {
-	snapshotCache := cache.NewSnapshotCache(false, cache.IDHash{}, &logrus.Logger{})
+	snapshotCache := cache.NewSnapshotCache(spec.Ads, cache.IDHash{}, &logrus.Logger{})
 
 	sc := &storeClient{
 		Cache:           snapshotCache,
 		PersistentStore: spec.PersistentStore,
 		CurrentStates:   map[string]store.EnvoyState{},
 		lock:            sync.RWMutex{},
+		watchers:        map[string]map[chan struct{}]bool{},
 	}
 
 	if err := sc.Load(); err != nil {
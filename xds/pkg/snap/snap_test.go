@@ -0,0 +1,142 @@
+package snap
+
+import (
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	endpoint "github.com/envoyproxy/go-control-plane/envoy/config/endpoint/v3"
+	listener "github.com/envoyproxy/go-control-plane/envoy/config/listener/v3"
+	route "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
+	"github.com/kage-cloud/kage/core/except"
+	"github.com/kage-cloud/kage/xds/pkg/factory"
+	"github.com/kage-cloud/kage/xds/pkg/meta"
+	"github.com/kage-cloud/kage/xds/pkg/snap/store"
+	"github.com/stretchr/testify/suite"
+	"testing"
+)
+
+type StoreClientTestSuite struct {
+	suite.Suite
+}
+
+func (s *StoreClientTestSuite) TestLoadMigratesPersistedState() {
+	// -- Given
+	//
+	persisted := store.NewInMemoryStore()
+	_, err := persisted.Save(&store.EnvoyState{
+		NodeId:    "node",
+		Listeners: []*listener.Listener{portListener("listener-8080", 8080)},
+		Routes:    []*route.RouteConfiguration{weightedRoutes("", map[string]uint32{"source": 100})},
+		Endpoints: []*endpoint.ClusterLoadAssignment{podEndpoint("source", "10.0.0.1"), podEndpoint("source", "10.0.0.2")},
+	})
+	s.Require().NoError(err)
+
+	sc, err := NewStoreClient(&StoreClientSpec{PersistentStore: persisted})
+	s.Require().NoError(err)
+	loaded, _ := sc.Get("node")
+	if s.Len(loaded.Endpoints, 1) {
+		s.Len(loaded.Endpoints[0].Endpoints[0].LbEndpoints, 2)
+	}
+
+	// -- When
+	//
+	err = sc.Set(&store.EnvoyState{
+		NodeId:    "node",
+		Endpoints: []*endpoint.ClusterLoadAssignment{podEndpoint("source", "10.0.0.1")},
+	})
+
+	// -- Then
+	//
+	if s.NoError(err) {
+		actual, _ := sc.Get("node")
+		s.Equal([]string{"*"}, actual.Routes[0].VirtualHosts[0].Domains)
+		s.Len(actual.Endpoints, 1)
+	}
+}
+
+func (s *StoreClientTestSuite) TestLoadSkipsInconsistentState() {
+	// -- Given
+	//
+	inconsistent := factory.NewClusterFactory(true, false).FromXdsConfig(&meta.XdsConfig{
+		Canary: meta.EnvoyConfig{ClusterName: "canary"},
+		Source: meta.EnvoyConfig{ClusterName: "source"},
+	})
+	inconsistent[0].EdsClusterConfig.ServiceName = "missing"
+
+	persisted := store.NewInMemoryStore()
+	_, err := persisted.Save(&store.EnvoyState{
+		NodeId:    "bad",
+		Listeners: []*listener.Listener{portListener("listener-8080", 8080)},
+		Clusters:  inconsistent,
+	})
+	s.Require().NoError(err)
+	_, err = persisted.Save(&store.EnvoyState{
+		NodeId:    "good",
+		Listeners: []*listener.Listener{portListener("listener-8080", 8080)},
+		Endpoints: []*endpoint.ClusterLoadAssignment{podEndpoint("source", "10.0.0.1")},
+	})
+	s.Require().NoError(err)
+
+	// -- When
+	//
+	sc, err := NewStoreClient(&StoreClientSpec{PersistentStore: persisted})
+
+	// -- Then
+	//
+	s.Require().NoError(err)
+	_, err = sc.Get("bad")
+	s.Equal(except.ErrNotFound, except.Reason(err))
+	actual, err := sc.Get("good")
+	if s.NoError(err) {
+		s.Len(actual.Endpoints, 1)
+	}
+}
+
+func (s *StoreClientTestSuite) TestSetDuplicateEndpoints() {
+	// -- Given
+	//
+	sc, err := NewStoreClient(&StoreClientSpec{PersistentStore: store.NewInMemoryStore()})
+	s.Require().NoError(err)
+
+	// -- When
+	//
+	err = sc.Set(&store.EnvoyState{
+		NodeId:    "node",
+		Endpoints: []*endpoint.ClusterLoadAssignment{podEndpoint("a", "10.0.0.1"), podEndpoint("a", "10.0.0.2")},
+	})
+
+	// -- Then
+	//
+	if s.Error(err) {
+		s.Equal(except.ErrInvalid, except.Reason(err))
+		s.Contains(err.Error(), "endpoints of cluster a are defined more than once")
+	}
+}
+
+func podEndpoint(cluster, addr string) *endpoint.ClusterLoadAssignment {
+	return &endpoint.ClusterLoadAssignment{
+		ClusterName: cluster,
+		Endpoints: []*endpoint.LocalityLbEndpoints{
+			{
+				LbEndpoints: []*endpoint.LbEndpoint{
+					{
+						HostIdentifier: &endpoint.LbEndpoint_Endpoint{
+							Endpoint: &endpoint.Endpoint{
+								Address: &core.Address{
+									Address: &core.Address_SocketAddress{
+										SocketAddress: &core.SocketAddress{
+											Address:       addr,
+											PortSpecifier: &core.SocketAddress_PortValue{PortValue: 8080},
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func TestStoreClientTestSuite(t *testing.T) {
+	suite.Run(t, new(StoreClientTestSuite))
+}
@@ -1,9 +1,13 @@
 package store
 
 import (
+	"bytes"
+	"encoding/json"
+	cluster "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
 	endpoint "github.com/envoyproxy/go-control-plane/envoy/config/endpoint/v3"
 	listener "github.com/envoyproxy/go-control-plane/envoy/config/listener/v3"
 	route "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
+	"github.com/golang/protobuf/jsonpb"
 	"github.com/golang/protobuf/proto"
 	"time"
 )
@@ -28,4 +32,115 @@ type EnvoyState struct {
 
 	// The Envoy Endpoint definitions for the Envoy config. Required.
 	Endpoints []*endpoint.ClusterLoadAssignment `json:"endpoints"`
+
+	// The Envoy Cluster definitions served over CDS. Empty for states saved before the clusters were served over CDS
+	// as their clusters are in the bootstrap of the Envoy.
+	Clusters []*cluster.Cluster `json:"clusters,omitempty"`
+
+	// The hash of the content of each resource type indexed by the type URL. Served as the version of the type so an
+	// Envoy is only sent a type when it changes.
+	Versions map[string]string `json:"versions,omitempty"`
+}
+
+// The persisted form of the EnvoyState. Each resource is encoded on its own by jsonpb as the EnvoyState is not a
+// generated message.
+type persistedState struct {
+	NodeId               string            `json:"node_id"`
+	UuidVersion          string            `json:"uuid_version"`
+	CreationTimestampUtc time.Time         `json:"creation_timestamp_utc"`
+	Listeners            []json.RawMessage `json:"listeners"`
+	Routes               []json.RawMessage `json:"routes"`
+	Endpoints            []json.RawMessage `json:"endpoints"`
+	Clusters             []json.RawMessage `json:"clusters,omitempty"`
+	Versions             map[string]string `json:"versions,omitempty"`
+}
+
+func (e *EnvoyState) MarshalJSONPB(m *jsonpb.Marshaler) ([]byte, error) {
+	ps := persistedState{
+		NodeId:               e.NodeId,
+		UuidVersion:          e.UuidVersion,
+		CreationTimestampUtc: e.CreationTimestampUtc,
+		Versions:             e.Versions,
+	}
+
+	var err error
+	for _, v := range e.Listeners {
+		if ps.Listeners, err = marshalResource(m, ps.Listeners, v); err != nil {
+			return nil, err
+		}
+	}
+	for _, v := range e.Routes {
+		if ps.Routes, err = marshalResource(m, ps.Routes, v); err != nil {
+			return nil, err
+		}
+	}
+	for _, v := range e.Endpoints {
+		if ps.Endpoints, err = marshalResource(m, ps.Endpoints, v); err != nil {
+			return nil, err
+		}
+	}
+	for _, v := range e.Clusters {
+		if ps.Clusters, err = marshalResource(m, ps.Clusters, v); err != nil {
+			return nil, err
+		}
+	}
+
+	return json.Marshal(ps)
+}
+
+func (e *EnvoyState) UnmarshalJSONPB(u *jsonpb.Unmarshaler, b []byte) error {
+	ps := new(persistedState)
+	if err := json.Unmarshal(b, ps); err != nil {
+		return err
+	}
+
+	e.NodeId = ps.NodeId
+	e.UuidVersion = ps.UuidVersion
+	e.CreationTimestampUtc = ps.CreationTimestampUtc
+	e.Versions = ps.Versions
+
+	e.Listeners = make([]*listener.Listener, len(ps.Listeners))
+	for i, v := range ps.Listeners {
+		e.Listeners[i] = new(listener.Listener)
+		if err := u.Unmarshal(bytes.NewReader(v), e.Listeners[i]); err != nil {
+			return err
+		}
+	}
+
+	e.Routes = make([]*route.RouteConfiguration, len(ps.Routes))
+	for i, v := range ps.Routes {
+		e.Routes[i] = new(route.RouteConfiguration)
+		if err := u.Unmarshal(bytes.NewReader(v), e.Routes[i]); err != nil {
+			return err
+		}
+	}
+
+	e.Endpoints = make([]*endpoint.ClusterLoadAssignment, len(ps.Endpoints))
+	for i, v := range ps.Endpoints {
+		e.Endpoints[i] = new(endpoint.ClusterLoadAssignment)
+		if err := u.Unmarshal(bytes.NewReader(v), e.Endpoints[i]); err != nil {
+			return err
+		}
+	}
+
+	// States saved before the clusters were served over CDS have none.
+	if len(ps.Clusters) > 0 {
+		e.Clusters = make([]*cluster.Cluster, len(ps.Clusters))
+		for i, v := range ps.Clusters {
+			e.Clusters[i] = new(cluster.Cluster)
+			if err := u.Unmarshal(bytes.NewReader(v), e.Clusters[i]); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func marshalResource(m *jsonpb.Marshaler, raws []json.RawMessage, resource proto.Message) ([]json.RawMessage, error) {
+	buf := bytes.NewBuffer([]byte{})
+	if err := m.Marshal(buf, resource); err != nil {
+		return nil, err
+	}
+	return append(raws, buf.Bytes()), nil
 }
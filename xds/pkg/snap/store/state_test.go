@@ -0,0 +1,76 @@
+package store
+
+import (
+	"bytes"
+	cluster "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
+	route "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/stretchr/testify/suite"
+	"testing"
+	"time"
+)
+
+type StateTestSuite struct {
+	suite.Suite
+}
+
+func (s *StateTestSuite) TestMarshalRoundTrip() {
+	// -- Given
+	//
+	given := &EnvoyState{
+		NodeId:               "node",
+		UuidVersion:          "version",
+		CreationTimestampUtc: time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+		Routes:               []*route.RouteConfiguration{{Name: "source-canary"}},
+		Clusters: []*cluster.Cluster{
+			{Name: "canary", ClusterDiscoveryType: &cluster.Cluster_Type{Type: cluster.Cluster_EDS}},
+		},
+	}
+
+	// -- When
+	//
+	buf := bytes.NewBuffer([]byte{})
+	err := new(jsonpb.Marshaler).Marshal(buf, given)
+
+	// -- Then
+	//
+	if s.NoError(err) {
+		actual := new(EnvoyState)
+		if s.NoError(jsonpb.Unmarshal(buf, actual)) {
+			s.Equal(given.NodeId, actual.NodeId)
+			s.Equal(given.UuidVersion, actual.UuidVersion)
+			s.True(given.CreationTimestampUtc.Equal(actual.CreationTimestampUtc))
+			if s.Len(actual.Routes, 1) {
+				s.Equal("source-canary", actual.Routes[0].Name)
+			}
+			if s.Len(actual.Clusters, 1) {
+				s.Equal("canary", actual.Clusters[0].Name)
+				s.Equal(cluster.Cluster_EDS, actual.Clusters[0].GetType())
+			}
+		}
+	}
+}
+
+func (s *StateTestSuite) TestUnmarshalWithoutClusters() {
+	// -- Given
+	//
+	given := `{"node_id":"node","uuid_version":"version","creation_timestamp_utc":"2020-01-02T03:04:05Z","listeners":[],"routes":[{"name":"source-canary"}],"endpoints":[{"cluster_name":"source"}]}`
+
+	// -- When
+	//
+	actual := new(EnvoyState)
+	err := jsonpb.Unmarshal(bytes.NewReader([]byte(given)), actual)
+
+	// -- Then
+	//
+	if s.NoError(err) {
+		s.Equal("node", actual.NodeId)
+		s.Len(actual.Routes, 1)
+		s.Len(actual.Endpoints, 1)
+		s.Nil(actual.Clusters)
+	}
+}
+
+func TestStateTestSuite(t *testing.T) {
+	suite.Run(t, new(StateTestSuite))
+}
@@ -0,0 +1,194 @@
+package snap
+
+import (
+	"fmt"
+	listener "github.com/envoyproxy/go-control-plane/envoy/config/listener/v3"
+	route "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
+	tcp "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/tcp_proxy/v3"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/types"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/v3"
+	"github.com/envoyproxy/go-control-plane/pkg/wellknown"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/kage-cloud/kage/core/except"
+	"github.com/kage-cloud/kage/xds/pkg/model"
+	"github.com/kage-cloud/kage/xds/pkg/snap/store"
+	"strings"
+)
+
+// Envoy's default total weight of weighted clusters.
+const defaultTotalWeight = 100
+
+// Checks every resource of the state against its protobuf rules and that the resources agree with one another. The
+// routes and TCP proxies must only reference clusters of the state, the listeners must have unique names and ports,
+// each cluster must have one ClusterLoadAssignment, and the weights of every weighted cluster must add up to its total
+// weight. The cluster references are not checked if the state has no clusters as the clusters of older kage-meshes are
+// in their bootstraps. Returns an except.ErrInvalid error listing every problem.
+func Validate(state *store.EnvoyState) error {
+	problems := make([]string, 0)
+	addProblem := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	for _, v := range state.Listeners {
+		validateProto(addProblem, "listener", v)
+	}
+	for _, v := range state.Routes {
+		validateProto(addProblem, "route", v)
+	}
+	for _, v := range state.Endpoints {
+		validateProto(addProblem, "endpoint", v)
+	}
+	for _, v := range state.Clusters {
+		validateProto(addProblem, "cluster", v)
+	}
+
+	names := map[string]bool{}
+	ports := map[string]string{}
+	for _, v := range state.Listeners {
+		if names[v.Name] {
+			addProblem("listener %s is defined more than once", v.Name)
+		}
+		names[v.Name] = true
+
+		addr := v.GetAddress().GetSocketAddress()
+		if addr == nil {
+			continue
+		}
+		port := fmt.Sprintf("%d/%s", addr.GetPortValue(), addr.GetProtocol())
+		if other, ok := ports[port]; ok && other != v.Name {
+			addProblem("listeners %s and %s both listen on port %s", other, v.Name, port)
+		}
+		ports[port] = v.Name
+	}
+
+	endpoints := map[string]bool{}
+	for _, v := range state.Endpoints {
+		if endpoints[v.ClusterName] {
+			addProblem("endpoints of cluster %s are defined more than once", v.ClusterName)
+		}
+		endpoints[v.ClusterName] = true
+	}
+
+	var clusters map[string]bool
+	if len(state.Clusters) > 0 {
+		clusters = make(map[string]bool, len(state.Clusters))
+		for _, v := range state.Clusters {
+			clusters[v.Name] = true
+		}
+	}
+
+	for _, v := range state.Listeners {
+		for _, fc := range v.FilterChains {
+			for _, f := range fc.Filters {
+				if f.Name == wellknown.TCPProxy {
+					validateTcpProxy(addProblem, v.Name, f, clusters)
+				}
+			}
+		}
+	}
+
+	for _, rc := range state.Routes {
+		for _, vh := range rc.VirtualHosts {
+			for _, d := range vh.Domains {
+				if d == "" {
+					addProblem("virtual host %s of route %s has an empty domain", vh.Name, rc.Name)
+				}
+			}
+			for _, r := range vh.Routes {
+				validateRouteAction(addProblem, rc.Name, r, clusters)
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		return except.NewError("envoy state for node %s is invalid: %s", except.ErrInvalid, state.NodeId, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+func validateProto(addProblem func(string, ...interface{}), kind string, res types.Resource) {
+	v, ok := res.(interface{ Validate() error })
+	if !ok {
+		return
+	}
+	if err := v.Validate(); err != nil {
+		addProblem("%s %s: %s", kind, cache.GetResourceName(res), err.Error())
+	}
+}
+
+// Checks the weights of the route's weighted clusters and, if clusters is not nil, that every cluster the route sends
+// or mirrors requests to is in clusters.
+func validateRouteAction(addProblem func(string, ...interface{}), routeConfig string, r *route.Route, clusters map[string]bool) {
+	action := r.GetRoute()
+	if action == nil {
+		return
+	}
+
+	referenced := make([]string, 0)
+	if c := action.GetCluster(); c != "" {
+		referenced = append(referenced, c)
+	}
+
+	if wc := action.GetWeightedClusters(); wc != nil {
+		total := uint32(defaultTotalWeight)
+		if wc.TotalWeight != nil {
+			total = wc.TotalWeight.Value
+		}
+
+		sum := uint32(0)
+		for _, v := range wc.Clusters {
+			sum += v.GetWeight().GetValue()
+			referenced = append(referenced, v.Name)
+		}
+		if sum != total {
+			addProblem("the weights of route %s in %s add up to %d rather than %d", r.Name, routeConfig, sum, total)
+		}
+	}
+
+	for _, v := range action.RequestMirrorPolicies {
+		referenced = append(referenced, v.Cluster)
+	}
+
+	if clusters == nil {
+		return
+	}
+	for _, v := range referenced {
+		if !clusters[v] {
+			addProblem("route %s in %s references the unknown cluster %s", r.Name, routeConfig, v)
+		}
+	}
+}
+
+// Checks that the weights of the TCP proxy's weighted clusters add up to the total routing weight and, if clusters is
+// not nil, that every cluster it sends connections to is in clusters.
+func validateTcpProxy(addProblem func(string, ...interface{}), listenerName string, f *listener.Filter, clusters map[string]bool) {
+	proxy := &tcp.TcpProxy{}
+	if err := ptypes.UnmarshalAny(f.GetTypedConfig(), proxy); err != nil {
+		addProblem("listener %s has an invalid TCP proxy: %s", listenerName, err.Error())
+		return
+	}
+
+	referenced := make([]string, 0)
+	switch cs := proxy.ClusterSpecifier.(type) {
+	case *tcp.TcpProxy_Cluster:
+		referenced = append(referenced, cs.Cluster)
+	case *tcp.TcpProxy_WeightedClusters:
+		sum := uint32(0)
+		for _, v := range cs.WeightedClusters.GetClusters() {
+			sum += v.Weight
+			referenced = append(referenced, v.Name)
+		}
+		if sum != model.TotalRoutingWeight {
+			addProblem("the weights of the TCP proxy of listener %s add up to %d rather than %d", listenerName, sum, model.TotalRoutingWeight)
+		}
+	}
+
+	if clusters == nil {
+		return
+	}
+	for _, v := range referenced {
+		if !clusters[v] {
+			addProblem("the TCP proxy of listener %s references the unknown cluster %s", listenerName, v)
+		}
+	}
+}
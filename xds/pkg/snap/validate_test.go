@@ -0,0 +1,199 @@
+package snap
+
+import (
+	cluster "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	listener "github.com/envoyproxy/go-control-plane/envoy/config/listener/v3"
+	route "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
+	"github.com/golang/protobuf/ptypes/wrappers"
+	"github.com/kage-cloud/kage/core/except"
+	"github.com/kage-cloud/kage/xds/pkg/factory"
+	"github.com/kage-cloud/kage/xds/pkg/snap/store"
+	"github.com/stretchr/testify/suite"
+	"testing"
+)
+
+type ValidateTestSuite struct {
+	suite.Suite
+}
+
+func (v *ValidateTestSuite) TestValidateDuplicatePorts() {
+	// -- Given
+	//
+	given := &store.EnvoyState{
+		NodeId:    "node",
+		Listeners: []*listener.Listener{portListener("a", 8080), portListener("b", 8080)},
+		Routes: []*route.RouteConfiguration{
+			weightedRoutes("*", map[string]uint32{"source": 20, "canary": 80}),
+		},
+		Clusters: []*cluster.Cluster{{Name: "source"}, {Name: "canary"}},
+	}
+
+	// -- When
+	//
+	err := Validate(given)
+
+	// -- Then
+	//
+	v.Error(err)
+	v.Equal(except.ErrInvalid, except.Reason(err))
+	v.Contains(err.Error(), "listeners a and b both listen on port 8080/TCP")
+}
+
+func (v *ValidateTestSuite) TestValidateListsEveryProblem() {
+	// -- Given
+	//
+	given := &store.EnvoyState{
+		NodeId:    "node",
+		Listeners: []*listener.Listener{portListener("a", 8080), portListener("a", 8081), {Name: "c"}},
+		Routes: []*route.RouteConfiguration{
+			weightedRoutes("", map[string]uint32{"source": 30, "missing": 30}),
+		},
+		Clusters: []*cluster.Cluster{{Name: "source"}},
+	}
+
+	// -- When
+	//
+	err := Validate(given)
+
+	// -- Then
+	//
+	if v.Error(err) {
+		v.Equal(except.ErrInvalid, except.Reason(err))
+		v.Contains(err.Error(), "listener c: invalid Listener.Address")
+		v.Contains(err.Error(), "listener a is defined more than once")
+		v.Contains(err.Error(), "virtual host kage-mesh of route kage-mesh has an empty domain")
+		v.Contains(err.Error(), "the weights of route weighted in kage-mesh add up to 60 rather than 100")
+		v.Contains(err.Error(), "route weighted in kage-mesh references the unknown cluster missing")
+	}
+}
+
+func (v *ValidateTestSuite) TestValidateWithoutClusters() {
+	// -- Given
+	//
+	given := &store.EnvoyState{
+		NodeId:    "node",
+		Listeners: []*listener.Listener{portListener("a", 8080)},
+		Routes: []*route.RouteConfiguration{
+			weightedRoutes("*", map[string]uint32{"source": 20, "canary": 80}),
+		},
+	}
+
+	// -- When
+	//
+	err := Validate(given)
+
+	// -- Then
+	//
+	v.NoError(err)
+}
+
+func (v *ValidateTestSuite) TestValidateTcpProxies() {
+	// -- Given
+	//
+	listenerFactory := factory.NewListenerFactory(true, false)
+	weighted, err := listenerFactory.TcpProxy("weighted", 9000, core.SocketAddress_TCP, map[string]uint32{"source": 30, "canary": 30})
+	v.Require().NoError(err)
+	single, err := listenerFactory.TcpProxy("single", 9001, core.SocketAddress_TCP, map[string]uint32{"missing": 100})
+	v.Require().NoError(err)
+
+	given := &store.EnvoyState{
+		NodeId:    "node",
+		Listeners: []*listener.Listener{weighted, single},
+		Clusters:  []*cluster.Cluster{{Name: "source"}, {Name: "canary"}},
+	}
+
+	// -- When
+	//
+	err = Validate(given)
+
+	// -- Then
+	//
+	if v.Error(err) {
+		v.Equal(except.ErrInvalid, except.Reason(err))
+		v.Contains(err.Error(), "the weights of the TCP proxy of listener weighted-9000 add up to 60 rather than 100")
+		v.Contains(err.Error(), "the TCP proxy of listener single-9001 references the unknown cluster missing")
+		v.NotContains(err.Error(), "unknown cluster source")
+	}
+
+	// -- When
+	//
+	given.Clusters = nil
+	err = Validate(given)
+
+	// -- Then
+	//
+	if v.Error(err) {
+		v.NotContains(err.Error(), "unknown cluster")
+	}
+}
+
+func (v *ValidateTestSuite) TestSetInvalid() {
+	// -- Given
+	//
+	sc, err := NewStoreClient(&StoreClientSpec{PersistentStore: store.NewInMemoryStore()})
+	v.Require().NoError(err)
+
+	// -- When
+	//
+	err = sc.Set(&store.EnvoyState{NodeId: "node", Listeners: []*listener.Listener{{Name: "a"}}})
+
+	// -- Then
+	//
+	if v.Error(err) {
+		v.Equal(except.ErrInvalid, except.Reason(err))
+		_, err = sc.Get("node")
+		v.Equal(except.ErrNotFound, except.Reason(err))
+	}
+}
+
+func portListener(name string, port uint32) *listener.Listener {
+	return &listener.Listener{
+		Name: name,
+		Address: &core.Address{
+			Address: &core.Address_SocketAddress{
+				SocketAddress: &core.SocketAddress{
+					Address:       "0.0.0.0",
+					PortSpecifier: &core.SocketAddress_PortValue{PortValue: port},
+				},
+			},
+		},
+	}
+}
+
+func weightedRoutes(domain string, weights map[string]uint32) *route.RouteConfiguration {
+	clusters := make([]*route.WeightedCluster_ClusterWeight, 0, len(weights))
+	for k, w := range weights {
+		clusters = append(clusters, &route.WeightedCluster_ClusterWeight{Name: k, Weight: &wrappers.UInt32Value{Value: w}})
+	}
+
+	return &route.RouteConfiguration{
+		Name: "kage-mesh",
+		VirtualHosts: []*route.VirtualHost{
+			{
+				Name:    "kage-mesh",
+				Domains: []string{domain},
+				Routes: []*route.Route{
+					{
+						Name:  "weighted",
+						Match: &route.RouteMatch{PathSpecifier: &route.RouteMatch_Prefix{Prefix: "/"}},
+						Action: &route.Route_Route{
+							Route: &route.RouteAction{
+								ClusterSpecifier: &route.RouteAction_WeightedClusters{
+									WeightedClusters: &route.WeightedCluster{
+										Clusters:    clusters,
+										TotalWeight: &wrappers.UInt32Value{Value: 100},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func TestValidateTestSuite(t *testing.T) {
+	suite.Run(t, new(ValidateTestSuite))
+}
@@ -0,0 +1,43 @@
+package snap
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/types"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/v3"
+	"github.com/golang/protobuf/proto"
+	"sort"
+)
+
+// The hash of the resource's content so a resource only gets a new version when it changes.
+func ResourceVersion(res types.Resource) (string, error) {
+	buf := proto.NewBuffer(nil)
+	buf.SetDeterministic(true)
+	if err := buf.Marshal(res); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(buf.Bytes())), nil
+}
+
+// The hash of the names and versions of every resource so the version of a type only changes when one of its
+// resources is added, removed, or changed. The order of the resources does not matter.
+func TypeVersion(resources []types.Resource) (string, error) {
+	versions := make(map[string]string, len(resources))
+	names := make([]string, 0, len(resources))
+	for _, v := range resources {
+		version, err := ResourceVersion(v)
+		if err != nil {
+			return "", err
+		}
+		name := cache.GetResourceName(v)
+		versions[name] = version
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	h := sha256.New()
+	for _, v := range names {
+		_, _ = fmt.Fprintf(h, "%s=%s\n", v, versions[v])
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
@@ -0,0 +1,79 @@
+package snap
+
+import (
+	endpoint "github.com/envoyproxy/go-control-plane/envoy/config/endpoint/v3"
+	listener "github.com/envoyproxy/go-control-plane/envoy/config/listener/v3"
+	route "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/types"
+	"github.com/envoyproxy/go-control-plane/pkg/resource/v3"
+	"github.com/kage-cloud/kage/xds/pkg/snap/store"
+	"github.com/stretchr/testify/suite"
+	"testing"
+)
+
+type VersionTestSuite struct {
+	suite.Suite
+}
+
+func (v *VersionTestSuite) TestTypeVersionOrder() {
+	// -- Given
+	//
+	given := []types.Resource{&listener.Listener{Name: "a"}, &listener.Listener{Name: "b"}}
+	reversed := []types.Resource{given[1], given[0]}
+
+	// -- When
+	//
+	actual, err := TypeVersion(given)
+
+	// -- Then
+	//
+	if v.NoError(err) {
+		expected, _ := TypeVersion(reversed)
+		v.Equal(expected, actual)
+	}
+}
+
+func (v *VersionTestSuite) TestTypeVersionChanged() {
+	// -- Given
+	//
+	given := []types.Resource{&route.RouteConfiguration{Name: "a"}}
+	changed := []types.Resource{&route.RouteConfiguration{Name: "a", VirtualHosts: []*route.VirtualHost{{Name: "vh"}}}}
+
+	// -- When
+	//
+	actual, err := TypeVersion(given)
+
+	// -- Then
+	//
+	if v.NoError(err) {
+		unexpected, _ := TypeVersion(changed)
+		v.NotEqual(unexpected, actual)
+	}
+}
+
+func (v *VersionTestSuite) TestSetVersions() {
+	// -- Given
+	//
+	sc, err := NewStoreClient(&StoreClientSpec{PersistentStore: store.NewInMemoryStore()})
+	v.Require().NoError(err)
+	v.Require().NoError(sc.Set(&store.EnvoyState{NodeId: "node", Routes: []*route.RouteConfiguration{{Name: "a"}}}))
+	initial, _ := sc.Get("node")
+
+	// -- When
+	//
+	err = sc.Set(&store.EnvoyState{NodeId: "node", Endpoints: []*endpoint.ClusterLoadAssignment{{ClusterName: "a"}}})
+
+	// -- Then
+	//
+	if v.NoError(err) {
+		actual, _ := sc.Get("node")
+		snapshot, _ := sc.SnapshotCache().GetSnapshot("node")
+		v.Equal(initial.Versions[resource.RouteType], actual.Versions[resource.RouteType])
+		v.NotEqual(initial.Versions[resource.EndpointType], actual.Versions[resource.EndpointType])
+		v.Equal(actual.Versions[resource.EndpointType], snapshot.GetVersion(resource.EndpointType))
+	}
+}
+
+func TestVersionTestSuite(t *testing.T) {
+	suite.Run(t, new(VersionTestSuite))
+}
@@ -59,7 +59,7 @@ func (k *K3sSuite) SetupSuite() {
 
 	k.Cluster.Nodes = append(k.Cluster.Nodes, node, k.Cluster.ServerLoadBalancer)
 
-	ctx, _ := context.WithCancel(context.Background())
+	ctx := context.Background()
 	rt := runtimes.Docker
 
 	if err := cluster.ClusterCreate(ctx, rt, k.Cluster); err != nil {
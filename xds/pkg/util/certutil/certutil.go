@@ -0,0 +1,189 @@
+package certutil
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"github.com/kage-cloud/kage/core/except"
+	"math/big"
+	"net"
+	"time"
+)
+
+const (
+	caValidity   = 10 * 365 * 24 * time.Hour
+	certValidity = 365 * 24 * time.Hour
+)
+
+// A CA which issues the certificates of the xDS server and its clients.
+type Authority struct {
+	Cert    *x509.Certificate
+	Key     crypto.Signer
+	CertPem []byte
+}
+
+type CertSpec struct {
+	CommonName string
+
+	// The DNS names and IPs the certificate is valid for. Only used by server certificates.
+	DnsNames []string
+	Ips      []net.IP
+
+	// Issues a client certificate rather than a server certificate.
+	Client bool
+}
+
+// Generates a self-signed CA.
+func NewAuthority(commonName string) (*Authority, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	serial, err := serialNumber()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(caValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	if err != nil {
+		return nil, err
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Authority{
+		Cert:    cert,
+		Key:     key,
+		CertPem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+	}, nil
+}
+
+// Parses the PEM encoded certificate and key of a CA.
+func ParseAuthority(certPem, keyPem []byte) (*Authority, error) {
+	block, _ := pem.Decode(certPem)
+	if block == nil {
+		return nil, except.NewError("the CA certificate is not PEM encoded", except.ErrInvalid)
+	}
+
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, except.NewError("the CA certificate is invalid: %s", except.ErrInvalid, err.Error())
+	}
+
+	if !cert.IsCA {
+		return nil, except.NewError("the certificate of %s is not a CA", except.ErrInvalid, cert.Subject.CommonName)
+	}
+
+	key, err := ParseKey(keyPem)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Authority{
+		Cert:    cert,
+		Key:     key,
+		CertPem: certPem,
+	}, nil
+}
+
+// Parses a PEM encoded PKCS #8, PKCS #1, or EC private key.
+func ParseKey(keyPem []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(keyPem)
+	if block == nil {
+		return nil, except.NewError("the key is not PEM encoded", except.ErrInvalid)
+	}
+
+	if key, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		if signer, ok := key.(crypto.Signer); ok {
+			return signer, nil
+		}
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	if key, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	return nil, except.NewError("the key is not a supported private key", except.ErrInvalid)
+}
+
+// The PEM encoded PKCS #8 key of the CA.
+func (a *Authority) KeyPem() ([]byte, error) {
+	return encodeKey(a.Key)
+}
+
+// Issues a certificate signed by the CA. Returns the PEM encoded certificate and key.
+func (a *Authority) Issue(spec *CertSpec) ([]byte, []byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	serial, err := serialNumber()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	extKeyUsage := x509.ExtKeyUsageServerAuth
+	if spec.Client {
+		extKeyUsage = x509.ExtKeyUsageClientAuth
+	}
+
+	now := time.Now()
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: spec.CommonName},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(certValidity),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:  []x509.ExtKeyUsage{extKeyUsage},
+		DNSNames:     spec.DnsNames,
+		IPAddresses:  spec.Ips,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, a.Cert, key.Public(), a.Key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	keyPem, err := encodeKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), keyPem, nil
+}
+
+func encodeKey(key crypto.Signer) ([]byte, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
+
+func serialNumber() (*big.Int, error) {
+	return rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+}
@@ -0,0 +1,80 @@
+package certutil
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"github.com/stretchr/testify/suite"
+	"testing"
+)
+
+type CertUtilTestSuite struct {
+	suite.Suite
+}
+
+func (c *CertUtilTestSuite) TestIssueClient() {
+	// -- Given
+	//
+	given, err := NewAuthority("kage-xds-ca")
+	c.Require().NoError(err)
+
+	// -- When
+	//
+	certPem, keyPem, err := given.Issue(&CertSpec{CommonName: "node", Client: true})
+
+	// -- Then
+	//
+	if c.NoError(err) {
+		pair, err := tls.X509KeyPair(certPem, keyPem)
+		c.Require().NoError(err)
+		cert, err := x509.ParseCertificate(pair.Certificate[0])
+		c.Require().NoError(err)
+
+		roots := x509.NewCertPool()
+		roots.AddCert(given.Cert)
+		_, err = cert.Verify(x509.VerifyOptions{Roots: roots, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}})
+		c.NoError(err)
+		c.Equal("node", cert.Subject.CommonName)
+	}
+}
+
+func (c *CertUtilTestSuite) TestParseAuthority() {
+	// -- Given
+	//
+	given, err := NewAuthority("kage-xds-ca")
+	c.Require().NoError(err)
+	keyPem, err := given.KeyPem()
+	c.Require().NoError(err)
+
+	// -- When
+	//
+	actual, err := ParseAuthority(given.CertPem, keyPem)
+
+	// -- Then
+	//
+	if c.NoError(err) {
+		c.Equal(given.Cert.SerialNumber, actual.Cert.SerialNumber)
+		_, _, err = actual.Issue(&CertSpec{CommonName: "xds"})
+		c.NoError(err)
+	}
+}
+
+func (c *CertUtilTestSuite) TestParseAuthorityNotCa() {
+	// -- Given
+	//
+	ca, err := NewAuthority("kage-xds-ca")
+	c.Require().NoError(err)
+	certPem, keyPem, err := ca.Issue(&CertSpec{CommonName: "xds"})
+	c.Require().NoError(err)
+
+	// -- When
+	//
+	_, err = ParseAuthority(certPem, keyPem)
+
+	// -- Then
+	//
+	c.Error(err)
+}
+
+func TestCertUtilTestSuite(t *testing.T) {
+	suite.Run(t, new(CertUtilTestSuite))
+}
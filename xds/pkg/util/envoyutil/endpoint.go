@@ -3,6 +3,7 @@ package envoyutil
 import (
 	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
 	endpoint "github.com/envoyproxy/go-control-plane/envoy/config/endpoint/v3"
+	"github.com/golang/protobuf/proto"
 )
 
 func EndpointMatchesAddr(addr string, endpoint *endpoint.Endpoint) bool {
@@ -42,10 +43,118 @@ func ContainsEndpointAddr(addr string, clas []*endpoint.ClusterLoadAssignment) b
 	return v != nil
 }
 
+// Whether the cluster has an endpoint at the address and port.
+func ContainsEndpoint(cluster, addr string, port uint32, clas []*endpoint.ClusterLoadAssignment) bool {
+	for _, cla := range clas {
+		if cla == nil || cla.ClusterName != cluster {
+			continue
+		}
+		for _, v := range AggAllEndpoints([]*endpoint.ClusterLoadAssignment{cla}) {
+			if EndpointMatchesAddr(addr, v) && v.GetAddress().GetSocketAddress().GetPortValue() == port {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Removes the endpoints at the address, on every port, from all of the ClusterLoadAssignments. The
+// ClusterLoadAssignments and their localities are kept, even when left empty, so the weights of the localities are
+// not lost. The ClusterLoadAssignments are not modified.
 func RemoveEndpointAddr(addr string, clas []*endpoint.ClusterLoadAssignment) []*endpoint.ClusterLoadAssignment {
-	v, idx := FindEndpointAddr(addr, AggAllEndpoints(clas))
-	if v != nil {
-		return append(clas[:idx], clas[idx+1:]...)
+	out := make([]*endpoint.ClusterLoadAssignment, 0, len(clas))
+	for _, cla := range clas {
+		if cla == nil || !ContainsEndpointAddr(addr, []*endpoint.ClusterLoadAssignment{cla}) {
+			out = append(out, cla)
+			continue
+		}
+
+		removed := &endpoint.ClusterLoadAssignment{
+			ClusterName:    cla.ClusterName,
+			Endpoints:      make([]*endpoint.LocalityLbEndpoints, 0, len(cla.Endpoints)),
+			NamedEndpoints: cla.NamedEndpoints,
+			Policy:         cla.Policy,
+		}
+		for _, locality := range cla.Endpoints {
+			lbEndpoints := make([]*endpoint.LbEndpoint, 0, len(locality.LbEndpoints))
+			for _, v := range locality.LbEndpoints {
+				if ep := v.GetEndpoint(); ep == nil || !EndpointMatchesAddr(addr, ep) {
+					lbEndpoints = append(lbEndpoints, v)
+				}
+			}
+			removed.Endpoints = append(removed.Endpoints, &endpoint.LocalityLbEndpoints{
+				Locality:            locality.Locality,
+				LbEndpoints:         lbEndpoints,
+				LoadBalancingWeight: locality.LoadBalancingWeight,
+				Priority:            locality.Priority,
+				Proximity:           locality.Proximity,
+			})
+		}
+		out = append(out, removed)
 	}
-	return clas
+	return out
+}
+
+// Combines the ClusterLoadAssignments of the same cluster into one as Envoy only keeps the last one it receives for a
+// cluster. The endpoints of the same locality and priority are combined into one LocalityLbEndpoints. The clusters
+// keep the order in which they first appear and the ClusterLoadAssignments are not modified.
+func MergeClusterLoadAssignments(clas []*endpoint.ClusterLoadAssignment) []*endpoint.ClusterLoadAssignment {
+	merged := make([]*endpoint.ClusterLoadAssignment, 0, len(clas))
+
+	// The index in merged of every cluster and whether it is a copy which can be modified.
+	idxs := map[string]int{}
+	copied := map[string]bool{}
+	for _, cla := range clas {
+		if cla == nil {
+			continue
+		}
+
+		idx, ok := idxs[cla.ClusterName]
+		if !ok {
+			idxs[cla.ClusterName] = len(merged)
+			merged = append(merged, cla)
+			continue
+		}
+
+		if !copied[cla.ClusterName] {
+			merged[idx] = copyClusterLoadAssignment(merged[idx])
+			copied[cla.ClusterName] = true
+		}
+
+		for _, v := range cla.Endpoints {
+			mergeLocalityLbEndpoints(merged[idx], v)
+		}
+	}
+	return merged
+}
+
+// Copies the ClusterLoadAssignment deep enough that endpoints can be added to it.
+func copyClusterLoadAssignment(cla *endpoint.ClusterLoadAssignment) *endpoint.ClusterLoadAssignment {
+	out := &endpoint.ClusterLoadAssignment{
+		ClusterName:    cla.ClusterName,
+		Endpoints:      make([]*endpoint.LocalityLbEndpoints, 0, len(cla.Endpoints)),
+		NamedEndpoints: cla.NamedEndpoints,
+		Policy:         cla.Policy,
+	}
+	for _, v := range cla.Endpoints {
+		mergeLocalityLbEndpoints(out, v)
+	}
+	return out
+}
+
+func mergeLocalityLbEndpoints(cla *endpoint.ClusterLoadAssignment, locality *endpoint.LocalityLbEndpoints) {
+	for _, v := range cla.Endpoints {
+		if v.Priority == locality.Priority && proto.Equal(v.Locality, locality.Locality) {
+			v.LbEndpoints = append(v.LbEndpoints, locality.LbEndpoints...)
+			return
+		}
+	}
+
+	cla.Endpoints = append(cla.Endpoints, &endpoint.LocalityLbEndpoints{
+		Locality:            locality.Locality,
+		LbEndpoints:         append([]*endpoint.LbEndpoint{}, locality.LbEndpoints...),
+		LoadBalancingWeight: locality.LoadBalancingWeight,
+		Priority:            locality.Priority,
+		Proximity:           locality.Proximity,
+	})
 }
@@ -0,0 +1,107 @@
+package envoyutil
+
+import (
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	endpoint "github.com/envoyproxy/go-control-plane/envoy/config/endpoint/v3"
+	"github.com/stretchr/testify/suite"
+	"testing"
+)
+
+type EndpointTestSuite struct {
+	suite.Suite
+}
+
+func (e *EndpointTestSuite) TestMergeClusterLoadAssignments() {
+	// -- Given
+	//
+	given := []*endpoint.ClusterLoadAssignment{
+		cla("source", "10.0.0.1"),
+		cla("canary", "10.0.0.2"),
+		cla("source", "10.0.0.3"),
+		cla("source", "10.0.0.4"),
+	}
+
+	// -- When
+	//
+	actual := MergeClusterLoadAssignments(given)
+
+	// -- Then
+	//
+	if e.Len(actual, 2) {
+		e.Equal("source", actual[0].ClusterName)
+		e.Equal([]string{"10.0.0.1", "10.0.0.3", "10.0.0.4"}, addresses(actual[0]))
+		e.Equal("canary", actual[1].ClusterName)
+		e.Same(given[1], actual[1])
+	}
+	e.Equal([]string{"10.0.0.1"}, addresses(given[0]))
+}
+
+func (e *EndpointTestSuite) TestMergeClusterLoadAssignmentsLocalities() {
+	// -- Given
+	//
+	zoned := cla("source", "10.0.0.2")
+	zoned.Endpoints[0].Locality = &core.Locality{Zone: "b"}
+	given := []*endpoint.ClusterLoadAssignment{cla("source", "10.0.0.1"), zoned, cla("source", "10.0.0.3")}
+
+	// -- When
+	//
+	actual := MergeClusterLoadAssignments(given)
+
+	// -- Then
+	//
+	if e.Len(actual, 1) && e.Len(actual[0].Endpoints, 2) {
+		e.Len(actual[0].Endpoints[0].LbEndpoints, 2)
+		e.Equal("b", actual[0].Endpoints[1].Locality.Zone)
+	}
+}
+
+func (e *EndpointTestSuite) TestRemoveEndpointAddr() {
+	// -- Given
+	//
+	sticky := StickyEndpoints("sticky", []*endpoint.ClusterLoadAssignment{cla("canary", "10.0.0.1")}, map[string]uint32{"canary": 100})
+	given := MergeClusterLoadAssignments([]*endpoint.ClusterLoadAssignment{
+		cla("source", "10.0.0.2"),
+		cla("canary", "10.0.0.1"),
+		cla("canary", "10.0.0.3"),
+		sticky,
+	})
+
+	// -- When
+	//
+	actual := RemoveEndpointAddr("10.0.0.1", given)
+
+	// -- Then
+	//
+	if e.Len(actual, 3) {
+		e.Same(given[0], actual[0])
+		e.Equal([]string{"10.0.0.3"}, addresses(actual[1]))
+		e.Empty(addresses(actual[2]))
+		e.Equal(map[string]uint32{"canary": 100}, StickyWeights(actual[2]))
+	}
+	e.Equal([]string{"10.0.0.1", "10.0.0.3"}, addresses(given[1]))
+}
+
+func (e *EndpointTestSuite) TestContainsEndpoint() {
+	// -- Given
+	//
+	given := []*endpoint.ClusterLoadAssignment{cla("source", "10.0.0.1")}
+	given[0].Endpoints[0].LbEndpoints[0].GetEndpoint().Address.GetSocketAddress().PortSpecifier = &core.SocketAddress_PortValue{PortValue: 8080}
+
+	// -- Then
+	//
+	e.True(ContainsEndpoint("source", "10.0.0.1", 8080, given))
+	e.False(ContainsEndpoint("source", "10.0.0.1", 9000, given))
+	e.False(ContainsEndpoint("canary", "10.0.0.1", 8080, given))
+}
+
+func addresses(cla *endpoint.ClusterLoadAssignment) []string {
+	out := make([]string, 0)
+	for _, v := range AggAllEndpoints([]*endpoint.ClusterLoadAssignment{cla}) {
+		out = append(out, v.Address.GetSocketAddress().Address)
+	}
+	return out
+}
+
+func TestEndpointTestSuite(t *testing.T) {
+	suite.Run(t, new(EndpointTestSuite))
+}
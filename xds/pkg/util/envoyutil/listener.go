@@ -3,8 +3,21 @@ package envoyutil
 import (
 	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
 	listener "github.com/envoyproxy/go-control-plane/envoy/config/listener/v3"
+	"github.com/envoyproxy/go-control-plane/pkg/wellknown"
 )
 
+// True if the listener forwards raw TCP connections rather than routing HTTP requests.
+func IsTcpProxy(l *listener.Listener) bool {
+	for _, fc := range l.FilterChains {
+		for _, f := range fc.Filters {
+			if f.Name == wellknown.TCPProxy {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 func ListenerMatchesPort(port uint32, listener *listener.Listener) bool {
 	if v, ok := listener.Address.Address.(*core.Address_SocketAddress); ok {
 		if ps, ok := v.SocketAddress.PortSpecifier.(*core.SocketAddress_PortValue); ok {
@@ -1,9 +1,12 @@
 package envoyutil
 
-import route "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
+import (
+	route "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
+	envoytype "github.com/envoyproxy/go-control-plane/envoy/type/v3"
+)
 
 func AggAllRoutes(routeConfig []*route.RouteConfiguration) []*route.Route {
-	routes := make([]*route.Route, len(routeConfig))
+	routes := make([]*route.Route, 0, len(routeConfig))
 	for _, rc := range routeConfig {
 		for _, vh := range rc.VirtualHosts {
 			routes = append(routes, vh.Routes...)
@@ -12,3 +15,44 @@ func AggAllRoutes(routeConfig []*route.RouteConfiguration) []*route.Route {
 
 	return routes
 }
+
+// The weights of the clusters which the catch-all route of each virtual host sends traffic to. A route to a single
+// cluster gives that cluster the total weight. Mirrored traffic is not included.
+func DefaultRouteWeights(routeConfig []*route.RouteConfiguration, totalWeight uint32) map[string]uint32 {
+	weights := map[string]uint32{}
+	for _, rc := range routeConfig {
+		for _, vh := range rc.VirtualHosts {
+			if len(vh.Routes) == 0 {
+				continue
+			}
+
+			action := vh.Routes[len(vh.Routes)-1].GetRoute()
+			if cluster := action.GetCluster(); cluster != "" {
+				weights[cluster] = totalWeight
+			}
+			for _, v := range action.GetWeightedClusters().GetClusters() {
+				weights[v.GetName()] = v.GetWeight().GetValue()
+			}
+		}
+	}
+
+	return weights
+}
+
+// Converts the fraction of requests mirrored by the policy into a weight out of the total weight.
+func MirroredWeight(mirror *route.RouteAction_RequestMirrorPolicy, totalWeight uint32) uint32 {
+	fraction := mirror.GetRuntimeFraction().GetDefaultValue()
+	if fraction == nil {
+		return totalWeight
+	}
+
+	denominator := uint32(100)
+	switch fraction.Denominator {
+	case envoytype.FractionalPercent_TEN_THOUSAND:
+		denominator = 10000
+	case envoytype.FractionalPercent_MILLION:
+		denominator = 1000000
+	}
+
+	return uint32(uint64(fraction.Numerator) * uint64(totalWeight) / uint64(denominator))
+}
@@ -0,0 +1,82 @@
+package envoyutil
+
+import (
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	endpoint "github.com/envoyproxy/go-control-plane/envoy/config/endpoint/v3"
+	"github.com/golang/protobuf/ptypes/wrappers"
+	"sort"
+)
+
+func FindClusterLoadAssignment(name string, clas []*endpoint.ClusterLoadAssignment) (*endpoint.ClusterLoadAssignment, int) {
+	for i := range clas {
+		if clas[i] != nil && clas[i].ClusterName == name {
+			return clas[i], i
+		}
+	}
+	return nil, -1
+}
+
+// Combines the endpoints of the weighted clusters into a single cluster. The endpoints of each cluster are placed in
+// their own locality, named after the cluster, which is weighted by the cluster's weight. Clusters with a weight of 0
+// are left out. When used with a consistent-hash load balancer, increasing a cluster's weight only moves the newly
+// added share of hashes onto it.
+func StickyEndpoints(name string, clas []*endpoint.ClusterLoadAssignment, weights map[string]uint32) *endpoint.ClusterLoadAssignment {
+	clusters := make([]string, 0, len(weights))
+	for k := range weights {
+		clusters = append(clusters, k)
+	}
+	sort.Strings(clusters)
+
+	sticky := &endpoint.ClusterLoadAssignment{
+		ClusterName: name,
+		Endpoints:   make([]*endpoint.LocalityLbEndpoints, 0, len(clusters)),
+	}
+
+	for _, cluster := range clusters {
+		weight := weights[cluster]
+		if weight == 0 {
+			continue
+		}
+
+		lbEndpoints := make([]*endpoint.LbEndpoint, 0)
+		for _, cla := range clas {
+			if cla == nil || cla.ClusterName != cluster {
+				continue
+			}
+			for _, v := range cla.Endpoints {
+				lbEndpoints = append(lbEndpoints, v.LbEndpoints...)
+			}
+		}
+
+		sticky.Endpoints = append(sticky.Endpoints, &endpoint.LocalityLbEndpoints{
+			Locality:            &core.Locality{Zone: cluster},
+			LbEndpoints:         lbEndpoints,
+			LoadBalancingWeight: &wrappers.UInt32Value{Value: weight},
+		})
+	}
+
+	return sticky
+}
+
+// The weights of each cluster combined in the sticky cluster indexed by the cluster name.
+func StickyWeights(sticky *endpoint.ClusterLoadAssignment) map[string]uint32 {
+	weights := map[string]uint32{}
+	for _, v := range sticky.Endpoints {
+		if v.Locality != nil && v.LoadBalancingWeight != nil {
+			weights[v.Locality.Zone] = v.LoadBalancingWeight.Value
+		}
+	}
+	return weights
+}
+
+// Rebuilds the sticky cluster, if present, from the latest endpoints of the clusters it combines.
+func RefreshStickyEndpoints(name string, clas []*endpoint.ClusterLoadAssignment) []*endpoint.ClusterLoadAssignment {
+	sticky, idx := FindClusterLoadAssignment(name, clas)
+	if sticky == nil {
+		return clas
+	}
+
+	out := append([]*endpoint.ClusterLoadAssignment{}, clas...)
+	out[idx] = StickyEndpoints(name, clas, StickyWeights(sticky))
+	return out
+}
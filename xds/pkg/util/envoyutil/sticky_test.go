@@ -0,0 +1,106 @@
+package envoyutil
+
+import (
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	endpoint "github.com/envoyproxy/go-control-plane/envoy/config/endpoint/v3"
+	"github.com/stretchr/testify/suite"
+	"testing"
+)
+
+type StickyTestSuite struct {
+	suite.Suite
+}
+
+func (s *StickyTestSuite) TestStickyEndpoints() {
+	// -- Given
+	//
+	given := []*endpoint.ClusterLoadAssignment{
+		cla("source", "10.0.0.1"),
+		cla("source", "10.0.0.2"),
+		cla("canary", "10.0.0.3"),
+	}
+
+	// -- When
+	//
+	actual := StickyEndpoints("sticky", given, map[string]uint32{"source": 75, "canary": 25})
+
+	// -- Then
+	//
+	s.Equal("sticky", actual.ClusterName)
+	if s.Len(actual.Endpoints, 2) {
+		s.Equal("canary", actual.Endpoints[0].Locality.Zone)
+		s.Len(actual.Endpoints[0].LbEndpoints, 1)
+		s.Equal("source", actual.Endpoints[1].Locality.Zone)
+		s.Len(actual.Endpoints[1].LbEndpoints, 2)
+	}
+	s.Equal(map[string]uint32{"source": 75, "canary": 25}, StickyWeights(actual))
+}
+
+func (s *StickyTestSuite) TestStickyEndpointsZeroWeight() {
+	// -- Given
+	//
+	given := []*endpoint.ClusterLoadAssignment{
+		cla("source", "10.0.0.1"),
+		cla("canary", "10.0.0.2"),
+	}
+
+	// -- When
+	//
+	actual := StickyEndpoints("sticky", given, map[string]uint32{"source": 100, "canary": 0})
+
+	// -- Then
+	//
+	if s.Len(actual.Endpoints, 1) {
+		s.Equal("source", actual.Endpoints[0].Locality.Zone)
+	}
+}
+
+func (s *StickyTestSuite) TestRefreshStickyEndpoints() {
+	// -- Given
+	//
+	sticky := StickyEndpoints("sticky", []*endpoint.ClusterLoadAssignment{cla("canary", "10.0.0.1")}, map[string]uint32{"canary": 100})
+	given := []*endpoint.ClusterLoadAssignment{
+		sticky,
+		cla("canary", "10.0.0.1"),
+		cla("canary", "10.0.0.2"),
+	}
+
+	// -- When
+	//
+	actual := RefreshStickyEndpoints("sticky", given)
+
+	// -- Then
+	//
+	if s.Len(actual, 3) && s.Len(actual[0].Endpoints, 1) {
+		s.Len(actual[0].Endpoints[0].LbEndpoints, 2)
+		s.Equal(uint32(100), actual[0].Endpoints[0].LoadBalancingWeight.Value)
+	}
+	s.Len(given[0].Endpoints[0].LbEndpoints, 1)
+}
+
+func cla(cluster, addr string) *endpoint.ClusterLoadAssignment {
+	return &endpoint.ClusterLoadAssignment{
+		ClusterName: cluster,
+		Endpoints: []*endpoint.LocalityLbEndpoints{
+			{
+				LbEndpoints: []*endpoint.LbEndpoint{
+					{
+						HostIdentifier: &endpoint.LbEndpoint_Endpoint{
+							Endpoint: &endpoint.Endpoint{
+								Address: &core.Address{
+									Address: &core.Address_SocketAddress{
+										SocketAddress: &core.SocketAddress{Address: addr},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func TestStickyTestSuite(t *testing.T) {
+	suite.Run(t, new(StickyTestSuite))
+}
@@ -3,9 +3,23 @@ package util
 import (
 	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
 	"github.com/kage-cloud/kage/core/except"
+	"github.com/kage-cloud/kage/xds/pkg/model"
 	corev1 "k8s.io/api/core/v1"
+	"strings"
 )
 
+// Finds the application protocol of a port by the prefix of its name e.g. tcp-redis or grpc-api. Ports without a known
+// prefix are assumed to be HTTP.
+func PortProtocol(name string) model.PortProtocol {
+	name = strings.ToLower(name)
+	for _, v := range []model.PortProtocol{model.PortProtocolHttp, model.PortProtocolHttp2, model.PortProtocolGrpc, model.PortProtocolTcp} {
+		if name == string(v) || strings.HasPrefix(name, string(v)+"-") {
+			return v
+		}
+	}
+	return model.PortProtocolHttp
+}
+
 func KubeProtocolToSocketAddressProtocol(protocol corev1.Protocol) (core.SocketAddress_Protocol, error) {
 	switch protocol {
 	case corev1.ProtocolSCTP:
@@ -0,0 +1,13 @@
+package webhook
+
+import "github.com/eddieowens/axon"
+
+type Package struct {
+}
+
+func (p *Package) Bindings() []axon.Binding {
+	return []axon.Binding{
+		axon.Bind(ValidatorKey).To().StructPtr(new(validator)),
+		axon.Bind(ServerKey).To().StructPtr(new(server)),
+	}
+}
@@ -0,0 +1,101 @@
+package webhook
+
+import (
+	"fmt"
+	"github.com/kage-cloud/kage/core/except"
+	"github.com/kage-cloud/kage/xds/pkg/config"
+	"github.com/labstack/echo/v4"
+	log "github.com/sirupsen/logrus"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"net/http"
+)
+
+const ServerKey = "WebhookServer"
+
+const ValidatePath = "/validate"
+
+// The HTTPS server Kubernetes calls to validate kage annotations before objects are created or updated.
+type Server interface {
+	// Starts the server in the background. Does nothing if no TLS certificate is configured.
+	StartAsync() error
+
+	// Reviews the AdmissionReview in the request body and responds with the same review including the response.
+	Review(ctx echo.Context) error
+}
+
+type server struct {
+	Validator Validator      `inject:"Validator"`
+	Config    *config.Config `inject:"Config"`
+}
+
+func NewServer(validator Validator) Server {
+	return &server{Validator: validator}
+}
+
+func (s *server) StartAsync() error {
+	conf := s.Config.Webhook
+	if conf.CertFile == "" || conf.KeyFile == "" {
+		log.Info("No TLS certificate configured for the admission webhook. Kage annotations will not be validated.")
+		return nil
+	}
+
+	e := echo.New()
+	e.HideBanner = true
+	e.HidePort = true
+	e.POST(ValidatePath, s.Review)
+
+	go func() {
+		addr := fmt.Sprintf(":%d", conf.Port)
+		if err := e.StartTLS(addr, conf.CertFile, conf.KeyFile); err != nil && err != http.ErrServerClosed {
+			log.WithError(err).Fatal("Admission webhook server stopped.")
+		}
+	}()
+
+	log.WithField("port", conf.Port).Info("Started admission webhook server")
+	return nil
+}
+
+func (s *server) Review(ctx echo.Context) error {
+	review := new(admissionv1beta1.AdmissionReview)
+	if err := ctx.Bind(review); err != nil {
+		return err
+	}
+
+	if review.Request == nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "the admission review has no request")
+	}
+
+	review.Response = s.review(review.Request)
+	review.Request = nil
+
+	return ctx.JSON(http.StatusOK, review)
+}
+
+func (s *server) review(req *admissionv1beta1.AdmissionRequest) *admissionv1beta1.AdmissionResponse {
+	res := &admissionv1beta1.AdmissionResponse{UID: req.UID, Allowed: true}
+
+	err := s.Validator.Validate(req)
+	if err == nil {
+		return res
+	}
+
+	status := except.ToHttpStatus(err)
+	if status == http.StatusInternalServerError {
+		log.WithField("kind", req.Kind.Kind).
+			WithField("name", req.Name).
+			WithField("namespace", req.Namespace).
+			WithError(err).
+			Error("Failed to validate object.")
+	}
+
+	res.Allowed = false
+	res.Result = &metav1.Status{
+		Status:  metav1.StatusFailure,
+		Code:    int32(status),
+		Reason:  metav1.StatusReason(http.StatusText(status)),
+		Message: err.Error(),
+	}
+
+	return res
+}
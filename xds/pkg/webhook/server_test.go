@@ -0,0 +1,195 @@
+package webhook
+
+import (
+	"encoding/json"
+	"github.com/kage-cloud/kage/core/kube/kconfig"
+	"github.com/kage-cloud/kage/core/kube/ktypes"
+	"github.com/kage-cloud/kage/xds/pkg/meta"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/suite"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type fakeGetter map[string]runtime.Object
+
+func (f fakeGetter) Get(name string, kind ktypes.Kind, opt kconfig.Opt) (runtime.Object, error) {
+	if obj, ok := f[opt.Namespace+"/"+string(kind)+"/"+name]; ok {
+		return obj, nil
+	}
+	return nil, errors.NewNotFound(schema.GroupResource{Resource: string(kind)}, name)
+}
+
+type ServerTestSuite struct {
+	suite.Suite
+	Server Server
+}
+
+func (s *ServerTestSuite) SetupTest() {
+	s.Server = NewServer(NewValidator(fakeGetter{
+		"default/Deployment/nginx": &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "nginx", Namespace: "default"}},
+	}))
+}
+
+func (s *ServerTestSuite) TestReviewValidCanary() {
+	// -- Given
+	//
+	given := s.canaryRequest(&meta.Canary{
+		SourceObj:         meta.ObjRef{Name: "nginx", Kind: "Deployment"},
+		RoutingPercentage: 20,
+	})
+
+	// -- When
+	//
+	actual := s.review(given)
+
+	// -- Then
+	//
+	s.True(actual.Allowed)
+	s.Equal(given.UID, actual.UID)
+}
+
+func (s *ServerTestSuite) TestReviewInvalidCanary() {
+	// -- Given
+	//
+	given := map[string]*meta.Canary{
+		"does not exist": {
+			SourceObj: meta.ObjRef{Name: "httpd", Kind: "Deployment"},
+		},
+		"not a controller": {
+			SourceObj: meta.ObjRef{Name: "nginx", Kind: "Service"},
+		},
+		"exceeds": {
+			SourceObj:         meta.ObjRef{Name: "nginx", Kind: "Deployment"},
+			RoutingPercentage: 120,
+		},
+		"same namespace": {
+			SourceObj: meta.ObjRef{Name: "nginx", Kind: "Deployment", Namespace: "other"},
+		},
+	}
+
+	for expected, canary := range given {
+		// -- When
+		//
+		actual := s.review(s.canaryRequest(canary))
+
+		// -- Then
+		//
+		if s.False(actual.Allowed, expected) && s.NotNil(actual.Result, expected) {
+			s.EqualValues(http.StatusBadRequest, actual.Result.Code)
+			s.Contains(actual.Result.Message, expected)
+		}
+	}
+}
+
+func (s *ServerTestSuite) TestReviewProxiedServiceSelector() {
+	// -- Given
+	//
+	old := &corev1.Service{
+		TypeMeta: metav1.TypeMeta{Kind: "Service", APIVersion: "v1"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "nginx",
+			Namespace: "default",
+			Labels:    meta.ToMap(&meta.ProxyMarker{Proxied: true}),
+		},
+		Spec: corev1.ServiceSpec{Selector: map[string]string{"app": "kage-mesh"}},
+	}
+	obj := old.DeepCopy()
+	obj.Spec.Selector = map[string]string{"app": "nginx"}
+
+	given := s.request(admissionv1beta1.Update, "Service", obj, old)
+
+	// -- When
+	//
+	actual := s.review(given)
+
+	// -- Then
+	//
+	if s.False(actual.Allowed) && s.NotNil(actual.Result) {
+		s.Contains(actual.Result.Message, "selector")
+	}
+}
+
+func (s *ServerTestSuite) TestReviewReleasedServiceSelector() {
+	// -- Given
+	//
+	old := &corev1.Service{
+		TypeMeta: metav1.TypeMeta{Kind: "Service", APIVersion: "v1"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "nginx",
+			Namespace: "default",
+			Labels:    meta.ToMap(&meta.ProxyMarker{Proxied: true}),
+		},
+		Spec: corev1.ServiceSpec{Selector: map[string]string{"app": "kage-mesh"}},
+	}
+	obj := old.DeepCopy()
+	obj.Labels = map[string]string{}
+	obj.Spec.Selector = map[string]string{"app": "nginx"}
+
+	given := s.request(admissionv1beta1.Update, "Service", obj, old)
+
+	// -- When
+	//
+	actual := s.review(given)
+
+	// -- Then
+	//
+	s.True(actual.Allowed)
+}
+
+func (s *ServerTestSuite) canaryRequest(canary *meta.Canary) *admissionv1beta1.AdmissionRequest {
+	obj := &appsv1.Deployment{
+		TypeMeta: metav1.TypeMeta{Kind: "Deployment", APIVersion: "apps/v1"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "nginx-canary",
+			Namespace:   "default",
+			Labels:      meta.ToMap(&meta.CanaryMarker{Canary: true}),
+			Annotations: meta.ToMap(canary),
+		},
+	}
+	return s.request(admissionv1beta1.Create, "Deployment", obj, nil)
+}
+
+func (s *ServerTestSuite) request(op admissionv1beta1.Operation, kind string, obj, old runtime.Object) *admissionv1beta1.AdmissionRequest {
+	req := &admissionv1beta1.AdmissionRequest{
+		UID:       "1234",
+		Kind:      metav1.GroupVersionKind{Kind: kind},
+		Namespace: "default",
+		Operation: op,
+	}
+	req.Object.Raw, _ = json.Marshal(obj)
+	if old != nil {
+		req.OldObject.Raw, _ = json.Marshal(old)
+	}
+	return req
+}
+
+func (s *ServerTestSuite) review(req *admissionv1beta1.AdmissionRequest) *admissionv1beta1.AdmissionResponse {
+	body, _ := json.Marshal(&admissionv1beta1.AdmissionReview{Request: req})
+
+	httpReq := httptest.NewRequest(http.MethodPost, ValidatePath, strings.NewReader(string(body)))
+	httpReq.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+
+	if !s.NoError(s.Server.Review(echo.New().NewContext(httpReq, rec))) {
+		return &admissionv1beta1.AdmissionResponse{}
+	}
+
+	review := new(admissionv1beta1.AdmissionReview)
+	s.NoError(json.Unmarshal(rec.Body.Bytes(), review))
+	s.Require().NotNil(review.Response)
+	return review.Response
+}
+
+func TestServerTestSuite(t *testing.T) {
+	suite.Run(t, new(ServerTestSuite))
+}
@@ -0,0 +1,195 @@
+package webhook
+
+import (
+	"fmt"
+	"github.com/kage-cloud/kage/core/except"
+	"github.com/kage-cloud/kage/core/kube/kconfig"
+	"github.com/kage-cloud/kage/core/kube/ktypes"
+	"github.com/kage-cloud/kage/xds/pkg/meta"
+	"github.com/kage-cloud/kage/xds/pkg/model"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"reflect"
+	"strings"
+)
+
+const ValidatorKey = "Validator"
+
+var (
+	canarySelector = labels.SelectorFromValidatedSet(meta.ToMap(&meta.CanaryMarker{Canary: true}))
+	proxySelector  = labels.SelectorFromValidatedSet(meta.ToMap(&meta.ProxyMarker{Proxied: true}))
+)
+
+// Checks the kage annotations of objects being created or updated.
+type Validator interface {
+	// Returns an ErrInvalid error describing every problem with the object. Any other error means the object could not
+	// be validated.
+	Validate(req *admissionv1beta1.AdmissionRequest) error
+}
+
+// Fetches the objects referenced by the kage annotations.
+type ObjectGetter interface {
+	Get(name string, kind ktypes.Kind, opt kconfig.Opt) (runtime.Object, error)
+}
+
+type validator struct {
+	ObjectGetter ObjectGetter `inject:"KubeReaderService"`
+}
+
+func NewValidator(getter ObjectGetter) Validator {
+	return &validator{ObjectGetter: getter}
+}
+
+func (v *validator) Validate(req *admissionv1beta1.AdmissionRequest) error {
+	if req.Operation != admissionv1beta1.Create && req.Operation != admissionv1beta1.Update {
+		return nil
+	}
+
+	obj, err := decode(req.Object.Raw)
+	if err != nil {
+		return err
+	}
+
+	var old *unstructured.Unstructured
+	if len(req.OldObject.Raw) > 0 {
+		old, err = decode(req.OldObject.Raw)
+		if err != nil {
+			return err
+		}
+	}
+
+	kind := ktypes.Kind(req.Kind.Kind)
+	switch {
+	case kind == ktypes.KindService:
+		return v.validateService(obj, old)
+	case ktypes.IsController(kind):
+		return v.validateCanary(req.Namespace, kind, obj, old)
+	}
+
+	return nil
+}
+
+func (v *validator) validateService(obj, old *unstructured.Unstructured) error {
+	if err := meta.FromMap(obj.GetAnnotations(), new(meta.Proxy)); err != nil {
+		return except.NewError("service %s has invalid proxy annotations: %s", except.ErrInvalid, obj.GetName(), err.Error())
+	}
+
+	// Kage adds and removes the marker in the same update that it changes the selector.
+	if old == nil || !v.proxied(old) || !v.proxied(obj) {
+		return nil
+	}
+
+	oldSelector, _, _ := unstructured.NestedStringMap(old.Object, "spec", "selector")
+	selector, _, _ := unstructured.NestedStringMap(obj.Object, "spec", "selector")
+	if !reflect.DeepEqual(oldSelector, selector) {
+		return except.NewError("service %s is proxied by kage. Its selector cannot be changed until the canary is promoted or aborted", except.ErrInvalid, obj.GetName())
+	}
+
+	return nil
+}
+
+func (v *validator) validateCanary(namespace string, kind ktypes.Kind, obj, old *unstructured.Unstructured) error {
+	canary := new(meta.Canary)
+	if err := meta.FromMap(obj.GetAnnotations(), canary); err != nil {
+		return except.NewError("%s %s has invalid canary annotations: %s", except.ErrInvalid, kind, obj.GetName(), err.Error())
+	}
+
+	marked := canarySelector.Matches(labels.Set(obj.GetLabels()))
+	if !marked && canary.SourceObj.Name == "" {
+		return nil
+	}
+
+	// Only changes to the canary are validated so kage can still update a canary whose source has since been deleted.
+	if old != nil {
+		prev := new(meta.Canary)
+		if err := meta.FromMap(old.GetAnnotations(), prev); err == nil &&
+			reflect.DeepEqual(prev, canary) &&
+			marked == canarySelector.Matches(labels.Set(old.GetLabels())) {
+			return nil
+		}
+	}
+
+	problems := canaryProblems(canary)
+
+	source := canary.SourceObj
+	if source.Namespace != "" && source.Namespace != namespace {
+		problems = append(problems, fmt.Sprintf("the source is in namespace %s but the canary is in namespace %s. They must be in the same namespace", source.Namespace, namespace))
+	}
+
+	if ktypes.Kind(source.Kind) == kind && source.Name == obj.GetName() {
+		problems = append(problems, "the canary cannot be its own source")
+	}
+
+	if len(problems) == 0 {
+		_, err := v.ObjectGetter.Get(source.Name, ktypes.Kind(source.Kind), kconfig.Opt{Namespace: namespace})
+		if errors.IsNotFound(err) {
+			problems = append(problems, fmt.Sprintf("the source %s %s does not exist", source.Kind, source.Name))
+		} else if err != nil {
+			return err
+		}
+	}
+
+	if len(problems) > 0 {
+		return except.NewError("%s %s is not a valid canary: %s", except.ErrInvalid, kind, obj.GetName(), strings.Join(problems, "; "))
+	}
+
+	return nil
+}
+
+// The problems with the canary's annotations which can be found without looking anything up.
+func canaryProblems(canary *meta.Canary) []string {
+	problems := make([]string, 0)
+
+	if canary.SourceObj.Name == "" {
+		problems = append(problems, "the source has no name")
+	}
+
+	if !ktypes.IsController(ktypes.Kind(canary.SourceObj.Kind)) {
+		problems = append(problems, fmt.Sprintf(`the source kind "%s" is not a controller`, canary.SourceObj.Kind))
+	}
+
+	if canary.RoutingPercentage > model.TotalRoutingWeight {
+		problems = append(problems, fmt.Sprintf("the routing percentage %d exceeds %d", canary.RoutingPercentage, model.TotalRoutingWeight))
+	}
+
+	if _, err := canary.RolloutSteps(); err != nil {
+		problems = append(problems, err.Error())
+	}
+
+	if _, err := canary.RoutingRules(); err != nil {
+		problems = append(problems, err.Error())
+	}
+
+	if _, err := canary.StickyKey(); err != nil {
+		problems = append(problems, err.Error())
+	}
+
+	if _, err := canary.CanaryMode(); err != nil {
+		problems = append(problems, err.Error())
+	}
+
+	if err := canary.Resiliency.Validate(); err != nil {
+		problems = append(problems, err.Error())
+	}
+
+	if err := canary.Faults.Validate(); err != nil {
+		problems = append(problems, err.Error())
+	}
+
+	return problems
+}
+
+func (v *validator) proxied(obj *unstructured.Unstructured) bool {
+	return proxySelector.Matches(labels.Set(obj.GetLabels()))
+}
+
+func decode(raw []byte) (*unstructured.Unstructured, error) {
+	obj := new(unstructured.Unstructured)
+	if err := obj.UnmarshalJSON(raw); err != nil {
+		return nil, except.NewError("invalid object: %s", except.ErrInvalid, err.Error())
+	}
+	return obj, nil
+}